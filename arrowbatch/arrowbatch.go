@@ -0,0 +1,354 @@
+// Package arrowbatch reads the results of SQL Server queries as Apache Arrow
+// record batches.
+//
+// The driver decodes the values of each row straight into the Arrow builders
+// of the columns, skipping the []driver.Value of database/sql rows. It is a
+// separate module so the driver itself does not depend on Arrow.
+package arrowbatch
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/denisenkom/go-mssqldb/columnar"
+)
+
+// DefaultBatchSize is the number of rows of record batches when
+// Options.BatchSize is not set.
+const DefaultBatchSize = 64 * 1024
+
+// TypeKey is the key of the field metadata holding the SQL Server type
+// of a column.
+const TypeKey = "sqlserver.type"
+
+// Options of Query.
+type Options struct {
+	// BatchSize is the maximum number of rows of a record batch.
+	BatchSize int
+	// Allocator allocates the buffers of record batches, defaults to
+	// memory.DefaultAllocator.
+	Allocator memory.Allocator
+	// Nanoseconds stores times with 7 fractional second digits in
+	// nanoseconds rather than microseconds. Timestamps in nanoseconds
+	// only cover years 1677 to 2262.
+	Nanoseconds bool
+}
+
+// Reader reads the record batches of a query, it implements
+// array.RecordReader. Record batches returned by RecordBatch are only
+// valid until the next call to Next, Retain them to keep them longer.
+type Reader struct {
+	refs   int64
+	rows   columnar.Rows
+	opts   Options
+	schema *arrow.Schema
+	rec    arrow.RecordBatch
+	err    error
+}
+
+// Query runs query on conn and returns a reader of the record batches of
+// its first result set. Call NextResultSet to read the following ones.
+func Query(ctx context.Context, conn *mssql.Conn, query string, opts Options, args ...driver.NamedValue) (*Reader, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.Allocator == nil {
+		opts.Allocator = memory.DefaultAllocator
+	}
+	rows, err := conn.QueryColumnar(ctx, query, args, &sink{opts: opts})
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{refs: 1, rows: rows, opts: opts, schema: newSchema(rows.Columns(), opts)}, nil
+}
+
+// Retain increases the reference count of r.
+func (r *Reader) Retain() {
+	atomic.AddInt64(&r.refs, 1)
+}
+
+// Release decreases the reference count of r, it closes r when the count
+// reaches zero.
+func (r *Reader) Release() {
+	if atomic.AddInt64(&r.refs, -1) == 0 {
+		r.Close()
+	}
+}
+
+// Schema returns the schema of the current result set.
+func (r *Reader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+// Next reads the next record batch of the current result set, it returns
+// false at the end of the result set or on error.
+func (r *Reader) Next() bool {
+	r.releaseRecord()
+	if r.err != nil {
+		return false
+	}
+	batch, err := r.rows.NextBatch()
+	if err != nil {
+		if err != io.EOF {
+			r.err = err
+		}
+		return false
+	}
+	r.rec = batch.(arrow.RecordBatch)
+	return true
+}
+
+// RecordBatch returns the record batch read by Next.
+func (r *Reader) RecordBatch() arrow.RecordBatch {
+	return r.rec
+}
+
+// Record returns the record batch read by Next.
+//
+// Deprecated: use RecordBatch.
+func (r *Reader) Record() arrow.RecordBatch {
+	return r.rec
+}
+
+// Err returns the error which stopped Next or NextResultSet.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// NextResultSet moves to the next result set, it returns false when there
+// are no more result sets or on error.
+func (r *Reader) NextResultSet() bool {
+	r.releaseRecord()
+	if r.err != nil {
+		return false
+	}
+	if err := r.rows.NextResultSet(); err != nil {
+		if err != io.EOF {
+			r.err = err
+		}
+		return false
+	}
+	r.schema = newSchema(r.rows.Columns(), r.opts)
+	return true
+}
+
+// Close releases the current record batch and discards the remaining
+// results of the query.
+func (r *Reader) Close() error {
+	r.releaseRecord()
+	return r.rows.Close()
+}
+
+func (r *Reader) releaseRecord() {
+	if r.rec != nil {
+		r.rec.Release()
+		r.rec = nil
+	}
+}
+
+func timeUnit(scale int, opts Options) arrow.TimeUnit {
+	switch {
+	case scale == 0:
+		return arrow.Second
+	case scale <= 3:
+		return arrow.Millisecond
+	case scale <= 6 || !opts.Nanoseconds:
+		return arrow.Microsecond
+	default:
+		return arrow.Nanosecond
+	}
+}
+
+func dataType(col columnar.Column, opts Options) arrow.DataType {
+	switch col.Kind {
+	case columnar.KindBool:
+		return arrow.FixedWidthTypes.Boolean
+	case columnar.KindInt:
+		switch col.Size {
+		case 1:
+			return arrow.PrimitiveTypes.Uint8
+		case 2:
+			return arrow.PrimitiveTypes.Int16
+		case 4:
+			return arrow.PrimitiveTypes.Int32
+		}
+		return arrow.PrimitiveTypes.Int64
+	case columnar.KindFloat:
+		if col.Size == 4 {
+			return arrow.PrimitiveTypes.Float32
+		}
+		return arrow.PrimitiveTypes.Float64
+	case columnar.KindDecimal:
+		return &arrow.Decimal128Type{Precision: int32(col.Precision), Scale: int32(col.Scale)}
+	case columnar.KindDate:
+		return arrow.FixedWidthTypes.Date32
+	case columnar.KindTime:
+		unit := timeUnit(col.Scale, opts)
+		if unit <= arrow.Millisecond {
+			return &arrow.Time32Type{Unit: unit}
+		}
+		return &arrow.Time64Type{Unit: unit}
+	case columnar.KindDateTime:
+		return &arrow.TimestampType{Unit: timeUnit(col.Scale, opts)}
+	case columnar.KindDateTimeOffset:
+		return &arrow.TimestampType{Unit: timeUnit(col.Scale, opts), TimeZone: "UTC"}
+	case columnar.KindBinary:
+		return arrow.BinaryTypes.Binary
+	case columnar.KindGUID:
+		return &arrow.FixedSizeBinaryType{ByteWidth: 16}
+	}
+	// strings, and other values formatted as text
+	return arrow.BinaryTypes.String
+}
+
+func newSchema(cols []columnar.Column, opts Options) *arrow.Schema {
+	fields := make([]arrow.Field, len(cols))
+	for i, col := range cols {
+		fields[i] = arrow.Field{
+			Name:     col.Name,
+			Type:     dataType(col, opts),
+			Nullable: col.Nullable,
+			Metadata: arrow.NewMetadata([]string{TypeKey}, []string{col.DatabaseType}),
+		}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// sink appends the values decoded by the driver to the builders of a
+// record batch.
+type sink struct {
+	opts    Options
+	builder *array.RecordBuilder
+	fields  []array.Builder
+	units   []arrow.TimeUnit
+	rows    int
+}
+
+func (s *sink) Begin(cols []columnar.Column) {
+	if s.builder != nil {
+		s.builder.Release()
+	}
+	schema := newSchema(cols, s.opts)
+	s.builder = array.NewRecordBuilder(s.opts.Allocator, schema)
+	s.fields = s.builder.Fields()
+	s.units = make([]arrow.TimeUnit, len(cols))
+	for i, f := range schema.Fields() {
+		if t, ok := f.Type.(arrow.TemporalWithUnit); ok {
+			s.units[i] = t.TimeUnit()
+		}
+	}
+	s.rows = 0
+}
+
+func (s *sink) AppendNull(col int) {
+	s.fields[col].AppendNull()
+}
+
+func (s *sink) AppendBool(col int, v bool) {
+	s.fields[col].(*array.BooleanBuilder).Append(v)
+}
+
+func (s *sink) AppendInt(col int, v int64) {
+	switch b := s.fields[col].(type) {
+	case *array.Uint8Builder:
+		b.Append(uint8(v))
+	case *array.Int16Builder:
+		b.Append(int16(v))
+	case *array.Int32Builder:
+		b.Append(int32(v))
+	case *array.Int64Builder:
+		b.Append(v)
+	}
+}
+
+func (s *sink) AppendFloat(col int, v float64) {
+	switch b := s.fields[col].(type) {
+	case *array.Float32Builder:
+		b.Append(float32(v))
+	case *array.Float64Builder:
+		b.Append(v)
+	}
+}
+
+func (s *sink) AppendDecimal(col int, hi int64, lo uint64) {
+	s.fields[col].(*array.Decimal128Builder).Append(decimal128.New(hi, lo))
+}
+
+func (s *sink) AppendTime(col int, v time.Time) {
+	switch b := s.fields[col].(type) {
+	case *array.Date32Builder:
+		b.Append(arrow.Date32FromTime(v))
+	case *array.TimestampBuilder:
+		b.Append(arrow.Timestamp(toUnit(v.Unix(), v.Nanosecond(), s.units[col])))
+	}
+}
+
+func (s *sink) AppendTimeOfDay(col int, ns int64) {
+	switch b := s.fields[col].(type) {
+	case *array.Time32Builder:
+		b.Append(arrow.Time32(toUnit(0, int(ns), s.units[col])))
+	case *array.Time64Builder:
+		b.Append(arrow.Time64(toUnit(0, int(ns), s.units[col])))
+	}
+}
+
+// toUnit converts seconds and nanoseconds to unit, truncating.
+func toUnit(sec int64, ns int, unit arrow.TimeUnit) int64 {
+	switch unit {
+	case arrow.Second:
+		return sec + int64(ns)/1e9
+	case arrow.Millisecond:
+		return sec*1e3 + int64(ns)/1e6
+	case arrow.Microsecond:
+		return sec*1e6 + int64(ns)/1e3
+	}
+	return sec*1e9 + int64(ns)
+}
+
+func (s *sink) AppendString(col int, v []byte) {
+	s.fields[col].(*array.StringBuilder).BinaryBuilder.Append(v)
+}
+
+func (s *sink) AppendBytes(col int, v []byte) {
+	switch b := s.fields[col].(type) {
+	case *array.BinaryBuilder:
+		b.Append(v)
+	case *array.FixedSizeBinaryBuilder:
+		b.Append(v)
+	}
+}
+
+func (s *sink) AppendValue(col int, v interface{}) {
+	b := s.fields[col].(*array.StringBuilder)
+	switch v := v.(type) {
+	case []byte:
+		b.Append("0x" + hex.EncodeToString(v))
+	case time.Time:
+		b.Append(v.Format(time.RFC3339Nano))
+	default:
+		b.Append(fmt.Sprint(v))
+	}
+}
+
+func (s *sink) EndRow() bool {
+	s.rows++
+	return s.rows >= s.opts.BatchSize
+}
+
+func (s *sink) Flush() interface{} {
+	if s.rows == 0 {
+		return nil
+	}
+	s.rows = 0
+	return s.builder.NewRecordBatch()
+}
@@ -0,0 +1,179 @@
+package arrowbatch
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/denisenkom/go-mssqldb/columnar"
+)
+
+func TestSink(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	cols := []columnar.Column{
+		{Name: "b", Kind: columnar.KindBool, DatabaseType: "BIT", Nullable: true},
+		{Name: "t", Kind: columnar.KindInt, DatabaseType: "TINYINT", Size: 1},
+		{Name: "i", Kind: columnar.KindInt, DatabaseType: "INT", Size: 4},
+		{Name: "r", Kind: columnar.KindFloat, DatabaseType: "REAL", Size: 4},
+		{Name: "d", Kind: columnar.KindDecimal, DatabaseType: "DECIMAL", Precision: 18, Scale: 2},
+		{Name: "dt", Kind: columnar.KindDate, DatabaseType: "DATE"},
+		{Name: "tm", Kind: columnar.KindTime, DatabaseType: "TIME", Scale: 3},
+		{Name: "ts", Kind: columnar.KindDateTime, DatabaseType: "DATETIME2", Scale: 7},
+		{Name: "tz", Kind: columnar.KindDateTimeOffset, DatabaseType: "DATETIMEOFFSET", Scale: 0},
+		{Name: "s", Kind: columnar.KindString, DatabaseType: "NVARCHAR", Nullable: true},
+		{Name: "bin", Kind: columnar.KindBinary, DatabaseType: "VARBINARY"},
+		{Name: "g", Kind: columnar.KindGUID, DatabaseType: "UNIQUEIDENTIFIER"},
+		{Name: "v", Kind: columnar.KindOther, DatabaseType: "SQL_VARIANT"},
+	}
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 123456700, time.UTC)
+	s := &sink{opts: Options{BatchSize: 2, Allocator: mem}}
+	s.Begin(cols)
+	defer s.builder.Release()
+	s.AppendBool(0, true)
+	s.AppendInt(1, 255)
+	s.AppendInt(2, -7)
+	s.AppendFloat(3, 0.5)
+	s.AppendDecimal(4, -1, ^uint64(1234)+1)
+	s.AppendTime(5, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC))
+	s.AppendTimeOfDay(6, 3600*1e9+5e6)
+	s.AppendTime(7, ts)
+	s.AppendTime(8, ts)
+	s.AppendString(9, []byte("abc"))
+	s.AppendBytes(10, []byte{1, 2})
+	s.AppendBytes(11, make([]byte, 16))
+	s.AppendValue(12, int64(42))
+	if s.EndRow() {
+		t.Error("batch of 2 rows complete after 1 row")
+	}
+	for i := range cols {
+		if i == 0 || i == 9 {
+			s.AppendNull(i)
+		}
+	}
+	s.AppendInt(1, 0)
+	s.AppendInt(2, 0)
+	s.AppendFloat(3, 0)
+	s.AppendDecimal(4, 0, 0)
+	s.AppendTime(5, ts)
+	s.AppendTimeOfDay(6, 0)
+	s.AppendTime(7, ts)
+	s.AppendTime(8, ts)
+	s.AppendBytes(10, nil)
+	s.AppendBytes(11, make([]byte, 16))
+	s.AppendValue(12, []byte{0xab})
+	if !s.EndRow() {
+		t.Error("batch of 2 rows not complete after 2 rows")
+	}
+	rec := s.Flush().(arrow.RecordBatch)
+	defer rec.Release()
+	if s.Flush() != nil {
+		t.Error("expected no batch after flush")
+	}
+
+	if rec.NumRows() != 2 || rec.NumCols() != int64(len(cols)) {
+		t.Fatalf("got %d rows and %d columns", rec.NumRows(), rec.NumCols())
+	}
+	if typ, _ := rec.Schema().Field(2).Metadata.GetValue(TypeKey); typ != "INT" {
+		t.Errorf("got type %q", typ)
+	}
+	if !rec.Schema().Field(0).Nullable || rec.Schema().Field(1).Nullable {
+		t.Error("unexpected nullability")
+	}
+	if v := rec.Column(1).(*array.Uint8).Value(0); v != 255 {
+		t.Errorf("got tinyint %d", v)
+	}
+	if v := rec.Column(4).(*array.Decimal128).ValueStr(0); v != "-12.34" {
+		t.Errorf("got decimal %s", v)
+	}
+	if v := rec.Column(6).(*array.Time32).Value(0); v != 3600*1000+5 {
+		t.Errorf("got time %d", v)
+	}
+	if v := rec.Column(7).(*array.Timestamp).Value(0); int64(v) != ts.UnixNano()/1e3 {
+		t.Errorf("got datetime2 %d", v)
+	}
+	if typ := rec.Schema().Field(8).Type.(*arrow.TimestampType); typ.Unit != arrow.Second || typ.TimeZone != "UTC" {
+		t.Errorf("got datetimeoffset type %v", typ)
+	}
+	if v := rec.Column(8).(*array.Timestamp).Value(0); int64(v) != ts.Unix() {
+		t.Errorf("got datetimeoffset %d", v)
+	}
+	if !rec.Column(9).IsNull(1) || rec.Column(9).(*array.String).Value(0) != "abc" {
+		t.Error("unexpected strings")
+	}
+	if v := rec.Column(12).(*array.String).Value(1); v != "0xab" {
+		t.Errorf("got variant %s", v)
+	}
+}
+
+func TestTimeUnit(t *testing.T) {
+	tests := []struct {
+		scale int
+		nano  bool
+		unit  arrow.TimeUnit
+	}{
+		{0, false, arrow.Second},
+		{3, false, arrow.Millisecond},
+		{6, false, arrow.Microsecond},
+		{7, false, arrow.Microsecond},
+		{7, true, arrow.Nanosecond},
+	}
+	for _, tt := range tests {
+		if unit := timeUnit(tt.scale, Options{Nanoseconds: tt.nano}); unit != tt.unit {
+			t.Errorf("scale %d: got %v, want %v", tt.scale, unit, tt.unit)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	dsn := os.Getenv("SQLSERVER_DSN")
+	if dsn == "" {
+		t.Skip("no SQLSERVER_DSN")
+	}
+	connector, err := mssql.NewConnector(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc, err := connector.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+
+	r, err := Query(context.Background(), dc.(*mssql.Conn),
+		"select top 250 n = cast(row_number() over (order by (select 1)) as int), s = N'x' from sys.all_columns; select @p1 as v",
+		Options{BatchSize: 100}, driver.NamedValue{Ordinal: 1, Value: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+	if f := r.Schema().Field(0); f.Name != "n" || f.Type.ID() != arrow.INT32 {
+		t.Errorf("unexpected field %v", f)
+	}
+	var rows []int64
+	for r.Next() {
+		rows = append(rows, r.RecordBatch().NumRows())
+	}
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	if len(rows) != 3 || rows[0] != 100 || rows[2] != 50 {
+		t.Errorf("got batches of %v rows", rows)
+	}
+	if !r.NextResultSet() {
+		t.Fatal("expected a second result set", r.Err())
+	}
+	if !r.Next() || r.RecordBatch().Column(0).(*array.String).Value(0) != "abc" {
+		t.Error("unexpected second result set")
+	}
+	if r.Next() || r.NextResultSet() {
+		t.Error("expected the end of the results")
+	}
+}
@@ -0,0 +1,24 @@
+module github.com/denisenkom/go-mssqldb/arrowbatch
+
+go 1.25.0
+
+require (
+	github.com/apache/arrow-go/v18 v18.8.0
+	github.com/denisenkom/go-mssqldb v0.0.0-20261019004329-7a6bba455656
+)
+
+require (
+	github.com/goccy/go-json v0.10.6 // indirect
+	github.com/golang-sql/civil v0.0.0-20190719163853-cb61b32ac6fe // indirect
+	github.com/golang-sql/sqlexp v0.1.0 // indirect
+	github.com/google/flatbuffers v25.12.19+incompatible // indirect
+	github.com/klauspost/cpuid/v2 v2.4.0 // indirect
+	github.com/zeebo/xxh3 v1.1.0 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/exp v0.0.0-20260112195511-716be5621a96 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+)
+
+// The replace is for local development only, the module requires the
+// commit of the driver that adds the columnar package.
+replace github.com/denisenkom/go-mssqldb => ../
@@ -18,13 +18,29 @@ import (
 // separator, often "GO". It also allows escaping newlines with a
 // backslash.
 func Split(sql, separator string) []string {
+	batches := SplitBatches(sql, separator)
+	if batches == nil {
+		return nil
+	}
+	texts := make([]string, len(batches))
+	for i, b := range batches {
+		texts[i] = b.Text
+	}
+	return texts
+}
+
+// SplitBatches splits the provided SQL as Split and returns the
+// location of each batch in the script.
+func SplitBatches(sql, separator string) []Batch {
 	if len(separator) == 0 || len(sql) < len(separator) {
-		return []string{sql}
+		return []Batch{{Text: sql, Line: 1, Column: 1}}
 	}
 	l := &lexer{
-		Sql: sql,
-		Sep: separator,
-		At:  0,
+		Sql:  sql,
+		Sep:  separator,
+		At:   0,
+		line: 1,
+		col:  1,
 	}
 	state := stateWhitespace
 	for state != nil {
@@ -57,16 +73,34 @@ type lexer struct {
 
 	Skip []int
 
-	Batch []string
+	Batch []Batch
+
+	// line and column of pos
+	pos, line, col int
 }
 
-func (l *lexer) Add(b string) {
-	if len(b) == 0 {
+func (l *lexer) Add(b Batch) {
+	if len(b.Text) == 0 {
 		return
 	}
 	l.Batch = append(l.Batch, b)
 }
 
+// locate returns the line and column of an offset after the previous
+// located offset.
+func (l *lexer) locate(offset int) (int, int) {
+	for _, r := range l.Sql[l.pos:offset] {
+		if r == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+	}
+	l.pos = offset
+	return l.line, l.col
+}
+
 func (l *lexer) Next() bool {
 	l.At++
 	return l.At < len(l.Sql)
@@ -79,22 +113,30 @@ func (l *lexer) AddCurrent(count int64) bool {
 	if l.At >= len(l.Sql) {
 		l.At = len(l.Sql)
 	}
-	text := l.Sql[l.Start:l.At]
+	b := Batch{Text: l.Sql[l.Start:l.At]}
+	b.Line, b.Column = l.locate(l.Start)
 	if len(l.Skip) > 0 {
 		buf := &bytes.Buffer{}
 		nextSkipIndex := 0
 		nextSkip := l.Skip[nextSkipIndex]
-		for i, r := range text {
-			if i == nextSkip {
+		textLine := 1
+		for i, r := range b.Text {
+			if l.Start+i == nextSkip {
 				nextSkipIndex++
 				if nextSkipIndex < len(l.Skip) {
 					nextSkip = l.Skip[nextSkipIndex]
 				}
+				if r == '\n' {
+					b.joined = append(b.joined, textLine)
+				}
 				continue
 			}
+			if r == '\n' {
+				textLine++
+			}
 			buf.WriteRune(r)
 		}
-		text = buf.String()
+		b.Text = buf.String()
 		l.Skip = nil
 	}
 	// Limit the number of counts for sanity.
@@ -102,7 +144,7 @@ func (l *lexer) AddCurrent(count int64) bool {
 		count = 1000
 	}
 	for i := int64(0); i < count; i++ {
-		l.Add(text)
+		l.Add(b)
 	}
 	l.At += len(l.Sep)
 	l.Start = l.At
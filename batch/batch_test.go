@@ -78,6 +78,7 @@ select top 1 1`,
 		testItem{Sql: "select 'hi\\\r\n-hello';", Expect: []string{"select 'hi-hello';"}},
 		testItem{Sql: "select 'hi\\\r-hello';", Expect: []string{"select 'hi-hello';"}},
 		testItem{Sql: "select 'hi\\\n\nhello';", Expect: []string{"select 'hi\nhello';"}},
+		testItem{Sql: "select 1\ngo\nselect 'hi\\\n-hello';", Expect: []string{"select 1\n", "\nselect 'hi-hello';"}},
 	}
 
 	index := -1
@@ -0,0 +1,100 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Batch is a batch of a script and its location in the script.
+type Batch struct {
+	Text string
+
+	// File is the name of the script, set by callers that split files.
+	File string
+
+	// Line and Column are the 1-based position of the start of Text in
+	// the script, the column is counted in characters.
+	Line   int
+	Column int
+
+	// lines of Text whose line break escaped with a backslash was removed
+	joined []int
+}
+
+// SourceLine returns the line of the script of a 1-based line of Text,
+// such as the LineNo of a server error.
+func (b Batch) SourceLine(line int) int {
+	res := b.Line + line - 1
+	for _, joined := range b.joined {
+		if joined < line {
+			res++
+		}
+	}
+	return res
+}
+
+// LineText returns a 1-based line of Text without its line break, an
+// empty string if Text has fewer lines.
+func (b Batch) LineText(line int) string {
+	if line < 1 {
+		return ""
+	}
+	lines := strings.SplitN(b.Text, "\n", line+1)
+	if len(lines) < line {
+		return ""
+	}
+	return strings.TrimRight(lines[line-1], "\r\n")
+}
+
+// SQLError is a server error, such as a mssql.Error.
+type SQLError interface {
+	error
+	SQLErrorLineNo() int32
+	SQLErrorProcName() string
+}
+
+// WrapError returns a *ScriptError locating a SQLError raised by the
+// batch in the script. Other errors and errors raised in procedures
+// called by the batch, whose line is in the procedure, are returned as
+// they are.
+func (b Batch) WrapError(err error) error {
+	var sqlErr SQLError
+	if !errors.As(err, &sqlErr) || sqlErr.SQLErrorLineNo() < 1 || sqlErr.SQLErrorProcName() != "" {
+		return err
+	}
+	line := int(sqlErr.SQLErrorLineNo())
+	return &ScriptError{
+		Err:     sqlErr,
+		File:    b.File,
+		Line:    b.SourceLine(line),
+		Snippet: strings.TrimSpace(b.LineText(line)),
+	}
+}
+
+// ScriptError is a server error located in a script.
+type ScriptError struct {
+	Err SQLError
+
+	// File and Line are the location of the error in the script.
+	File string
+	Line int
+
+	// Snippet is the SQL of the line of the error.
+	Snippet string
+}
+
+func (e *ScriptError) Error() string {
+	location := fmt.Sprintf("line %d", e.Line)
+	if e.File != "" {
+		location = fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+	if e.Snippet == "" {
+		return location + ": " + e.Err.Error()
+	}
+	return location + ": " + e.Err.Error() + "\n\t" + e.Snippet
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,68 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+func TestSplitBatchesLocation(t *testing.T) {
+	sql := "select 1\ngo\n\nselect 'a\\\nb',\n  é go 2\nselect x\r\nGO\n"
+	batches := SplitBatches(sql, "go")
+	if len(batches) != 3 {
+		t.Fatalf("expected 3 batches, got %q", batches)
+	}
+	values := []struct {
+		line, column int
+		text         string
+	}{
+		{1, 1, "select 1\n"},
+		{2, 3, "\n\nselect 'ab',\n  é go 2\nselect x\r\n"},
+		{8, 3, "\n"},
+	}
+	for i, v := range values {
+		b := batches[i]
+		if b.Line != v.line || b.Column != v.column || b.Text != v.text {
+			t.Errorf("batch %d: got %d:%d %q, want %d:%d %q", i, b.Line, b.Column, b.Text, v.line, v.column, v.text)
+		}
+	}
+	b := batches[1]
+	for line, want := range map[int]int{3: 4, 4: 6, 5: 7} {
+		if got := b.SourceLine(line); got != want {
+			t.Errorf("line %d of the batch: got line %d of the script, want %d", line, got, want)
+		}
+	}
+	if got := b.LineText(5); got != "select x" {
+		t.Errorf("got line %q", got)
+	}
+	if got := b.LineText(7); got != "" {
+		t.Errorf("got line %q past the end", got)
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	b := Batch{Text: "\nselect 1\nselect x from t\n", File: "script.sql", Line: 10, Column: 3}
+	err := b.WrapError(fmt.Errorf("query failed: %w", mssql.Error{Number: 207, Message: "Invalid column name 'x'.", LineNo: 3}))
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("expected a script error, got %v", err)
+	}
+	if want := "script.sql:12: mssql: Invalid column name 'x'.\n\tselect x from t"; err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+	var sqlErr mssql.Error
+	if !errors.As(err, &sqlErr) || sqlErr.Number != 207 {
+		t.Errorf("the server error is not wrapped: %v", err)
+	}
+
+	procErr := mssql.Error{Message: "in proc", ProcName: "p", LineNo: 3}
+	if err = b.WrapError(procErr); errors.As(err, &scriptErr) {
+		t.Errorf("errors of procedures should not be located, got %v", err)
+	}
+	other := errors.New("other")
+	if err = b.WrapError(other); err != other {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package batch
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// minReadSize is the minimum size of the reads of a Scanner.
+const minReadSize = 64 * 1024
+
+// Scanner splits a script read from an io.Reader into batches as
+// SplitBatches, without reading the whole script first. Only the batch
+// being read is kept in memory.
+//
+//	s := batch.NewScanner(f, "GO")
+//	for s.Scan() {
+//		if _, err := db.ExecContext(ctx, s.Batch().Text); err != nil {
+//			return s.Batch().WrapError(err)
+//		}
+//	}
+//	return s.Err()
+type Scanner struct {
+	r   io.Reader
+	l   lexer
+	err error
+
+	// state resumes the lexer when more lines are read
+	state stateFn
+	// rest is the incomplete last line read
+	rest []byte
+	buf  []byte
+	done bool
+
+	batches []Batch
+	batch   Batch
+}
+
+// NewScanner returns a Scanner reading a script from r.
+func NewScanner(r io.Reader, separator string) *Scanner {
+	return &Scanner{
+		r: r,
+		l: lexer{
+			Sep:  separator,
+			line: 1,
+			col:  1,
+		},
+		state: stateWhitespace,
+	}
+}
+
+// Scan reads the next batch, which is then available through Batch. It
+// returns false at the end of the script or when reading fails.
+func (s *Scanner) Scan() bool {
+	for len(s.batches) == 0 {
+		if s.done {
+			return false
+		}
+		s.read()
+	}
+	s.batch = s.batches[0]
+	s.batches = s.batches[1:]
+	return true
+}
+
+// Batch returns the batch read by the last call to Scan.
+func (s *Scanner) Batch() Batch {
+	return s.batch
+}
+
+// Err returns the error of the reader, nil at the end of the script.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+func (s *Scanner) read() {
+	if len(s.l.Sep) == 0 {
+		// the script is a single batch
+		data, err := ioutil.ReadAll(s.r)
+		s.done = true
+		if err != nil {
+			s.err = err
+			return
+		}
+		s.batches = []Batch{{Text: string(data), Line: 1, Column: 1}}
+		return
+	}
+
+	// read at least the size of the pending batch and of the incomplete
+	// line so that they are copied a constant number of times
+	size := len(s.l.Sql) - s.l.Start
+	if size < len(s.rest) {
+		size = len(s.rest)
+	}
+	if size < minReadSize {
+		size = minReadSize
+	}
+	if cap(s.buf) < size {
+		if size < 2*cap(s.buf) {
+			size = 2 * cap(s.buf)
+		}
+		s.buf = make([]byte, size)
+	}
+	n, err := s.r.Read(s.buf[:size])
+	data := append(s.rest, s.buf[:n]...)
+	if err == nil {
+		// the lexer looks ahead until the end of the line, which can
+		// only be in the bytes just read
+		end := bytes.LastIndexByte(s.buf[:n], '\n')
+		if end < 0 {
+			s.rest = data
+			return
+		}
+		complete := len(s.rest) + end + 1
+		s.rest = append([]byte(nil), data[complete:]...)
+		data = data[:complete]
+	} else {
+		s.rest = nil
+	}
+	s.lex(string(data))
+
+	switch {
+	case err == io.EOF:
+		s.l.AddCurrent(1)
+		s.done = true
+	case err != nil:
+		s.err = err
+		s.done = true
+	}
+	s.batches = append(s.batches, s.l.Batch...)
+	s.l.Batch = nil
+}
+
+// lex appends complete lines to the text of the lexer and resumes it.
+func (s *Scanner) lex(text string) {
+	l := &s.l
+	if l.Start > 0 {
+		// drop the text of the batches already read
+		start := l.Start
+		l.locate(start)
+		l.Sql = l.Sql[start:]
+		l.At -= start
+		l.Start = 0
+		l.pos -= start
+		for i := range l.Skip {
+			l.Skip[i] -= start
+		}
+	}
+	if len(text) == 0 {
+		return
+	}
+	l.Sql += text
+	// the states return nil at the end of the text, they are resumed
+	// from the same position
+	for {
+		next := s.state(l)
+		if next == nil {
+			return
+		}
+		s.state = next
+	}
+}
@@ -0,0 +1,99 @@
+package batch
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestScanner(t *testing.T) {
+	scripts := []string{
+		"use DB\ngo\nselect 1\ngo\nselect 2\n",
+		"go\nuse DB go\n",
+		"select 'It''s go time'\ngo\nselect top 1 1",
+		"select 1 /* go\ngo\n*/\ngo\nselect top 1 1",
+		"select 1 -- go\ngo\nselect top 1 1",
+		"select 1;\nGO  2\nselect 2;\r\nGO",
+		"select 'hi\\\n-hello';\ngo\nselect 'a\\\r\n\nb'\ngo 3\n",
+		"select 'é\ngo\n'\n  go\n\n  select 2\ngo\n",
+		"GO", "--", "/*", "0'", "",
+	}
+	readers := map[string]func(string) io.Reader{
+		"all":      func(s string) io.Reader { return strings.NewReader(s) },
+		"one byte": func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) },
+		"data err": func(s string) io.Reader { return iotest.DataErrReader(strings.NewReader(s)) },
+	}
+	for _, script := range scripts {
+		want := SplitBatches(script, "go")
+		if script == "" {
+			want = nil
+		}
+		for name, reader := range readers {
+			s := NewScanner(reader(script), "go")
+			var got []Batch
+			for s.Scan() {
+				got = append(got, s.Batch())
+			}
+			if s.Err() != nil {
+				t.Fatal(s.Err())
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s reader of %q: got %+v, want %+v", name, script, got, want)
+			}
+		}
+	}
+}
+
+func TestScannerLarge(t *testing.T) {
+	var script strings.Builder
+	for i := 0; i < 20000; i++ {
+		script.WriteString("insert into t values (1, 'go\n-- go\n')\ngo\n")
+	}
+	s := NewScanner(strings.NewReader(script.String()), "GO")
+	n := 0
+	for s.Scan() {
+		n++
+		want := 4 * (n - 1) // the line of the previous separator
+		if n == 1 {
+			want = 1
+		}
+		if b := s.Batch(); b.Line != want {
+			t.Fatalf("batch %d at line %d, want %d", n, b.Line, want)
+		}
+	}
+	// the last batch is the line break after the last separator
+	if s.Err() != nil || n != 20001 {
+		t.Errorf("got %d batches, %v", n, s.Err())
+	}
+}
+
+func TestScannerLongLine(t *testing.T) {
+	// the incomplete line is not copied again by each read
+	line := "select '" + strings.Repeat("x", 1<<20) + "'"
+	s := NewScanner(iotest.OneByteReader(strings.NewReader(line+"\ngo\n")), "go")
+	if !s.Scan() || s.Batch().Text != line+"\n" {
+		t.Fatalf("got %d bytes, %v", len(s.Batch().Text), s.Err())
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestScannerError(t *testing.T) {
+	failed := errors.New("failed")
+	r := io.MultiReader(strings.NewReader("select 1\ngo\nselect 2"), errReader{failed})
+	s := NewScanner(r, "go")
+	var got []string
+	for s.Scan() {
+		got = append(got, s.Batch().Text)
+	}
+	if s.Err() != failed || !reflect.DeepEqual(got, []string{"select 1\n"}) {
+		t.Errorf("got %q, %v", got, s.Err())
+	}
+}
@@ -0,0 +1,941 @@
+package mssql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BCPField describes a field of a bcp data file, as listed in a format file.
+type BCPField struct {
+	// Type is the host file data type, such as SQLINT or SQLNCHAR.
+	Type string
+	// PrefixLength is the size in bytes of the length prefix
+	// of the field: 0, 1, 2, 4 or 8.
+	PrefixLength int
+	// Length is the length in bytes of fields without prefix
+	// and terminator, the maximum length of others.
+	Length int
+	// Terminator ends the field, it is empty in native files.
+	Terminator string
+	// Column is the position of the table column, starting at 1.
+	// Fields with Column 0 are not loaded.
+	Column int
+	// Name is the name of the table column.
+	Name string
+	// Collation is the collation name of character fields.
+	Collation string
+}
+
+// BCPFormat describes the fields of a bcp data file.
+type BCPFormat struct {
+	// Version is the version of bcp in non-XML format files.
+	Version string
+	Fields  []BCPField
+}
+
+// BCPOptions configure Bulk.LoadBCP and Conn.ExportBCP.
+type BCPOptions struct {
+	// Wide stores character values as UCS-2, like the -N option of bcp.
+	// Otherwise they are stored in the code page of their column,
+	// like the -n option.
+	Wide bool
+}
+
+const (
+	defaultBCPVersion = "14.0"
+
+	bcpXMLNamespace    = "http://schemas.microsoft.com/sqlserver/2004/bulkload/format"
+	bcpXSINamespace    = "http://www.w3.org/2001/XMLSchema-instance"
+	bcpVariantMaxBytes = 8016
+)
+
+// ReadBCPFormat reads a format file, either in non-XML or XML format.
+func ReadBCPFormat(r io.Reader) (*BCPFormat, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if text := bytes.TrimSpace(data); len(text) > 0 && text[0] == '<' {
+		return parseBCPXMLFormat(data)
+	}
+	return parseBCPFormat(string(data))
+}
+
+// parseBCPFormat parses a non-XML format file:
+// https://docs.microsoft.com/en-us/sql/relational-databases/import-export/non-xml-format-files-sql-server
+func parseBCPFormat(text string) (*BCPFormat, error) {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 2 {
+		return nil, errors.New("bcp: format file is incomplete")
+	}
+	f := &BCPFormat{Version: lines[0]}
+	n, err := strconv.Atoi(lines[1])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("bcp: invalid number of fields %q", lines[1])
+	}
+	if len(lines)-2 != n {
+		return nil, fmt.Errorf("bcp: format file has %d fields, want %d", len(lines)-2, n)
+	}
+	for i, line := range lines[2:] {
+		tokens, err := splitBCPFormatLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("bcp: field %d: %v", i+1, err)
+		}
+		if len(tokens) == 7 {
+			// the collation is optional for non character fields
+			tokens = append(tokens, "")
+		}
+		if len(tokens) != 8 {
+			return nil, fmt.Errorf("bcp: field %d has %d attributes, want 8", i+1, len(tokens))
+		}
+		var nums [4]int
+		for j, k := range []int{0, 2, 3, 5} {
+			if nums[j], err = strconv.Atoi(tokens[k]); err != nil {
+				return nil, fmt.Errorf("bcp: field %d: invalid number %q", i+1, tokens[k])
+			}
+		}
+		if nums[0] != i+1 {
+			return nil, fmt.Errorf("bcp: field %d is listed at position %d", nums[0], i+1)
+		}
+		field := BCPField{
+			Type:         strings.ToUpper(tokens[1]),
+			PrefixLength: nums[1],
+			Length:       nums[2],
+			Terminator:   tokens[4],
+			Column:       nums[3],
+			Name:         tokens[6],
+			Collation:    tokens[7],
+		}
+		if err = field.validate(); err != nil {
+			return nil, err
+		}
+		f.Fields = append(f.Fields, field)
+	}
+	return f, nil
+}
+
+// splitBCPFormatLine splits a line of a non-XML format file into its
+// attributes, unquoting and unescaping quoted attributes.
+func splitBCPFormatLine(line string) ([]string, error) {
+	var tokens []string
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return tokens, nil
+		}
+		if line[0] != '"' {
+			i := strings.IndexAny(line, " \t")
+			if i < 0 {
+				i = len(line)
+			}
+			tokens = append(tokens, line[:i])
+			line = line[i:]
+			continue
+		}
+		end := 1
+		for end < len(line) && line[end] != '"' {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(line) {
+			return nil, errors.New("unterminated quoted attribute")
+		}
+		tokens = append(tokens, unescapeBCPTerminator(line[1:end]))
+		line = line[end+1:]
+	}
+}
+
+var bcpTerminatorEscapes = strings.NewReplacer(`\t`, "\t", `\n`, "\n", `\r`, "\r", `\0`, "\x00", `\"`, `"`, `\\`, `\`)
+
+func unescapeBCPTerminator(s string) string {
+	return bcpTerminatorEscapes.Replace(s)
+}
+
+func escapeBCPTerminator(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", `\0`, `"`, `\"`).Replace(s)
+}
+
+func (f BCPField) validate() error {
+	switch f.PrefixLength {
+	case 0, 1, 2, 4, 8:
+	default:
+		return fmt.Errorf("bcp: field %s has invalid prefix length %d", f.Name, f.PrefixLength)
+	}
+	if f.PrefixLength == 0 && f.Terminator == "" && f.Length <= 0 {
+		return fmt.Errorf("bcp: field %s has no prefix, terminator or length", f.Name)
+	}
+	if f.Column < 0 {
+		return fmt.Errorf("bcp: field %s has invalid column %d", f.Name, f.Column)
+	}
+	return nil
+}
+
+type bcpXMLFormat struct {
+	Fields  []bcpXMLField  `xml:"RECORD>FIELD"`
+	Columns []bcpXMLColumn `xml:"ROW>COLUMN"`
+}
+
+type bcpXMLField struct {
+	ID           string `xml:"ID,attr"`
+	Type         string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	Length       int    `xml:"LENGTH,attr"`
+	PrefixLength int    `xml:"PREFIX_LENGTH,attr"`
+	MaxLength    int    `xml:"MAX_LENGTH,attr"`
+	Terminator   string `xml:"TERMINATOR,attr"`
+	Collation    string `xml:"COLLATION,attr"`
+}
+
+type bcpXMLColumn struct {
+	Source string `xml:"SOURCE,attr"`
+	Name   string `xml:"NAME,attr"`
+	Type   string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+}
+
+// parseBCPXMLFormat parses an XML format file:
+// https://docs.microsoft.com/en-us/sql/relational-databases/import-export/xml-format-files-sql-server
+func parseBCPXMLFormat(data []byte) (*BCPFormat, error) {
+	var x bcpXMLFormat
+	if err := xml.Unmarshal(data, &x); err != nil {
+		return nil, fmt.Errorf("bcp: invalid XML format file: %v", err)
+	}
+	f := &BCPFormat{}
+	ids := make(map[string]int)
+	for i, xf := range x.Fields {
+		field := BCPField{
+			Terminator: unescapeBCPTerminator(xf.Terminator),
+			Collation:  xf.Collation,
+		}
+		switch xf.Type {
+		case "NativeFixed", "CharFixed", "NCharFixed":
+			field.Length = xf.Length
+		case "NativePrefix", "CharPrefix", "NCharPrefix":
+			field.PrefixLength = xf.PrefixLength
+			field.Length = xf.MaxLength
+		case "CharTerm", "NCharTerm":
+			field.Length = xf.MaxLength
+		default:
+			return nil, fmt.Errorf("bcp: field %s has unknown type %q", xf.ID, xf.Type)
+		}
+		switch {
+		case strings.HasPrefix(xf.Type, "NChar"):
+			field.Type = "SQLNCHAR"
+		case strings.HasPrefix(xf.Type, "Char"):
+			field.Type = "SQLCHAR"
+		}
+		ids[xf.ID] = i
+		f.Fields = append(f.Fields, field)
+	}
+	for i, xc := range x.Columns {
+		j, ok := ids[xc.Source]
+		if !ok {
+			return nil, fmt.Errorf("bcp: column %s refers to unknown field %s", xc.Name, xc.Source)
+		}
+		field := &f.Fields[j]
+		field.Column = i + 1
+		field.Name = xc.Name
+		if field.Type == "" {
+			// the data type of native fields is the column type
+			field.Type = bcpHostType(xc.Type)
+		}
+	}
+	for _, field := range f.Fields {
+		if field.Type == "" {
+			return nil, errors.New("bcp: native field without column")
+		}
+		if err := field.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// bcpHostType returns the host file data type of a column type of an XML
+// format file.
+func bcpHostType(sqlType string) string {
+	switch sqlType {
+	case "SQLVARYCHAR", "SQLTEXT":
+		return "SQLCHAR"
+	case "SQLNVARCHAR", "SQLNTEXT":
+		return "SQLNCHAR"
+	case "SQLVARYBIN", "SQLIMAGE":
+		return "SQLBINARY"
+	}
+	return sqlType
+}
+
+// bcpColumnType returns the column type of an XML format file
+// for a host file data type.
+func bcpColumnType(hostType string) string {
+	switch hostType {
+	case "SQLCHAR":
+		return "SQLVARYCHAR"
+	case "SQLNCHAR":
+		return "SQLNVARCHAR"
+	case "SQLBINARY":
+		return "SQLVARYBIN"
+	}
+	return hostType
+}
+
+// Write writes f as a non-XML format file.
+func (f *BCPFormat) Write(w io.Writer) error {
+	version := f.Version
+	if version == "" {
+		version = defaultBCPVersion
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\r\n%d\r\n", version, len(f.Fields))
+	for i, field := range f.Fields {
+		name := field.Name
+		if name == "" || strings.ContainsAny(name, " \t\"") {
+			name = `"` + escapeBCPTerminator(name) + `"`
+		}
+		collation := field.Collation
+		if collation == "" {
+			collation = `""`
+		}
+		fmt.Fprintf(bw, "%d\t%s\t%d\t%d\t\"%s\"\t%d\t%s\t%s\r\n", i+1, field.Type, field.PrefixLength,
+			field.Length, escapeBCPTerminator(field.Terminator), field.Column, name, collation)
+	}
+	return bw.Flush()
+}
+
+// WriteXML writes f as an XML format file.
+func (f *BCPFormat) WriteXML(w io.Writer) error {
+	attr := func(s string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<?xml version=\"1.0\"?>\r\n<BCPFORMAT xmlns=\"%s\" xmlns:xsi=\"%s\">\r\n <RECORD>\r\n",
+		bcpXMLNamespace, bcpXSINamespace)
+	for i, field := range f.Fields {
+		kind := "Native"
+		switch field.Type {
+		case "SQLCHAR":
+			kind = "Char"
+		case "SQLNCHAR":
+			kind = "NChar"
+		}
+		if field.Terminator != "" && (kind == "Native" || field.PrefixLength > 0) {
+			return fmt.Errorf("bcp: terminator of field %s can't be written in XML format files", field.Name)
+		}
+		fmt.Fprintf(bw, "  <FIELD ID=\"%d\"", i+1)
+		switch {
+		case field.Terminator != "":
+			fmt.Fprintf(bw, " xsi:type=\"%sTerm\" TERMINATOR=\"%s\"", kind, attr(escapeBCPTerminator(field.Terminator)))
+			if field.Length > 0 {
+				fmt.Fprintf(bw, " MAX_LENGTH=\"%d\"", field.Length)
+			}
+		case field.PrefixLength > 0:
+			fmt.Fprintf(bw, " xsi:type=\"%sPrefix\" PREFIX_LENGTH=\"%d\"", kind, field.PrefixLength)
+			if field.Length > 0 && kind != "Native" {
+				fmt.Fprintf(bw, " MAX_LENGTH=\"%d\"", field.Length)
+			}
+		default:
+			fmt.Fprintf(bw, " xsi:type=\"%sFixed\" LENGTH=\"%d\"", kind, field.Length)
+		}
+		if field.Collation != "" {
+			fmt.Fprintf(bw, " COLLATION=\"%s\"", attr(field.Collation))
+		}
+		bw.WriteString("/>\r\n")
+	}
+	bw.WriteString(" </RECORD>\r\n <ROW>\r\n")
+	columns := make([]int, 0, len(f.Fields))
+	for i, field := range f.Fields {
+		if field.Column > 0 {
+			columns = append(columns, i)
+		}
+	}
+	sort.SliceStable(columns, func(i, j int) bool {
+		return f.Fields[columns[i]].Column < f.Fields[columns[j]].Column
+	})
+	for _, i := range columns {
+		fmt.Fprintf(bw, "  <COLUMN SOURCE=\"%d\" NAME=\"%s\" xsi:type=\"%s\"/>\r\n", i+1,
+			attr(f.Fields[i].Name), bcpColumnType(f.Fields[i].Type))
+	}
+	bw.WriteString(" </ROW>\r\n</BCPFORMAT>\r\n")
+	return bw.Flush()
+}
+
+// bcpNativeField returns the field storing values of col in a native,
+// or with wide set a wide native, data file.
+func bcpNativeField(col columnStruct, wide bool) (BCPField, error) {
+	ti := col.ti
+	field := BCPField{Name: col.ColName, Length: ti.Size}
+	fixed := func(typ string) {
+		field.Type = typ
+		if col.Flags&colFlagNullable != 0 {
+			field.PrefixLength = 1
+		}
+	}
+	switch ti.TypeId {
+	case typeInt1, typeInt2, typeInt4, typeInt8, typeIntN:
+		switch ti.Size {
+		case 1:
+			fixed("SQLTINYINT")
+		case 2:
+			fixed("SQLSMALLINT")
+		case 4:
+			fixed("SQLINT")
+		default:
+			fixed("SQLBIGINT")
+		}
+	case typeBit, typeBitN:
+		fixed("SQLBIT")
+	case typeFlt4, typeFlt8, typeFltN:
+		if ti.Size == 4 {
+			fixed("SQLFLT4")
+		} else {
+			fixed("SQLFLT8")
+		}
+	case typeMoney, typeMoney4, typeMoneyN:
+		if ti.Size == 4 {
+			fixed("SQLMONEY4")
+		} else {
+			fixed("SQLMONEY")
+		}
+	case typeDateTime, typeDateTim4, typeDateTimeN:
+		if ti.Size == 4 {
+			fixed("SQLDATETIM4")
+		} else {
+			fixed("SQLDATETIME")
+		}
+	case typeGuid:
+		fixed("SQLUNIQUEID")
+	case typeDecimal, typeDecimalN:
+		fixed("SQLDECIMAL")
+		field.Length = bcpNumericLen
+	case typeNumeric, typeNumericN:
+		fixed("SQLNUMERIC")
+		field.Length = bcpNumericLen
+	case typeDateN:
+		field.Type, field.PrefixLength, field.Length = "SQLDATE", 1, 3
+	case typeTimeN:
+		field.Type, field.PrefixLength, field.Length = "SQLTIME", 1, calcTimeSize(int(ti.Scale))
+	case typeDateTime2N:
+		field.Type, field.PrefixLength, field.Length = "SQLDATETIME2", 1, 3+calcTimeSize(int(ti.Scale))
+	case typeDateTimeOffsetN:
+		field.Type, field.PrefixLength, field.Length = "SQLDATETIMEOFFSET", 1, 5+calcTimeSize(int(ti.Scale))
+	case typeVarChar, typeBigVarChar, typeChar, typeBigChar, typeText:
+		field.Type = "SQLCHAR"
+		if wide {
+			field.Type = "SQLNCHAR"
+			field.Length *= 2
+		}
+	case typeNVarChar, typeNChar, typeNText:
+		field.Type = "SQLNCHAR"
+	case typeVarBinary, typeBigVarBin, typeBinary, typeBigBinary, typeImage:
+		field.Type = "SQLBINARY"
+	case typeUdt:
+		field.Type = "SQLUDT"
+	case typeXml, typeVector:
+		// vectors are stored as JSON arrays
+		field.Type, field.PrefixLength, field.Length = "SQLNCHAR", 8, 0
+	case typeVariant:
+		field.Type, field.PrefixLength, field.Length = "SQLVARIANT", 4, bcpVariantMaxBytes
+	default:
+		return field, fmt.Errorf("bcp: column %s has unsupported type %s", col.ColName, makeDecl(ti))
+	}
+	if field.Type == "SQLCHAR" || field.Type == "SQLNCHAR" || field.Type == "SQLBINARY" || field.Type == "SQLUDT" {
+		switch {
+		case field.PrefixLength == 8:
+		case ti.TypeId == typeText || ti.TypeId == typeNText || ti.TypeId == typeImage:
+			field.PrefixLength, field.Length = 4, 0
+		case isPLPColumn(ti) || ti.Size == 0xffff:
+			field.PrefixLength, field.Length = 8, 0
+		default:
+			field.PrefixLength = 2
+		}
+	}
+	return field, nil
+}
+
+// bcpNumericLen is the length of decimal and numeric values in data files,
+// they are stored as precision, scale, sign and a 16 bytes integer.
+const bcpNumericLen = 19
+
+// LoadBCP reads rows from a bcp data file and loads them, then completes
+// the bulk copy like Done.
+//
+// If format is nil the file is in native format, or wide native format if
+// opts.Wide is set, and has a field for each column of the bulk, or for
+// each column of the table if the bulk has no columns. Otherwise format
+// describes the fields, which are matched to the bulk columns by name. If
+// the bulk has no columns the columns of the format are used.
+//
+// Character fields are in the code page of their column, date and time
+// values have the scale of their column.
+//
+// If r can't be read or a row fails the bulk copy is aborted and no rows
+// are inserted.
+func (b *Bulk) LoadBCP(r io.Reader, format *BCPFormat, opts BCPOptions) (rowCount int64, err error) {
+	if b.headerSent {
+		return 0, errors.New("bcp: rows were already added to the bulk copy")
+	}
+	if len(b.columnsName) == 0 {
+		if format != nil {
+			var fields []BCPField
+			for _, field := range format.Fields {
+				if field.Column > 0 {
+					fields = append(fields, field)
+				}
+			}
+			sort.SliceStable(fields, func(i, j int) bool {
+				return fields[i].Column < fields[j].Column
+			})
+			for _, field := range fields {
+				b.columnsName = append(b.columnsName, field.Name)
+			}
+		} else {
+			tableParts, err := parseObjectName(b.tablename)
+			if err != nil {
+				return 0, err
+			}
+			if err = b.getMetadata(b.ctx, tableParts); err != nil {
+				return 0, err
+			}
+			for _, col := range b.metadata {
+				b.columnsName = append(b.columnsName, col.ColName)
+			}
+		}
+	}
+	if err = b.sendBulkCommand(b.ctx); err != nil {
+		return
+	}
+
+	// columns maps the fields to bulk columns, -1 for fields not loaded
+	var fields []BCPField
+	var columns []int
+	if format == nil {
+		for i, col := range b.bulkColumns {
+			field, err := bcpNativeField(col, opts.Wide)
+			if err != nil {
+				return 0, b.abortBCP(err)
+			}
+			fields = append(fields, field)
+			columns = append(columns, i)
+		}
+	} else {
+		fields = format.Fields
+		loaded := make([]bool, len(b.bulkColumns))
+		for _, field := range fields {
+			column := -1
+			if field.Column > 0 {
+				for i, col := range b.bulkColumns {
+					if col.ColName == field.Name && !loaded[i] {
+						column = i
+						loaded[i] = true
+						break
+					}
+				}
+			}
+			columns = append(columns, column)
+		}
+		for i, ok := range loaded {
+			if !ok {
+				return 0, b.abortBCP(fmt.Errorf("bcp: column %s is not in the format", b.bulkColumns[i].ColName))
+			}
+		}
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		row := make([]interface{}, len(b.bulkColumns))
+		for i, field := range fields {
+			data, null, err := readBCPField(br, field)
+			if err == io.EOF && i > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			if err == io.EOF {
+				return b.Done()
+			}
+			if err != nil {
+				return 0, b.abortBCP(fmt.Errorf("bcp: row %d, field %d: %v", b.numRows, i+1, err))
+			}
+			if columns[i] < 0 || null {
+				continue
+			}
+			col := b.bulkColumns[columns[i]]
+			if row[columns[i]], err = decodeBCPValue(field, data, col); err != nil {
+				return 0, b.abortBCP(BulkRowError{Row: b.numRows, Column: col.ColName, Err: err})
+			}
+		}
+		if err = b.AddRow(row); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// abortBCP aborts the bulk copy after err.
+func (b *Bulk) abortBCP(err error) error {
+	if abortErr := b.abort(); abortErr != nil {
+		return abortErr
+	}
+	return err
+}
+
+// readBCPField reads the data of a field, it returns io.EOF if there are
+// no more fields.
+func readBCPField(r *bufio.Reader, field BCPField) (data []byte, null bool, err error) {
+	n := -1
+	if field.PrefixLength > 0 {
+		prefix := make([]byte, 8)
+		if _, err = io.ReadFull(r, prefix[:field.PrefixLength]); err != nil {
+			return
+		}
+		length := binary.LittleEndian.Uint64(prefix)
+		if length == math.MaxUint64>>(64-8*uint(field.PrefixLength)) {
+			if field.PrefixLength == 8 {
+				return nil, true, nil
+			}
+			// a NULL value may still be followed by its terminator
+			null = true
+			length = 0
+		}
+		if length > math.MaxInt32 {
+			return nil, false, fmt.Errorf("invalid length %d", length)
+		}
+		n = int(length)
+	} else if field.Terminator == "" {
+		n = field.Length
+	}
+
+	if n >= 0 {
+		data = make([]byte, n)
+		if _, err = io.ReadFull(r, data); err != nil {
+			if err == io.EOF && field.PrefixLength > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+		if field.Terminator != "" {
+			term := bcpTerminator(field)
+			got := make([]byte, len(term))
+			if _, err = io.ReadFull(r, got); err != nil {
+				return nil, false, io.ErrUnexpectedEOF
+			}
+			if !bytes.Equal(got, term) {
+				return nil, false, errors.New("missing field terminator")
+			}
+		}
+		return
+	}
+
+	// terminated field
+	term := bcpTerminator(field)
+	for {
+		c, rerr := r.ReadByte()
+		if rerr != nil {
+			if rerr == io.EOF && len(data) > 0 {
+				rerr = io.ErrUnexpectedEOF
+			}
+			return nil, false, rerr
+		}
+		data = append(data, c)
+		if bytes.HasSuffix(data, term) && (field.Type != "SQLNCHAR" || len(data)%2 == 0) {
+			data = data[:len(data)-len(term)]
+			// empty fields are loaded as NULL, like bcp does
+			return data, len(data) == 0, nil
+		}
+	}
+}
+
+// bcpTerminator returns the terminator of field, it is UCS-2 for wide
+// character fields.
+func bcpTerminator(field BCPField) []byte {
+	if field.Type == "SQLNCHAR" {
+		return str2ucs2(field.Terminator)
+	}
+	return []byte(field.Terminator)
+}
+
+// decodeBCPValue converts the data of a field to a value accepted by
+// Bulk.makeParam for col.
+func decodeBCPValue(field BCPField, data []byte, col columnStruct) (val interface{}, err error) {
+	size := func(sizes ...int) error {
+		for _, s := range sizes {
+			if len(data) == s {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid length %d for %s field", len(data), field.Type)
+	}
+	switch field.Type {
+	case "SQLCHAR", "SQLNCHAR":
+		var s string
+		if field.Type == "SQLCHAR" {
+			s = decodeChar(col.ti.Collation, data)
+		} else {
+			if err = size(len(data) &^ 1); err != nil {
+				return
+			}
+			s = decodeNChar(data)
+		}
+		switch col.ti.TypeId {
+		case typeVarChar, typeBigVarChar, typeChar, typeBigChar, typeText,
+			typeNVarChar, typeNChar, typeNText, typeXml, typeVector, typeVariant:
+			return s, nil
+		}
+		// character mode fields of other columns
+		return csvConverter{opts: CSVOptions{NullValues: []string{}}}.convert(s, col)
+	case "SQLBINARY", "SQLUDT", "SQLUNIQUEID":
+		if field.Type == "SQLUNIQUEID" {
+			if err = size(16); err != nil {
+				return
+			}
+		}
+		return data, nil
+	case "SQLBIT":
+		if err = size(1); err != nil {
+			return
+		}
+		return data[0] != 0, nil
+	case "SQLTINYINT":
+		if err = size(1); err != nil {
+			return
+		}
+		return int64(data[0]), nil
+	case "SQLSMALLINT":
+		if err = size(2); err != nil {
+			return
+		}
+		return int64(int16(binary.LittleEndian.Uint16(data))), nil
+	case "SQLINT":
+		if err = size(4); err != nil {
+			return
+		}
+		return int64(int32(binary.LittleEndian.Uint32(data))), nil
+	case "SQLBIGINT":
+		if err = size(8); err != nil {
+			return
+		}
+		return int64(binary.LittleEndian.Uint64(data)), nil
+	case "SQLFLT4":
+		if err = size(4); err != nil {
+			return
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data))), nil
+	case "SQLFLT8":
+		if err = size(8); err != nil {
+			return
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	case "SQLMONEY":
+		if err = size(8); err != nil {
+			return
+		}
+		return string(decodeMoney(data)), nil
+	case "SQLMONEY4":
+		if err = size(4); err != nil {
+			return
+		}
+		return string(decodeMoney4(data)), nil
+	case "SQLDECIMAL", "SQLNUMERIC":
+		if err = size(bcpNumericLen); err != nil {
+			return
+		}
+		return string(decodeDecimal(data[0], data[1], data[2:])), nil
+	case "SQLDATETIME":
+		if err = size(8); err != nil {
+			return
+		}
+		return decodeDateTime(data), nil
+	case "SQLDATETIM4":
+		if err = size(4); err != nil {
+			return
+		}
+		return decodeDateTim4(data), nil
+	case "SQLDATE":
+		if err = size(3); err != nil {
+			return
+		}
+		return decodeDate(data), nil
+	case "SQLTIME":
+		if err = size(3, 4, 5); err != nil {
+			return
+		}
+		return decodeTime(col.ti.Scale, data), nil
+	case "SQLDATETIME2":
+		if err = size(6, 7, 8); err != nil {
+			return
+		}
+		return decodeDateTime2(col.ti.Scale, data), nil
+	case "SQLDATETIMEOFFSET":
+		if err = size(8, 9, 10); err != nil {
+			return
+		}
+		return decodeDateTimeOffset(col.ti.Scale, data), nil
+	case "SQLVARIANT":
+		return decodeBCPVariant(data)
+	}
+	return nil, fmt.Errorf("unsupported field type %s", field.Type)
+}
+
+// decodeBCPVariant decodes a sql_variant value, stored like in TDS
+// without its length.
+func decodeBCPVariant(data []byte) (val interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid sql_variant value: %v", r)
+		}
+	}()
+	buf := make([]byte, 4+len(data))
+	binary.LittleEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	r := &tdsBuffer{packetSize: len(buf), rbuf: buf, rsize: len(buf)}
+	return readVariantType(&typeInfo{TypeId: typeVariant}, r), nil
+}
+
+// ExportBCP runs query and writes the rows of its first result set to w as
+// a bcp data file in native format, or in wide native format if opts.Wide
+// is set. The returned format describes the data file, it can be written as
+// a format file for bcp.
+func (cn *Conn) ExportBCP(ctx context.Context, w io.Writer, query string, opts BCPOptions, args ...driver.NamedValue) (rowCount int64, format *BCPFormat, err error) {
+	stmt, err := cn.prepareContext(ctx, query)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx, args)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	bw, err := newBCPWriter(w, rows.(*Rows).cols, opts)
+	if err != nil {
+		return
+	}
+	format = bw.format()
+	values := make([]driver.Value, len(bw.cols))
+	for {
+		if err = rows.Next(values); err == io.EOF {
+			break
+		}
+		if err != nil {
+			return
+		}
+		if err = bw.writeRow(values); err != nil {
+			return rowCount, format, fmt.Errorf("bcp: row %d: %v", rowCount, err)
+		}
+		rowCount++
+	}
+	return rowCount, format, bw.w.Flush()
+}
+
+// bcpWriter writes rows in native format, encoding values with the
+// bulk copy encoders of their columns.
+type bcpWriter struct {
+	w      *bufio.Writer
+	cols   []columnStruct
+	fields []BCPField
+	bulk   Bulk
+}
+
+func newBCPWriter(w io.Writer, cols []columnStruct, opts BCPOptions) (*bcpWriter, error) {
+	bw := &bcpWriter{w: bufio.NewWriter(w), cols: cols}
+	for i, col := range cols {
+		field, err := bcpNativeField(col, opts.Wide)
+		if err != nil {
+			return nil, err
+		}
+		field.Column = i + 1
+		bw.fields = append(bw.fields, field)
+	}
+	return bw, nil
+}
+
+func (bw *bcpWriter) format() *BCPFormat {
+	return &BCPFormat{Version: defaultBCPVersion, Fields: append([]BCPField(nil), bw.fields...)}
+}
+
+func (bw *bcpWriter) writeRow(row []driver.Value) error {
+	for i, col := range bw.cols {
+		field := bw.fields[i]
+		data, err := bw.encode(row[i], field, col)
+		if err != nil {
+			return fmt.Errorf("column %s: %v", col.ColName, err)
+		}
+		if data == nil {
+			if field.PrefixLength == 0 {
+				return fmt.Errorf("column %s: NULL value in a column without prefix", col.ColName)
+			}
+			bw.w.Write(bytes.Repeat([]byte{0xff}, field.PrefixLength))
+			continue
+		}
+		if field.PrefixLength == 0 {
+			if len(data) != field.Length {
+				return fmt.Errorf("column %s: value has %d bytes instead of %d", col.ColName, len(data), field.Length)
+			}
+		} else {
+			prefix := make([]byte, 8)
+			binary.LittleEndian.PutUint64(prefix, uint64(len(data)))
+			bw.w.Write(prefix[:field.PrefixLength])
+		}
+		if _, err = bw.w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode returns the data of a field, nil for NULL.
+func (bw *bcpWriter) encode(val driver.Value, field BCPField, col columnStruct) ([]byte, error) {
+	switch v := val.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		switch col.ti.TypeId {
+		case typeDecimal, typeDecimalN, typeNumeric, typeNumericN, typeMoney, typeMoney4, typeMoneyN:
+			val = string(v)
+		}
+	case Vector:
+		if v.IsNull() {
+			return nil, nil
+		}
+		return str2ucs2(v.String()), nil
+	}
+	if field.Type == "SQLNCHAR" {
+		if s, ok := val.(string); ok {
+			// also character columns of wide native files
+			return str2ucs2(s), nil
+		}
+	}
+	p, err := bw.bulk.makeParam(val, col)
+	if err != nil {
+		return nil, err
+	}
+	switch field.Type {
+	case "SQLDECIMAL", "SQLNUMERIC":
+		data := make([]byte, bcpNumericLen)
+		data[0] = col.ti.Prec
+		data[1] = col.ti.Scale
+		copy(data[2:], p.buffer)
+		return data, nil
+	}
+	if p.buffer == nil {
+		return []byte{}, nil
+	}
+	return p.buffer, nil
+}
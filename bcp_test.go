@@ -0,0 +1,346 @@
+package mssql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denisenkom/go-mssqldb/internal/cp"
+)
+
+const testBCPFormat = `14.0
+4
+1       SQLINT        0       4       ""       1     id       ""
+2       SQLNCHAR      2       40      ""       2     name     SQL_Latin1_General_CP1_CI_AS
+3       SQLCHAR       0       0       "\t"     0     skipped  ""
+4       SQLDATETIME2  1       8       "\r\n"   3     "created at"  ""
+`
+
+var testBCPFields = []BCPField{
+	{Type: "SQLINT", Length: 4, Column: 1, Name: "id"},
+	{Type: "SQLNCHAR", PrefixLength: 2, Length: 40, Column: 2, Name: "name", Collation: "SQL_Latin1_General_CP1_CI_AS"},
+	{Type: "SQLCHAR", Terminator: "\t", Name: "skipped"},
+	{Type: "SQLDATETIME2", PrefixLength: 1, Length: 8, Terminator: "\r\n", Column: 3, Name: "created at"},
+}
+
+func TestReadBCPFormat(t *testing.T) {
+	f, err := ReadBCPFormat(strings.NewReader(testBCPFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Version != "14.0" || !reflect.DeepEqual(f.Fields, testBCPFields) {
+		t.Errorf("unexpected format %+v", f)
+	}
+
+	xmlFormat := `<?xml version="1.0"?>
+<BCPFORMAT xmlns="http://schemas.microsoft.com/sqlserver/2004/bulkload/format" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+ <RECORD>
+  <FIELD ID="1" xsi:type="NativeFixed" LENGTH="4"/>
+  <FIELD ID="2" xsi:type="NCharPrefix" PREFIX_LENGTH="2" MAX_LENGTH="40" COLLATION="SQL_Latin1_General_CP1_CI_AS"/>
+  <FIELD ID="3" xsi:type="CharTerm" TERMINATOR="\t"/>
+  <FIELD ID="4" xsi:type="NativePrefix" PREFIX_LENGTH="1"/>
+ </RECORD>
+ <ROW>
+  <COLUMN SOURCE="1" NAME="id" xsi:type="SQLINT"/>
+  <COLUMN SOURCE="2" NAME="name" xsi:type="SQLNVARCHAR"/>
+  <COLUMN SOURCE="4" NAME="created at" xsi:type="SQLDATETIME2"/>
+ </ROW>
+</BCPFORMAT>`
+	f, err = ReadBCPFormat(strings.NewReader(xmlFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// XML format files have no names for skipped fields, no terminators
+	// for native fields and no maximum length for native fields
+	xmlFields := append([]BCPField(nil), testBCPFields...)
+	xmlFields[2].Name = ""
+	xmlFields[3].Terminator = ""
+	xmlFields[3].Length = 0
+	if !reflect.DeepEqual(f.Fields, xmlFields) {
+		t.Errorf("unexpected XML format %+v", f.Fields)
+	}
+
+	// written format files are read back
+	f = &BCPFormat{Fields: testBCPFields}
+	var buf bytes.Buffer
+	if err = f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = ReadBCPFormat(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if f.Version != defaultBCPVersion || !reflect.DeepEqual(f.Fields, testBCPFields) {
+		t.Errorf("format file is not read back: %+v", f)
+	}
+	buf.Reset()
+	if err = f.WriteXML(&buf); err == nil {
+		t.Error("a native field with a terminator can't be written in XML")
+	}
+	buf.Reset()
+	if err = (&BCPFormat{Fields: xmlFields}).WriteXML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	xmlText := buf.String()
+	if f, err = ReadBCPFormat(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f.Fields, xmlFields) {
+		t.Errorf("XML format file is not read back: %+v\n%s", f.Fields, xmlText)
+	}
+
+	for _, bad := range []string{
+		"14.0\n",
+		"14.0\n2\n1 SQLINT 0 4 \"\" 1 id \"\"\n",
+		"14.0\n1\n2 SQLINT 0 4 \"\" 1 id \"\"\n",
+		"14.0\n1\n1 SQLINT 3 4 \"\" 1 id \"\"\n",
+		"14.0\n1\n1 SQLINT 0 0 \"\" 1 id \"\"\n",
+		"14.0\n1\n1 SQLCHAR 0 0 \"\\t 1 id \"\"\n",
+		`<BCPFORMAT><RECORD><FIELD ID="1" xsi:type="Other"/></RECORD></BCPFORMAT>`,
+		`<BCPFORMAT xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><RECORD><FIELD ID="1" xsi:type="NativePrefix" PREFIX_LENGTH="1"/></RECORD></BCPFORMAT>`,
+	} {
+		if _, err = ReadBCPFormat(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q should fail", bad)
+		}
+	}
+}
+
+func TestBCPNativeRoundTrip(t *testing.T) {
+	latin1 := cp.Collation{LcidAndFlags: 0x0409, SortId: 52}
+	cols := []columnStruct{
+		{ColName: "id", ti: typeInfo{TypeId: typeInt4, Size: 4}},
+		{ColName: "n", Flags: colFlagNullable, ti: typeInfo{TypeId: typeIntN, Size: 8}},
+		{ColName: "name", Flags: colFlagNullable, ti: typeInfo{TypeId: typeNVarChar, Size: 40}},
+		{ColName: "code", Flags: colFlagNullable, ti: typeInfo{TypeId: typeBigVarChar, Size: 10, Collation: latin1}},
+		{ColName: "doc", Flags: colFlagNullable, ti: typeInfo{TypeId: typeNVarChar, Size: 0xffff}},
+		{ColName: "flag", ti: typeInfo{TypeId: typeBitN, Size: 1}},
+		{ColName: "ratio", Flags: colFlagNullable, ti: typeInfo{TypeId: typeFltN, Size: 8}},
+		{ColName: "price", Flags: colFlagNullable, ti: typeInfo{TypeId: typeMoneyN, Size: 8}},
+		{ColName: "amount", Flags: colFlagNullable, ti: typeInfo{TypeId: typeDecimalN, Size: 9, Prec: 18, Scale: 2}},
+		{ColName: "created", Flags: colFlagNullable, ti: typeInfo{TypeId: typeDateTime2N, Scale: 3}},
+		{ColName: "day", Flags: colFlagNullable, ti: typeInfo{TypeId: typeDateN, Size: 3}},
+		{ColName: "at", Flags: colFlagNullable, ti: typeInfo{TypeId: typeDateTimeN, Size: 8}},
+		{ColName: "data", Flags: colFlagNullable, ti: typeInfo{TypeId: typeBigVarBin, Size: 10}},
+		{ColName: "guid", Flags: colFlagNullable, ti: typeInfo{TypeId: typeGuid, Size: 16}},
+	}
+	created := time.Date(2021, 3, 4, 5, 6, 7, 8000000, time.UTC)
+	rows := [][]driver.Value{
+		{int64(1), int64(-5), "héllo", "café", strings.Repeat("x", 5000), true, 1.5, []byte("12.3400"), []byte("-1234.56"),
+			created, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC), time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), []byte{1, 2},
+			[]byte{0xFF, 0x19, 0x96, 0x6F, 0x86, 0x8B, 0x11, 0xD0, 0xB4, 0x2D, 0x00, 0xC0, 0x4F, 0xC9, 0x64, 0xFF}},
+		{int64(2), nil, nil, "", nil, false, nil, nil, nil, nil, nil, nil, nil, nil},
+	}
+	want := [][]interface{}{
+		{int64(1), int64(-5), "héllo", "café", strings.Repeat("x", 5000), true, 1.5, "12.3400", "-1234.56",
+			created, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC), time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), []byte{1, 2},
+			[]byte{0xFF, 0x19, 0x96, 0x6F, 0x86, 0x8B, 0x11, 0xD0, 0xB4, 0x2D, 0x00, 0xC0, 0x4F, 0xC9, 0x64, 0xFF}},
+		{int64(2), nil, nil, "", nil, false, nil, nil, nil, nil, nil, nil, nil, nil},
+	}
+
+	for _, wide := range []bool{false, true} {
+		var buf bytes.Buffer
+		bw, err := newBCPWriter(&buf, cols, BCPOptions{Wide: wide})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			if err = bw.writeRow(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = bw.w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		// int not null without prefix, bigint with a 1 byte prefix,
+		// nvarchar with a 2 bytes prefix
+		prefix := []byte{1, 0, 0, 0, 8, 0xfb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 10, 0, 'h', 0, 0xe9, 0}
+		if !bytes.HasPrefix(data, prefix) {
+			t.Errorf("wide %v: data starts with % x, want % x", wide, data[:len(prefix)], prefix)
+		}
+		code := []byte{4, 0, 'c', 'a', 'f', 0xe9}
+		if wide {
+			code = []byte{8, 0, 'c', 0, 'a', 0, 'f', 0, 0xe9, 0}
+		}
+		if !bytes.HasPrefix(data[len(prefix)+6:], code) {
+			t.Errorf("wide %v: unexpected varchar field % x", wide, data[len(prefix)+6:len(prefix)+6+len(code)])
+		}
+
+		r := bufio.NewReader(&buf)
+		for i, row := range want {
+			for j, field := range bw.fields {
+				data, null, err := readBCPField(r, field)
+				if err != nil {
+					t.Fatalf("wide %v: row %d, field %d: %v", wide, i, j, err)
+				}
+				var got interface{}
+				if !null {
+					if got, err = decodeBCPValue(field, data, cols[j]); err != nil {
+						t.Fatalf("wide %v: row %d, field %d: %v", wide, i, j, err)
+					}
+				}
+				if !reflect.DeepEqual(got, row[j]) {
+					t.Errorf("wide %v: row %d, column %s: got %T %v, want %T %v", wide, i, cols[j].ColName, got, got, row[j], row[j])
+				}
+			}
+		}
+		if _, _, err = readBCPField(r, bw.fields[0]); err != io.EOF {
+			t.Errorf("wide %v: expected EOF, got %v", wide, err)
+		}
+	}
+
+	bw, err := newBCPWriter(ioutil.Discard, cols, BCPOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bw.writeRow(make([]driver.Value, len(cols))); err == nil {
+		t.Error("NULL in a NOT NULL column should fail")
+	}
+}
+
+func TestReadBCPFieldTerminated(t *testing.T) {
+	input := "abc\t\t1,5\r\n"
+	fields := []BCPField{
+		{Type: "SQLCHAR", Terminator: "\t"},
+		{Type: "SQLCHAR", Terminator: "\t"},
+		{Type: "SQLCHAR", Terminator: "\r\n"},
+	}
+	r := bufio.NewReader(strings.NewReader(input))
+	want := []string{"abc", "", "1,5"}
+	for i, field := range fields {
+		data, null, err := readBCPField(r, field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want[i] || null != (want[i] == "") {
+			t.Errorf("field %d: got %q null %v", i, data, null)
+		}
+	}
+	if _, _, err := readBCPField(r, fields[0]); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	if _, _, err := readBCPField(bufio.NewReader(strings.NewReader("abc")), fields[0]); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+
+	// character fields of other columns are converted
+	v, err := decodeBCPValue(fields[0], []byte(" 42"), columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 4}})
+	if err != nil || v != int64(42) {
+		t.Errorf("got %v, %v", v, err)
+	}
+}
+
+func TestBulkLoadBCP(t *testing.T) {
+	dsn := makeConnStr(t)
+	if strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	tl := testLogger{t: t}
+	defer tl.StopLogging()
+	conn, err := driverWithProcess(t, &tl).open(context.Background(), dsn.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	exec := func(query string) {
+		stmt, err := conn.prepareContext(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stmt.Close()
+		if _, err = stmt.ExecContext(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const columns = "(id int not null, name nvarchar(20), code varchar(10) collate Latin1_General_CI_AS, " +
+		"doc nvarchar(max), amount decimal(18, 2), price money, created datetime2(3), at datetime, " +
+		"t time(2), dto datetimeoffset, data varbinary(max), guid uniqueidentifier, v sql_variant, flag bit)"
+	exec("create table #bcp_src " + columns)
+	exec("create table #bcp_dst " + columns)
+	exec("insert into #bcp_src values " +
+		"(1, N'héllo', 'café', replicate(cast(N'x' as nvarchar(max)), 9000), 123.45, 1.5, '2021-03-04 05:06:07.123', " +
+		"'2021-03-04 05:06:07', '05:06:07.12', '2021-03-04 05:06:07 +02:00', 0x0102, newid(), 42, 1), " +
+		"(2, null, '', null, null, null, null, null, null, null, null, null, null, 0)")
+
+	count := func(query string) int64 {
+		stmt, err := conn.prepareContext(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stmt.Close()
+		rows, err := stmt.QueryContext(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		row := make([]driver.Value, 1)
+		if err = rows.Next(row); err != nil {
+			t.Fatal(err)
+		}
+		return row[0].(int64)
+	}
+
+	for _, wide := range []bool{false, true} {
+		exec("delete from #bcp_dst")
+		var data bytes.Buffer
+		n, format, err := conn.ExportBCP(context.Background(), &data, "select * from #bcp_src order by id", BCPOptions{Wide: wide})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 || len(format.Fields) != 14 {
+			t.Fatalf("exported %d rows with %d fields", n, len(format.Fields))
+		}
+
+		// native file without format file
+		bulk := conn.CreateBulk("#bcp_dst", nil)
+		if n, err = bulk.LoadBCP(bytes.NewReader(data.Bytes()), nil, BCPOptions{Wide: wide}); err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Errorf("loaded %d rows, want 2", n)
+		}
+		diff := "select count(*) from (select * from #bcp_src except select * from #bcp_dst) d"
+		if c := count(diff); c != 0 {
+			t.Errorf("wide %v: %d rows differ", wide, c)
+		}
+
+		// with the format file, into a subset of the columns
+		var formatFile bytes.Buffer
+		if err = format.Write(&formatFile); err != nil {
+			t.Fatal(err)
+		}
+		if format, err = ReadBCPFormat(&formatFile); err != nil {
+			t.Fatal(err)
+		}
+		bulk = conn.CreateBulk("#bcp_dst", []string{"name", "id"})
+		if n, err = bulk.LoadBCP(bytes.NewReader(data.Bytes()), format, BCPOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 || count("select count(*) from #bcp_dst where flag is null and name = N'héllo'") != 1 {
+			t.Errorf("wide %v: rows were not loaded with the format file", wide)
+		}
+	}
+
+	// truncated files abort the bulk copy
+	var data bytes.Buffer
+	if _, _, err = conn.ExportBCP(context.Background(), &data, "select id, name from #bcp_src where id = @p1", BCPOptions{},
+		driver.NamedValue{Ordinal: 1, Value: int64(1)}); err != nil {
+		t.Fatal(err)
+	}
+	exec("delete from #bcp_dst")
+	bulk := conn.CreateBulk("#bcp_dst", []string{"id", "name"})
+	if _, err = bulk.LoadBCP(bytes.NewReader(data.Bytes()[:data.Len()-1]), nil, BCPOptions{}); err == nil {
+		t.Error("expected error for a truncated file")
+	}
+	if c := count("select count(*) from #bcp_dst"); c != 0 {
+		t.Errorf("%d rows were inserted", c)
+	}
+}
@@ -134,6 +134,13 @@ func (w *tdsBuffer) FinishPacket() error {
 	return w.flush()
 }
 
+// AbortPacket ends the message with a last packet marked to be ignored,
+// the server discards the whole message.
+func (w *tdsBuffer) AbortPacket() error {
+	w.wbuf[1] |= 1 | 2 // Mark this as the last packet and ignore the message.
+	return w.flush()
+}
+
 var headerSize = binary.Size(header{})
 
 func (r *tdsBuffer) readNextPacket() error {
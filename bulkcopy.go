@@ -3,14 +3,22 @@ package mssql
 import (
 	"bytes"
 	"context"
+	"database/sql/driver"
+	"encoding"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/denisenkom/go-mssqldb/internal/cp"
 	"github.com/denisenkom/go-mssqldb/internal/decimal"
 	"github.com/denisenkom/go-mssqldb/msdsn"
 )
@@ -28,21 +36,56 @@ type Bulk struct {
 	columnsName []string
 	tablename   string
 	numRows     int
+	// collations maps character column names to their collation names.
+	collations map[string]string
 
 	headerSent bool
-	Options    BulkOptions
-	Debug      bool
+	// aborted is set when the bulk copy was cancelled after an error
+	aborted bool
+	Options BulkOptions
+	Debug   bool
 }
 type BulkOptions struct {
-	CheckConstraints  bool
-	FireTriggers      bool
-	KeepNulls         bool
+	CheckConstraints bool
+	FireTriggers     bool
+	KeepNulls        bool
+	// KeepDefaults has no effect, it is kept for parity with the options
+	// of other bulk copy APIs. Nil values are replaced by the default value
+	// of the column unless KeepNulls is set, which takes precedence.
+	KeepDefaults bool
+	// KeepIdentity inserts the values of identity columns,
+	// otherwise identity columns are skipped and the server assigns
+	// their values.
+	KeepIdentity      bool
 	KilobytesPerBatch int
 	RowsPerBatch      int
 	Order             []string
 	Tablock           bool
 }
 
+// BulkRowError is returned by AddRow when a value can't be converted
+// to the type of its column. The bulk copy is aborted and rows added
+// before are not inserted, the connection remains usable.
+type BulkRowError struct {
+	// Row is the index of the row, starting at zero.
+	Row int
+	// Column is the name of the column.
+	Column string
+	// Value is the value that failed.
+	Value interface{}
+	Err   error
+}
+
+func (e BulkRowError) Error() string {
+	return fmt.Sprintf("bulkcopy: row %d, column %s: %v", e.Row, e.Column, e.Err)
+}
+
+func (e BulkRowError) Unwrap() error {
+	return e.Err
+}
+
+var errBulkAborted = errors.New("bulkcopy: bulk copy was aborted")
+
 type DataValue interface{}
 
 const (
@@ -64,12 +107,19 @@ func (cn *Conn) CreateBulkContext(ctx context.Context, table string, columns []s
 }
 
 func (b *Bulk) sendBulkCommand(ctx context.Context) (err error) {
-	//get table columns info
-	err = b.getMetadata(ctx)
+	tableParts, err := parseObjectName(b.tablename)
 	if err != nil {
 		return err
 	}
 
+	//get table columns info
+	if b.metadata == nil {
+		err = b.getMetadata(ctx, tableParts)
+		if err != nil {
+			return err
+		}
+	}
+
 	//match the columns
 	for _, colname := range b.columnsName {
 		var bulkCol *columnStruct
@@ -86,6 +136,10 @@ func (b *Bulk) sendBulkCommand(ctx context.Context) (err error) {
 				//send udt as binary
 				bulkCol.ti.TypeId = typeBigVarBin
 			}
+			if bulkCol.ti.TypeId == typeXml {
+				//send typed xml as untyped, server validates it against the column schema collection
+				bulkCol.ti.XmlInfo = xmlInfo{}
+			}
 			b.bulkColumns = append(b.bulkColumns, *bulkCol)
 			b.dlogf(ctx, "Adding column %s %s %#x", colname, bulkCol.ColName, bulkCol.ti.TypeId)
 		} else {
@@ -97,11 +151,17 @@ func (b *Bulk) sendBulkCommand(ctx context.Context) (err error) {
 
 	//columns definitions
 	var col_defs bytes.Buffer
-	for i, col := range b.bulkColumns {
-		if i != 0 {
+	for _, col := range b.bulkColumns {
+		if !b.sendColumn(col) {
+			continue
+		}
+		if col_defs.Len() != 0 {
 			col_defs.WriteString(", ")
 		}
-		col_defs.WriteString("[" + col.ColName + "] " + makeDecl(col.ti))
+		col_defs.WriteString(quoteName(col.ColName) + " " + makeDecl(col.ti))
+		if collation, ok := b.collations[col.ColName]; ok {
+			col_defs.WriteString(" COLLATE " + collation)
+		}
 	}
 
 	//options
@@ -133,7 +193,7 @@ func (b *Bulk) sendBulkCommand(ctx context.Context) (err error) {
 		with_part = fmt.Sprintf("WITH (%s)", strings.Join(with_opts, ","))
 	}
 
-	query := fmt.Sprintf("INSERT BULK %s (%s) %s", b.tablename, col_defs.String(), with_part)
+	query := fmt.Sprintf("INSERT BULK %s (%s) %s", quoteObjectName(tableParts), col_defs.String(), with_part)
 
 	stmt, err := b.cn.PrepareContext(ctx, query)
 	if err != nil {
@@ -160,7 +220,13 @@ func (b *Bulk) sendBulkCommand(ctx context.Context) (err error) {
 
 // AddRow immediately writes the row to the destination table.
 // The arguments are the row values in the order they were specified.
+// Values of varchar(max), nvarchar(max), varbinary(max) and xml columns
+// may be an io.Reader, its content is streamed to the server, text is
+// read as UTF-8.
 func (b *Bulk) AddRow(row []interface{}) (err error) {
+	if b.aborted {
+		return errBulkAborted
+	}
 	if !b.headerSent {
 		err = b.sendBulkCommand(b.ctx)
 		if err != nil {
@@ -173,13 +239,20 @@ func (b *Bulk) AddRow(row []interface{}) (err error) {
 			len(row), len(b.bulkColumns))
 	}
 
-	bytes, err := b.makeRowData(row)
-	if err != nil {
-		return
+	if b.hasStreamedValue(row) {
+		// large values are written to the connection as they are read
+		err = b.writeRowData(b.cn.sess.buf, row)
+	} else {
+		var bytes []byte
+		bytes, err = b.makeRowData(row)
+		if err == nil {
+			_, err = b.cn.sess.buf.Write(bytes)
+		}
 	}
-
-	_, err = b.cn.sess.buf.Write(bytes)
 	if err != nil {
+		if abortErr := b.abort(); abortErr != nil {
+			return abortErr
+		}
 		return
 	}
 
@@ -189,35 +262,83 @@ func (b *Bulk) AddRow(row []interface{}) (err error) {
 
 func (b *Bulk) makeRowData(row []interface{}) ([]byte, error) {
 	buf := new(bytes.Buffer)
-	buf.WriteByte(byte(tokenRow))
+	if err := b.writeRowData(buf, row); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hasStreamedValue reports whether the row has an io.Reader value for a
+// PLP column, such values are streamed instead of being read into memory.
+func (b *Bulk) hasStreamedValue(row []interface{}) bool {
+	for i, col := range b.bulkColumns {
+		if _, ok := row[i].(io.Reader); ok && isPLPColumn(col.ti) && b.sendColumn(col) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendColumn reports whether values of the column are sent,
+// identity columns are skipped unless KeepIdentity is set.
+func (b *Bulk) sendColumn(col columnStruct) bool {
+	return col.Flags&colFlagIdentity == 0 || b.Options.KeepIdentity
+}
+
+// abort ends the bulk load message being sent with the ignore flag and
+// cancels the bulk copy, so the connection can be used for other requests.
+func (b *Bulk) abort() error {
+	b.aborted = true
+	return b.cn.abortRequest(b.ctx)
+}
+
+func (b *Bulk) writeRowData(buf io.Writer, row []interface{}) error {
+	if _, err := buf.Write([]byte{byte(tokenRow)}); err != nil {
+		return err
+	}
 
 	var logcol bytes.Buffer
 	for i, col := range b.bulkColumns {
+		if !b.sendColumn(col) {
+			continue
+		}
 
 		if b.Debug {
 			logcol.WriteString(fmt.Sprintf(" col[%d]='%v' ", i, row[i]))
 		}
+		rowErr := func(err error) error {
+			return BulkRowError{Row: b.numRows, Column: col.ColName, Value: row[i], Err: err}
+		}
+		if r, ok := row[i].(io.Reader); ok && isPLPColumn(col.ti) {
+			if err := writePLPReader(buf, r, b.plpEncoder(col)); err != nil {
+				return rowErr(err)
+			}
+			continue
+		}
 		param, err := b.makeParam(row[i], col)
 		if err != nil {
-			return nil, fmt.Errorf("bulkcopy: %s", err.Error())
+			return rowErr(err)
 		}
 
 		if col.ti.Writer == nil {
-			return nil, fmt.Errorf("no writer for column: %s, TypeId: %#x",
+			return fmt.Errorf("no writer for column: %s, TypeId: %#x",
 				col.ColName, col.ti.TypeId)
 		}
 		err = col.ti.Writer(buf, param.ti, param.buffer)
 		if err != nil {
-			return nil, fmt.Errorf("bulkcopy: %s", err.Error())
+			return rowErr(err)
 		}
 	}
 
 	b.dlogf(b.ctx, "row[%d] %s", b.numRows, logcol.String())
 
-	return buf.Bytes(), nil
+	return nil
 }
 
 func (b *Bulk) Done() (rowcount int64, err error) {
+	if b.aborted {
+		return 0, errBulkAborted
+	}
 	if !b.headerSent {
 		//no rows had been sent
 		return 0, nil
@@ -247,10 +368,19 @@ func (b *Bulk) Done() (rowcount int64, err error) {
 
 func (b *Bulk) createColMetadata() []byte {
 	buf := new(bytes.Buffer)
-	buf.WriteByte(byte(tokenColMetadata))                              // token
-	binary.Write(buf, binary.LittleEndian, uint16(len(b.bulkColumns))) // column count
+	var count uint16
+	for _, col := range b.bulkColumns {
+		if b.sendColumn(col) {
+			count++
+		}
+	}
+	buf.WriteByte(byte(tokenColMetadata))         // token
+	binary.Write(buf, binary.LittleEndian, count) // column count
 
 	for i, col := range b.bulkColumns {
+		if !b.sendColumn(col) {
+			continue
+		}
 
 		if b.cn.sess.loginAck.TDSVersion >= verTDS72 {
 			binary.Write(buf, binary.LittleEndian, uint32(col.UserType)) //  usertype, always 0?
@@ -277,47 +407,190 @@ func (b *Bulk) createColMetadata() []byte {
 	return buf.Bytes()
 }
 
-func (b *Bulk) getMetadata(ctx context.Context) (err error) {
-	stmt, err := b.cn.prepareContext(ctx, "SET FMTONLY ON")
+func (b *Bulk) getMetadata(ctx context.Context, tableParts []string) (err error) {
+	table := quoteObjectName(tableParts)
+
+	// Get columns info.
+	stmt, err := b.cn.prepareContext(ctx, "select top 0 * from "+table)
 	if err != nil {
 		return
 	}
-
-	_, err = stmt.ExecContext(ctx, nil)
+	rows, err := stmt.QueryContext(ctx, nil)
 	if err != nil {
+		return fmt.Errorf("get columns info failed: %v", err)
+	}
+	b.metadata = rows.(*Rows).cols
+	if err = rows.Close(); err != nil {
 		return
 	}
 
-	// Get columns info.
-	stmt, err = b.cn.prepareContext(ctx, fmt.Sprintf("select * from %s SET FMTONLY OFF", b.tablename))
+	// Get collation names of character columns, they are part of the
+	// column definitions of the INSERT BULK statement.
+	catalog := ""
+	name := tableParts[len(tableParts)-1]
+	if strings.HasPrefix(name, "#") {
+		catalog = "tempdb."
+		table = "tempdb.." + quoteName(name)
+	} else if len(tableParts) == 3 && tableParts[0] != "" {
+		catalog = quoteName(tableParts[0]) + "."
+	}
+	stmt, err = b.cn.prepareContext(ctx, "select name, collation_name from "+catalog+
+		"sys.columns where object_id = object_id(@p1) and collation_name is not null")
 	if err != nil {
 		return
 	}
-	rows, err := stmt.QueryContext(ctx, nil)
+	rows, err = stmt.QueryContext(ctx, []driver.NamedValue{{Ordinal: 1, Value: table}})
 	if err != nil {
-		return fmt.Errorf("get columns info failed: %v", err)
+		return fmt.Errorf("get columns collation failed: %v", err)
+	}
+	b.collations = make(map[string]string)
+	row := make([]driver.Value, 2)
+	for {
+		if err = rows.Next(row); err != nil {
+			break
+		}
+		colName, _ := row[0].(string)
+		collation, _ := row[1].(string)
+		if isRegularIdentifier(collation) {
+			b.collations[colName] = collation
+		}
+	}
+	if err != io.EOF {
+		rows.Close()
+		return fmt.Errorf("get columns collation failed: %v", err)
 	}
-	b.metadata = rows.(*Rows).cols
 
 	if b.Debug {
 		for _, col := range b.metadata {
-			b.dlogf(ctx, "col: %s typeId: %#x size: %d scale: %d prec: %d flags: %d lcid: %#x",
+			b.dlogf(ctx, "col: %s typeId: %#x size: %d scale: %d prec: %d flags: %d lcid: %#x collation: %s",
 				col.ColName, col.ti.TypeId, col.ti.Size, col.ti.Scale, col.ti.Prec,
-				col.Flags, col.ti.Collation.LcidAndFlags)
+				col.Flags, col.ti.Collation.LcidAndFlags, b.collations[col.ColName])
 		}
 	}
 
 	return rows.Close()
 }
 
+// parseObjectName splits a table name such as db.dbo.[my table] or #temp
+// into its unquoted parts. Parts may be delimited by brackets or double
+// quotes, other parts must be regular identifiers, so the name can't
+// carry anything else into the statements built from it.
+func parseObjectName(name string) ([]string, error) {
+	var parts []string
+	var part strings.Builder
+	quoted := false
+	i := 0
+	for {
+		if i < len(name) && (name[i] == '[' || name[i] == '"') {
+			closing := byte(']')
+			if name[i] == '"' {
+				closing = '"'
+			}
+			i++
+			for {
+				j := strings.IndexByte(name[i:], closing)
+				if j < 0 {
+					return nil, fmt.Errorf("mssql: invalid table name %q: missing %c", name, closing)
+				}
+				part.WriteString(name[i : i+j])
+				i += j + 1
+				if i < len(name) && name[i] == closing {
+					// escaped delimiter
+					part.WriteByte(closing)
+					i++
+					continue
+				}
+				break
+			}
+			quoted = true
+		} else {
+			j := strings.IndexByte(name[i:], '.')
+			if j < 0 {
+				j = len(name) - i
+			}
+			part.WriteString(name[i : i+j])
+			i += j
+		}
+		p := part.String()
+		if !quoted && p != "" && !isRegularIdentifier(p) {
+			return nil, fmt.Errorf("mssql: invalid table name %q", name)
+		}
+		parts = append(parts, p)
+		part.Reset()
+		quoted = false
+		if i == len(name) {
+			break
+		}
+		if name[i] != '.' {
+			return nil, fmt.Errorf("mssql: invalid table name %q", name)
+		}
+		i++
+	}
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("mssql: invalid table name %q: too many parts", name)
+	}
+	for i, p := range parts {
+		// only the schema of a three part name may be omitted
+		if p == "" && !(len(parts) == 3 && i == 1) {
+			return nil, fmt.Errorf("mssql: invalid table name %q", name)
+		}
+	}
+	return parts, nil
+}
+
+// quoteObjectName joins the parts of a name made by parseObjectName,
+// empty parts are kept to select the default schema.
+func quoteObjectName(parts []string) string {
+	quoted := make([]string, len(parts))
+	for i, p := range parts {
+		if p != "" {
+			quoted[i] = quoteName(p)
+		}
+	}
+	return strings.Join(quoted, ".")
+}
+
+// isRegularIdentifier reports whether s follows the rules of regular
+// identifiers, which don't need to be quoted.
+func isRegularIdentifier(s string) bool {
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r), r == '_', r == '@', r == '#':
+		case i > 0 && (unicode.IsDigit(r) || r == '$'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
 func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error) {
 	res.ti.Size = col.ti.Size
 	res.ti.TypeId = col.ti.TypeId
 
+	if valuer, ok := val.(driver.Valuer); ok {
+		if val, err = valuer.Value(); err != nil {
+			return
+		}
+	}
 	if val == nil {
 		res.ti.Size = 0
 		return
 	}
+	if r, ok := val.(io.Reader); ok {
+		// values of PLP columns are streamed by writeRowData,
+		// others are read into memory
+		var data []byte
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return
+		}
+		switch col.ti.TypeId {
+		case typeBigVarBin, typeBigBinary, typeImage, typeGuid, typeUdt:
+			val = data
+		default:
+			val = string(data)
+		}
+	}
 
 	switch col.ti.TypeId {
 
@@ -383,6 +656,10 @@ func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error)
 			res.buffer = []byte(strconv.FormatInt(val, 10))
 		case []byte:
 			res.buffer = val
+		case Vector:
+			if !val.IsNull() {
+				res.buffer = str2ucs2(val.String())
+			}
 		default:
 			err = fmt.Errorf("mssql: invalid type for nvarchar column: %T %s", val, val)
 			return
@@ -392,11 +669,15 @@ func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error)
 	case typeVarChar, typeBigVarChar, typeText, typeChar, typeBigChar:
 		switch val := val.(type) {
 		case string:
-			res.buffer = []byte(val)
+			res.buffer = cp.UTF8ToCharset(col.ti.Collation, val)
 		case []byte:
 			res.buffer = val
 		case int64:
 			res.buffer = []byte(strconv.FormatInt(val, 10))
+		case Vector:
+			if !val.IsNull() {
+				res.buffer = cp.UTF8ToCharset(col.ti.Collation, val.String())
+			}
 		default:
 			err = fmt.Errorf("mssql: invalid type for varchar column: %T %s", val, val)
 			return
@@ -501,7 +782,28 @@ func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error)
 			err = fmt.Errorf("mssql: invalid type for time column: %T %s", val, val)
 			return
 		}
-	// case typeMoney, typeMoney4, typeMoneyN:
+	case typeMoney, typeMoney4, typeMoneyN:
+		var money int64
+		if money, err = moneyValue(val); err != nil {
+			return
+		}
+		switch col.ti.Size {
+		case 4:
+			if money < math.MinInt32 || money > math.MaxInt32 {
+				err = fmt.Errorf("mssql: value %v is out of range for smallmoney column", val)
+				return
+			}
+			res.buffer = make([]byte, 4)
+			binary.LittleEndian.PutUint32(res.buffer, uint32(money))
+		case 8:
+			res.buffer = make([]byte, 8)
+			binary.LittleEndian.PutUint32(res.buffer, uint32(uint64(money)>>32))
+			binary.LittleEndian.PutUint32(res.buffer[4:], uint32(money))
+		default:
+			err = fmt.Errorf("mssql: invalid size of money column %d", col.ti.Size)
+			return
+		}
+		res.ti.Size = len(res.buffer)
 	case typeDecimal, typeDecimalN, typeNumeric, typeNumericN:
 		prec := col.ti.Prec
 		scale := col.ti.Scale
@@ -565,11 +867,17 @@ func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error)
 			buf[i] = ub[j]
 		}
 		res.buffer = buf
-	case typeBigVarBin, typeBigBinary:
+	case typeBigVarBin, typeBigBinary, typeImage, typeUdt:
 		switch val := val.(type) {
 		case []byte:
 			res.ti.Size = len(val)
 			res.buffer = val
+		case encoding.BinaryMarshaler:
+			// native serialization of CLR types
+			if res.buffer, err = val.MarshalBinary(); err != nil {
+				return
+			}
+			res.ti.Size = len(res.buffer)
 		default:
 			err = fmt.Errorf("mssql: invalid type for Binary column: %T %s", val, val)
 			return
@@ -583,6 +891,53 @@ func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error)
 			err = fmt.Errorf("mssql: invalid type for Guid column: %T %s", val, val)
 			return
 		}
+	case typeXml:
+		switch val := val.(type) {
+		case string:
+			res.buffer = str2ucs2(val)
+		case []byte:
+			res.buffer = str2ucs2(string(val))
+		case XML:
+			res.buffer = str2ucs2(val.Value)
+		default:
+			err = fmt.Errorf("mssql: invalid type for xml column: %T %s", val, val)
+			return
+		}
+		res.ti.Size = len(res.buffer)
+	case typeVariant:
+		if res.buffer, err = encodeVariant(val, b.collation()); err != nil {
+			return
+		}
+		res.ti.Size = len(res.buffer)
+	case typeVector:
+		var v Vector
+		switch val := val.(type) {
+		case Vector:
+			v = val
+		case []float32:
+			v = NewVector(val)
+		case string:
+			if err = v.Scan(val); err != nil {
+				return
+			}
+		default:
+			err = fmt.Errorf("mssql: invalid type for vector column: %T %s", val, val)
+			return
+		}
+		if v.IsNull() {
+			res.ti.Size = 0
+			return
+		}
+		if v.Dimensions == 0 {
+			v.Dimensions = len(v.Values)
+		}
+		if v.Dimensions != vectorDimensions(col.ti.Size) {
+			err = fmt.Errorf("mssql: vector with %d dimensions does not fit column %s", v.Dimensions, makeDecl(col.ti))
+			return
+		}
+		res.ti.Scale = col.ti.Scale
+		res.buffer, err = encodeVector(v)
+		res.ti.Size = len(res.buffer)
 
 	default:
 		err = fmt.Errorf("mssql: type %x not implemented", col.ti.TypeId)
@@ -591,6 +946,200 @@ func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error)
 
 }
 
+// collation returns the collation of string values in sql_variant columns.
+func (b *Bulk) collation() cp.Collation {
+	if b.cn == nil || b.cn.sess == nil {
+		return cp.Collation{}
+	}
+	return b.cn.sess.collation
+}
+
+// moneyValue converts val to a money amount in units of 1/10000.
+func moneyValue(val DataValue) (int64, error) {
+	switch val := val.(type) {
+	case int:
+		return moneyValue(int64(val))
+	case int32:
+		return int64(val) * 10000, nil
+	case int64:
+		if val > math.MaxInt64/10000 || val < math.MinInt64/10000 {
+			return 0, fmt.Errorf("mssql: value %d is out of range for money column", val)
+		}
+		return val * 10000, nil
+	case float32:
+		return moneyFloat(float64(val))
+	case float64:
+		return moneyFloat(val)
+	case string:
+		dec, err := decimal.StringToDecimalScale(val, 4)
+		if err != nil {
+			return 0, err
+		}
+		i := dec.BigInt()
+		if !i.IsInt64() {
+			return 0, fmt.Errorf("mssql: value %s is out of range for money column", val)
+		}
+		return i.Int64(), nil
+	}
+	return 0, fmt.Errorf("mssql: invalid type for money column: %T %v", val, val)
+}
+
+func moneyFloat(f float64) (int64, error) {
+	f = math.Round(f * 10000)
+	if math.IsNaN(f) || f >= math.MaxInt64 || f < math.MinInt64 {
+		return 0, fmt.Errorf("mssql: value %v is out of range for money column", f/10000)
+	}
+	return int64(f), nil
+}
+
+// encodeVariant encodes val as a sql_variant value: base type,
+// number of property bytes, properties and data.
+// https://msdn.microsoft.com/en-us/library/dd303302.aspx
+func encodeVariant(val DataValue, col cp.Collation) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	header := func(typeId uint8, props ...byte) {
+		buf.WriteByte(typeId)
+		buf.WriteByte(byte(len(props)))
+		buf.Write(props)
+	}
+	switch val := val.(type) {
+	case bool:
+		header(typeBit)
+		if val {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case uint8:
+		header(typeInt1)
+		buf.WriteByte(val)
+	case int16:
+		header(typeInt2)
+		binary.Write(buf, binary.LittleEndian, val)
+	case int32:
+		header(typeInt4)
+		binary.Write(buf, binary.LittleEndian, val)
+	case int:
+		header(typeInt8)
+		binary.Write(buf, binary.LittleEndian, int64(val))
+	case int64:
+		header(typeInt8)
+		binary.Write(buf, binary.LittleEndian, val)
+	case float32:
+		header(typeFlt4)
+		binary.Write(buf, binary.LittleEndian, math.Float32bits(val))
+	case float64:
+		header(typeFlt8)
+		binary.Write(buf, binary.LittleEndian, math.Float64bits(val))
+	case string:
+		data := str2ucs2(val)
+		if len(data) > 8000 {
+			return nil, fmt.Errorf("mssql: string of %d bytes is too long for sql_variant column", len(data))
+		}
+		props := new(bytes.Buffer)
+		writeCollation(props, col)
+		binary.Write(props, binary.LittleEndian, uint16(len(data)))
+		header(typeNVarChar, props.Bytes()...)
+		buf.Write(data)
+	case []byte:
+		if len(val) > 8000 {
+			return nil, fmt.Errorf("mssql: binary value of %d bytes is too long for sql_variant column", len(val))
+		}
+		header(typeBigVarBin, byte(len(val)), byte(len(val)>>8))
+		buf.Write(val)
+	case time.Time:
+		header(typeDateTimeOffsetN, 7)
+		buf.Write(encodeDateTimeOffset(val, 7))
+	default:
+		return nil, fmt.Errorf("mssql: invalid type for sql_variant column: %T %v", val, val)
+	}
+	return buf.Bytes(), nil
+}
+
+// isPLPColumn reports whether values of the column are sent as PLP.
+func isPLPColumn(ti typeInfo) bool {
+	switch ti.TypeId {
+	case typeXml:
+		return true
+	case typeBigVarBin, typeBigVarChar, typeNVarChar:
+		return ti.Size == 0 || ti.Size > 8000
+	}
+	return false
+}
+
+// plpEncoder returns the function encoding UTF-8 text streamed into a
+// character column, nil for binary columns.
+func (b *Bulk) plpEncoder(col columnStruct) func(string) []byte {
+	switch col.ti.TypeId {
+	case typeNVarChar, typeXml:
+		return str2ucs2
+	case typeBigVarChar:
+		return func(s string) []byte {
+			return cp.UTF8ToCharset(col.ti.Collation, s)
+		}
+	}
+	return nil
+}
+
+// plpChunkSize is the size of chunks written by writePLPReader.
+const plpChunkSize = 8000
+
+// writePLPReader streams the content of r as PLP chunks.
+// If encode is not nil the content is UTF-8 text and each chunk
+// is encoded without splitting characters.
+func writePLPReader(w io.Writer, r io.Reader, encode func(string) []byte) error {
+	if err := binary.Write(w, binary.LittleEndian, uint64(_UNKNOWN_PLP_LEN)); err != nil {
+		return err
+	}
+	chunk := make([]byte, plpChunkSize)
+	pending := 0
+	for {
+		n, rerr := r.Read(chunk[pending:])
+		n += pending
+		pending = 0
+		data := chunk[:n]
+		if encode != nil && rerr == nil {
+			// keep an incomplete character for the next read
+			pending = incompleteRuneLen(data)
+			data = data[:n-pending]
+		}
+		if len(data) > 0 {
+			out := data
+			if encode != nil {
+				out = encode(string(data))
+			}
+			if err := binary.Write(w, binary.LittleEndian, uint32(len(out))); err != nil {
+				return err
+			}
+			if _, err := w.Write(out); err != nil {
+				return err
+			}
+		}
+		copy(chunk, chunk[n-pending:n])
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+	return binary.Write(w, binary.LittleEndian, uint32(_PLP_TERMINATOR))
+}
+
+// incompleteRuneLen returns the length of an incomplete UTF-8
+// sequence at the end of buf.
+func incompleteRuneLen(buf []byte) int {
+	for i := 1; i <= utf8.UTFMax-1 && i <= len(buf); i++ {
+		if utf8.RuneStart(buf[len(buf)-i]) {
+			if utf8.FullRune(buf[len(buf)-i:]) {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
+
 func (b *Bulk) dlogf(ctx context.Context, format string, v ...interface{}) {
 	if b.Debug {
 		b.cn.sess.logger.Log(ctx, msdsn.LogDebug, fmt.Sprintf(format, v...))
@@ -0,0 +1,345 @@
+package mssql
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVOptions configure Bulk.LoadCSV.
+type CSVOptions struct {
+	// Comma is the field delimiter, defaults to ','. Use '\t' for TSV.
+	Comma rune
+	// Quote is the character quoting fields, defaults to '"'.
+	// Quotes in quoted fields are escaped by doubling them.
+	// Set NoQuote to read fields verbatim.
+	Quote   rune
+	NoQuote bool
+	// Header is set when the first record holds column names. If the
+	// bulk has no columns the header names are used, otherwise fields
+	// are matched to the bulk columns by name.
+	Header bool
+	// NullValues are the field values loaded as NULL,
+	// if nil empty fields are NULL.
+	NullValues []string
+	// TimeFormats are the layouts, as used by time.Parse, tried in order
+	// for date and time columns. Values without time zone are in UTC.
+	// Defaults to RFC 3339 and the SQL Server formats.
+	TimeFormats []string
+	// TrimSpace removes leading and trailing white space of fields.
+	TrimSpace bool
+	// MaxErrors is the number of rejected rows tolerated before the load
+	// fails, rejected rows are skipped. A negative value tolerates any
+	// number of rejected rows.
+	MaxErrors int
+}
+
+var defaultCSVTimeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+	"15:04:05.999999999",
+}
+
+// CSVRowError reports a row rejected by Bulk.LoadCSV.
+type CSVRowError struct {
+	// Line is the line of the record, starting at 1.
+	Line int
+	// Column is the name of the column, empty for errors of the
+	// whole record.
+	Column string
+	Err    error
+}
+
+func (e CSVRowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("csv: line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("csv: line %d, column %s: %v", e.Line, e.Column, e.Err)
+}
+
+func (e CSVRowError) Unwrap() error {
+	return e.Err
+}
+
+// CSVResult is the result of Bulk.LoadCSV.
+type CSVResult struct {
+	// RowCount is the number of rows inserted.
+	RowCount int64
+	// Rejected are the rows skipped because their values could not be
+	// converted to the column types.
+	Rejected []CSVRowError
+}
+
+// LoadCSV reads CSV records from r and loads them, converting fields to the
+// types of the destination columns, then completes the bulk copy like Done.
+//
+// When more rows than opts.MaxErrors are rejected, or r can't be parsed,
+// the bulk copy is aborted and no rows are inserted.
+func (b *Bulk) LoadCSV(r io.Reader, opts CSVOptions) (res CSVResult, err error) {
+	if b.headerSent {
+		return res, errors.New("csv: rows were already added to the bulk copy")
+	}
+	cr := newCSVReader(r, opts)
+
+	var header []string
+	if opts.Header {
+		if header, _, err = cr.readRecord(); err != nil {
+			if err == io.EOF {
+				err = errors.New("csv: missing header")
+			}
+			return
+		}
+		if len(b.columnsName) == 0 {
+			b.columnsName = header
+		}
+	}
+	if len(b.columnsName) == 0 {
+		return res, errors.New("csv: no columns, set the bulk columns or use a header")
+	}
+	fields := make([]int, len(b.columnsName))
+	for i, name := range b.columnsName {
+		fields[i] = i
+		if header != nil {
+			fields[i] = -1
+			for j, h := range header {
+				if h == name {
+					fields[i] = j
+					break
+				}
+			}
+			if fields[i] < 0 {
+				return res, fmt.Errorf("csv: column %s is not in the header", name)
+			}
+		}
+	}
+
+	if err = b.sendBulkCommand(b.ctx); err != nil {
+		return
+	}
+
+	conv := csvConverter{opts: opts}
+	row := make([]interface{}, len(b.bulkColumns))
+	for {
+		record, line, rerr := cr.readRecord()
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return res, b.abortCSV(CSVRowError{Line: line, Err: rerr})
+		}
+
+		data, rowErr := func() ([]byte, *CSVRowError) {
+			for i, col := range b.bulkColumns {
+				if fields[i] >= len(record) {
+					return nil, &CSVRowError{Line: line, Err: fmt.Errorf("record has %d fields", len(record))}
+				}
+				v, err := conv.convert(record[fields[i]], col)
+				if err != nil {
+					return nil, &CSVRowError{Line: line, Column: col.ColName, Err: err}
+				}
+				row[i] = v
+			}
+			data, err := b.makeRowData(row)
+			if err != nil {
+				var bulkErr BulkRowError
+				if errors.As(err, &bulkErr) {
+					return nil, &CSVRowError{Line: line, Column: bulkErr.Column, Err: bulkErr.Err}
+				}
+				return nil, &CSVRowError{Line: line, Err: err}
+			}
+			return data, nil
+		}()
+		if rowErr != nil {
+			res.Rejected = append(res.Rejected, *rowErr)
+			if opts.MaxErrors >= 0 && len(res.Rejected) > opts.MaxErrors {
+				return res, b.abortCSV(*rowErr)
+			}
+			continue
+		}
+		// a failed write is a connection error, not a rejected row
+		if _, err = b.cn.sess.buf.Write(data); err != nil {
+			b.aborted = true
+			return res, b.cn.checkBadConn(b.ctx, err, false)
+		}
+		b.numRows++
+	}
+	res.RowCount, err = b.Done()
+	return
+}
+
+// abortCSV aborts the bulk copy after err.
+func (b *Bulk) abortCSV(err error) error {
+	if abortErr := b.abort(); abortErr != nil {
+		return abortErr
+	}
+	return err
+}
+
+type csvConverter struct {
+	opts CSVOptions
+}
+
+// convert converts field to a value accepted by Bulk.makeParam for col.
+func (c csvConverter) convert(field string, col columnStruct) (interface{}, error) {
+	if c.opts.TrimSpace {
+		field = strings.TrimSpace(field)
+	}
+	if c.opts.NullValues == nil {
+		if field == "" {
+			return nil, nil
+		}
+	} else {
+		for _, null := range c.opts.NullValues {
+			if field == null {
+				return nil, nil
+			}
+		}
+	}
+
+	switch col.ti.TypeId {
+	case typeInt1, typeInt2, typeInt4, typeInt8, typeIntN:
+		return strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+	case typeFlt4, typeFlt8, typeFltN:
+		return strconv.ParseFloat(strings.TrimSpace(field), 64)
+	case typeBit, typeBitN:
+		return strconv.ParseBool(strings.TrimSpace(field))
+	case typeDecimal, typeDecimalN, typeNumeric, typeNumericN,
+		typeMoney, typeMoney4, typeMoneyN:
+		return strings.TrimSpace(field), nil
+	case typeDateTime, typeDateTimeN, typeDateTim4, typeDateTime2N,
+		typeDateTimeOffsetN, typeDateN, typeTimeN:
+		return c.parseTime(strings.TrimSpace(field))
+	case typeBigVarBin, typeBigBinary, typeImage:
+		field = strings.TrimSpace(field)
+		if strings.HasPrefix(field, "0x") || strings.HasPrefix(field, "0X") {
+			field = field[2:]
+		}
+		return hex.DecodeString(field)
+	case typeGuid:
+		var u UniqueIdentifier
+		if err := u.Scan(strings.Trim(strings.TrimSpace(field), "{}")); err != nil {
+			return nil, err
+		}
+		return u.Value()
+	}
+	return field, nil
+}
+
+func (c csvConverter) parseTime(s string) (time.Time, error) {
+	formats := c.opts.TimeFormats
+	if formats == nil {
+		formats = defaultCSVTimeFormats
+	}
+	for _, layout := range formats {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date or time %q", s)
+}
+
+// csvReader reads records, keeping track of line numbers.
+type csvReader struct {
+	r     *bufio.Reader
+	comma rune
+	quote rune
+	line  int
+}
+
+func newCSVReader(r io.Reader, opts CSVOptions) *csvReader {
+	cr := &csvReader{r: bufio.NewReader(r), comma: opts.Comma, quote: opts.Quote}
+	if cr.comma == 0 {
+		cr.comma = ','
+	}
+	if cr.quote == 0 {
+		cr.quote = '"'
+	}
+	if opts.NoQuote {
+		cr.quote = -1
+	}
+	return cr
+}
+
+// readLine reads a line without its line ending.
+func (cr *csvReader) readLine() (string, error) {
+	line, err := cr.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	cr.line++
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// readRecord returns the fields of the next record and the line it starts on.
+// Empty lines are skipped.
+func (cr *csvReader) readRecord() (fields []string, start int, err error) {
+	var line string
+	for line == "" {
+		if line, err = cr.readLine(); err != nil {
+			return nil, cr.line + 1, err
+		}
+	}
+	start = cr.line
+
+	var field strings.Builder
+	for {
+		if cr.quote < 0 || !strings.HasPrefix(line, string(cr.quote)) {
+			// unquoted field
+			i := strings.IndexRune(line, cr.comma)
+			if i < 0 {
+				return append(fields, line), start, nil
+			}
+			fields = append(fields, line[:i])
+			line = line[i+len(string(cr.comma)):]
+			continue
+		}
+
+		// quoted field, it may span several lines
+		line = line[len(string(cr.quote)):]
+		field.Reset()
+		for {
+			i := strings.IndexRune(line, cr.quote)
+			if i < 0 {
+				field.WriteString(line)
+				field.WriteByte('\n')
+				if line, err = cr.readLine(); err != nil {
+					if err == io.EOF {
+						err = errors.New("quoted field is not terminated")
+					}
+					return nil, start, err
+				}
+				continue
+			}
+			field.WriteString(line[:i])
+			line = line[i+len(string(cr.quote)):]
+			if strings.HasPrefix(line, string(cr.quote)) {
+				// escaped quote
+				field.WriteRune(cr.quote)
+				line = line[len(string(cr.quote)):]
+				continue
+			}
+			break
+		}
+		fields = append(fields, field.String())
+		if line == "" {
+			return fields, start, nil
+		}
+		if !strings.HasPrefix(line, string(cr.comma)) {
+			return nil, start, fmt.Errorf("unexpected %q after quoted field", line[0])
+		}
+		line = line[len(string(cr.comma)):]
+	}
+}
@@ -0,0 +1,189 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readCSVRecords(t *testing.T, input string, opts CSVOptions) ([][]string, []int, error) {
+	t.Helper()
+	cr := newCSVReader(strings.NewReader(input), opts)
+	var records [][]string
+	var lines []int
+	for {
+		record, line, err := cr.readRecord()
+		if err == io.EOF {
+			return records, lines, nil
+		}
+		if err != nil {
+			return records, append(lines, line), err
+		}
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	tests := []struct {
+		input   string
+		opts    CSVOptions
+		records [][]string
+		lines   []int
+	}{
+		{"a,b,c\n1,2,3\n", CSVOptions{}, [][]string{{"a", "b", "c"}, {"1", "2", "3"}}, []int{1, 2}},
+		{"a,b,\r\n,,\r\n", CSVOptions{}, [][]string{{"a", "b", ""}, {"", "", ""}}, []int{1, 2}},
+		{"1,\"x, \"\"y\"\"\"\n2,z", CSVOptions{}, [][]string{{"1", `x, "y"`}, {"2", "z"}}, []int{1, 2}},
+		{"1,\"multi\nline\"\n\n2,\"\"\n", CSVOptions{}, [][]string{{"1", "multi\nline"}, {"2", ""}}, []int{1, 4}},
+		{"a\t\"b\"\tc", CSVOptions{Comma: '\t', NoQuote: true}, [][]string{{"a", `"b"`, "c"}}, []int{1}},
+		{"a;'b;c'", CSVOptions{Comma: ';', Quote: '\''}, [][]string{{"a", "b;c"}}, []int{1}},
+		{"a|b☀c", CSVOptions{Comma: '☀'}, [][]string{{"a|b", "c"}}, []int{1}},
+	}
+	for _, tt := range tests {
+		records, lines, err := readCSVRecords(t, tt.input, tt.opts)
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(records, tt.records) || !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("%q: got %q at lines %v, want %q at lines %v", tt.input, records, lines, tt.records, tt.lines)
+		}
+	}
+
+	for _, input := range []string{"a\n\"b", "a\n\"b\"c"} {
+		_, lines, err := readCSVRecords(t, input, CSVOptions{})
+		if err == nil {
+			t.Errorf("%q: expected error", input)
+		} else if lines[len(lines)-1] != 2 {
+			t.Errorf("%q: error reported at line %d", input, lines[len(lines)-1])
+		}
+	}
+}
+
+func TestCSVConvert(t *testing.T) {
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 800000000, time.UTC)
+	tests := []struct {
+		field    string
+		ti       typeInfo
+		opts     CSVOptions
+		expected interface{}
+	}{
+		{"", typeInfo{TypeId: typeIntN, Size: 4}, CSVOptions{}, nil},
+		{" 42 ", typeInfo{TypeId: typeIntN, Size: 4}, CSVOptions{}, int64(42)},
+		{"NULL", typeInfo{TypeId: typeIntN, Size: 4}, CSVOptions{NullValues: []string{"NULL"}}, nil},
+		{"", typeInfo{TypeId: typeNVarChar, Size: 20}, CSVOptions{NullValues: []string{`\N`}}, ""},
+		{"1.5", typeInfo{TypeId: typeFltN, Size: 8}, CSVOptions{}, 1.5},
+		{"true", typeInfo{TypeId: typeBitN, Size: 1}, CSVOptions{}, true},
+		{"0", typeInfo{TypeId: typeBitN, Size: 1}, CSVOptions{}, false},
+		{"12.34", typeInfo{TypeId: typeMoneyN, Size: 8}, CSVOptions{}, "12.34"},
+		{"0x0102", typeInfo{TypeId: typeBigVarBin, Size: 10}, CSVOptions{}, []byte{1, 2}},
+		{"2021-03-04 05:06:07.8", typeInfo{TypeId: typeDateTime2N, Scale: 7}, CSVOptions{}, tm},
+		{"2021-03-04T05:06:07.8Z", typeInfo{TypeId: typeDateTimeOffsetN, Scale: 7}, CSVOptions{}, tm},
+		{"04/03/2021", typeInfo{TypeId: typeDateN}, CSVOptions{TimeFormats: []string{"02/01/2006"}}, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{" x ", typeInfo{TypeId: typeNVarChar, Size: 20}, CSVOptions{TrimSpace: true}, "x"},
+		{"{6F9619FF-8B86-D011-B42D-00C04FC964FF}", typeInfo{TypeId: typeGuid, Size: 16}, CSVOptions{},
+			[]byte{0xFF, 0x19, 0x96, 0x6F, 0x86, 0x8B, 0x11, 0xD0, 0xB4, 0x2D, 0x00, 0xC0, 0x4F, 0xC9, 0x64, 0xFF}},
+	}
+	for _, tt := range tests {
+		got, err := csvConverter{opts: tt.opts}.convert(tt.field, columnStruct{ti: tt.ti})
+		if err != nil {
+			t.Errorf("convert(%q) failed: %v", tt.field, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("convert(%q) = %T %v, want %T %v", tt.field, got, got, tt.expected, tt.expected)
+		}
+	}
+
+	for _, tt := range []struct {
+		field string
+		ti    typeInfo
+	}{
+		{"x", typeInfo{TypeId: typeIntN, Size: 4}},
+		{"1,5", typeInfo{TypeId: typeFltN, Size: 8}},
+		{"2021-13-01", typeInfo{TypeId: typeDateN}},
+		{"0xZZ", typeInfo{TypeId: typeBigVarBin, Size: 10}},
+		{"maybe", typeInfo{TypeId: typeBitN, Size: 1}},
+	} {
+		if _, err := (csvConverter{}).convert(tt.field, columnStruct{ti: tt.ti}); err == nil {
+			t.Errorf("convert(%q) to %s should fail", tt.field, makeDecl(tt.ti))
+		}
+	}
+}
+
+func TestBulkLoadCSV(t *testing.T) {
+	dsn := makeConnStr(t)
+	if strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	tl := testLogger{t: t}
+	defer tl.StopLogging()
+	conn, err := driverWithProcess(t, &tl).open(context.Background(), dsn.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	exec := func(query string) {
+		stmt, err := conn.prepareContext(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stmt.Close()
+		if _, err = stmt.ExecContext(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec("create table #csv (id int, name nvarchar(20), amount money, created datetime2, flag bit)")
+
+	input := "name,id,amount,created,flag,extra\n" +
+		"a,1,1.5,2021-03-04 05:06:07,true,x\n" +
+		"\"b, \"\"quoted\"\"\",2,,2021-03-04,false,x\n" +
+		"c,three,1,2021-03-04,true,x\n" +
+		"d,4,1,not a date,true,x\n" +
+		"e,5,2.25,2021-03-04,1,x\n"
+	// fields are matched by name, extra fields are ignored
+	bulk := conn.CreateBulk("#csv", []string{"id", "name", "amount", "created", "flag"})
+	res, err := bulk.LoadCSV(strings.NewReader(input), CSVOptions{Header: true, MaxErrors: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RowCount != 3 {
+		t.Errorf("inserted %d rows, want 3", res.RowCount)
+	}
+	if len(res.Rejected) != 2 || res.Rejected[0].Line != 4 || res.Rejected[0].Column != "id" ||
+		res.Rejected[1].Line != 5 || res.Rejected[1].Column != "created" {
+		t.Errorf("unexpected rejected rows %v", res.Rejected)
+	}
+
+	// too many errors abort the load, the connection remains usable
+	bulk = conn.CreateBulk("#csv", []string{"id", "name"})
+	_, err = bulk.LoadCSV(strings.NewReader("6,f\nx,g\n"), CSVOptions{})
+	var csvErr CSVRowError
+	if !errors.As(err, &csvErr) || csvErr.Line != 2 {
+		t.Errorf("expected error at line 2, got %v", err)
+	}
+
+	stmt, err := conn.prepareContext(context.Background(), "select count(*), sum(amount) from #csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	row := make([]driver.Value, 2)
+	if err = rows.Next(row); err != nil {
+		t.Fatal(err)
+	}
+	if row[0] != int64(3) || string(row[1].([]byte)) != "3.7500" {
+		t.Errorf("unexpected table content %v", row)
+	}
+}
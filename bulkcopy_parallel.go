@@ -0,0 +1,197 @@
+// +build go1.10
+
+package mssql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// BulkRowSource is a source of rows for BulkCopyParallel.
+type BulkRowSource interface {
+	// Next returns the next row, or io.EOF when there are no more rows.
+	// The row is used after the next call, so a new slice must be
+	// returned for every row.
+	Next() ([]interface{}, error)
+}
+
+// ParallelBulkOptions are the options of BulkCopyParallel.
+type ParallelBulkOptions struct {
+	// BulkOptions are used by every bulk copy stream. Concurrent streams
+	// into a heap should set Tablock, which takes bulk update locks that
+	// don't block each other, and not set Order.
+	BulkOptions
+
+	// Connections is the number of connections loading rows
+	// concurrently, defaults to 4.
+	Connections int
+
+	// Key partitions the rows, rows with the same key are sent over the
+	// same connection. If nil rows are distributed round-robin.
+	Key func(row []interface{}) uint64
+
+	// BufferedRows is the number of rows queued for each connection,
+	// defaults to 1000.
+	BufferedRows int
+}
+
+const (
+	defaultBulkConnections  = 4
+	defaultBulkBufferedRows = 1000
+)
+
+// ParallelBulkError is returned by BulkCopyParallel when loading fails,
+// it holds the error of every failed stream.
+type ParallelBulkError struct {
+	Errors []error
+}
+
+func (e ParallelBulkError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "bulkcopy: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the first error.
+func (e ParallelBulkError) Unwrap() error {
+	return e.Errors[0]
+}
+
+type indexedRow struct {
+	index int
+	row   []interface{}
+}
+
+// BulkCopyParallel loads the rows of src into table over several
+// connections opened from c, each running its own bulk copy.
+// The row index of a BulkRowError is the index of the row in src.
+//
+// When a stream fails or ctx is cancelled, the other streams are
+// cancelled and their rows are not inserted. Rows of streams which
+// already completed remain, their count is returned with the error.
+func BulkCopyParallel(ctx context.Context, c *Connector, table string, columns []string, src BulkRowSource, opts ParallelBulkOptions) (rowCount int64, err error) {
+	n := opts.Connections
+	if n <= 0 {
+		n = defaultBulkConnections
+	}
+	buffered := opts.BufferedRows
+	if buffered <= 0 {
+		buffered = defaultBulkBufferedRows
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var errs []error
+	fail := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+		cancel()
+	}
+
+	var wg sync.WaitGroup
+	streams := make([]chan indexedRow, n)
+	for i := range streams {
+		streams[i] = make(chan indexedRow, buffered)
+		wg.Add(1)
+		go func(rows <-chan indexedRow) {
+			defer wg.Done()
+			count, err := bulkCopyStream(ctx, c, table, columns, opts.BulkOptions, rows)
+			if err != nil {
+				fail(err)
+				return
+			}
+			mu.Lock()
+			rowCount += count
+			mu.Unlock()
+		}(streams[i])
+	}
+
+	var next uint64
+feed:
+	for index := 0; ; index++ {
+		row, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fail(err)
+			break
+		}
+		var i uint64
+		if opts.Key != nil {
+			i = opts.Key(row) % uint64(n)
+		} else {
+			i = next % uint64(n)
+			next++
+		}
+		select {
+		case streams[i] <- indexedRow{index: index, row: row}:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	for _, s := range streams {
+		close(s)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return rowCount, nil
+	}
+	// streams cancelled because another one failed only add noise
+	var failed []error
+	for _, err := range errs {
+		if err != context.Canceled {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == 0 {
+		failed = errs[:1]
+	}
+	return rowCount, ParallelBulkError{Errors: failed}
+}
+
+// bulkCopyStream loads rows over a new connection. On cancellation the
+// connection is closed, so the server discards the unfinished bulk copy.
+func bulkCopyStream(ctx context.Context, c *Connector, table string, columns []string, options BulkOptions, rows <-chan indexedRow) (int64, error) {
+	dc, err := c.Connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	conn := dc.(*Conn)
+	defer conn.Close()
+
+	bulk := conn.CreateBulkContext(ctx, table, columns)
+	bulk.Options = options
+	for {
+		select {
+		case r, ok := <-rows:
+			if !ok {
+				// the channels are also closed after a cancellation,
+				// whose rows must not be committed
+				if err := ctx.Err(); err != nil {
+					return 0, err
+				}
+				return bulk.Done()
+			}
+			if err := bulk.AddRow(r.row); err != nil {
+				var rowErr BulkRowError
+				if errors.As(err, &rowErr) {
+					rowErr.Row = r.index
+					err = rowErr
+				}
+				return 0, err
+			}
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
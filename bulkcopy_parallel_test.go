@@ -0,0 +1,171 @@
+// +build go1.10
+
+package mssql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sliceRowSource struct {
+	rows [][]interface{}
+	pos  int
+}
+
+func (s *sliceRowSource) Next() ([]interface{}, error) {
+	if s.pos == len(s.rows) {
+		return nil, io.EOF
+	}
+	s.pos++
+	return s.rows[s.pos-1], nil
+}
+
+type failingDialer struct{}
+
+func (failingDialer) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return nil, errors.New("dial failed")
+}
+
+func TestBulkCopyParallelConnectError(t *testing.T) {
+	connector, err := NewConnector("sqlserver://localhost?dial+timeout=1&disableretry=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector.Dialer = failingDialer{}
+
+	src := &sliceRowSource{rows: make([][]interface{}, 100000)}
+	for i := range src.rows {
+		src.rows[i] = []interface{}{i}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err = BulkCopyParallel(context.Background(), connector, "t", []string{"id"}, src, ParallelBulkOptions{Connections: 3, BufferedRows: 10})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("BulkCopyParallel did not return")
+	}
+	var parallelErr ParallelBulkError
+	if !errors.As(err, &parallelErr) {
+		t.Fatalf("expected ParallelBulkError, got %v", err)
+	}
+	if len(parallelErr.Errors) == 0 || len(parallelErr.Errors) > 3 {
+		t.Errorf("unexpected errors %v", parallelErr.Errors)
+	}
+	if src.pos == len(src.rows) {
+		t.Error("source should not be read after streams failed")
+	}
+}
+
+func TestBulkCopyParallelSourceError(t *testing.T) {
+	connector, err := NewConnector("sqlserver://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector.Dialer = failingDialer{}
+	srcErr := errors.New("source failed")
+	src := errSource{err: srcErr}
+	_, err = BulkCopyParallel(context.Background(), connector, "t", []string{"id"}, src, ParallelBulkOptions{})
+	if err == nil || !strings.Contains(err.Error(), srcErr.Error()) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+type errSource struct {
+	err error
+}
+
+func (s errSource) Next() ([]interface{}, error) {
+	return nil, s.err
+}
+
+// failingRowSource returns its rows, then err.
+type failingRowSource struct {
+	sliceRowSource
+	err error
+}
+
+func (s *failingRowSource) Next() ([]interface{}, error) {
+	row, err := s.sliceRowSource.Next()
+	if err == io.EOF {
+		return nil, s.err
+	}
+	return row, err
+}
+
+func TestBulkCopyParallel(t *testing.T) {
+	dsn := makeConnStr(t)
+	if strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	connector, err := NewConnector(dsn.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	table := fmt.Sprintf("##bulk_parallel_%d", time.Now().UnixNano())
+	if _, err = pool.Exec("create table " + table + " (id int not null, name nvarchar(20))"); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Exec("drop table " + table)
+
+	const rows = 10000
+	src := &sliceRowSource{}
+	for i := 0; i < rows; i++ {
+		src.rows = append(src.rows, []interface{}{i, fmt.Sprint("row ", i)})
+	}
+	key := func(row []interface{}) uint64 {
+		return uint64(row[0].(int))
+	}
+	count, err := BulkCopyParallel(context.Background(), connector, table, []string{"id", "name"}, src,
+		ParallelBulkOptions{BulkOptions: BulkOptions{Tablock: true}, Connections: 4, Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != rows {
+		t.Errorf("BulkCopyParallel returned %d rows, want %d", count, rows)
+	}
+	var inserted, sum int64
+	if err = pool.QueryRow("select count(*), sum(cast(id as bigint)) from "+table).Scan(&inserted, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if inserted != rows || sum != rows*(rows-1)/2 {
+		t.Errorf("inserted %d rows with sum %d", inserted, sum)
+	}
+
+	// the rows of the streams are not inserted when the source fails
+	srcErr := errors.New("source failed")
+	failing := &failingRowSource{err: srcErr}
+	for i := 0; i < 1000; i++ {
+		failing.rows = append(failing.rows, []interface{}{rows + i, "failed"})
+	}
+	_, err = BulkCopyParallel(context.Background(), connector, table, []string{"id", "name"}, failing, ParallelBulkOptions{Connections: 4})
+	if !errors.Is(err, srcErr) {
+		t.Errorf("expected the source error, got %v", err)
+	}
+	if err = pool.QueryRow("select count(*) from " + table).Scan(&inserted); err != nil {
+		t.Fatal(err)
+	}
+	if inserted != rows {
+		t.Errorf("%d rows were inserted after the source failed", inserted-rows)
+	}
+
+	// the index of a failed row is its index in the source
+	src = &sliceRowSource{rows: [][]interface{}{{1, "a"}, {2, "b"}, {"x", "c"}, {4, "d"}}}
+	_, err = BulkCopyParallel(context.Background(), connector, table, []string{"id", "name"}, src, ParallelBulkOptions{Connections: 2})
+	var rowErr BulkRowError
+	if !errors.As(err, &rowErr) || rowErr.Row != 2 || rowErr.Column != "id" {
+		t.Errorf("expected BulkRowError for row 2, got %v", err)
+	}
+}
@@ -3,14 +3,22 @@
 package mssql
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"math"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
+
+	"github.com/denisenkom/go-mssqldb/internal/cp"
 )
 
 func TestBulkcopy(t *testing.T) {
@@ -67,8 +75,12 @@ func TestBulkcopy(t *testing.T) {
 		{"test_intf32", float32(1234.56), 1234},
 		{"test_geom", geom, string(geom)},
 		{"test_uniqueidentifier", uid, string(uid)},
-		// {"test_smallmoney", 1234.56, nil},
-		// {"test_money", 1234.56, nil},
+		{"test_smallmoney", 1234.56, "1234.5600"},
+		{"test_money", 1234.56, "1234.5600"},
+		{"text_xml", "<a/>", nil},
+		{"test_variant", int64(7), nil},
+		{"test_variant_string", "abc", nil},
+		{"test_image", bin, nil},
 		{"test_decimal_18_0", 1234.0001, "1234"},
 		{"test_decimal_9_2", -1234.560001, "-1234.56"},
 		{"test_decimal_20_0", 1234, "1234"},
@@ -264,6 +276,9 @@ func setupTable(ctx context.Context, t *testing.T, conn *sql.Conn, tableName str
 	[test_geom] [geometry] NULL,
 	[test_geog] [geography] NULL,
 	[text_xml] [xml] NULL,
+	[test_variant] [sql_variant] NULL,
+	[test_variant_string] [sql_variant] NULL,
+	[test_image] [image] NULL,
 	[test_uniqueidentifier] [uniqueidentifier] NULL,
 	[test_decimal_18_0] [decimal](18, 0) NULL,
 	[test_decimal_18_2] [decimal](18, 2) NULL,
@@ -290,3 +305,407 @@ func setupTable(ctx context.Context, t *testing.T, conn *sql.Conn, tableName str
 	}
 	return
 }
+
+type testMarshaler []byte
+
+func (m testMarshaler) MarshalBinary() ([]byte, error) {
+	return []byte(m), nil
+}
+
+func TestBulkMakeParamTypes(t *testing.T) {
+	latin1 := cp.Collation{LcidAndFlags: 0x0409, SortId: 52}
+	tm := time.Date(2010, 11, 12, 13, 14, 15, 0, time.UTC)
+	uid := UniqueIdentifier{0x6F, 0x96, 0x19, 0xFF, 0x8B, 0x86, 0xD0, 0x11, 0xB4, 0x2D, 0x00, 0xC0, 0x4F, 0xC9, 0x64, 0xFF}
+	uidBytes, _ := uid.Value()
+	tests := []struct {
+		name     string
+		ti       typeInfo
+		in       interface{}
+		expected interface{}
+	}{
+		{"tinyint", typeInfo{TypeId: typeIntN, Size: 1}, 255, int64(255)},
+		{"int", typeInfo{TypeId: typeInt4, Size: 4}, int64(-5), int64(-5)},
+		{"bigint null", typeInfo{TypeId: typeIntN, Size: 8}, nil, nil},
+		{"float", typeInfo{TypeId: typeFltN, Size: 8}, 1.5, 1.5},
+		{"bit", typeInfo{TypeId: typeBitN, Size: 1}, true, true},
+		{"money", typeInfo{TypeId: typeMoneyN, Size: 8}, 1234.56, []byte("1234.5600")},
+		{"money string", typeInfo{TypeId: typeMoney, Size: 8}, "-922337203685477.5808", []byte("-922337203685477.5808")},
+		{"money int", typeInfo{TypeId: typeMoneyN, Size: 8}, 12, []byte("12.0000")},
+		{"money null", typeInfo{TypeId: typeMoneyN, Size: 8}, nil, nil},
+		{"smallmoney", typeInfo{TypeId: typeMoneyN, Size: 4}, float32(-1.25), []byte("-1.2500")},
+		{"smallmoney fixed", typeInfo{TypeId: typeMoney4, Size: 4}, "214748.3647", []byte("214748.3647")},
+		{"decimal", typeInfo{TypeId: typeDecimalN, Size: 17, Prec: 18, Scale: 2}, "12.34", []byte("12.34")},
+		{"nvarchar", typeInfo{TypeId: typeNVarChar, Size: 100}, "ab©Я", "ab©Я"},
+		{"nvarchar max", typeInfo{TypeId: typeNVarChar, Size: 0xffff}, "ab©Я", "ab©Я"},
+		{"nvarchar max null", typeInfo{TypeId: typeNVarChar, Size: 0xffff}, nil, nil},
+		{"nvarchar max reader", typeInfo{TypeId: typeNVarChar, Size: 0xffff}, strings.NewReader("ab©Я"), "ab©Я"},
+		{"varchar", typeInfo{TypeId: typeBigVarChar, Size: 100, Collation: latin1}, "café", "café"},
+		{"varchar max", typeInfo{TypeId: typeBigVarChar, Size: 0xffff, Collation: latin1}, "café", "café"},
+		{"text", typeInfo{TypeId: typeText, Size: 0x7fffffff, Collation: latin1}, "café", "café"},
+		{"text null", typeInfo{TypeId: typeText, Size: 0x7fffffff, Collation: latin1}, nil, nil},
+		{"ntext", typeInfo{TypeId: typeNText, Size: 0x7ffffffe, Collation: latin1}, "ab©Я", "ab©Я"},
+		{"image", typeInfo{TypeId: typeImage, Size: 0x7fffffff}, []byte{1, 2, 3}, []byte{1, 2, 3}},
+		{"image reader", typeInfo{TypeId: typeImage, Size: 0x7fffffff}, bytes.NewReader([]byte{1, 2}), []byte{1, 2}},
+		{"varbinary", typeInfo{TypeId: typeBigVarBin, Size: 16}, []byte{1, 2}, []byte{1, 2}},
+		{"varbinary max", typeInfo{TypeId: typeBigVarBin, Size: 0xffff}, []byte{1, 2}, []byte{1, 2}},
+		{"udt", typeInfo{TypeId: typeBigVarBin, Size: 0xffff}, testMarshaler{0xe6, 0x10}, []byte{0xe6, 0x10}},
+		{"binary", typeInfo{TypeId: typeBigBinary, Size: 2}, []byte{1, 2}, []byte{1, 2}},
+		{"uniqueidentifier", typeInfo{TypeId: typeGuid, Size: 16}, uid, uidBytes},
+		{"xml", typeInfo{TypeId: typeXml}, XML{Value: "<a/>"}, "<a/>"},
+		{"xml reader", typeInfo{TypeId: typeXml}, strings.NewReader("<a/>"), "<a/>"},
+		{"datetime", typeInfo{TypeId: typeDateTimeN, Size: 8}, tm, tm},
+		{"smalldatetime", typeInfo{TypeId: typeDateTim4, Size: 4}, tm.Truncate(time.Minute), tm.Truncate(time.Minute)},
+		{"datetime2", typeInfo{TypeId: typeDateTime2N, Scale: 7}, tm, tm},
+		{"date", typeInfo{TypeId: typeDateN}, tm, tm.Truncate(24 * time.Hour)},
+		{"sql_variant int", typeInfo{TypeId: typeVariant, Size: 8016}, int64(7), int64(7)},
+		{"sql_variant int32", typeInfo{TypeId: typeVariant, Size: 8016}, int32(7), int64(7)},
+		{"sql_variant float", typeInfo{TypeId: typeVariant, Size: 8016}, 1.5, 1.5},
+		{"sql_variant bit", typeInfo{TypeId: typeVariant, Size: 8016}, true, true},
+		{"sql_variant string", typeInfo{TypeId: typeVariant, Size: 8016}, "ab©Я", "ab©Я"},
+		{"sql_variant binary", typeInfo{TypeId: typeVariant, Size: 8016}, []byte{1, 2}, []byte{1, 2}},
+		{"sql_variant time", typeInfo{TypeId: typeVariant, Size: 8016}, tm, tm},
+		{"sql_variant null", typeInfo{TypeId: typeVariant, Size: 8016}, nil, nil},
+		{"vector", typeInfo{TypeId: typeVector, Size: 16}, []float32{1, 2}, NewVector([]float32{1, 2})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ti := tt.ti
+			var buf bytes.Buffer
+			if err := writeTypeInfo(&buf, &ti); err != nil {
+				t.Fatal(err)
+			}
+			switch ti.TypeId {
+			case typeText, typeNText, typeImage:
+				// table name parts of column metadata in a result set
+				buf.WriteByte(0)
+			}
+			b := &Bulk{ctx: context.Background(), bulkColumns: []columnStruct{{ti: ti}}}
+			row, err := b.makeRowData([]interface{}{tt.in})
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf.Write(row[1:])
+
+			r := &tdsBuffer{packetSize: buf.Len(), rbuf: buf.Bytes(), rsize: buf.Len()}
+			rti := readTypeInfo(r)
+			got := rti.Reader(&rti, r)
+			if tm, ok := got.(time.Time); ok {
+				got = tm.UTC()
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %T %v, want %T %v", got, got, tt.expected, tt.expected)
+			}
+			if r.rpos != r.rsize {
+				t.Errorf("%d bytes left after value", r.rsize-r.rpos)
+			}
+		})
+	}
+}
+
+func TestBulkMakeParamErrors(t *testing.T) {
+	b := &Bulk{}
+	tests := []struct {
+		ti typeInfo
+		in interface{}
+	}{
+		{typeInfo{TypeId: typeMoneyN, Size: 4}, 300000},
+		{typeInfo{TypeId: typeMoneyN, Size: 8}, int64(math.MaxInt64)},
+		{typeInfo{TypeId: typeMoneyN, Size: 8}, "1.23456"},
+		{typeInfo{TypeId: typeMoneyN, Size: 8}, true},
+		{typeInfo{TypeId: typeVariant}, struct{}{}},
+		{typeInfo{TypeId: typeVariant}, strings.Repeat("x", 4001)},
+		{typeInfo{TypeId: typeBigVarBin, Size: 10}, "x"},
+	}
+	for _, tt := range tests {
+		if _, err := b.makeParam(tt.in, columnStruct{ti: tt.ti}); err == nil {
+			t.Errorf("makeParam(%T) for %s should fail", tt.in, makeDecl(tt.ti))
+		}
+	}
+}
+
+func TestBulkStreamPLP(t *testing.T) {
+	text := strings.Repeat("ab©Я☀", 3000)
+	tests := []struct {
+		ti       typeInfo
+		in       io.Reader
+		expected interface{}
+	}{
+		// one byte reads split multi-byte characters between reads
+		{typeInfo{TypeId: typeNVarChar, Size: 0xffff}, iotest.OneByteReader(strings.NewReader("ab©Я☀")), "ab©Я☀"},
+		{typeInfo{TypeId: typeNVarChar, Size: 0xffff}, strings.NewReader(text), text},
+		{typeInfo{TypeId: typeBigVarChar, Size: 0xffff, Collation: cp.Collation{LcidAndFlags: 0x0409, SortId: 52}}, iotest.HalfReader(strings.NewReader("café")), "café"},
+		{typeInfo{TypeId: typeBigVarBin, Size: 0xffff}, bytes.NewReader(bytes.Repeat([]byte{1, 2, 3}, 5000)), bytes.Repeat([]byte{1, 2, 3}, 5000)},
+		{typeInfo{TypeId: typeNVarChar, Size: 0xffff}, strings.NewReader(""), ""},
+	}
+	for i, tt := range tests {
+		ti := tt.ti
+		var buf bytes.Buffer
+		if err := writeTypeInfo(&buf, &ti); err != nil {
+			t.Fatal(err)
+		}
+		b := &Bulk{ctx: context.Background(), bulkColumns: []columnStruct{{ti: ti}}}
+		row := []interface{}{tt.in}
+		if !b.hasStreamedValue(row) {
+			t.Errorf("%d: value should be streamed", i)
+		}
+		if err := b.writeRowData(&buf, row); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		r := &tdsBuffer{packetSize: len(data), rbuf: data, rsize: len(data)}
+		rti := readTypeInfo(r)
+		if tok := r.byte(); tok != byte(tokenRow) {
+			t.Fatalf("%d: expected row token, got %#x", i, tok)
+		}
+		got := rti.Reader(&rti, r)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%d: got %d bytes/chars, want %v", i, len(fmt.Sprint(got)), len(fmt.Sprint(tt.expected)))
+		}
+	}
+
+	b := &Bulk{bulkColumns: []columnStruct{{ti: typeInfo{TypeId: typeNVarChar, Size: 100}}}}
+	if b.hasStreamedValue([]interface{}{strings.NewReader("x")}) {
+		t.Error("value of nvarchar(50) column should not be streamed")
+	}
+}
+
+func TestParseObjectName(t *testing.T) {
+	tests := []struct {
+		name     string
+		parts    []string
+		expected string
+	}{
+		{"table", []string{"table"}, "[table]"},
+		{"dbo.table", []string{"dbo", "table"}, "[dbo].[table]"},
+		{"db..table", []string{"db", "", "table"}, "[db]..[table]"},
+		{"#temp", []string{"#temp"}, "[#temp]"},
+		{"##global_temp", []string{"##global_temp"}, "[##global_temp]"},
+		{"[my table]", []string{"my table"}, "[my table]"},
+		{"[a]]b].[c.d]", []string{"a]b", "c.d"}, "[a]]b].[c.d]"},
+		{`"quoted ""name"""`, []string{`quoted "name"`}, `[quoted "name"]`},
+		{"db.[dbo].\"t\"", []string{"db", "dbo", "t"}, "[db].[dbo].[t]"},
+		{"Привет_1$", []string{"Привет_1$"}, "[Привет_1$]"},
+	}
+	for _, tt := range tests {
+		parts, err := parseObjectName(tt.name)
+		if err != nil {
+			t.Errorf("parseObjectName(%s) failed: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(parts, tt.parts) {
+			t.Errorf("parseObjectName(%s) = %q, want %q", tt.name, parts, tt.parts)
+		}
+		if quoted := quoteObjectName(parts); quoted != tt.expected {
+			t.Errorf("quoteObjectName(%q) = %s, want %s", parts, quoted, tt.expected)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"t; drop table users",
+		"t --",
+		"t/*",
+		"[t]; drop table users --",
+		"[t",
+		"[t]]",
+		"\"t",
+		"t(1)",
+		"t'",
+		"1t",
+		"a.b.c.d",
+		".t",
+		"t.",
+		"a..",
+		"[a]b",
+	}
+	for _, name := range invalid {
+		if parts, err := parseObjectName(name); err == nil {
+			t.Errorf("parseObjectName(%s) should fail, got %q", name, parts)
+		}
+	}
+}
+
+func TestBulkcopyQuotedTableName(t *testing.T) {
+	if dsn := makeConnStr(t); strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "create table [#bulk test]]1] ([id] int, [name value] varchar(20) collate Cyrillic_General_CI_AS, [n] nvarchar(20))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := conn.PrepareContext(ctx, CopyIn("[#bulk test]]1]", BulkOptions{}, "id", "name value", "n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stmt.Exec(1, "Привет", "Привет"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stmt.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	stmt.Close()
+
+	var name, n string
+	err = conn.QueryRowContext(ctx, "select [name value], n from [#bulk test]]1]").Scan(&name, &n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Привет" || n != "Привет" {
+		t.Errorf("got %q, %q", name, n)
+	}
+
+	stmt, err = conn.PrepareContext(ctx, CopyIn("#t; drop table x", BulkOptions{}, "id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	if _, err = stmt.Exec(1); err == nil || !strings.Contains(err.Error(), "invalid table name") {
+		t.Errorf("expected invalid table name error, got %v", err)
+	}
+}
+
+func TestBulkRowError(t *testing.T) {
+	b := &Bulk{
+		ctx:         context.Background(),
+		bulkColumns: []columnStruct{{ColName: "id", ti: typeInfo{TypeId: typeIntN, Size: 4}}, {ColName: "amount", ti: typeInfo{TypeId: typeMoneyN, Size: 8}}},
+		numRows:     3,
+	}
+	for i := range b.bulkColumns {
+		writeTypeInfo(new(bytes.Buffer), &b.bulkColumns[i].ti)
+	}
+
+	_, err := b.makeRowData([]interface{}{1, "12.34567"})
+	var rowErr BulkRowError
+	if !errors.As(err, &rowErr) {
+		t.Fatalf("expected BulkRowError, got %T %v", err, err)
+	}
+	if rowErr.Row != 3 || rowErr.Column != "amount" || rowErr.Value != "12.34567" || rowErr.Err == nil {
+		t.Errorf("unexpected error %+v", rowErr)
+	}
+	if !strings.HasPrefix(err.Error(), "bulkcopy: row 3, column amount: ") {
+		t.Errorf("unexpected message %s", err)
+	}
+}
+
+func TestBulkKeepIdentity(t *testing.T) {
+	columns := []columnStruct{
+		{ColName: "id", Flags: colFlagIdentity, ti: typeInfo{TypeId: typeIntN, Size: 4}},
+		{ColName: "name", Flags: colFlagNullable, ti: typeInfo{TypeId: typeNVarChar, Size: 20}},
+	}
+	for _, keep := range []bool{false, true} {
+		b := &Bulk{
+			ctx:         context.Background(),
+			cn:          &Conn{sess: &tdsSession{}},
+			bulkColumns: append([]columnStruct(nil), columns...),
+			Options:     BulkOptions{KeepIdentity: keep},
+		}
+		metadata := b.createColMetadata()
+		count := int(binary.LittleEndian.Uint16(metadata[1:]))
+		row, err := b.makeRowData([]interface{}{5, "x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedCount, expectedRow := 1, []byte{byte(tokenRow), 2, 0, 'x', 0}
+		if keep {
+			expectedCount, expectedRow = 2, []byte{byte(tokenRow), 4, 5, 0, 0, 0, 2, 0, 'x', 0}
+		}
+		if count != expectedCount {
+			t.Errorf("KeepIdentity=%v: %d columns in metadata, want %d", keep, count, expectedCount)
+		}
+		if !bytes.Equal(row, expectedRow) {
+			t.Errorf("KeepIdentity=%v: row % x, want % x", keep, row, expectedRow)
+		}
+	}
+}
+
+func TestBulkAbort(t *testing.T) {
+	if dsn := makeConnStr(t); strings.HasSuffix(strings.Split(dsn.Host, ":")[0], ".database.windows.net") {
+		t.Skip("TDS level bulk copy is not supported on Azure SQL Server")
+	}
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "create table #bulk_abort (id int identity(1,1), amount money, note varchar(10) default 'none')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stmt, err := conn.PrepareContext(ctx, CopyIn("#bulk_abort", BulkOptions{}, "amount"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stmt.Exec(1.5); err != nil {
+		t.Fatal(err)
+	}
+	_, err = stmt.Exec("not a number")
+	var rowErr BulkRowError
+	if !errors.As(err, &rowErr) || rowErr.Row != 1 || rowErr.Column != "amount" {
+		t.Fatalf("expected BulkRowError for row 1, got %v", err)
+	}
+	if _, err = stmt.Exec(2.5); err == nil {
+		t.Error("AddRow should fail after the bulk copy was aborted")
+	}
+	stmt.Close()
+
+	// the connection is usable and no row was inserted
+	var count int
+	if err = conn.QueryRowContext(ctx, "select count(*) from #bulk_abort").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d rows inserted by aborted bulk copy", count)
+	}
+
+	for _, keep := range []bool{true, false} {
+		stmt, err = conn.PrepareContext(ctx, CopyIn("#bulk_abort", BulkOptions{KeepIdentity: keep, KeepDefaults: true}, "id", "amount", "note"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = stmt.Exec(100, 1, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = stmt.Exec(); err != nil {
+			t.Fatal(err)
+		}
+		stmt.Close()
+	}
+	rows, err := conn.QueryContext(ctx, "select id, note from #bulk_abort order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		var note string
+		if err = rows.Scan(&id, &note); err != nil {
+			t.Fatal(err)
+		}
+		if note != "none" {
+			t.Errorf("default value was not used: %s", note)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) != 2 || ids[1] != 100 || ids[0] == 100 {
+		t.Errorf("unexpected identity values %v", ids)
+	}
+}
@@ -0,0 +1,104 @@
+package mssql
+
+import (
+	"github.com/denisenkom/go-mssqldb/internal/catalog"
+)
+
+func init() {
+	catalog.Describe = describeCatalogType
+}
+
+// describeCatalogType describes a type of the catalog views with the type
+// info the server sends for a column of the type, so that the names match
+// those of result sets.
+func describeCatalogType(t catalog.Type) (catalog.Description, bool) {
+	ti, ok := catalogTypeInfo(t)
+	if !ok {
+		return catalog.Description{}, false
+	}
+	d := catalog.Description{
+		DatabaseType: makeGoLangTypeName(ti),
+		Decl:         makeDecl(ti),
+	}
+	d.Length, d.HasLength = makeGoLangTypeLength(ti)
+	return d, true
+}
+
+// catalogTypeInfo returns the type info of a column of a system type,
+// the sizes of the catalog views are in bytes and -1 for max types.
+func catalogTypeInfo(t catalog.Type) (typeInfo, bool) {
+	size := t.MaxLength
+	if size == -1 {
+		size = 0xffff
+	}
+	ti := typeInfo{Size: size, Prec: uint8(t.Precision), Scale: uint8(t.Scale)}
+	switch t.Name {
+	case "tinyint":
+		ti.TypeId, ti.Size = typeIntN, 1
+	case "smallint":
+		ti.TypeId, ti.Size = typeIntN, 2
+	case "int":
+		ti.TypeId, ti.Size = typeIntN, 4
+	case "bigint":
+		ti.TypeId, ti.Size = typeIntN, 8
+	case "bit":
+		ti.TypeId, ti.Size = typeBitN, 1
+	case "real", "float":
+		if size != 4 && size != 8 {
+			return typeInfo{}, false
+		}
+		ti.TypeId = typeFltN
+	case "decimal":
+		ti.TypeId = typeDecimalN
+	case "numeric":
+		ti.TypeId = typeNumericN
+	case "smallmoney":
+		ti.TypeId, ti.Size = typeMoneyN, 4
+	case "money":
+		ti.TypeId, ti.Size = typeMoneyN, 8
+	case "smalldatetime":
+		ti.TypeId, ti.Size = typeDateTimeN, 4
+	case "datetime":
+		ti.TypeId, ti.Size = typeDateTimeN, 8
+	case "date":
+		ti.TypeId = typeDateN
+	case "time":
+		ti.TypeId = typeTimeN
+	case "datetime2":
+		ti.TypeId = typeDateTime2N
+	case "datetimeoffset":
+		ti.TypeId = typeDateTimeOffsetN
+	case "char":
+		ti.TypeId = typeBigChar
+	case "varchar":
+		ti.TypeId = typeBigVarChar
+	case "nchar":
+		ti.TypeId = typeNChar
+	case "nvarchar":
+		ti.TypeId = typeNVarChar
+	case "binary":
+		ti.TypeId = typeBigBinary
+	case "varbinary":
+		ti.TypeId = typeBigVarBin
+	case "timestamp":
+		// rowversion columns are sent as binary(8)
+		ti.TypeId, ti.Size = typeBigBinary, 8
+	case "uniqueidentifier":
+		ti.TypeId, ti.Size = typeGuid, 16
+	case "xml":
+		ti.TypeId = typeXml
+	case "text":
+		ti.TypeId = typeText
+	case "ntext":
+		ti.TypeId = typeNText
+	case "image":
+		ti.TypeId = typeImage
+	case "sql_variant":
+		ti.TypeId = typeVariant
+	case "vector":
+		ti.TypeId = typeVector
+	default:
+		return typeInfo{}, false
+	}
+	return ti, true
+}
@@ -0,0 +1,53 @@
+package mssql
+
+import (
+	"testing"
+
+	"github.com/denisenkom/go-mssqldb/internal/catalog"
+)
+
+func TestDescribeCatalogType(t *testing.T) {
+	values := []struct {
+		t      catalog.Type
+		name   string
+		decl   string
+		length int64
+	}{
+		{catalog.Type{Name: "int", MaxLength: 4, Precision: 10}, "INT", "int", 0},
+		{catalog.Type{Name: "tinyint", MaxLength: 1, Precision: 3}, "TINYINT", "tinyint", 0},
+		{catalog.Type{Name: "float", MaxLength: 8, Precision: 53}, "FLOAT", "float", 0},
+		{catalog.Type{Name: "float", MaxLength: 4, Precision: 24}, "REAL", "real", 0},
+		{catalog.Type{Name: "numeric", MaxLength: 9, Precision: 10, Scale: 2}, "DECIMAL", "numeric(10, 2)", 0},
+		{catalog.Type{Name: "money", MaxLength: 8, Precision: 19, Scale: 4}, "MONEY", "money", 0},
+		{catalog.Type{Name: "datetime2", MaxLength: 8, Precision: 27, Scale: 7}, "DATETIME2", "datetime2(7)", 0},
+		{catalog.Type{Name: "time", MaxLength: 4, Precision: 12, Scale: 3}, "TIME", "time(3)", 0},
+		{catalog.Type{Name: "smalldatetime", MaxLength: 4}, "SMALLDATETIME", "smalldatetime", 0},
+		{catalog.Type{Name: "nvarchar", MaxLength: 100}, "NVARCHAR", "nvarchar(50)", 50},
+		{catalog.Type{Name: "nvarchar", MaxLength: -1}, "NVARCHAR", "nvarchar(max)", 2147483645 / 2},
+		{catalog.Type{Name: "varchar", MaxLength: -1}, "VARCHAR", "varchar(max)", 2147483645},
+		{catalog.Type{Name: "nchar", MaxLength: 20}, "NCHAR", "nchar(10)", 10},
+		{catalog.Type{Name: "char", MaxLength: 3}, "CHAR", "char(3)", 3},
+		{catalog.Type{Name: "varbinary", MaxLength: 16}, "VARBINARY", "varbinary(16)", 16},
+		{catalog.Type{Name: "timestamp", MaxLength: 8}, "BINARY", "binary(8)", 8},
+		{catalog.Type{Name: "uniqueidentifier", MaxLength: 16}, "UNIQUEIDENTIFIER", "uniqueidentifier", 0},
+		{catalog.Type{Name: "xml", MaxLength: -1}, "XML", "xml", 1073741822},
+		{catalog.Type{Name: "sql_variant", MaxLength: 8016}, "SQL_VARIANT", "sql_variant", 0},
+		{catalog.Type{Name: "vector", MaxLength: 20}, "VECTOR", "vector(3)", 3},
+	}
+	for _, v := range values {
+		d, ok := catalog.Describe(v.t)
+		if !ok {
+			t.Errorf("%+v is not described", v.t)
+			continue
+		}
+		if d.DatabaseType != v.name || d.Decl != v.decl || d.Length != v.length || d.HasLength != (v.length > 0) {
+			t.Errorf("%+v: got %+v, want %s %s %d", v.t, d, v.name, v.decl, v.length)
+		}
+	}
+
+	for _, name := range []string{"hierarchyid", "geography", "sysname"} {
+		if d, ok := catalog.Describe(catalog.Type{Name: name, MaxLength: 892}); ok {
+			t.Errorf("%s: got %+v, want no description", name, d)
+		}
+	}
+}
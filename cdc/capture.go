@@ -0,0 +1,239 @@
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Capture reads the changes of a capture instance of Change Data Capture
+// with cdc.fn_cdc_get_all_changes_<instance>, in the order of their
+// commit LSN and __$seqval.
+type Capture struct {
+	// Instance is the name of the capture instance, such as dbo_orders.
+	Instance string
+	// OldValues reads the values before updates into Event.Before.
+	OldValues bool
+}
+
+// Name returns "cdc:" followed by the capture instance.
+func (s *Capture) Name() string {
+	return "cdc:" + s.Instance
+}
+
+// capturedColumn is a column of a capture instance, the ordinal is its
+// bit in the update mask.
+type capturedColumn struct {
+	name    string
+	ordinal int
+}
+
+func (s *Capture) poll(ctx context.Context, q Queryer, last *Position, resetOnLost bool, handle func(Event) error) (*Position, int, error) {
+	columns, err := s.columns(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var lastLSN, minLSN, maxLSN, nextLSN []byte
+	if last != nil {
+		lastLSN = last.LSN
+	}
+	rows, err := q.QueryContext(ctx, "SELECT sys.fn_cdc_get_min_lsn(@p1), sys.fn_cdc_get_max_lsn(), sys.fn_cdc_increment_lsn(@p2)",
+		s.Instance, lastLSN)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cdc: cannot read the LSN range of %s: %w", s.Instance, err)
+	}
+	for rows.Next() {
+		err = rows.Scan(&minLSN, &maxLSN, &nextLSN)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	if err != nil {
+		return nil, 0, fmt.Errorf("cdc: cannot read the LSN range of %s: %w", s.Instance, err)
+	}
+
+	from, err := captureStart(lastLSN, nextLSN, minLSN, resetOnLost)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %s after 0x%X, the oldest change is 0x%X", err, s.Instance, lastLSN, minLSN)
+	}
+	if maxLSN == nil || bytes.Compare(from, maxLSN) > 0 {
+		// no new changes
+		return last, 0, nil
+	}
+
+	filter := "all"
+	if s.OldValues {
+		filter = "all update old"
+	}
+	rows, err = q.QueryContext(ctx, `
+SELECT * FROM cdc.`+quoteName("fn_cdc_get_all_changes_"+s.Instance)+`(@p1, @p2, @p3)
+ORDER BY __$start_lsn, __$seqval, __$operation`, from, maxLSN, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cdc: cannot read the changes of %s: %w", s.Instance, err)
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, 0, err
+	}
+	m := captureMerger{columns: columns}
+	n := 0
+	for rows.Next() {
+		values := make([]interface{}, len(names))
+		dest := make([]interface{}, len(names))
+		for i := range dest {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, n, err
+		}
+		row, err := makeCaptureRow(names, values)
+		if err != nil {
+			return nil, n, fmt.Errorf("cdc: %s: %w", s.Instance, err)
+		}
+		e, ok := m.add(row)
+		if !ok {
+			continue
+		}
+		if err = handle(e); err != nil {
+			return nil, n, err
+		}
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return nil, n, err
+	}
+	return &Position{LSN: maxLSN}, n, nil
+}
+
+// columns returns the captured columns in the order of their ordinals.
+func (s *Capture) columns(ctx context.Context, q Queryer) ([]capturedColumn, error) {
+	rows, err := q.QueryContext(ctx, `
+SELECT cc.column_name, cc.column_ordinal
+FROM cdc.captured_columns cc
+JOIN cdc.change_tables ct ON ct.object_id = cc.object_id
+WHERE ct.capture_instance = @p1
+ORDER BY cc.column_ordinal`, s.Instance)
+	if err != nil {
+		return nil, fmt.Errorf("cdc: cannot read the columns of %s: %w", s.Instance, err)
+	}
+	defer rows.Close()
+	var columns []capturedColumn
+	for rows.Next() {
+		var c capturedColumn
+		if err = rows.Scan(&c.name, &c.ordinal); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("cdc: capture instance %s not found", s.Instance)
+	}
+	return columns, nil
+}
+
+// captureStart returns the first LSN to read after the last one, next is
+// the LSN that follows it and min the oldest LSN of the capture instance.
+func captureStart(last, next, min []byte, resetOnLost bool) ([]byte, error) {
+	if last == nil {
+		return min, nil
+	}
+	if bytes.Compare(next, min) < 0 {
+		if resetOnLost {
+			return min, nil
+		}
+		return nil, ErrChangesLost
+	}
+	return next, nil
+}
+
+// captureRow is a row of a change table.
+type captureRow struct {
+	op     int64
+	lsn    []byte
+	seq    []byte
+	mask   []byte
+	values map[string]interface{}
+}
+
+// makeCaptureRow splits a row of a change function into the metadata
+// columns, named __$..., and the captured columns.
+func makeCaptureRow(names []string, values []interface{}) (captureRow, error) {
+	row := captureRow{values: make(map[string]interface{}, len(names))}
+	for i, name := range names {
+		if !strings.HasPrefix(name, "__$") {
+			row.values[name] = values[i]
+			continue
+		}
+		switch name {
+		case "__$operation":
+			row.op, _ = values[i].(int64)
+		case "__$start_lsn":
+			row.lsn, _ = values[i].([]byte)
+		case "__$seqval":
+			row.seq, _ = values[i].([]byte)
+		case "__$update_mask":
+			row.mask, _ = values[i].([]byte)
+		}
+	}
+	if row.op < 1 || row.op > 4 || row.lsn == nil {
+		return row, fmt.Errorf("invalid change with operation %d", row.op)
+	}
+	return row, nil
+}
+
+// captureMerger makes the events of the rows of a change function, the
+// row of the values before an update, operation 3, is merged into the
+// row of the values after it, operation 4.
+type captureMerger struct {
+	columns []capturedColumn
+	before  *captureRow
+}
+
+func (m *captureMerger) add(row captureRow) (Event, bool) {
+	e := Event{
+		Position: Position{LSN: row.lsn},
+		Seq:      row.seq,
+		Row:      row.values,
+	}
+	switch row.op {
+	case 1:
+		e.Op = Delete
+	case 2:
+		e.Op = Insert
+	case 3:
+		m.before = &row
+		return Event{}, false
+	case 4:
+		e.Op = Update
+		e.Updated = updatedColumns(row.mask, m.columns)
+		if m.before != nil && bytes.Equal(m.before.lsn, row.lsn) && bytes.Equal(m.before.seq, row.seq) {
+			e.Before = m.before.values
+		}
+	}
+	m.before = nil
+	return e, true
+}
+
+// updatedColumns returns the columns whose bits are set in an update
+// mask, as sys.fn_cdc_is_bit_set reads them: the bit of ordinal 1 is the
+// lowest bit of the last byte.
+func updatedColumns(mask []byte, columns []capturedColumn) []string {
+	if mask == nil {
+		return nil
+	}
+	updated := []string{}
+	for _, c := range columns {
+		i := len(mask) - 1 - (c.ordinal-1)/8
+		if i >= 0 && mask[i]&(1<<uint((c.ordinal-1)%8)) != 0 {
+			updated = append(updated, c.name)
+		}
+	}
+	return updated
+}
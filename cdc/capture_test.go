@@ -0,0 +1,84 @@
+package cdc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUpdatedColumns(t *testing.T) {
+	columns := []capturedColumn{{"id", 1}, {"name", 2}, {"price", 3}, {"notes", 9}}
+	values := []struct {
+		mask []byte
+		want []string
+	}{
+		{nil, nil},
+		{[]byte{0x00, 0x00}, []string{}},
+		{[]byte{0x00, 0x06}, []string{"name", "price"}},
+		{[]byte{0x01, 0x01}, []string{"id", "notes"}},
+		// masks shorter than the ordinals
+		{[]byte{0x04}, []string{"price"}},
+	}
+	for _, v := range values {
+		if got := updatedColumns(v.mask, columns); !reflect.DeepEqual(got, v.want) {
+			t.Errorf("%x: got %q, want %q", v.mask, got, v.want)
+		}
+	}
+}
+
+func TestCaptureMerger(t *testing.T) {
+	names := []string{"__$start_lsn", "__$seqval", "__$operation", "__$update_mask", "id", "name"}
+	lsn := []byte{0, 0, 0, 0x2a, 0, 0, 0, 0x10, 0, 1}
+	rows := [][]interface{}{
+		{lsn, []byte{1}, int64(2), []byte{0x03}, int64(1), "a"},
+		{lsn, []byte{2}, int64(3), []byte{0x02}, int64(1), "a"},
+		{lsn, []byte{2}, int64(4), []byte{0x02}, int64(1), "b"},
+		{lsn, []byte{3}, int64(4), []byte{0x02}, int64(1), "c"},
+		{lsn, []byte{4}, int64(1), []byte{0x03}, int64(1), "c"},
+	}
+	m := captureMerger{columns: []capturedColumn{{"id", 1}, {"name", 2}}}
+	var events []Event
+	for _, values := range rows {
+		row, err := makeCaptureRow(names, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, ok := m.add(row); ok {
+			events = append(events, e)
+		}
+	}
+	want := []Event{
+		{Op: Insert, Position: Position{LSN: lsn}, Seq: []byte{1}, Row: map[string]interface{}{"id": int64(1), "name": "a"}},
+		{Op: Update, Position: Position{LSN: lsn}, Seq: []byte{2}, Row: map[string]interface{}{"id": int64(1), "name": "b"},
+			Before: map[string]interface{}{"id": int64(1), "name": "a"}, Updated: []string{"name"}},
+		{Op: Update, Position: Position{LSN: lsn}, Seq: []byte{3}, Row: map[string]interface{}{"id": int64(1), "name": "c"},
+			Updated: []string{"name"}},
+		{Op: Delete, Position: Position{LSN: lsn}, Seq: []byte{4}, Row: map[string]interface{}{"id": int64(1), "name": "c"}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got events\n%+v\nwant\n%+v", events, want)
+	}
+
+	if _, err := makeCaptureRow(names, []interface{}{lsn, []byte{1}, int64(5), nil, int64(1), "a"}); err == nil {
+		t.Error("no error for operation 5")
+	}
+}
+
+func TestCaptureStart(t *testing.T) {
+	min := []byte{0, 0, 0, 0x20, 0, 0, 0, 0, 0, 1}
+	before := []byte{0, 0, 0, 0x10, 0, 0, 0, 0, 0, 1}
+	after := []byte{0, 0, 0, 0x30, 0, 0, 0, 0, 0, 1}
+
+	if from, err := captureStart(nil, nil, min, false); err != nil || !reflect.DeepEqual(from, min) {
+		t.Errorf("without a position: got %x, %v", from, err)
+	}
+	if from, err := captureStart(after, after, min, false); err != nil || !reflect.DeepEqual(from, after) {
+		t.Errorf("got %x, %v", from, err)
+	}
+	if _, err := captureStart(before, before, min, false); !errors.Is(err, ErrChangesLost) {
+		t.Errorf("got error %v, want ErrChangesLost", err)
+	}
+	if from, err := captureStart(before, before, min, true); err != nil || !reflect.DeepEqual(from, min) {
+		t.Errorf("reset: got %x, %v", from, err)
+	}
+}
@@ -0,0 +1,203 @@
+// Package cdc consumes the changes recorded by Change Data Capture or
+// Change Tracking, as insert, update and delete events in the order of
+// their commits.
+//
+//	c := &cdc.Consumer{
+//		Source: &cdc.Capture{Instance: "dbo_orders"},
+//		Store:  &cdc.TableStore{DB: db},
+//	}
+//	err := c.Run(ctx, db, 10*time.Second, func(e cdc.Event) error {
+//		return publish(e)
+//	})
+//
+// The position of the last change read is saved to a Store after the
+// changes of a poll have been handled, so a consumer resumes after it
+// when restarted. Changes are delivered at least once: when a handler
+// fails or the process stops before the position is saved, the changes
+// of the poll are read again.
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrChangesLost is returned when changes after the saved position were
+// removed by the cleanup of the source, so that the consumer would miss
+// them. Consumers that reload their copy of the data set
+// Consumer.ResetOnLost to continue with the oldest changes available.
+var ErrChangesLost = errors.New("cdc: changes after the saved position were cleaned up")
+
+// Queryer reads changes, it is implemented by *sql.DB, *sql.Conn and
+// *sql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Operation is the kind of a change.
+type Operation int
+
+const (
+	Insert Operation = iota + 1
+	Update
+	Delete
+)
+
+func (op Operation) String() string {
+	switch op {
+	case Insert:
+		return "insert"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	}
+	return fmt.Sprintf("Operation(%d)", int(op))
+}
+
+// Position is a position in the changes of a source.
+type Position struct {
+	// LSN is the commit log sequence number of Change Data Capture, a
+	// binary(10).
+	LSN []byte
+	// Version is the version of Change Tracking.
+	Version int64
+}
+
+// Compare returns -1, 0 or 1 when p is before, at or after other.
+func (p Position) Compare(other Position) int {
+	if c := bytes.Compare(p.LSN, other.LSN); c != 0 {
+		return c
+	}
+	switch {
+	case p.Version < other.Version:
+		return -1
+	case p.Version > other.Version:
+		return 1
+	}
+	return 0
+}
+
+func (p Position) String() string {
+	if p.LSN != nil {
+		return fmt.Sprintf("0x%X", p.LSN)
+	}
+	return fmt.Sprint(p.Version)
+}
+
+// Event is a change of a row.
+type Event struct {
+	Op Operation
+	// Position is the position of the transaction of the change.
+	Position Position
+	// Seq orders the changes of a transaction of Change Data Capture,
+	// it is the __$seqval of the change.
+	Seq []byte
+
+	// Row are the values of the columns by name. They are the values
+	// after inserts and updates and before deletes for Change Data
+	// Capture. For Change Tracking they are the current values of the
+	// row, only the primary key for deletes and rows deleted since.
+	Row map[string]interface{}
+	// Before are the values before an update, read by Change Data
+	// Capture when Capture.OldValues is set.
+	Before map[string]interface{}
+	// Updated are the columns changed by an update, nil when unknown.
+	Updated []string
+}
+
+// Source is a source of changes, a Capture or a Tracking.
+type Source interface {
+	// Name is the default name of the saved positions of the source.
+	Name() string
+
+	// poll reads the changes after the position, from the oldest changes
+	// available when there is none, and returns the position to resume
+	// from, nil when there is none yet.
+	poll(ctx context.Context, q Queryer, last *Position, resetOnLost bool, handle func(Event) error) (*Position, int, error)
+}
+
+// Consumer reads the changes of a source after a saved position.
+type Consumer struct {
+	Source Source
+	// Store saves the position of the last change read, the position is
+	// only kept in memory when nil.
+	Store Store
+	// Name is the name of the position in the store, the name of the
+	// source when empty.
+	Name string
+
+	// ResetOnLost continues with the oldest changes available when
+	// changes after the saved position were cleaned up, instead of
+	// returning ErrChangesLost.
+	ResetOnLost bool
+
+	// last is the position when Store is nil
+	last *Position
+}
+
+func (c *Consumer) name() string {
+	if c.Name == "" {
+		return c.Source.Name()
+	}
+	return c.Name
+}
+
+// Poll calls handle for each change after the saved position, in order,
+// then saves the position of the last change. It stops at the first
+// error of handle, without saving the position. It returns the number of
+// changes handled.
+func (c *Consumer) Poll(ctx context.Context, q Queryer, handle func(Event) error) (int, error) {
+	last := c.last
+	if c.Store != nil {
+		pos, ok, err := c.Store.Load(ctx, c.name())
+		if err != nil {
+			return 0, fmt.Errorf("cdc: cannot load the position of %s: %w", c.name(), err)
+		}
+		if ok {
+			last = &pos
+		}
+	}
+	pos, n, err := c.Source.poll(ctx, q, last, c.ResetOnLost, handle)
+	if err != nil {
+		return n, err
+	}
+	if pos == nil || (last != nil && pos.Compare(*last) == 0) {
+		return n, nil
+	}
+	if c.Store == nil {
+		c.last = pos
+		return n, nil
+	}
+	if err = c.Store.Save(ctx, c.name(), *pos); err != nil {
+		return n, fmt.Errorf("cdc: cannot save the position of %s: %w", c.name(), err)
+	}
+	return n, nil
+}
+
+// Run polls the changes every interval until the context is done or an
+// error occurs, it returns the error.
+func (c *Consumer) Run(ctx context.Context, q Queryer, interval time.Duration, handle func(Event) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := c.Poll(ctx, q, handle); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// quoteName quotes an identifier with brackets.
+func quoteName(name string) string {
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
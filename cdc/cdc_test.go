@@ -0,0 +1,120 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testSource returns the changes after the position from a list.
+type testSource struct {
+	changes []Event
+	lost    int64
+}
+
+func (s *testSource) Name() string {
+	return "test"
+}
+
+func (s *testSource) poll(ctx context.Context, q Queryer, last *Position, resetOnLost bool, handle func(Event) error) (*Position, int, error) {
+	from := int64(0)
+	if last != nil {
+		from = last.Version
+	}
+	if from < s.lost && !resetOnLost {
+		return nil, 0, ErrChangesLost
+	}
+	n := 0
+	for _, e := range s.changes {
+		if e.Position.Version <= from {
+			continue
+		}
+		if err := handle(e); err != nil {
+			return nil, n, err
+		}
+		from = e.Position.Version
+		n++
+	}
+	if n == 0 {
+		return last, 0, nil
+	}
+	return &Position{Version: from}, n, nil
+}
+
+func TestConsumerPoll(t *testing.T) {
+	ctx := context.Background()
+	source := &testSource{changes: []Event{
+		{Op: Insert, Position: Position{Version: 1}},
+		{Op: Update, Position: Position{Version: 2}},
+	}}
+	store := &MemoryStore{}
+	c := &Consumer{Source: source, Store: store}
+
+	var got []Operation
+	handle := func(e Event) error {
+		got = append(got, e.Op)
+		return nil
+	}
+	if n, err := c.Poll(ctx, nil, handle); err != nil || n != 2 {
+		t.Fatalf("got %d changes, error %v", n, err)
+	}
+	if pos, ok, _ := store.Load(ctx, "test"); !ok || pos.Version != 2 {
+		t.Errorf("saved position %v %v", pos, ok)
+	}
+
+	// a new consumer resumes after the saved position
+	source.changes = append(source.changes, Event{Op: Delete, Position: Position{Version: 3}})
+	c = &Consumer{Source: source, Store: store}
+	if n, err := c.Poll(ctx, nil, handle); err != nil || n != 1 {
+		t.Fatalf("got %d changes, error %v", n, err)
+	}
+	if len(got) != 3 || got[2] != Delete {
+		t.Errorf("got changes %v", got)
+	}
+
+	// the position is not saved when a change fails
+	source.changes = append(source.changes, Event{Op: Insert, Position: Position{Version: 4}})
+	failed := errors.New("failed")
+	if _, err := c.Poll(ctx, nil, func(Event) error { return failed }); err != failed {
+		t.Fatalf("got error %v", err)
+	}
+	if pos, _, _ := store.Load(ctx, "test"); pos.Version != 3 {
+		t.Errorf("saved position %v after a failure", pos)
+	}
+
+	source.lost = 5
+	if _, err := c.Poll(ctx, nil, handle); !errors.Is(err, ErrChangesLost) {
+		t.Errorf("got error %v, want ErrChangesLost", err)
+	}
+	c.ResetOnLost = true
+	if n, err := c.Poll(ctx, nil, handle); err != nil || n != 1 {
+		t.Errorf("got %d changes, error %v", n, err)
+	}
+
+	// without a store the position is kept in memory
+	source.lost = 0
+	c = &Consumer{Source: source, Name: "other"}
+	if n, _ := c.Poll(ctx, nil, handle); n != 4 {
+		t.Errorf("got %d changes, want 4", n)
+	}
+	if n, _ := c.Poll(ctx, nil, handle); n != 0 {
+		t.Errorf("got %d changes again", n)
+	}
+	if _, ok, _ := store.Load(ctx, "other"); ok {
+		t.Error("position saved without a store")
+	}
+}
+
+func TestPositionCompare(t *testing.T) {
+	a := Position{LSN: []byte{0, 0, 0, 0x2a, 0, 0, 0, 0x10, 0, 1}}
+	b := Position{LSN: []byte{0, 0, 0, 0x2a, 0, 0, 0, 0x11, 0, 1}}
+	if a.Compare(b) != -1 || b.Compare(a) != 1 || a.Compare(a) != 0 {
+		t.Error("LSN positions are not ordered")
+	}
+	if (Position{Version: 3}).Compare(Position{Version: 10}) != -1 {
+		t.Error("versions are not ordered")
+	}
+	if a.String() != "0x0000002A000000100001" || (Position{Version: 7}).String() != "7" {
+		t.Errorf("got %s", a)
+	}
+}
@@ -0,0 +1,113 @@
+package cdc
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Store saves the positions of consumers by name.
+type Store interface {
+	// Load returns the saved position, ok is false when there is none.
+	Load(ctx context.Context, name string) (pos Position, ok bool, err error)
+	Save(ctx context.Context, name string, pos Position) error
+}
+
+// MemoryStore keeps the positions in memory, the zero value is ready to
+// use.
+type MemoryStore struct {
+	mu        sync.Mutex
+	positions map[string]Position
+}
+
+// Load returns the position saved with name.
+func (s *MemoryStore) Load(ctx context.Context, name string) (Position, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pos, ok := s.positions[name]
+	return pos, ok, nil
+}
+
+// Save saves the position with name.
+func (s *MemoryStore) Save(ctx context.Context, name string, pos Position) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.positions == nil {
+		s.positions = make(map[string]Position)
+	}
+	s.positions[name] = pos
+	return nil
+}
+
+// DefaultTable is the table of the positions used when TableStore.Table
+// is empty.
+const DefaultTable = "dbo.cdc_position"
+
+// Execer saves positions, it is implemented by *sql.DB, *sql.Conn and
+// *sql.Tx.
+type Execer interface {
+	Queryer
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// TableStore saves the positions in a table of the database, which is
+// created when missing. With a transaction as DB, positions are saved
+// with the changes of the transaction.
+type TableStore struct {
+	DB Execer
+
+	// Table is the name of the table, as written in SQL such as
+	// "dbo.cdc_position". DefaultTable is used when empty.
+	Table string
+}
+
+func (s *TableStore) table() string {
+	if s.Table == "" {
+		return DefaultTable
+	}
+	return s.Table
+}
+
+// Load returns the position saved with name.
+func (s *TableStore) Load(ctx context.Context, name string) (Position, bool, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+IF OBJECT_ID(@table, 'U') IS NOT NULL
+SELECT lsn, version FROM `+s.table()+` WHERE name = @name`,
+		sql.Named("table", s.table()), sql.Named("name", name))
+	if err != nil {
+		return Position{}, false, err
+	}
+	defer rows.Close()
+	var pos Position
+	var version sql.NullInt64
+	ok := false
+	for rows.Next() {
+		if err = rows.Scan(&pos.LSN, &version); err != nil {
+			return Position{}, false, err
+		}
+		pos.Version = version.Int64
+		ok = true
+	}
+	return pos, ok, rows.Err()
+}
+
+// Save saves the position with name.
+func (s *TableStore) Save(ctx context.Context, name string, pos Position) error {
+	var version sql.NullInt64
+	if pos.LSN == nil {
+		version = sql.NullInt64{Int64: pos.Version, Valid: true}
+	}
+	_, err := s.DB.ExecContext(ctx, `
+IF OBJECT_ID(@table, 'U') IS NULL
+CREATE TABLE `+s.table()+` (
+	name nvarchar(256) NOT NULL PRIMARY KEY,
+	lsn binary(10) NULL,
+	version bigint NULL,
+	saved_on datetime2 NOT NULL
+)
+UPDATE `+s.table()+` SET lsn = @lsn, version = @version, saved_on = SYSUTCDATETIME() WHERE name = @name
+IF @@ROWCOUNT = 0
+INSERT INTO `+s.table()+` (name, lsn, version, saved_on) VALUES (@name, @lsn, @version, SYSUTCDATETIME())`,
+		sql.Named("table", s.table()), sql.Named("name", name), sql.Named("lsn", pos.LSN), sql.Named("version", version))
+	return err
+}
@@ -0,0 +1,230 @@
+package cdc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Tracking reads the changes of a table of Change Tracking with
+// CHANGETABLE(CHANGES ...), in the order of their versions. The values
+// of the changed rows are read from the table, use a snapshot isolation
+// transaction as Queryer for values consistent with the versions.
+type Tracking struct {
+	// Table is the name of the tracked table, as written in SQL such as
+	// "dbo.orders" or "[app].[order lines]".
+	Table string
+}
+
+// Name returns "ct:" followed by the table.
+func (s *Tracking) Name() string {
+	return "ct:" + s.Table
+}
+
+// trackedColumn is a column of a tracked table.
+type trackedColumn struct {
+	name       string
+	id         int
+	primaryKey bool
+}
+
+func (s *Tracking) poll(ctx context.Context, q Queryer, last *Position, resetOnLost bool, handle func(Event) error) (*Position, int, error) {
+	columns, err := s.columns(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var minVersion, current sql.NullInt64
+	rows, err := q.QueryContext(ctx, "SELECT CHANGE_TRACKING_MIN_VALID_VERSION(OBJECT_ID(@p1)), CHANGE_TRACKING_CURRENT_VERSION()", s.Table)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cdc: cannot read the versions of %s: %w", s.Table, err)
+	}
+	for rows.Next() {
+		err = rows.Scan(&minVersion, &current)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	if err != nil {
+		return nil, 0, fmt.Errorf("cdc: cannot read the versions of %s: %w", s.Table, err)
+	}
+	if !minVersion.Valid {
+		return nil, 0, fmt.Errorf("cdc: change tracking is not enabled for %s", s.Table)
+	}
+
+	from, err := trackingStart(last, minVersion.Int64, resetOnLost)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %s after version %d, the oldest valid version is %d", err, s.Table, last.Version, minVersion.Int64)
+	}
+	if !current.Valid || current.Int64 <= from {
+		return &Position{Version: from}, 0, nil
+	}
+
+	rows, err = q.QueryContext(ctx, trackingQuery(s.Table, columns), from, current.Int64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cdc: cannot read the changes of %s: %w", s.Table, err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		e, err := scanTrackingEvent(rows, columns)
+		if err != nil {
+			return nil, n, err
+		}
+		if err = handle(e); err != nil {
+			return nil, n, err
+		}
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return nil, n, err
+	}
+	return &Position{Version: current.Int64}, n, nil
+}
+
+// columns returns the columns of the table in their order.
+func (s *Tracking) columns(ctx context.Context, q Queryer) ([]trackedColumn, error) {
+	rows, err := q.QueryContext(ctx, `
+SELECT c.name, c.column_id, CAST(CASE WHEN ic.column_id IS NULL THEN 0 ELSE 1 END AS bit)
+FROM sys.columns c
+LEFT JOIN sys.indexes i ON i.object_id = c.object_id AND i.is_primary_key = 1
+LEFT JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id AND ic.column_id = c.column_id
+WHERE c.object_id = OBJECT_ID(@p1)
+ORDER BY c.column_id`, s.Table)
+	if err != nil {
+		return nil, fmt.Errorf("cdc: cannot read the columns of %s: %w", s.Table, err)
+	}
+	defer rows.Close()
+	var columns []trackedColumn
+	hasKey := false
+	for rows.Next() {
+		var c trackedColumn
+		if err = rows.Scan(&c.name, &c.id, &c.primaryKey); err != nil {
+			return nil, err
+		}
+		hasKey = hasKey || c.primaryKey
+		columns = append(columns, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(columns) == 0:
+		return nil, fmt.Errorf("cdc: table %s not found", s.Table)
+	case !hasKey:
+		return nil, fmt.Errorf("cdc: table %s has no primary key", s.Table)
+	}
+	return columns, nil
+}
+
+// trackingStart returns the version to read the changes after.
+func trackingStart(last *Position, minVersion int64, resetOnLost bool) (int64, error) {
+	if last == nil {
+		return minVersion, nil
+	}
+	if last.Version < minVersion {
+		if resetOnLost {
+			return minVersion, nil
+		}
+		return 0, ErrChangesLost
+	}
+	return last.Version, nil
+}
+
+// trackingQuery returns the query of the changes of a table between two
+// versions, @p1 excluded. It selects the version, the operation, whether
+// the columns of updates are known, the primary key of the change, then
+// the value of each column of the table and whether it was updated.
+func trackingQuery(table string, columns []trackedColumn) string {
+	var sel, join []string
+	for _, c := range columns {
+		if c.primaryKey {
+			sel = append(sel, "ct."+quoteName(c.name))
+			join = append(join, "t."+quoteName(c.name)+" = ct."+quoteName(c.name))
+		}
+	}
+	for _, c := range columns {
+		sel = append(sel, "t."+quoteName(c.name), fmt.Sprintf("ISNULL(CHANGE_TRACKING_IS_COLUMN_IN_MASK(%d, ct.SYS_CHANGE_COLUMNS), 0)", c.id))
+	}
+	return `
+SELECT ct.SYS_CHANGE_VERSION, ct.SYS_CHANGE_OPERATION, CAST(CASE WHEN ct.SYS_CHANGE_COLUMNS IS NULL THEN 0 ELSE 1 END AS bit),
+	` + strings.Join(sel, ", ") + `
+FROM CHANGETABLE(CHANGES ` + table + `, @p1) AS ct
+LEFT JOIN ` + table + ` AS t ON ` + strings.Join(join, " AND ") + `
+WHERE ct.SYS_CHANGE_VERSION <= @p2
+ORDER BY ct.SYS_CHANGE_VERSION`
+}
+
+// scanner is implemented by *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTrackingEvent scans a row of trackingQuery.
+func scanTrackingEvent(rows scanner, columns []trackedColumn) (Event, error) {
+	var (
+		version    int64
+		op         string
+		hasUpdated bool
+		keys       []interface{}
+		values     = make([]interface{}, len(columns))
+		updated    = make([]bool, len(columns))
+		dest       = []interface{}{&version, &op, &hasUpdated}
+		keyColumns []string
+	)
+	for _, c := range columns {
+		if c.primaryKey {
+			keys = append(keys, nil)
+			keyColumns = append(keyColumns, c.name)
+		}
+	}
+	for i := range keys {
+		dest = append(dest, &keys[i])
+	}
+	for i := range columns {
+		dest = append(dest, &values[i], &updated[i])
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return Event{}, err
+	}
+
+	e := Event{Position: Position{Version: version}, Row: make(map[string]interface{}, len(columns))}
+	switch op {
+	case "I":
+		e.Op = Insert
+	case "U":
+		e.Op = Update
+	case "D":
+		e.Op = Delete
+	default:
+		return e, fmt.Errorf("cdc: invalid change tracking operation %q", op)
+	}
+	// the row was deleted since when its primary key is not joined
+	joined := false
+	for i, c := range columns {
+		if c.primaryKey && values[i] != nil {
+			joined = true
+			break
+		}
+	}
+	if e.Op == Delete || !joined {
+		for i, name := range keyColumns {
+			e.Row[name] = keys[i]
+		}
+		return e, nil
+	}
+	for i, c := range columns {
+		e.Row[c.name] = values[i]
+	}
+	if e.Op == Update && hasUpdated {
+		e.Updated = []string{}
+		for i, c := range columns {
+			if updated[i] {
+				e.Updated = append(e.Updated, c.name)
+			}
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,195 @@
+package cdc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/denisenkom/go-mssqldb"
+)
+
+func TestTrackingStart(t *testing.T) {
+	values := []struct {
+		last  *Position
+		min   int64
+		reset bool
+		from  int64
+		err   error
+	}{
+		{nil, 4, false, 4, nil},
+		{&Position{Version: 4}, 4, false, 4, nil},
+		{&Position{Version: 9}, 4, false, 9, nil},
+		{&Position{Version: 3}, 4, false, 0, ErrChangesLost},
+		{&Position{Version: 3}, 4, true, 4, nil},
+	}
+	for _, v := range values {
+		from, err := trackingStart(v.last, v.min, v.reset)
+		if from != v.from || err != v.err {
+			t.Errorf("%v after %d: got %d, %v", v.last, v.min, from, err)
+		}
+	}
+}
+
+func TestTrackingQuery(t *testing.T) {
+	columns := []trackedColumn{{"id", 1, true}, {"name", 2, false}, {"line", 3, true}}
+	q := trackingQuery("dbo.orders", columns)
+	for _, want := range []string{
+		"ct.[id], ct.[line], t.[id], ISNULL(CHANGE_TRACKING_IS_COLUMN_IN_MASK(1, ct.SYS_CHANGE_COLUMNS), 0), t.[name]",
+		"FROM CHANGETABLE(CHANGES dbo.orders, @p1) AS ct",
+		"LEFT JOIN dbo.orders AS t ON t.[id] = ct.[id] AND t.[line] = ct.[line]",
+	} {
+		if !strings.Contains(q, want) {
+			t.Errorf("query has no %q:\n%s", want, q)
+		}
+	}
+}
+
+type testRow []interface{}
+
+func (r testRow) Scan(dest ...interface{}) error {
+	if len(dest) != len(r) {
+		return fmt.Errorf("%d values for %d destinations", len(r), len(dest))
+	}
+	for i, v := range r {
+		switch d := dest[i].(type) {
+		case *int64:
+			*d = v.(int64)
+		case *string:
+			*d = v.(string)
+		case *bool:
+			*d = v.(bool)
+		case *interface{}:
+			*d = v
+		}
+	}
+	return nil
+}
+
+func TestScanTrackingEvent(t *testing.T) {
+	columns := []trackedColumn{{"id", 1, true}, {"name", 2, false}}
+	values := []struct {
+		row  testRow
+		want Event
+	}{
+		{
+			testRow{int64(5), "U", true, int64(1), int64(1), false, "b", true},
+			Event{Op: Update, Position: Position{Version: 5}, Row: map[string]interface{}{"id": int64(1), "name": "b"}, Updated: []string{"name"}},
+		},
+		{
+			testRow{int64(6), "U", false, int64(1), int64(1), true, "b", true},
+			Event{Op: Update, Position: Position{Version: 6}, Row: map[string]interface{}{"id": int64(1), "name": "b"}},
+		},
+		// deleted since
+		{
+			testRow{int64(7), "I", false, int64(2), nil, false, nil, false},
+			Event{Op: Insert, Position: Position{Version: 7}, Row: map[string]interface{}{"id": int64(2)}},
+		},
+		{
+			testRow{int64(8), "D", false, int64(3), nil, false, nil, false},
+			Event{Op: Delete, Position: Position{Version: 8}, Row: map[string]interface{}{"id": int64(3)}},
+		},
+	}
+	for _, v := range values {
+		e, err := scanTrackingEvent(v.row, columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(e, v.want) {
+			t.Errorf("got %+v, want %+v", e, v.want)
+		}
+	}
+	if _, err := scanTrackingEvent(testRow{int64(9), "X", false, int64(1), nil, false, nil, false}, columns); err == nil {
+		t.Error("no error for operation X")
+	}
+}
+
+func TestTracking(t *testing.T) {
+	dsn := os.Getenv("SQLSERVER_DSN")
+	if dsn == "" {
+		t.Skip("no SQLSERVER_DSN")
+	}
+	db, err := sql.Open("sqlserver", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	_, err = db.Exec("IF NOT EXISTS (SELECT * FROM sys.change_tracking_databases WHERE database_id = DB_ID()) ALTER DATABASE CURRENT SET CHANGE_TRACKING = ON")
+	if err != nil {
+		t.Skip("cannot enable change tracking:", err)
+	}
+	table := fmt.Sprint("cdc_tracked_", time.Now().UnixNano())
+	store := fmt.Sprint("dbo.cdc_position_", time.Now().UnixNano())
+	_, err = db.Exec(`
+CREATE TABLE ` + table + ` (id int NOT NULL PRIMARY KEY, name nvarchar(50) NULL, price int NULL)
+ALTER TABLE ` + table + ` ENABLE CHANGE_TRACKING WITH (TRACK_COLUMNS_UPDATED = ON)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE " + table + "; DROP TABLE " + store)
+
+	c := &Consumer{Source: &Tracking{Table: table}, Store: &TableStore{DB: db, Table: store}}
+	var events []Event
+	handle := func(e Event) error {
+		events = append(events, e)
+		return nil
+	}
+	if n, err := c.Poll(ctx, db, handle); err != nil || n != 0 {
+		t.Fatalf("got %d changes, error %v", n, err)
+	}
+	_, err = db.Exec(`
+INSERT INTO ` + table + ` VALUES (1, N'a', 10), (2, N'b', 20)
+UPDATE ` + table + ` SET price = 11 WHERE id = 1
+DELETE FROM ` + table + ` WHERE id = 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Poll(ctx, db, handle); err != nil {
+		t.Fatal(err)
+	}
+	// changes are merged by row
+	inserted := false
+	for _, e := range events {
+		switch e.Row["id"] {
+		case int64(1):
+			inserted = e.Op == Insert && e.Row["price"] == int64(11)
+		case int64(2):
+			if len(e.Row) != 1 {
+				t.Errorf("got values of a deleted row %+v", e)
+			}
+		}
+	}
+	if !inserted {
+		t.Errorf("got events %+v", events)
+	}
+
+	// a new consumer resumes after the saved position
+	_, err = db.Exec("UPDATE " + table + " SET name = N'c' WHERE id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events = nil
+	c = &Consumer{Source: &Tracking{Table: table}, Store: &TableStore{DB: db, Table: store}}
+	if _, err = c.Poll(ctx, db, handle); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Op != Update || !reflect.DeepEqual(events[0].Updated, []string{"name"}) {
+		t.Errorf("got events %+v", events)
+	}
+
+	// positions before the oldest valid version are lost
+	err = (&TableStore{DB: db, Table: store}).Save(ctx, c.Source.Name(), Position{Version: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Poll(ctx, db, handle); !errors.Is(err, ErrChangesLost) {
+		t.Errorf("got error %v, want ErrChangesLost", err)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/denisenkom/go-mssqldb/sqlcmd"
+)
+
+// Output formats.
+const (
+	formatTable    = "table"
+	formatCSV      = "csv"
+	formatJSON     = "json"
+	formatVertical = "vertical"
+)
+
+// rowSource is the part of *sql.Rows read by the formats.
+type rowSource interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}
+
+// output writes the results of the batches in a format, it implements
+// sqlcmd.Output.
+type output struct {
+	format string
+	// footer writes the number of rows affected and the time of batches
+	footer bool
+
+	w    io.Writer // result sets
+	msg  io.Writer // messages and footers
+	errw io.Writer // errors
+
+	errors int
+}
+
+func (o *output) Rows(rows *sql.Rows) error {
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(columns))
+	types := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name()
+		types[i] = col.DatabaseTypeName()
+	}
+	return o.writeRows(names, types, rows)
+}
+
+func (o *output) writeRows(names, types []string, rows rowSource) error {
+	switch o.format {
+	case formatCSV:
+		return writeCSV(o.w, names, types, rows)
+	case formatJSON:
+		return writeJSON(o.w, names, types, rows)
+	case formatVertical:
+		return writeVertical(o.w, names, types, rows)
+	}
+	return writeTable(o.w, names, types, rows)
+}
+
+func (o *output) Message(msg string) {
+	fmt.Fprintln(o.msg, msg)
+}
+
+func (o *output) Error(err error) {
+	o.errors++
+	fmt.Fprintln(o.errw, sqlcmd.FormatError(err))
+}
+
+func (o *output) RowsAffected(count int64) {
+	if o.footer {
+		fmt.Fprintf(o.msg, "(%d rows affected)\n", count)
+	}
+}
+
+func (o *output) BatchDone(elapsed time.Duration) {
+	if o.footer {
+		fmt.Fprintf(o.msg, "Elapsed time: %s\n", elapsed.Round(time.Millisecond))
+	}
+}
+
+// scanRow returns a function reading the values of the next row.
+func scanRow(n int, rows rowSource) func() ([]interface{}, error) {
+	values := make([]interface{}, n)
+	dest := make([]interface{}, n)
+	for i := range dest {
+		dest[i] = &values[i]
+	}
+	return func() ([]interface{}, error) {
+		for i := range values {
+			values[i] = nil
+		}
+		return values, rows.Scan(dest...)
+	}
+}
+
+// formatValue formats a value of a column of a database type as text.
+func formatValue(v interface{}, typeName string) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case []byte:
+		switch typeName {
+		case "DECIMAL", "NUMERIC", "MONEY", "SMALLMONEY":
+			return string(v)
+		case "UNIQUEIDENTIFIER":
+			var id mssql.UniqueIdentifier
+			if id.Scan(v) == nil {
+				return id.String()
+			}
+		}
+		return fmt.Sprintf("0x%X", v)
+	case time.Time:
+		switch typeName {
+		case "DATE":
+			return v.Format("2006-01-02")
+		case "TIME":
+			return v.Format("15:04:05.9999999")
+		case "DATETIMEOFFSET":
+			return v.Format("2006-01-02 15:04:05.9999999 -07:00")
+		}
+		return v.Format("2006-01-02 15:04:05.9999999")
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// writeTable writes a result set as a table with aligned columns, the
+// rows are read before writing to know the widths of the columns.
+func writeTable(w io.Writer, names, types []string, rows rowSource) error {
+	widths := make([]int, len(names))
+	for i, name := range names {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+	var table [][]string
+	scan := scanRow(len(names), rows)
+	for rows.Next() {
+		values, err := scan()
+		if err != nil {
+			return err
+		}
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = formatValue(v, types[i])
+			if n := utf8.RuneCountInString(fields[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+		table = append(table, fields)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var line bytes.Buffer
+	writeLine := func(fields []string) {
+		line.Reset()
+		for i, f := range fields {
+			if i > 0 {
+				line.WriteByte(' ')
+			}
+			line.WriteString(f)
+			if i < len(fields)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(f)))
+			}
+		}
+		line.WriteByte('\n')
+		w.Write(line.Bytes())
+	}
+	writeLine(names)
+	separators := make([]string, len(names))
+	for i := range separators {
+		separators[i] = strings.Repeat("-", widths[i])
+	}
+	writeLine(separators)
+	for _, fields := range table {
+		writeLine(fields)
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// writeVertical writes each row as a record of a line per column.
+func writeVertical(w io.Writer, names, types []string, rows rowSource) error {
+	width := 0
+	for _, name := range names {
+		if n := utf8.RuneCountInString(name); n > width {
+			width = n
+		}
+	}
+	scan := scanRow(len(names), rows)
+	for n := 1; rows.Next(); n++ {
+		values, err := scan()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "-[ RECORD %d ]-\n", n)
+		for i, v := range values {
+			pad := strings.Repeat(" ", width-utf8.RuneCountInString(names[i]))
+			if _, err = fmt.Fprintf(w, "%s%s | %s\n", names[i], pad, formatValue(v, types[i])); err != nil {
+				return err
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// writeCSV writes a result set as CSV with a header, NULL values are
+// empty fields.
+func writeCSV(w io.Writer, names, types []string, rows rowSource) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(names); err != nil {
+		return err
+	}
+	fields := make([]string, len(names))
+	scan := scanRow(len(names), rows)
+	for rows.Next() {
+		values, err := scan()
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			fields[i] = ""
+			if v != nil {
+				fields[i] = formatValue(v, types[i])
+			}
+		}
+		if err = cw.Write(fields); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSON writes a result set as a JSON array of objects, one per line,
+// whose members are in the order of the columns.
+func writeJSON(w io.Writer, names, types []string, rows rowSource) error {
+	keys := make([][]byte, len(names))
+	for i, name := range names {
+		key, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+	var line bytes.Buffer
+	scan := scanRow(len(names), rows)
+	sep := "[\n"
+	for rows.Next() {
+		values, err := scan()
+		if err != nil {
+			return err
+		}
+		line.Reset()
+		line.WriteString(sep)
+		line.WriteByte('{')
+		for i, v := range values {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			line.Write(keys[i])
+			line.WriteByte(':')
+			value, err := json.Marshal(jsonValue(v, types[i]))
+			if err != nil {
+				return err
+			}
+			line.Write(value)
+		}
+		line.WriteByte('}')
+		if _, err = w.Write(line.Bytes()); err != nil {
+			return err
+		}
+		sep = ",\n"
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if sep == "[\n" {
+		_, err := io.WriteString(w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+// jsonValue returns the JSON value of a column value, numbers and
+// booleans are kept and decimals are written as numbers.
+func jsonValue(v interface{}, typeName string) interface{} {
+	switch v := v.(type) {
+	case nil, bool, int64, float64, string:
+		return v
+	case float32:
+		return json.Number(formatValue(v, typeName))
+	case []byte:
+		switch typeName {
+		case "DECIMAL", "NUMERIC", "MONEY", "SMALLMONEY":
+			return json.Number(string(v))
+		}
+	}
+	return formatValue(v, typeName)
+}
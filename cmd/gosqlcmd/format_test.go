@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRows is a result set read by the formats.
+type testRows struct {
+	rows [][]interface{}
+	i    int
+	err  error
+}
+
+func (r *testRows) Next() bool {
+	if r.i >= len(r.rows) {
+		return false
+	}
+	r.i++
+	return true
+}
+
+func (r *testRows) Scan(dest ...interface{}) error {
+	for i, v := range r.rows[r.i-1] {
+		*dest[i].(*interface{}) = v
+	}
+	return nil
+}
+
+func (r *testRows) Err() error {
+	return r.err
+}
+
+func TestFormats(t *testing.T) {
+	names := []string{"id", "name", "price", "created"}
+	types := []string{"INT", "NVARCHAR", "DECIMAL", "DATE"}
+	rows := func() *testRows {
+		return &testRows{rows: [][]interface{}{
+			{int64(1), "apple", []byte("1.25"), time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)},
+			{int64(22), "kiwi, green", nil, nil},
+			{int64(3), `"ümlaut"`, []byte("10.00"), time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC)},
+		}}
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{formatTable, `id name        price created
+-- ----------- ----- ----------
+1  apple       1.25  2021-03-04
+22 kiwi, green NULL  NULL
+3  "ümlaut"    10.00 2021-12-31
+
+`},
+		{formatCSV, `id,name,price,created
+1,apple,1.25,2021-03-04
+22,"kiwi, green",,
+3,"""ümlaut""",10.00,2021-12-31
+`},
+		{formatJSON, `[
+{"id":1,"name":"apple","price":1.25,"created":"2021-03-04"},
+{"id":22,"name":"kiwi, green","price":null,"created":null},
+{"id":3,"name":"\"ümlaut\"","price":10.00,"created":"2021-12-31"}
+]
+`},
+		{formatVertical, `-[ RECORD 1 ]-
+id      | 1
+name    | apple
+price   | 1.25
+created | 2021-03-04
+-[ RECORD 2 ]-
+id      | 22
+name    | kiwi, green
+price   | NULL
+created | NULL
+-[ RECORD 3 ]-
+id      | 3
+name    | "ümlaut"
+price   | 10.00
+created | 2021-12-31
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			o := &output{format: test.format, w: &buf}
+			if err := o.writeRows(names, types, rows()); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatsEmpty(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{formatTable, "id\n--\n\n"},
+		{formatCSV, "id\n"},
+		{formatJSON, "[]\n"},
+		{formatVertical, ""},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		o := &output{format: test.format, w: &buf}
+		if err := o.writeRows([]string{"id"}, []string{"INT"}, &testRows{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.format, got, test.want)
+		}
+	}
+}
+
+func TestFormatsRowsError(t *testing.T) {
+	rowsErr := errors.New("connection lost")
+	for _, format := range []string{formatTable, formatCSV, formatJSON, formatVertical} {
+		o := &output{format: format, w: &bytes.Buffer{}}
+		err := o.writeRows([]string{"id"}, []string{"INT"}, &testRows{err: rowsErr})
+		if err != rowsErr {
+			t.Errorf("%s: got error %v, want %v", format, err, rowsErr)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 120000000, time.FixedZone("", -5*3600))
+	tests := []struct {
+		value    interface{}
+		typeName string
+		want     string
+	}{
+		{nil, "INT", "NULL"},
+		{true, "BIT", "1"},
+		{false, "BIT", "0"},
+		{int64(-5), "BIGINT", "-5"},
+		{0.1, "FLOAT", "0.1"},
+		{float32(0.1), "REAL", "0.1"},
+		{[]byte("12.3400"), "NUMERIC", "12.3400"},
+		{[]byte("$"), "MONEY", "$"},
+		{[]byte{0xde, 0xad}, "VARBINARY", "0xDEAD"},
+		{[]byte{0x78, 0x56, 0x34, 0x12, 0x34, 0x12, 0x78, 0x56, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}, "UNIQUEIDENTIFIER", "12345678-1234-5678-1234-56789ABCDEF0"},
+		{ts, "DATE", "2021-03-04"},
+		{ts, "TIME", "05:06:07.12"},
+		{ts, "DATETIME2", "2021-03-04 05:06:07.12"},
+		{ts, "DATETIMEOFFSET", "2021-03-04 05:06:07.12 -05:00"},
+		{"text", "NVARCHAR", "text"},
+	}
+	for _, test := range tests {
+		if got := formatValue(test.value, test.typeName); got != test.want {
+			t.Errorf("formatValue(%v, %s) = %q, want %q", test.value, test.typeName, got, test.want)
+		}
+	}
+}
+
+func TestOutputFooter(t *testing.T) {
+	var msg, errw bytes.Buffer
+	o := &output{footer: true, msg: &msg, errw: &errw}
+	o.Message("hello")
+	o.RowsAffected(3)
+	o.BatchDone(1234567 * time.Microsecond)
+	o.Error(errors.New("failed"))
+	want := "hello\n(3 rows affected)\nElapsed time: 1.235s\n"
+	if msg.String() != want {
+		t.Errorf("got messages %q, want %q", msg.String(), want)
+	}
+	if !strings.Contains(errw.String(), "failed") || o.errors != 1 {
+		t.Errorf("got errors %q, count %d", errw.String(), o.errors)
+	}
+
+	msg.Reset()
+	o.footer = false
+	o.RowsAffected(3)
+	o.BatchDone(time.Second)
+	if msg.Len() != 0 {
+		t.Errorf("got footer %q without footer", msg.String())
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	o, err := parseFlags([]string{"-S", `host\inst`, "-i", "a.sql,b.sql", "-i", "c.sql", "-v", "x=1", "-f", "json", "-footer=false"}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.server != `host\inst` || len(o.inputs) != 2 || len(o.vars) != 1 || o.format != formatJSON || o.footer || o.separator != "GO" {
+		t.Errorf("unexpected options %+v", o)
+	}
+
+	bad := [][]string{
+		{"-f", "xml"},
+		{"-i", "a.sql", "-Q", "SELECT 1"},
+		{"extra"},
+		{"-l", "soon"},
+	}
+	for _, args := range bad {
+		if _, err := parseFlags(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("parseFlags(%q) succeeded, want error", args)
+		}
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	var stderr bytes.Buffer
+	if code := run([]string{"-v", "novalue"}, strings.NewReader(""), &bytes.Buffer{}, &stderr); code != exitFailure {
+		t.Errorf("got exit code %d, want %d", code, exitFailure)
+	}
+	if !strings.Contains(stderr.String(), "novalue") {
+		t.Errorf("got %q, want the invalid variable", stderr.String())
+	}
+}
+
+func TestConnector(t *testing.T) {
+	o := &options{database: "db", encrypt: true}
+	for _, server := range []string{"host", `host\inst`, "host,1434"} {
+		if _, err := o.connector(server, "sa", "p@ss;word"); err != nil {
+			t.Errorf("connector(%q): %v", server, err)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+// Command gosqlcmd runs SQL scripts and queries on SQL Server, as the
+// sqlcmd utility.
+//
+// Scripts are read from the files of -i, the query of -Q or the standard
+// input; when the standard input is a terminal the batches are read
+// interactively and run at each GO line. Scripts may use the sqlcmd
+// commands :setvar, :r, :on error and :connect and $(Var) variables
+// defined with -v.
+//
+//	gosqlcmd -S localhost -U sa -P secret -d master -Q "SELECT name FROM sys.databases"
+//	gosqlcmd -S myserver.database.windows.net -G ActiveDirectoryDefault -i setup.sql -f json
+//
+// The exit code is 0 when all the batches ran, 1 when a batch failed and
+// 2 when the script could not be read or the connection failed.
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/denisenkom/go-mssqldb/azuread"
+	"github.com/denisenkom/go-mssqldb/sqlcmd"
+)
+
+// Exit codes.
+const (
+	exitOK         = 0
+	exitBatchError = 1
+	exitFailure    = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// listFlag is a flag that may be repeated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// options are the command-line flags.
+type options struct {
+	server       string
+	user         string
+	password     string
+	database     string
+	fedAuth      string
+	dsn          string
+	encrypt      bool
+	trustCert    bool
+	loginTimeout int
+
+	inputs    listFlag
+	query     string
+	vars      listFlag
+	separator string
+	exitOnErr bool
+	outFile   string
+	format    string
+	footer    bool
+}
+
+func parseFlags(args []string, stderr io.Writer) (*options, error) {
+	var o options
+	fs := flag.NewFlagSet("gosqlcmd", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&o.server, "S", "localhost", "server `name`, as host, host\\instance or host,port")
+	fs.StringVar(&o.user, "U", "", "login `id`")
+	fs.StringVar(&o.password, "P", "", "`password`, the SQLCMDPASSWORD environment variable if empty")
+	fs.StringVar(&o.database, "d", "", "`database` name")
+	fs.StringVar(&o.fedAuth, "G", "", "Azure Active Directory authentication `method`, such as ActiveDirectoryDefault")
+	fs.StringVar(&o.dsn, "dsn", "", "connection `string`, replacing the connection flags")
+	fs.BoolVar(&o.encrypt, "N", false, "encrypt the connection")
+	fs.BoolVar(&o.trustCert, "C", false, "trust the server certificate")
+	fs.IntVar(&o.loginTimeout, "l", 0, "login timeout in `seconds`")
+	fs.Var(&o.inputs, "i", "input `files`, comma separated or repeated")
+	fs.StringVar(&o.query, "Q", "", "`query` to run")
+	fs.Var(&o.vars, "v", "scripting variable `var=value`, may be repeated")
+	fs.StringVar(&o.separator, "c", "GO", "batch `separator`")
+	fs.BoolVar(&o.exitOnErr, "b", false, "exit at the first failed batch")
+	fs.StringVar(&o.outFile, "o", "", "output `file`")
+	fs.StringVar(&o.format, "f", formatTable, "output `format`: table, csv, json or vertical")
+	fs.BoolVar(&o.footer, "footer", true, "write the rows affected and the time of each batch")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	switch o.format {
+	case formatTable, formatCSV, formatJSON, formatVertical:
+	default:
+		return nil, fmt.Errorf("unknown output format %q", o.format)
+	}
+	if len(o.inputs) > 0 && o.query != "" {
+		return nil, errors.New("-i and -Q cannot be used together")
+	}
+	if o.password == "" {
+		o.password = os.Getenv("SQLCMDPASSWORD")
+	}
+	return &o, nil
+}
+
+// run runs the command and returns its exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	o, err := parseFlags(args, stderr)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "gosqlcmd:", err)
+		return exitFailure
+	}
+	vars := make(map[string]string, len(o.vars))
+	for _, v := range o.vars {
+		i := strings.IndexByte(v, '=')
+		if i <= 0 {
+			fmt.Fprintf(stderr, "gosqlcmd: invalid variable %q, expected var=value\n", v)
+			return exitFailure
+		}
+		vars[v[:i]] = v[i+1:]
+	}
+
+	w := stdout
+	if o.outFile != "" {
+		f, err := os.Create(o.outFile)
+		if err != nil {
+			fmt.Fprintln(stderr, "gosqlcmd:", err)
+			return exitFailure
+		}
+		defer f.Close()
+		bw := bufio.NewWriter(f)
+		defer bw.Flush()
+		w = bw
+	}
+	out := &output{format: o.format, footer: o.footer, w: w, msg: w, errw: stderr}
+	if o.format == formatCSV || o.format == formatJSON {
+		// keep the data parsable
+		out.msg = stderr
+	}
+
+	ctx := context.Background()
+	var connector driver.Connector
+	if o.dsn != "" {
+		connector, err = o.dsnConnector()
+	} else {
+		connector, err = o.connector(o.server, o.user, o.password)
+	}
+	var c conn
+	if err == nil {
+		err = connect(ctx, connector, o.loginTimeout, &c)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "gosqlcmd:", err)
+		return exitFailure
+	}
+	defer c.Close()
+
+	runner := &sqlcmd.Runner{
+		Vars:        vars,
+		Output:      out,
+		ExitOnError: o.exitOnErr,
+		Separator:   o.separator,
+		Connect: func(ctx context.Context, args sqlcmd.ConnectArgs) (sqlcmd.Queryer, error) {
+			timeout := o.loginTimeout
+			if args.LoginTimeout > 0 {
+				timeout = int(args.LoginTimeout / time.Second)
+			}
+			connector, err := o.connector(args.Server, args.User, args.Password)
+			if err != nil {
+				return nil, err
+			}
+			var c conn
+			if err = connect(ctx, connector, timeout, &c); err != nil {
+				return nil, err
+			}
+			return c, nil
+		},
+	}
+
+	switch {
+	case o.query != "":
+		err = runner.Run(ctx, c, o.query)
+	case len(o.inputs) > 0:
+		err = runFiles(ctx, runner, c, o.inputs)
+	case isTerminal(stdin):
+		err = interactive(ctx, runner, c, stdin, stdout, out)
+	default:
+		var script []byte
+		script, err = ioutil.ReadAll(stdin)
+		if err == nil {
+			err = runner.Run(ctx, c, string(script))
+		}
+	}
+
+	switch {
+	case err != nil && out.errors == 0:
+		// the script could not be read or parsed, or :connect failed
+		fmt.Fprintln(stderr, "gosqlcmd:", err)
+		return exitFailure
+	case err != nil || out.errors > 0:
+		return exitBatchError
+	}
+	return exitOK
+}
+
+// runFiles runs the input files in order, each flag value may be a comma
+// separated list of files.
+func runFiles(ctx context.Context, runner *sqlcmd.Runner, q sqlcmd.Queryer, inputs []string) error {
+	for _, input := range inputs {
+		for _, name := range strings.Split(input, ",") {
+			if err := runner.RunFile(ctx, q, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dsnConnector returns the connector of the connection string of -dsn.
+func (o *options) dsnConnector() (driver.Connector, error) {
+	if o.fedAuth != "" {
+		return azuread.NewConnector(o.dsn)
+	}
+	return mssql.NewConnector(o.dsn)
+}
+
+// connector returns the connector of a server and login with the
+// connection flags.
+func (o *options) connector(server, user, password string) (driver.Connector, error) {
+	u := &url.URL{Scheme: "sqlserver", Host: server}
+	if i := strings.IndexByte(server, '\\'); i >= 0 {
+		u.Host = server[:i]
+		u.Path = server[i+1:]
+	} else if i := strings.IndexByte(server, ','); i >= 0 {
+		u.Host = server[:i] + ":" + server[i+1:]
+	}
+	if user != "" {
+		u.User = url.UserPassword(user, password)
+	}
+	query := url.Values{}
+	query.Set("app name", "gosqlcmd")
+	if o.database != "" {
+		query.Set("database", o.database)
+	}
+	if o.encrypt {
+		query.Set("encrypt", "true")
+	}
+	if o.trustCert {
+		query.Set("TrustServerCertificate", "true")
+	}
+	if o.fedAuth != "" {
+		query.Set("fedauth", o.fedAuth)
+	}
+	u.RawQuery = query.Encode()
+	if o.fedAuth != "" {
+		return azuread.NewConnector(u.String())
+	}
+	return mssql.NewConnector(u.String())
+}
+
+// conn is a connection with the pool that opened it.
+type conn struct {
+	*sql.Conn
+	db *sql.DB
+}
+
+func (c conn) Close() error {
+	c.Conn.Close()
+	return c.db.Close()
+}
+
+// connect opens a connection, a single connection is used so that the
+// session, such as temporary tables and SET options, is kept between
+// batches.
+func connect(ctx context.Context, connector driver.Connector, loginTimeout int, c *conn) error {
+	db := sql.OpenDB(connector)
+	if loginTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(loginTimeout)*time.Second)
+		defer cancel()
+	}
+	sc, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("cannot connect: %v", err)
+	}
+	*c = conn{Conn: sc, db: db}
+	return nil
+}
+
+// interactive reads batches from a terminal, each batch is run when a
+// separator line is read.
+func interactive(ctx context.Context, runner *sqlcmd.Runner, q sqlcmd.Queryer, stdin io.Reader, stdout io.Writer, out *output) error {
+	runner.KeepVars = true
+	separator := strings.ToUpper(runner.Separator)
+	scanner := bufio.NewScanner(stdin)
+	var script strings.Builder
+	n := 1
+	for {
+		fmt.Fprintf(stdout, "%d> ", n)
+		if !scanner.Scan() {
+			fmt.Fprintln(stdout)
+			return scanner.Err()
+		}
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 1 && script.Len() == 0 {
+			switch strings.ToLower(fields[0]) {
+			case "exit", "quit":
+				return nil
+			}
+		}
+		script.WriteString(line)
+		script.WriteByte('\n')
+		n++
+		if len(fields) == 0 || strings.ToUpper(fields[0]) != separator || !isCount(fields[1:]) {
+			continue
+		}
+		failed := out.errors
+		err := runner.Run(ctx, q, script.String())
+		script.Reset()
+		n = 1
+		if err != nil && runner.ExitOnError {
+			return err
+		}
+		if err != nil && out.errors == failed {
+			// errors of batches are already written
+			fmt.Fprintln(out.errw, "gosqlcmd:", err)
+		}
+	}
+}
+
+// isCount tells whether the arguments of a separator line are empty or a
+// repeat count.
+func isCount(args []string) bool {
+	switch len(args) {
+	case 0:
+		return true
+	case 1:
+		_, err := strconv.Atoi(args[0])
+		return err == nil
+	}
+	return false
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
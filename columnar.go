@@ -0,0 +1,430 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"io"
+	"math"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/denisenkom/go-mssqldb/columnar"
+)
+
+// columnarBatch is the token of a batch made by the sink of a columnar query.
+type columnarBatch struct {
+	batch interface{}
+}
+
+// QueryColumnar runs query and decodes the rows of its result sets into
+// sink, the returned rows iterate the batches made by sink. Arguments are
+// checked like the arguments of database/sql queries.
+func (c *Conn) QueryColumnar(ctx context.Context, query string, args []driver.NamedValue, sink columnar.Sink) (_ columnar.Rows, err error) {
+	// the outputs set by the arguments and the sink are only cleared
+	// once the response is processed
+	defer func() {
+		if err != nil {
+			c.clearOuts()
+		}
+	}()
+	// check the arguments as database/sql does
+	checked := make([]driver.NamedValue, 0, len(args))
+	for _, nv := range args {
+		err = c.CheckNamedValue(&nv)
+		if err == driver.ErrRemoveArgument {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		checked = append(checked, nv)
+	}
+	stmt, err := c.prepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	// the rows are decoded into sink by the goroutine processing the
+	// response, which passes the batches made by sink as columnarBatch
+	// tokens
+	c.outs.sink = sink
+	rows, err := stmt.QueryContext(ctx, checked)
+	if err != nil {
+		return nil, err
+	}
+	return columnarRows{rows.(*Rows)}, nil
+}
+
+type columnarRows struct {
+	rows *Rows
+}
+
+func (cr columnarRows) Columns() []columnar.Column {
+	return columnarColumns(cr.rows.cols)
+}
+
+func (cr columnarRows) NextBatch() (interface{}, error) {
+	rc := cr.rows
+	if !rc.stmt.c.connectionGood {
+		return nil, driver.ErrBadConn
+	}
+	if rc.nextCols != nil {
+		return nil, io.EOF
+	}
+	for {
+		tok, err := rc.reader.nextToken()
+		if err != nil {
+			return nil, rc.stmt.c.checkBadConn(rc.reader.ctx, err, false)
+		}
+		switch tokdata := tok.(type) {
+		case nil:
+			return nil, io.EOF
+		case columnarBatch:
+			return tokdata.batch, nil
+		case []columnStruct:
+			rc.nextCols = tokdata
+			return nil, io.EOF
+		case doneStruct:
+			if tokdata.isError() {
+				return nil, rc.stmt.c.checkBadConn(rc.reader.ctx, tokdata.getError(), false)
+			}
+		case ReturnStatus:
+			if rc.reader.outs.returnStatus != nil {
+				*rc.reader.outs.returnStatus = tokdata
+			}
+		}
+	}
+}
+
+func (cr columnarRows) HasNextResultSet() bool {
+	return cr.rows.HasNextResultSet()
+}
+
+func (cr columnarRows) NextResultSet() error {
+	return cr.rows.NextResultSet()
+}
+
+func (cr columnarRows) Close() error {
+	return cr.rows.Close()
+}
+
+// columnarColumns describes columns for a columnar sink.
+func columnarColumns(cols []columnStruct) []columnar.Column {
+	res := make([]columnar.Column, len(cols))
+	for i, col := range cols {
+		c := columnar.Column{
+			Name:         col.ColName,
+			Kind:         columnarKind(col.ti),
+			DatabaseType: makeGoLangTypeName(col.ti),
+			Nullable:     col.Flags&colFlagNullable != 0,
+			Size:         col.ti.Size,
+			Precision:    int(col.ti.Prec),
+			Scale:        int(col.ti.Scale),
+		}
+		switch col.ti.TypeId {
+		case typeMoney, typeMoney4, typeMoneyN:
+			c.Precision, c.Scale = 19, 4
+			if col.ti.Size == 4 {
+				c.Precision = 10
+			}
+		case typeDateTime, typeDateTimeN:
+			c.Scale = 3
+			if col.ti.Size == 4 {
+				c.Scale = 0
+			}
+		case typeDateTim4:
+			c.Scale = 0
+		}
+		res[i] = c
+	}
+	return res
+}
+
+func columnarKind(ti typeInfo) columnar.Kind {
+	switch ti.TypeId {
+	case typeBit, typeBitN:
+		return columnar.KindBool
+	case typeInt1, typeInt2, typeInt4, typeInt8, typeIntN:
+		return columnar.KindInt
+	case typeFlt4, typeFlt8, typeFltN:
+		return columnar.KindFloat
+	case typeDecimal, typeDecimalN, typeNumeric, typeNumericN, typeMoney, typeMoney4, typeMoneyN:
+		return columnar.KindDecimal
+	case typeDateN:
+		return columnar.KindDate
+	case typeTimeN:
+		return columnar.KindTime
+	case typeDateTime, typeDateTimeN, typeDateTim4, typeDateTime2N:
+		return columnar.KindDateTime
+	case typeDateTimeOffsetN:
+		return columnar.KindDateTimeOffset
+	case typeChar, typeVarChar, typeBigChar, typeBigVarChar, typeText,
+		typeNChar, typeNVarChar, typeNText, typeXml:
+		return columnar.KindString
+	case typeBinary, typeVarBinary, typeBigBinary, typeBigVarBin, typeImage, typeUdt:
+		return columnar.KindBinary
+	case typeGuid:
+		return columnar.KindGUID
+	}
+	return columnar.KindOther
+}
+
+// columnarDecoder decodes rows into a sink, reusing its buffers for
+// the values.
+type columnarDecoder struct {
+	sink  columnar.Sink
+	kinds []columnar.Kind
+	data  []byte
+	text  []byte
+	nulls []byte
+	guid  [16]byte
+}
+
+func (d *columnarDecoder) begin(cols []columnStruct) {
+	d.kinds = d.kinds[:0]
+	for _, col := range cols {
+		d.kinds = append(d.kinds, columnarKind(col.ti))
+	}
+	d.sink.Begin(columnarColumns(cols))
+}
+
+// decodeRow decodes a ROW or, if nbc is set, an NBCROW token,
+// it reports whether the sink completed a batch.
+func (d *columnarDecoder) decodeRow(r *tdsBuffer, cols []columnStruct, nbc bool) bool {
+	if nbc {
+		d.nulls = d.buffer(d.nulls, (len(cols)+7)/8)
+		r.ReadFull(d.nulls)
+	}
+	for i := range cols {
+		if nbc && d.nulls[i/8]&(1<<(uint(i)%8)) != 0 {
+			d.sink.AppendNull(i)
+			continue
+		}
+		d.decodeValue(r, i, &cols[i].ti)
+	}
+	return d.sink.EndRow()
+}
+
+func (d *columnarDecoder) decodeValue(r *tdsBuffer, i int, ti *typeInfo) {
+	kind := d.kinds[i]
+	if kind == columnar.KindOther {
+		if v := ti.Reader(ti, r); v != nil {
+			d.sink.AppendValue(i, v)
+		} else {
+			d.sink.AppendNull(i)
+		}
+		return
+	}
+	buf, ok := d.readValue(r, ti)
+	if !ok {
+		d.sink.AppendNull(i)
+		return
+	}
+
+	switch kind {
+	case columnar.KindBool:
+		d.sink.AppendBool(i, buf[0] != 0)
+	case columnar.KindInt:
+		switch len(buf) {
+		case 1:
+			d.sink.AppendInt(i, int64(buf[0]))
+		case 2:
+			d.sink.AppendInt(i, int64(int16(binary.LittleEndian.Uint16(buf))))
+		case 4:
+			d.sink.AppendInt(i, int64(int32(binary.LittleEndian.Uint32(buf))))
+		case 8:
+			d.sink.AppendInt(i, int64(binary.LittleEndian.Uint64(buf)))
+		default:
+			badStreamPanicf("Invalid size %d for int value", len(buf))
+		}
+	case columnar.KindFloat:
+		switch len(buf) {
+		case 4:
+			d.sink.AppendFloat(i, float64(math.Float32frombits(binary.LittleEndian.Uint32(buf))))
+		case 8:
+			d.sink.AppendFloat(i, math.Float64frombits(binary.LittleEndian.Uint64(buf)))
+		default:
+			badStreamPanicf("Invalid size %d for float value", len(buf))
+		}
+	case columnar.KindDecimal:
+		d.decodeDecimal(i, ti, buf)
+	case columnar.KindDate:
+		d.sink.AppendTime(i, decodeDate(buf))
+	case columnar.KindTime:
+		sec, ns := decodeTimeInt(ti.Scale, buf)
+		d.sink.AppendTimeOfDay(i, int64(sec)*1e9+int64(ns))
+	case columnar.KindDateTime:
+		switch {
+		case ti.TypeId == typeDateTime2N:
+			d.sink.AppendTime(i, decodeDateTime2(ti.Scale, buf))
+		case len(buf) == 4:
+			d.sink.AppendTime(i, decodeDateTim4(buf))
+		default:
+			d.sink.AppendTime(i, decodeDateTime(buf))
+		}
+	case columnar.KindDateTimeOffset:
+		// the date and time are in UTC, followed by the offset
+		d.sink.AppendTime(i, decodeDateTime2(ti.Scale, buf[:len(buf)-2]))
+	case columnar.KindString:
+		switch ti.TypeId {
+		case typeNChar, typeNVarChar, typeNText, typeXml:
+			d.text = appendUcs2AsUTF8(d.text[:0], buf)
+			d.sink.AppendString(i, d.text)
+		default:
+			if isASCII(buf) {
+				d.sink.AppendString(i, buf)
+			} else {
+				d.text = append(d.text[:0], decodeChar(ti.Collation, buf)...)
+				d.sink.AppendString(i, d.text)
+			}
+		}
+	case columnar.KindBinary:
+		d.sink.AppendBytes(i, buf)
+	case columnar.KindGUID:
+		if len(buf) != 16 {
+			badStreamPanicf("Invalid size %d for uniqueidentifier value", len(buf))
+		}
+		copy(d.guid[:], buf)
+		d.guid[0], d.guid[1], d.guid[2], d.guid[3] = d.guid[3], d.guid[2], d.guid[1], d.guid[0]
+		d.guid[4], d.guid[5] = d.guid[5], d.guid[4]
+		d.guid[6], d.guid[7] = d.guid[7], d.guid[6]
+		d.sink.AppendBytes(i, d.guid[:])
+	}
+}
+
+// decodeDecimal passes a decimal or money value as a 128 bits integer.
+func (d *columnarDecoder) decodeDecimal(i int, ti *typeInfo, buf []byte) {
+	switch ti.TypeId {
+	case typeMoney, typeMoney4, typeMoneyN:
+		var v int64
+		switch len(buf) {
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(buf)))
+		case 8:
+			v = int64(uint64(binary.LittleEndian.Uint32(buf))<<32 | uint64(binary.LittleEndian.Uint32(buf[4:])))
+		default:
+			badStreamPanicf("Invalid size %d for money value", len(buf))
+		}
+		d.sink.AppendDecimal(i, v>>63, uint64(v))
+		return
+	}
+	if len(buf) < 1 || len(buf) > 17 {
+		badStreamPanicf("Invalid size %d for decimal value", len(buf))
+	}
+	// sign followed by the magnitude in little endian order
+	var le [16]byte
+	copy(le[:], buf[1:])
+	lo := binary.LittleEndian.Uint64(le[:8])
+	hi := binary.LittleEndian.Uint64(le[8:])
+	if buf[0] == 0 {
+		lo = ^lo + 1
+		hi = ^hi
+		if lo == 0 {
+			hi++
+		}
+	}
+	d.sink.AppendDecimal(i, int64(hi), lo)
+}
+
+// readValue reads the data of a value like the Reader of ti, ok is false
+// for NULL. The data is valid until the next call.
+func (d *columnarDecoder) readValue(r *tdsBuffer, ti *typeInfo) (buf []byte, ok bool) {
+	switch ti.TypeId {
+	case typeInt1, typeBit, typeInt2, typeInt4, typeDateTim4, typeFlt4,
+		typeMoney4, typeMoney, typeDateTime, typeFlt8, typeInt8:
+		d.data = d.buffer(d.data, ti.Size)
+	case typeText, typeNText, typeImage:
+		textptrsize := int(r.byte())
+		if textptrsize == 0 {
+			return nil, false
+		}
+		// text pointer and timestamp are ignored
+		d.data = d.buffer(d.data, textptrsize+8)
+		r.ReadFull(d.data)
+		size := r.int32()
+		if size == -1 {
+			return nil, false
+		}
+		d.data = d.buffer(d.data, int(size))
+	case typeXml, typeUdt:
+		return d.readPLP(r)
+	case typeBigVarBin, typeBigVarChar, typeBigBinary, typeBigChar, typeNVarChar, typeNChar:
+		if ti.Size == 0xffff {
+			return d.readPLP(r)
+		}
+		size := r.uint16()
+		if size == 0xffff {
+			return nil, false
+		}
+		d.data = d.buffer(d.data, int(size))
+	default:
+		// byte length types
+		size := r.byte()
+		if size == 0 {
+			return nil, false
+		}
+		d.data = d.buffer(d.data, int(size))
+	}
+	r.ReadFull(d.data)
+	return d.data, true
+}
+
+func (d *columnarDecoder) readPLP(r *tdsBuffer) ([]byte, bool) {
+	size := r.uint64()
+	if size == _PLP_NULL {
+		return nil, false
+	}
+	d.data = d.data[:0]
+	for {
+		chunksize := int(r.uint32())
+		if chunksize == 0 {
+			return d.data, true
+		}
+		n := len(d.data)
+		d.data = d.buffer(d.data, n+chunksize)
+		r.ReadFull(d.data[n:])
+	}
+}
+
+// buffer returns buf resized to n bytes, keeping its content.
+func (d *columnarDecoder) buffer(buf []byte, n int) []byte {
+	if cap(buf) < n {
+		grown := make([]byte, n, 2*n)
+		copy(grown, buf)
+		return grown
+	}
+	return buf[:n]
+}
+
+func isASCII(buf []byte) bool {
+	for _, c := range buf {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// appendUcs2AsUTF8 appends UCS-2 text to dst as UTF-8.
+func appendUcs2AsUTF8(dst []byte, buf []byte) []byte {
+	if len(buf)%2 != 0 {
+		badStreamPanicf("Invalid UCS2 encoding: odd length %d", len(buf))
+	}
+	var enc [utf8.UTFMax]byte
+	for i := 0; i < len(buf); i += 2 {
+		r := rune(binary.LittleEndian.Uint16(buf[i:]))
+		if utf16.IsSurrogate(r) && i+3 < len(buf) {
+			if r2 := utf16.DecodeRune(r, rune(binary.LittleEndian.Uint16(buf[i+2:]))); r2 != utf8.RuneError {
+				r = r2
+				i += 2
+			}
+		}
+		if r < utf8.RuneSelf {
+			dst = append(dst, byte(r))
+			continue
+		}
+		n := utf8.EncodeRune(enc[:], r)
+		dst = append(dst, enc[:n]...)
+	}
+	return dst
+}
@@ -0,0 +1,98 @@
+// Package columnar lets packages decode result sets into columnar
+// formats, such as the Apache Arrow record batches of the arrowbatch
+// module. The driver decodes the values of each row straight into a Sink,
+// without allocating a row of interface{} values, see Conn.QueryColumnar.
+package columnar
+
+import "time"
+
+// Kind is the kind of values of a column, it selects the Sink method
+// receiving them.
+type Kind int
+
+const (
+	// KindOther values are passed to AppendValue as decoded for Rows.
+	KindOther Kind = iota
+	// KindBool values are passed to AppendBool.
+	KindBool
+	// KindInt values are passed to AppendInt, Size is the size in
+	// bytes, tinyint has size 1 and is unsigned.
+	KindInt
+	// KindFloat values are passed to AppendFloat, Size is 4 or 8.
+	KindFloat
+	// KindDecimal values are passed to AppendDecimal, money has
+	// precision 19 and smallmoney precision 10, both have scale 4.
+	KindDecimal
+	// KindDate values are passed to AppendTime at midnight UTC.
+	KindDate
+	// KindTime values are passed to AppendTimeOfDay.
+	KindTime
+	// KindDateTime values are passed to AppendTime in UTC, the time
+	// zone of the column is unknown.
+	KindDateTime
+	// KindDateTimeOffset values are passed to AppendTime in UTC.
+	KindDateTimeOffset
+	// KindString values are passed to AppendString.
+	KindString
+	// KindBinary values are passed to AppendBytes.
+	KindBinary
+	// KindGUID values are passed to AppendBytes in RFC 4122 byte order.
+	KindGUID
+)
+
+// Column describes a column of a result set.
+type Column struct {
+	Name string
+	Kind Kind
+	// DatabaseType is the type name, as returned by
+	// Rows.ColumnTypeDatabaseTypeName.
+	DatabaseType string
+	Nullable     bool
+	// Size is the size of KindInt and KindFloat values.
+	Size int
+	// Precision and Scale of decimal values, Scale is also the number
+	// of fractional second digits of time values.
+	Precision int
+	Scale     int
+}
+
+// Sink receives the rows of result sets. Its methods are called by the
+// goroutine reading the response, col is the index of the column.
+type Sink interface {
+	// Begin starts a result set.
+	Begin(cols []Column)
+
+	AppendNull(col int)
+	AppendBool(col int, v bool)
+	AppendInt(col int, v int64)
+	AppendFloat(col int, v float64)
+	// AppendDecimal appends the unscaled value, a 128 bits two's
+	// complement integer.
+	AppendDecimal(col int, hi int64, lo uint64)
+	AppendTime(col int, v time.Time)
+	// AppendTimeOfDay appends nanoseconds since midnight.
+	AppendTimeOfDay(col int, ns int64)
+	// AppendString appends UTF-8 text, v is only valid during the call.
+	AppendString(col int, v []byte)
+	// AppendBytes appends binary data, v is only valid during the call.
+	AppendBytes(col int, v []byte)
+	AppendValue(col int, v interface{})
+
+	// EndRow ends a row, it reports whether a batch is complete.
+	EndRow() bool
+	// Flush returns the batch of rows appended since the last call,
+	// nil if there are none.
+	Flush() interface{}
+}
+
+// Rows iterates the batches of a query.
+type Rows interface {
+	// Columns returns the columns of the current result set.
+	Columns() []Column
+	// NextBatch returns the next batch of the result set,
+	// io.EOF at its end.
+	NextBatch() (interface{}, error)
+	HasNextResultSet() bool
+	NextResultSet() error
+	Close() error
+}
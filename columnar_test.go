@@ -0,0 +1,258 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denisenkom/go-mssqldb/columnar"
+	"github.com/denisenkom/go-mssqldb/internal/cp"
+)
+
+// recordingSink keeps the appended values, in batches of size rows.
+type recordingSink struct {
+	size int
+	cols []columnar.Column
+	row  []interface{}
+	rows [][]interface{}
+}
+
+type testDecimal struct {
+	hi int64
+	lo uint64
+}
+
+type testTimeOfDay int64
+
+func (s *recordingSink) Begin(cols []columnar.Column) {
+	s.cols = cols
+	s.row = make([]interface{}, len(cols))
+}
+func (s *recordingSink) AppendNull(col int)              { s.row[col] = nil }
+func (s *recordingSink) AppendBool(col int, v bool)      { s.row[col] = v }
+func (s *recordingSink) AppendInt(col int, v int64)      { s.row[col] = v }
+func (s *recordingSink) AppendFloat(col int, v float64)  { s.row[col] = v }
+func (s *recordingSink) AppendTime(col int, v time.Time) { s.row[col] = v }
+func (s *recordingSink) AppendTimeOfDay(col int, ns int64) {
+	s.row[col] = testTimeOfDay(ns)
+}
+func (s *recordingSink) AppendDecimal(col int, hi int64, lo uint64) {
+	s.row[col] = testDecimal{hi, lo}
+}
+func (s *recordingSink) AppendString(col int, v []byte)     { s.row[col] = string(v) }
+func (s *recordingSink) AppendBytes(col int, v []byte)      { s.row[col] = append([]byte(nil), v...) }
+func (s *recordingSink) AppendValue(col int, v interface{}) { s.row[col] = v }
+
+func (s *recordingSink) EndRow() bool {
+	s.rows = append(s.rows, s.row)
+	s.row = make([]interface{}, len(s.cols))
+	return s.size > 0 && len(s.rows)%s.size == 0
+}
+
+func (s *recordingSink) Flush() interface{} {
+	if len(s.rows) == 0 {
+		return nil
+	}
+	rows := s.rows
+	s.rows = nil
+	return rows
+}
+
+func TestColumnarDecodeRow(t *testing.T) {
+	latin1 := cp.Collation{LcidAndFlags: 0x0409, SortId: 52}
+	dto := time.Date(2021, 3, 4, 5, 6, 7, 123456700, time.FixedZone("", 2*3600))
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	uid := UniqueIdentifier{0x6F, 0x96, 0x19, 0xFF, 0x8B, 0x86, 0xD0, 0x11, 0xB4, 0x2D, 0x00, 0xC0, 0x4F, 0xC9, 0x64, 0xFF}
+	uidBytes, _ := uid.Value()
+	tests := []struct {
+		ti       typeInfo
+		in       interface{}
+		kind     columnar.Kind
+		expected interface{}
+	}{
+		{typeInfo{TypeId: typeInt4, Size: 4}, int64(-5), columnar.KindInt, int64(-5)},
+		{typeInfo{TypeId: typeIntN, Size: 1}, 255, columnar.KindInt, int64(255)},
+		{typeInfo{TypeId: typeIntN, Size: 8}, nil, columnar.KindInt, nil},
+		{typeInfo{TypeId: typeFltN, Size: 8}, 1.5, columnar.KindFloat, 1.5},
+		{typeInfo{TypeId: typeFltN, Size: 4}, 0.25, columnar.KindFloat, 0.25},
+		{typeInfo{TypeId: typeBitN, Size: 1}, true, columnar.KindBool, true},
+		{typeInfo{TypeId: typeDecimalN, Size: 9, Prec: 18, Scale: 2}, "-12.34", columnar.KindDecimal, testDecimal{-1, ^uint64(1234) + 1}},
+		{typeInfo{TypeId: typeDecimalN, Size: 17, Prec: 38, Scale: 0}, "18446744073709551616", columnar.KindDecimal, testDecimal{1, 0}},
+		{typeInfo{TypeId: typeMoneyN, Size: 8}, "-1.5", columnar.KindDecimal, testDecimal{-1, ^uint64(15000) + 1}},
+		{typeInfo{TypeId: typeMoney4, Size: 4}, "2.25", columnar.KindDecimal, testDecimal{0, 22500}},
+		{typeInfo{TypeId: typeNVarChar, Size: 100}, "ab©Я", columnar.KindString, "ab©Я"},
+		{typeInfo{TypeId: typeNVarChar, Size: 0xffff}, strings.Repeat("😀", 5000), columnar.KindString, strings.Repeat("😀", 5000)},
+		{typeInfo{TypeId: typeBigVarChar, Size: 100, Collation: latin1}, "café", columnar.KindString, "café"},
+		{typeInfo{TypeId: typeBigVarChar, Size: 100, Collation: latin1}, "plain", columnar.KindString, "plain"},
+		{typeInfo{TypeId: typeText, Size: 0x7fffffff, Collation: latin1}, "text", columnar.KindString, "text"},
+		{typeInfo{TypeId: typeNText, Size: 0x7ffffffe, Collation: latin1}, nil, columnar.KindString, nil},
+		{typeInfo{TypeId: typeXml}, "<a/>", columnar.KindString, "<a/>"},
+		{typeInfo{TypeId: typeBigVarBin, Size: 16}, []byte{1, 2}, columnar.KindBinary, []byte{1, 2}},
+		{typeInfo{TypeId: typeBigVarBin, Size: 0xffff}, nil, columnar.KindBinary, nil},
+		{typeInfo{TypeId: typeGuid, Size: 16}, uidBytes, columnar.KindGUID, uid[:]},
+		{typeInfo{TypeId: typeDateN}, tm, columnar.KindDate, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{typeInfo{TypeId: typeTimeN, Scale: 3}, tm.Add(5 * time.Millisecond), columnar.KindTime, testTimeOfDay((5*3600+6*60+7)*1e9 + 5e6)},
+		{typeInfo{TypeId: typeDateTime2N, Scale: 7}, dto, columnar.KindDateTime, time.Date(2021, 3, 4, 5, 6, 7, 123456700, time.UTC)},
+		{typeInfo{TypeId: typeDateTimeOffsetN, Scale: 7}, dto, columnar.KindDateTimeOffset, dto.UTC()},
+		{typeInfo{TypeId: typeDateTimeN, Size: 8}, tm, columnar.KindDateTime, tm},
+		{typeInfo{TypeId: typeDateTim4, Size: 4}, tm.Truncate(time.Minute), columnar.KindDateTime, tm.Truncate(time.Minute)},
+		{typeInfo{TypeId: typeVariant, Size: 8016}, int64(7), columnar.KindOther, int64(7)},
+	}
+
+	var buf bytes.Buffer
+	var row []interface{}
+	var bulkCols []columnStruct
+	for _, tt := range tests {
+		ti := tt.ti
+		if err := writeTypeInfo(&buf, &ti); err != nil {
+			t.Fatal(err)
+		}
+		switch ti.TypeId {
+		case typeText, typeNText, typeImage:
+			// table name parts of column metadata in a result set
+			buf.WriteByte(0)
+		}
+		bulkCols = append(bulkCols, columnStruct{ti: ti})
+		row = append(row, tt.in)
+	}
+	b := &Bulk{ctx: context.Background(), bulkColumns: bulkCols}
+	data, err := b.makeRowData(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the row twice, to check buffers are reused correctly
+	buf.Write(data[1:])
+	buf.Write(data[1:])
+
+	r := &tdsBuffer{packetSize: buf.Len(), rbuf: buf.Bytes(), rsize: buf.Len()}
+	cols := make([]columnStruct, len(tests))
+	for i := range cols {
+		cols[i] = columnStruct{ColName: fmt.Sprint("c", i), ti: readTypeInfo(r)}
+	}
+	sink := &recordingSink{}
+	d := &columnarDecoder{sink: sink}
+	d.begin(cols)
+	for i, tt := range tests {
+		if sink.cols[i].Kind != tt.kind {
+			t.Errorf("column %d has kind %d, want %d", i, sink.cols[i].Kind, tt.kind)
+		}
+	}
+	for n := 0; n < 2; n++ {
+		if d.decodeRow(r, cols, false) {
+			t.Error("batch without size should not be complete")
+		}
+	}
+	if r.rpos != r.rsize {
+		t.Errorf("%d bytes left after rows", r.rsize-r.rpos)
+	}
+	rows := sink.Flush().([][]interface{})
+	for n, got := range rows {
+		for i, tt := range tests {
+			if !reflect.DeepEqual(got[i], tt.expected) {
+				t.Errorf("row %d, column %d (%s): got %T %v, want %T %v", n, i, makeDecl(tt.ti), got[i], got[i], tt.expected, tt.expected)
+			}
+		}
+	}
+	if money := sink.cols[8]; money.Precision != 19 || money.Scale != 4 {
+		t.Errorf("money column has precision %d and scale %d", money.Precision, money.Scale)
+	}
+}
+
+func TestColumnarDecodeNbcRow(t *testing.T) {
+	cols := []columnStruct{
+		{ti: typeInfo{TypeId: typeIntN, Size: 4}},
+		{ti: typeInfo{TypeId: typeNVarChar, Size: 20}},
+	}
+	for i := range cols {
+		if err := writeTypeInfo(ioutil.Discard, &cols[i].ti); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := &Bulk{ctx: context.Background(), bulkColumns: cols[1:]}
+	data, err := b.makeRowData([]interface{}{"x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := append([]byte{1}, data[1:]...)
+	r := &tdsBuffer{packetSize: len(buf), rbuf: buf, rsize: len(buf)}
+	sink := &recordingSink{size: 1}
+	d := &columnarDecoder{sink: sink}
+	d.begin(cols)
+	if !d.decodeRow(r, cols, true) {
+		t.Error("batch of one row should be complete")
+	}
+	rows := sink.Flush().([][]interface{})
+	if !reflect.DeepEqual(rows, [][]interface{}{{nil, "x"}}) {
+		t.Errorf("unexpected rows %v", rows)
+	}
+}
+
+func TestColumnarQueryArguments(t *testing.T) {
+	c := &Conn{}
+	var rs ReturnStatus
+	args := []driver.NamedValue{{Ordinal: 1, Value: &rs}, {Name: "out", Ordinal: 2, Value: sql.Out{}}}
+	if _, err := c.QueryColumnar(context.Background(), "select 1", args, &recordingSink{}); err == nil {
+		t.Fatal("no error for a nil output destination")
+	}
+	if c.outs.returnStatus != nil || c.outs.params != nil || c.outs.sink != nil {
+		t.Errorf("outputs are kept after the failed query: %+v", c.outs)
+	}
+}
+
+func TestColumnarQuery(t *testing.T) {
+	dsn := makeConnStr(t)
+	tl := testLogger{t: t}
+	defer tl.StopLogging()
+	conn, err := driverWithProcess(t, &tl).open(context.Background(), dsn.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink := &recordingSink{size: 100}
+	rows, err := conn.QueryColumnar(context.Background(),
+		"select top 250 n = row_number() over (order by (select 1)), s = N'x' from sys.all_columns; select @p1 as v",
+		[]driver.NamedValue{{Ordinal: 1, Value: "abc"}}, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if cols := rows.Columns(); len(cols) != 2 || cols[0].Name != "n" || cols[0].Kind != columnar.KindInt {
+		t.Errorf("unexpected columns %v", cols)
+	}
+	var sizes []int
+	for {
+		batch, err := rows.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(batch.([][]interface{})))
+	}
+	if !reflect.DeepEqual(sizes, []int{100, 100, 50}) {
+		t.Errorf("got batches of %v rows", sizes)
+	}
+	if err = rows.NextResultSet(); err != nil {
+		t.Fatal(err)
+	}
+	batch, err := rows.NextBatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(batch, [][]interface{}{{"abc"}}) {
+		t.Errorf("unexpected batch %v", batch)
+	}
+	if _, err = rows.NextBatch(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
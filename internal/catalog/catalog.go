@@ -0,0 +1,36 @@
+// Package catalog lets packages of this module describe the types of the
+// catalog views, such as sys.columns, as the driver describes the columns
+// of result sets.
+//
+// This package is not subject to any API compatibility guarantee.
+package catalog
+
+// Type is a type as described by the catalog views.
+type Type struct {
+	// Name is the name of the system type, TYPE_NAME(system_type_id),
+	// such as nvarchar for a sysname column.
+	Name string
+	// MaxLength is the maximum length in bytes, -1 for max types.
+	MaxLength int
+	Precision int
+	Scale     int
+}
+
+// Description describes a type as the driver describes the columns of
+// result sets.
+type Description struct {
+	// DatabaseType is the name returned by
+	// Rows.ColumnTypeDatabaseTypeName, such as NVARCHAR.
+	DatabaseType string
+	// Decl is the declaration of the type, such as nvarchar(50).
+	Decl string
+	// Length is the length returned by Rows.ColumnTypeLength, in
+	// characters for strings, HasLength is false for types without a
+	// length.
+	Length    int64
+	HasLength bool
+}
+
+// Describe describes a system type, ok is false for the types the driver
+// does not describe, such as CLR types. It is set by the driver.
+var Describe func(t Type) (d Description, ok bool)
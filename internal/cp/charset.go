@@ -1,13 +1,46 @@
 package cp
 
+import (
+	"sync"
+	"unicode/utf8"
+)
+
 type charsetMap struct {
 	sb [256]rune    // single byte runes, -1 for a double byte character lead byte
 	db map[int]rune // double byte runes
+
+	once sync.Once
+	rev  map[rune]int // runes to single or double byte characters, built on first use
+}
+
+// reverse returns the map from runes to characters of the code page
+func (cm *charsetMap) reverse() map[rune]int {
+	cm.once.Do(func() {
+		cm.rev = make(map[rune]int, 256+len(cm.db))
+		for n, ch := range cm.db {
+			// several characters may map to the same rune, use the lowest one
+			if prev, ok := cm.rev[ch]; !ok || n < prev {
+				cm.rev[ch] = n
+			}
+		}
+		// single byte characters take precedence over double byte ones
+		for n := len(cm.sb) - 1; n >= 0; n-- {
+			ch := cm.sb[n]
+			if ch == -1 || ch == utf8.RuneError {
+				continue
+			}
+			cm.rev[ch] = n
+		}
+	})
+	return cm.rev
 }
 
 func collation2charset(col Collation) *charsetMap {
 	// http://msdn.microsoft.com/en-us/library/ms144250.aspx
 	// http://msdn.microsoft.com/en-us/library/ms144250(v=sql.105).aspx
+	if col.isUTF8() {
+		return nil
+	}
 	switch col.SortId {
 	case 30, 31, 32, 33, 34:
 		return cp437
@@ -111,3 +144,27 @@ func CharsetToUTF8(col Collation, s []byte) string {
 	}
 	return string(buf)
 }
+
+// UTF8ToCharset encodes s in the code page of the collation.
+// Characters that do not exist in the code page are replaced with '?',
+// the same way SQL Server converts nvarchar to varchar.
+func UTF8ToCharset(col Collation, s string) []byte {
+	cm := collation2charset(col)
+	if cm == nil {
+		return []byte(s)
+	}
+	rev := cm.reverse()
+	buf := make([]byte, 0, len(s))
+	for _, ch := range s {
+		n, ok := rev[ch]
+		switch {
+		case !ok:
+			buf = append(buf, '?')
+		case n > 0xff:
+			buf = append(buf, byte(n>>8), byte(n))
+		default:
+			buf = append(buf, byte(n))
+		}
+	}
+	return buf
+}
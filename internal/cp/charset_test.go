@@ -0,0 +1,59 @@
+package cp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUTF8ToCharset(t *testing.T) {
+	tests := []struct {
+		name      string
+		col       Collation
+		utf8      string
+		encoded   []byte
+		roundTrip bool
+	}{
+		{"ascii", Collation{LcidAndFlags: 0x0409, SortId: 52}, "hello", []byte("hello"), true},
+		{"cp1252", Collation{LcidAndFlags: 0x0409}, "café €", []byte{'c', 'a', 'f', 0xe9, ' ', 0x80}, true},
+		{"cp1251", Collation{LcidAndFlags: 0x0419}, "Привет", []byte{0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2}, true},
+		{"cp932", Collation{SortId: 192}, "aあ", []byte{'a', 0x82, 0xa0}, true},
+		{"unmapped", Collation{LcidAndFlags: 0x0409}, "a€Ж", []byte{'a', 0x80, '?'}, false},
+		{"utf8", Collation{LcidAndFlags: 0x0409 | 0x40<<20}, "Привет", []byte("Привет"), true},
+	}
+	for _, tt := range tests {
+		got := UTF8ToCharset(tt.col, tt.utf8)
+		if !bytes.Equal(got, tt.encoded) {
+			t.Errorf("%s: UTF8ToCharset() = % x, want % x", tt.name, got, tt.encoded)
+			continue
+		}
+		if !tt.roundTrip {
+			continue
+		}
+		if back := CharsetToUTF8(tt.col, got); back != tt.utf8 {
+			t.Errorf("%s: CharsetToUTF8() = %s, want %s", tt.name, back, tt.utf8)
+		}
+	}
+}
+
+func TestUTF8ToCharsetAllCodePages(t *testing.T) {
+	for _, cm := range []*charsetMap{cp437, cp850, cp874, cp1250, cp1251, cp1252, cp1253, cp1254, cp1255, cp1256, cp1257, cp1258, cp932, cp936, cp949, cp950} {
+		rev := cm.reverse()
+		for n, ch := range cm.sb {
+			if ch == -1 || ch == 0xfffd {
+				continue
+			}
+			if cm.sb[rev[ch]] != ch {
+				t.Errorf("rune %U of byte %#x maps back to %#x", ch, n, rev[ch])
+			}
+		}
+		for n, ch := range cm.db {
+			m := rev[ch]
+			if m <= 0xff && cm.sb[m] == ch {
+				continue
+			}
+			if cm.db[m] != ch {
+				t.Errorf("rune %U of %#x maps back to %#x", ch, n, m)
+			}
+		}
+	}
+}
@@ -18,3 +18,10 @@ func (c Collation) getFlags() uint32 {
 func (c Collation) getVersion() uint32 {
 	return (c.LcidAndFlags & 0xf0000000) >> 28
 }
+
+// isUTF8 reports whether the collation stores varchar data as UTF-8,
+// which is the case for the _UTF8 collations of SQL Server 2019 and later.
+func (c Collation) isUTF8() bool {
+	const fUTF8 = 0x40
+	return c.getFlags()&fUTF8 != 0
+}
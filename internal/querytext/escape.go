@@ -0,0 +1,353 @@
+package querytext
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Call is a query made of an ODBC call escape sequence whose arguments
+// are all parameters, such as {call dbo.proc(?, ?)}. It can be executed
+// as an RPC.
+type Call struct {
+	// Proc is the name of the procedure.
+	Proc string
+	// Params are the parameters passed as arguments, in order, such as
+	// @p1 or @name.
+	Params []string
+}
+
+// parseEscape translates an ODBC escape sequence, the opening brace has
+// been read.
+func parseEscape(p *parser) stateFunc {
+	body, ok := p.escapeBody()
+	if !ok {
+		p.write('{')
+		p.w.WriteString(p.translate(body))
+		return nil
+	}
+	keyword, rest := escapeKeyword(body)
+	switch strings.ToLower(keyword) {
+	case "d":
+		p.w.WriteString("CAST(" + p.translate(rest) + " AS date)")
+	case "t":
+		p.w.WriteString("CAST(" + p.translate(rest) + " AS time)")
+	case "ts":
+		p.w.WriteString("CAST(" + p.translate(rest) + " AS datetime2)")
+	case "fn":
+		p.w.WriteString(translateFunction(p.translate(rest)))
+	case "oj":
+		p.w.WriteString(p.translate(rest))
+	case "escape":
+		p.w.WriteString("ESCAPE " + p.translate(rest))
+	case "call", "?=call":
+		p.writeCall(rest)
+	default:
+		p.write('{')
+		p.w.WriteString(p.translate(body))
+		p.write('}')
+	}
+	return parseNormal
+}
+
+// escapeBody reads an escape sequence up to its closing brace, skipping
+// strings, quoted names, comments and nested escape sequences.
+func (p *parser) escapeBody() (string, bool) {
+	var body strings.Builder
+	var closing rune // end of the string, name or comment being read
+	var prev rune
+	depth := 0
+	for {
+		ch, ok := p.next()
+		if !ok {
+			return body.String(), false
+		}
+		switch {
+		case closing == '*':
+			if prev == '*' && ch == '/' {
+				closing = 0
+				body.WriteRune(ch)
+				prev = 0 // the slash does not start a comment
+				continue
+			}
+		case closing != 0:
+			if ch == closing {
+				closing = 0
+			}
+		case ch == '\'', ch == '"':
+			closing = ch
+		case ch == '[':
+			closing = ']'
+		case ch == '-' && prev == '-':
+			closing = '\n'
+		case ch == '*' && prev == '/':
+			closing = '*'
+			body.WriteRune(ch)
+			prev = 0 // the star does not end the comment
+			continue
+		case ch == '{':
+			depth++
+		case ch == '}':
+			if depth == 0 {
+				return body.String(), true
+			}
+			depth--
+		}
+		body.WriteRune(ch)
+		prev = ch
+	}
+}
+
+// escapeKeyword splits an escape sequence into its keyword and the rest,
+// the keyword of {?= call ...} is ?=call.
+func escapeKeyword(body string) (string, string) {
+	s := strings.TrimLeft(body, " \t\r\n")
+	prefix := ""
+	if strings.HasPrefix(s, "?") {
+		rest := strings.TrimLeft(s[1:], " \t\r\n")
+		if !strings.HasPrefix(rest, "=") {
+			return "", body
+		}
+		prefix = "?="
+		s = strings.TrimLeft(rest[1:], " \t\r\n")
+	}
+	i := 0
+	for i < len(s) && ('a' <= s[i] && s[i] <= 'z' || 'A' <= s[i] && s[i] <= 'Z') {
+		i++
+	}
+	return prefix + s[:i], strings.TrimLeft(s[i:], " \t\r\n")
+}
+
+// translate rewrites the text of an escape sequence, numbering its
+// parameters after those already read.
+func (p *parser) translate(s string) string {
+	sub := &parser{
+		r:           bytes.NewReader([]byte(s)),
+		paramCount:  p.paramCount,
+		paramMax:    p.paramMax,
+		namedParams: p.namedParams,
+	}
+	state := parseNormal
+	for state != nil {
+		state = state(sub)
+	}
+	p.paramCount = sub.paramCount
+	p.paramMax = sub.paramMax
+	return sub.w.String()
+}
+
+// writeCall writes a call escape as an EXEC statement, it records the
+// call when its arguments are parameters.
+func (p *parser) writeCall(s string) {
+	s = strings.TrimSpace(s)
+	name := s
+	var args []string
+	if i := indexTopLevel(s, '('); i >= 0 && strings.HasSuffix(s, ")") {
+		name = strings.TrimSpace(s[:i])
+		for _, arg := range splitTopLevel(s[i+1:len(s)-1], ',') {
+			args = append(args, p.translate(arg))
+		}
+	}
+	p.calls++
+	start := p.w.Len()
+	p.w.WriteString("EXEC " + name)
+	if len(args) > 0 {
+		p.w.WriteString(" " + strings.Join(args, ", "))
+	}
+	for _, arg := range args {
+		if !isParameter(arg) {
+			return
+		}
+	}
+	p.call = &Call{Proc: name, Params: args}
+	p.callStart, p.callEnd = start, p.w.Len()
+}
+
+func isParameter(s string) bool {
+	if len(s) < 2 || s[0] != '@' {
+		return false
+	}
+	for _, ch := range s[1:] {
+		if !(ch >= '0' && ch <= '9' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// scanTopLevel calls fn with the index of each byte of s outside strings,
+// quoted names and parentheses, until fn returns false.
+func scanTopLevel(s string, fn func(i int) bool) {
+	var closing byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case closing != 0:
+			if ch == closing {
+				closing = 0
+			}
+			continue
+		case ch == '\'', ch == '"':
+			closing = ch
+			continue
+		case ch == '[':
+			closing = ']'
+			continue
+		case ch == ')':
+			depth--
+			continue
+		}
+		if depth == 0 && !fn(i) {
+			return
+		}
+		if ch == '(' {
+			depth++
+		}
+	}
+}
+
+func indexTopLevel(s string, sep byte) int {
+	index := -1
+	scanTopLevel(s, func(i int) bool {
+		if s[i] == sep {
+			index = i
+			return false
+		}
+		return true
+	})
+	return index
+}
+
+// splitTopLevel splits s at the separators outside strings, quoted names
+// and parentheses, the parts are trimmed.
+func splitTopLevel(s string, sep byte) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var parts []string
+	start := 0
+	scanTopLevel(s, func(i int) bool {
+		if s[i] == sep {
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+		return true
+	})
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+// odbcRenamed are the ODBC scalar functions with another T-SQL name.
+var odbcRenamed = map[string]string{
+	"UCASE":            "UPPER",
+	"LCASE":            "LOWER",
+	"LENGTH":           "LEN",
+	"CHAR_LENGTH":      "LEN",
+	"CHARACTER_LENGTH": "LEN",
+	"OCTET_LENGTH":     "DATALENGTH",
+	"LOCATE":           "CHARINDEX",
+	"INSERT":           "STUFF",
+	"IFNULL":           "ISNULL",
+	"NOW":              "GETDATE",
+	"DATABASE":         "DB_NAME",
+	"USER":             "USER_NAME",
+	"DAYOFMONTH":       "DAY",
+}
+
+// odbcDateParts are the date parts of DATEPART functions and SQL_TSI
+// intervals.
+var odbcDateParts = map[string]string{
+	"FRAC_SECOND": "nanosecond",
+	"SECOND":      "second",
+	"MINUTE":      "minute",
+	"HOUR":        "hour",
+	"DAY":         "day",
+	"DAYOFWEEK":   "weekday",
+	"DAYOFYEAR":   "dayofyear",
+	"WEEK":        "week",
+	"MONTH":       "month",
+	"QUARTER":     "quarter",
+	"YEAR":        "year",
+}
+
+// odbcTypes are the T-SQL types of the SQL types of CONVERT.
+var odbcTypes = map[string]string{
+	"SQL_BIGINT":         "bigint",
+	"SQL_BINARY":         "varbinary(max)",
+	"SQL_BIT":            "bit",
+	"SQL_CHAR":           "varchar(max)",
+	"SQL_DATE":           "date",
+	"SQL_DECIMAL":        "decimal",
+	"SQL_DOUBLE":         "float",
+	"SQL_FLOAT":          "float",
+	"SQL_GUID":           "uniqueidentifier",
+	"SQL_INTEGER":        "int",
+	"SQL_LONGVARBINARY":  "varbinary(max)",
+	"SQL_LONGVARCHAR":    "varchar(max)",
+	"SQL_NUMERIC":        "numeric",
+	"SQL_REAL":           "real",
+	"SQL_SMALLINT":       "smallint",
+	"SQL_TIME":           "time",
+	"SQL_TIMESTAMP":      "datetime2",
+	"SQL_TINYINT":        "tinyint",
+	"SQL_TYPE_DATE":      "date",
+	"SQL_TYPE_TIME":      "time",
+	"SQL_TYPE_TIMESTAMP": "datetime2",
+	"SQL_VARBINARY":      "varbinary(max)",
+	"SQL_VARCHAR":        "varchar(max)",
+	"SQL_WCHAR":          "nvarchar(max)",
+	"SQL_WLONGVARCHAR":   "nvarchar(max)",
+	"SQL_WVARCHAR":       "nvarchar(max)",
+}
+
+// translateFunction translates the call of an ODBC scalar function, the
+// calls of functions with the same name in T-SQL are kept.
+func translateFunction(s string) string {
+	s = strings.TrimSpace(s)
+	i := 0
+	for i < len(s) && (s[i] == '_' || 'a' <= s[i] && s[i] <= 'z' || 'A' <= s[i] && s[i] <= 'Z' || i > 0 && '0' <= s[i] && s[i] <= '9') {
+		i++
+	}
+	name := strings.ToUpper(s[:i])
+	call := strings.TrimSpace(s[i:])
+	if !strings.HasPrefix(call, "(") || !strings.HasSuffix(call, ")") {
+		return s
+	}
+	if renamed, ok := odbcRenamed[name]; ok {
+		return renamed + call
+	}
+	args := splitTopLevel(call[1:len(call)-1], ',')
+	switch {
+	case name == "CURDATE" || name == "CURRENT_DATE":
+		return "CAST(GETDATE() AS date)"
+	case name == "CURTIME" || name == "CURRENT_TIME":
+		return "CAST(GETDATE() AS time)"
+	case name == "CURRENT_TIMESTAMP":
+		return "GETDATE()"
+	case name == "MOD" && len(args) == 2:
+		return "(" + args[0] + " % " + args[1] + ")"
+	case name == "TRUNCATE" && len(args) == 2:
+		return "ROUND(" + args[0] + ", " + args[1] + ", 1)"
+	case name == "DAYNAME" && len(args) == 1:
+		return "DATENAME(weekday, " + args[0] + ")"
+	case name == "MONTHNAME" && len(args) == 1:
+		return "DATENAME(month, " + args[0] + ")"
+	case name == "CONVERT" && len(args) == 2:
+		if typ, ok := odbcTypes[strings.ToUpper(args[1])]; ok {
+			return "CONVERT(" + typ + ", " + args[0] + ")"
+		}
+	case (name == "TIMESTAMPADD" || name == "TIMESTAMPDIFF") && len(args) == 3:
+		part, ok := odbcDateParts[strings.TrimPrefix(strings.ToUpper(args[0]), "SQL_TSI_")]
+		if ok {
+			function := "DATEADD("
+			if name == "TIMESTAMPDIFF" {
+				function = "DATEDIFF("
+			}
+			return function + part + ", " + args[1] + ", " + args[2] + ")"
+		}
+	case len(args) == 1:
+		if part, ok := odbcDateParts[name]; ok && name != "DAY" && name != "MONTH" && name != "YEAR" {
+			return "DATEPART(" + part + ", " + args[0] + ")"
+		}
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package querytext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEscapes(t *testing.T) {
+	values := []struct {
+		s string
+		d string
+		n int
+	}{
+		{"select {d '2024-01-01'}", "select CAST('2024-01-01' AS date)", 0},
+		{"select {t '10:11:12'}, {ts '2024-01-01 10:11:12'}", "select CAST('10:11:12' AS time), CAST('2024-01-01 10:11:12' AS datetime2)", 0},
+		{"select {fn UCASE(?)}, ?", "select UPPER(@p1), @p2", 2},
+		{"select {fn ucase({fn lcase(?)})}", "select UPPER(LOWER(@p1))", 1},
+		{"select {fn CURDATE()}", "select CAST(GETDATE() AS date)", 0},
+		{"select {fn MOD(?, 3)}", "select (@p1 % 3)", 1},
+		{"select {fn CONVERT(?, SQL_INTEGER)}", "select CONVERT(int, @p1)", 1},
+		{"select {fn TIMESTAMPADD(SQL_TSI_DAY, 1, x)}", "select DATEADD(day, 1, x)", 0},
+		{"select {fn TIMESTAMPDIFF(SQL_TSI_MONTH, a, b)}", "select DATEDIFF(month, a, b)", 0},
+		{"select {fn HOUR(x)}, {fn DAYNAME(x)}", "select DATEPART(hour, x), DATENAME(weekday, x)", 0},
+		{"select {fn SUBSTRING('a,b', 1, 2)}", "select SUBSTRING('a,b', 1, 2)", 0},
+		{"select {fn LOCATE('}', x)}", "select CHARINDEX('}', x)", 0},
+		{"select * from {oj a left outer join b on a.id = b.id}", "select * from a left outer join b on a.id = b.id", 0},
+		{"select * from a where x like 'a!%' {escape '!'}", "select * from a where x like 'a!%' ESCAPE '!'", 0},
+		{"select '{d x}', [{fn y}] -- {fn z}\n", "select '{d x}', [{fn y}] -- {fn z}\n", 0},
+		{"select {fn UCASE(x /* } */)}", "select UPPER(x /* } */)", 0},
+		{"select {unknown ?}", "select {unknown @p1}", 1},
+		{"select {d '2024", "select {d '2024", 0},
+		{"{call dbo.proc(?, 'x')}", "EXEC dbo.proc @p1, 'x'", 1},
+		{"{?= call [my proc]}", "EXEC [my proc]", 0},
+	}
+	for _, v := range values {
+		d, n := ParseParams(v.s)
+		if d != v.d {
+			t.Errorf("Parse escapes don't match for %s, got %s but expected %s", v.s, d, v.d)
+		}
+		if n != v.n {
+			t.Errorf("Parse number of params don't match for %s, got %d but expected %d", v.s, n, v.n)
+		}
+	}
+}
+
+func TestParseCall(t *testing.T) {
+	values := []struct {
+		s    string
+		call *Call
+	}{
+		{"{call dbo.proc(?, ?)}", &Call{Proc: "dbo.proc", Params: []string{"@p1", "@p2"}}},
+		{" {?= CALL dbo.proc(:b, ?1)} ;", &Call{Proc: "dbo.proc", Params: []string{"@b", "@p1"}}},
+		{"{call dbo.proc}", &Call{Proc: "dbo.proc"}},
+		{"{call [a(b)].proc()}", &Call{Proc: "[a(b)].proc"}},
+		{"{call dbo.proc(?, 1)}", nil},
+		{"select 1; {call dbo.proc(?)}", nil},
+		{"{call a(?)} {call b(?)}", nil},
+		{"select {fn UCASE(?)}", nil},
+	}
+	for _, v := range values {
+		_, _, call := Parse(v.s)
+		if !reflect.DeepEqual(call, v.call) {
+			t.Errorf("Parse call doesn't match for %s, got %+v but expected %+v", v.s, call, v.call)
+		}
+	}
+}
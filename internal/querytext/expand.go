@@ -0,0 +1,91 @@
+package querytext
+
+import "strings"
+
+// ReplaceParams replaces the parameters of a T-SQL query, such as @ids,
+// with the text given for their lower case name in replace. Parameters
+// in strings, quoted names and comments are kept.
+//
+// This function and package is not subject to any API compatibility guarantee.
+func ReplaceParams(query string, replace map[string]string) string {
+	var w strings.Builder
+	for i := 0; i < len(query); {
+		ch := query[i]
+		end := i + 1
+		switch {
+		case ch == '\'' || ch == '"':
+			end = closingIndex(query, i+1, ch)
+		case ch == '[':
+			end = closingIndex(query, i+1, ']')
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			if n := strings.IndexByte(query[i:], '\n'); n >= 0 {
+				end = i + n + 1
+			} else {
+				end = len(query)
+			}
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			end = commentEnd(query, i+2)
+		case ch == '@':
+			for end < len(query) && isIdentifierByte(query[end]) {
+				end++
+			}
+			if text, ok := replace[strings.ToLower(query[i:end])]; ok {
+				w.WriteString(text)
+				i = end
+				continue
+			}
+		case isIdentifierByte(ch):
+			// the @ of a name such as a@b does not start a parameter
+			for end < len(query) && isIdentifierByte(query[end]) {
+				end++
+			}
+		}
+		w.WriteString(query[i:end])
+		i = end
+	}
+	return w.String()
+}
+
+// closingIndex returns the index after the closing character of a string
+// or quoted name, doubled closing characters are escapes.
+func closingIndex(s string, i int, closing byte) int {
+	for i < len(s) {
+		if s[i] != closing {
+			i++
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == closing {
+			i += 2
+			continue
+		}
+		return i + 1
+	}
+	return len(s)
+}
+
+// commentEnd returns the index after the end of a block comment, block
+// comments nest.
+func commentEnd(s string, i int) int {
+	nested := 0
+	for i < len(s) {
+		switch {
+		case strings.HasPrefix(s[i:], "/*"):
+			nested++
+			i += 2
+		case strings.HasPrefix(s[i:], "*/"):
+			if nested == 0 {
+				return i + 2
+			}
+			nested--
+			i += 2
+		default:
+			i++
+		}
+	}
+	return len(s)
+}
+
+func isIdentifierByte(ch byte) bool {
+	return ch >= 0x80 || ch == '_' || ch == '@' || ch == '#' || ch == '$' ||
+		'0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+}
@@ -0,0 +1,29 @@
+package querytext
+
+import "testing"
+
+func TestReplaceParams(t *testing.T) {
+	replace := map[string]string{
+		"@ids": "@ids1, @ids2",
+		"@p1":  "@p1_1",
+	}
+	values := []struct {
+		s string
+		d string
+	}{
+		{"select * from t where id in (@ids)", "select * from t where id in (@ids1, @ids2)"},
+		{"select * from t where id in (@IDS) and x = @p1", "select * from t where id in (@ids1, @ids2) and x = @p1_1"},
+		{"select @ids2, @p11, @@ids, a@ids", "select @ids2, @p11, @@ids, a@ids"},
+		{"select '@ids', 'it''s @ids', [@ids]], @ids]", "select '@ids', 'it''s @ids', [@ids]], @ids]"},
+		{"select \"@ids\" -- @ids\n, @ids", "select \"@ids\" -- @ids\n, @ids1, @ids2"},
+		{"select /* @ids /* @ids */ @ids */ @ids", "select /* @ids /* @ids */ @ids */ @ids1, @ids2"},
+		{"select @ids", "select @ids1, @ids2"},
+		{"select '@ids", "select '@ids"},
+	}
+	for _, v := range values {
+		d := ReplaceParams(v.s, replace)
+		if d != v.d {
+			t.Errorf("Replace params don't match for %s, got %s but expected %s", v.s, d, v.d)
+		}
+	}
+}
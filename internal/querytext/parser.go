@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"io"
 	"strconv"
+	"strings"
 )
 
 type parser struct {
@@ -18,6 +19,12 @@ type parser struct {
 
 	// using map as a set
 	namedParams map[string]bool
+
+	// number of call escapes, the last one whose arguments are parameters
+	// and its position in the output
+	calls              int
+	call               *Call
+	callStart, callEnd int
 }
 
 func (p *parser) next() (rune, bool) {
@@ -49,6 +56,17 @@ type stateFunc func(*parser) stateFunc
 //
 // This function and package is not subject to any API compatibility guarantee.
 func ParseParams(query string) (string, int) {
+	query, paramCount, _ := Parse(query)
+	return query, paramCount
+}
+
+// Parse rewrites the query as ParseParams and translates ODBC escape
+// sequences such as {fn UCASE(?)} or {d '2024-01-01'} into T-SQL. It
+// returns the call when the query is only a call escape whose arguments
+// are parameters, such as {call dbo.proc(?, ?)}.
+//
+// This function and package is not subject to any API compatibility guarantee.
+func Parse(query string) (string, int, *Call) {
 	p := &parser{
 		r:           bytes.NewReader([]byte(query)),
 		namedParams: map[string]bool{},
@@ -57,7 +75,16 @@ func ParseParams(query string) (string, int) {
 	for state != nil {
 		state = state(p)
 	}
-	return p.w.String(), p.paramMax + len(p.namedParams)
+	out := p.w.String()
+	call := p.call
+	if call != nil {
+		before := strings.TrimSpace(out[:p.callStart])
+		after := strings.TrimSpace(out[p.callEnd:])
+		if p.calls != 1 || before != "" || after != "" && after != ";" {
+			call = nil
+		}
+	}
+	return out, p.paramMax + len(p.namedParams), call
 }
 
 func parseNormal(p *parser) stateFunc {
@@ -66,6 +93,9 @@ func parseNormal(p *parser) stateFunc {
 		if !ok {
 			return nil
 		}
+		if ch == '{' {
+			return parseEscape
+		}
 		if ch == '?' {
 			return parseOrdinalParameter
 		} else if ch == '$' || ch == ':' {
@@ -0,0 +1,206 @@
+//go:build go1.9
+// +build go1.9
+
+package mssql
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denisenkom/go-mssqldb/internal/querytext"
+	"github.com/denisenkom/go-mssqldb/msdsn"
+)
+
+// defaultListParameterThreshold is the number of elements of slice
+// parameters above which they are sent as JSON.
+const defaultListParameterThreshold = 1000
+
+// maxRPCParameters is the maximum number of parameters of a request,
+// including the statement and declarations of sp_executesql.
+const maxRPCParameters = 2100
+
+// listParam is a slice argument, it is expanded into a parameter per
+// element, such as @ids1, @ids2 for @ids, or sent as a JSON array read
+// with OPENJSON.
+type listParam []driver.Value
+
+// isListParameter reports whether val is a slice expanded into a list,
+// byte slices and driver.Valuer values are sent as they are.
+func isListParameter(val interface{}) bool {
+	if _, ok := val.(driver.Valuer); ok {
+		return false
+	}
+	t := reflect.TypeOf(val)
+	return t != nil && t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8
+}
+
+func convertListParameter(val interface{}) (listParam, error) {
+	v := reflect.ValueOf(val)
+	list := make(listParam, v.Len())
+	for i := range list {
+		elem, err := convertInputParameter(v.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("mssql: element %d of %T: %v", i, val, err)
+		}
+		list[i] = elem
+	}
+	return list, nil
+}
+
+// listParameterThreshold returns the number of elements of slice
+// parameters above which they are sent as JSON, -1 to always send JSON.
+func (c *Conn) listParameterThreshold() int {
+	threshold := 0
+	if c.connector != nil {
+		threshold = c.connector.params.ListParameterThreshold
+	}
+	switch {
+	case threshold == 0:
+		return defaultListParameterThreshold
+	case threshold < 0:
+		return -1
+	}
+	return threshold
+}
+
+// expandLists replaces the slice parameters of a query by their elements,
+// lists above the threshold, empty lists and lists that would exceed the
+// maximum number of parameters are sent as JSON and replaced by a query
+// of their elements.
+func (s *Stmt) expandLists(query string, args []namedValue) (string, []namedValue, error) {
+	var lists []int
+	count := 2 // statement and declarations of sp_executesql
+	for i, arg := range args {
+		if list, ok := arg.Value.(listParam); ok {
+			lists = append(lists, i)
+			count += len(list)
+		} else {
+			count++
+		}
+	}
+	if len(lists) == 0 {
+		return query, args, nil
+	}
+	if s.call != nil || isProc(query) {
+		return "", nil, fmt.Errorf("mssql: slice parameter %s cannot be passed to a procedure", listParamName(args[lists[0]]))
+	}
+
+	threshold := s.c.listParameterThreshold()
+	asJSON := make(map[int]bool)
+	for _, i := range lists {
+		n := len(args[i].Value.(listParam))
+		if n == 0 || n > threshold {
+			asJSON[i] = true
+			count -= n - 1
+		}
+	}
+	// send the largest remaining lists as JSON until the parameters fit
+	sort.SliceStable(lists, func(a, b int) bool {
+		return len(args[lists[a]].Value.(listParam)) > len(args[lists[b]].Value.(listParam))
+	})
+	for _, i := range lists {
+		if count <= maxRPCParameters {
+			break
+		}
+		if !asJSON[i] {
+			asJSON[i] = true
+			count -= len(args[i].Value.(listParam)) - 1
+		}
+	}
+
+	res := make([]namedValue, 0, count)
+	replace := make(map[string]string)
+	for i, arg := range args {
+		list, ok := arg.Value.(listParam)
+		if !ok {
+			res = append(res, arg)
+			continue
+		}
+		name := listParamName(arg)
+		if asJSON[i] {
+			text, typ, err := s.c.listJSON(list)
+			if err != nil {
+				return "", nil, fmt.Errorf("mssql: slice parameter %s: %v", name, err)
+			}
+			res = append(res, namedValue{Name: arg.Name, Ordinal: arg.Ordinal, Value: NVarCharMax(text)})
+			replace[strings.ToLower(name)] = "SELECT [value] FROM OPENJSON(" + name + ") WITH ([value] " + typ + " '$')"
+			continue
+		}
+		// elements of positional parameters are named @p1_1, @p1_2 so
+		// they do not collide with @p11
+		prefix := arg.Name
+		if prefix == "" {
+			prefix = "p" + strconv.Itoa(arg.Ordinal) + "_"
+		}
+		names := make([]string, len(list))
+		for j, val := range list {
+			elemName := prefix + strconv.Itoa(j+1)
+			names[j] = "@" + elemName
+			res = append(res, namedValue{Name: elemName, Ordinal: arg.Ordinal, Value: val})
+		}
+		replace[strings.ToLower(name)] = strings.Join(names, ", ")
+	}
+	return querytext.ReplaceParams(query, replace), res, nil
+}
+
+func listParamName(arg namedValue) string {
+	if arg.Name != "" {
+		return "@" + arg.Name
+	}
+	return "@p" + strconv.Itoa(arg.Ordinal)
+}
+
+// listJSON encodes the elements of a list as a JSON array and returns
+// the SQL type they are read as.
+func (c *Conn) listJSON(list listParam) (string, string, error) {
+	values := make([]interface{}, len(list))
+	typ := ""
+	for i, val := range list {
+		val, err := tvpPlainValue(val)
+		if err != nil {
+			return "", "", err
+		}
+		var elemType string
+		switch v := val.(type) {
+		case nil:
+			continue
+		case int64:
+			elemType = "bigint"
+		case float64:
+			elemType = "float"
+		case bool:
+			elemType = "bit"
+		case string:
+			elemType = "nvarchar(max)"
+		case time.Time:
+			if c.timeParameterType() == msdsn.TimeParameterDateTimeOffset {
+				elemType = "datetimeoffset"
+				val = v.Format("2006-01-02T15:04:05.9999999-07:00")
+			} else {
+				elemType = "datetime2"
+				val = v.Format("2006-01-02T15:04:05.9999999")
+			}
+		default:
+			return "", "", fmt.Errorf("elements of type %T cannot be sent as JSON", val)
+		}
+		if typ != "" && typ != elemType {
+			return "", "", fmt.Errorf("elements of types %s and %s cannot be sent as JSON", typ, elemType)
+		}
+		typ = elemType
+		values[i] = val
+	}
+	if typ == "" {
+		typ = "nvarchar(max)"
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", "", err
+	}
+	return string(data), typ, nil
+}
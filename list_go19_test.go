@@ -0,0 +1,126 @@
+//go:build go1.9
+// +build go1.9
+
+package mssql
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denisenkom/go-mssqldb/msdsn"
+)
+
+func TestCheckNamedValueList(t *testing.T) {
+	c := &Conn{}
+	nv := &driver.NamedValue{Ordinal: 1, Value: []int{1, 2}}
+	if err := c.CheckNamedValue(nv); err != nil {
+		t.Fatal(err)
+	}
+	if want := (listParam{int64(1), int64(2)}); !reflect.DeepEqual(nv.Value, want) {
+		t.Errorf("got %#v, want %#v", nv.Value, want)
+	}
+	nv = &driver.NamedValue{Ordinal: 1, Value: []byte{1, 2}}
+	if err := c.CheckNamedValue(nv); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nv.Value.([]byte); !ok {
+		t.Errorf("byte slices should not be lists, got %T", nv.Value)
+	}
+	nv = &driver.NamedValue{Ordinal: 1, Value: []interface{}{1, struct{}{}}}
+	if err := c.CheckNamedValue(nv); err == nil {
+		t.Error("expected an error for an unsupported element")
+	}
+}
+
+func TestExpandLists(t *testing.T) {
+	s := &Stmt{c: &Conn{connector: &Connector{params: msdsn.Config{ListParameterThreshold: 3}}}}
+	query, args, err := s.expandLists("select * from t where id in (@ids) and code in (@p2) and x = @p3", []namedValue{
+		{Name: "ids", Ordinal: 1, Value: listParam{int64(1), int64(2)}},
+		{Ordinal: 2, Value: listParam{"a", "b", "c", "d"}},
+		{Ordinal: 3, Value: "x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantQuery := "select * from t where id in (@ids1, @ids2) and code in " +
+		"(SELECT [value] FROM OPENJSON(@p2) WITH ([value] nvarchar(max) '$')) and x = @p3"
+	if query != wantQuery {
+		t.Errorf("got query %s", query)
+	}
+	wantArgs := []namedValue{
+		{Name: "ids1", Ordinal: 1, Value: int64(1)},
+		{Name: "ids2", Ordinal: 1, Value: int64(2)},
+		{Ordinal: 2, Value: NVarCharMax(`["a","b","c","d"]`)},
+		{Ordinal: 3, Value: "x"},
+	}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("got args %v", args)
+	}
+
+	query, args, err = s.expandLists("select @p1, @p2", []namedValue{
+		{Ordinal: 1, Value: listParam{}},
+		{Ordinal: 2, Value: listParam{true, nil}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "select SELECT [value] FROM OPENJSON(@p1) WITH ([value] nvarchar(max) '$'), @p2_1, @p2_2"; query != want {
+		t.Errorf("got query %s", query)
+	}
+	if len(args) != 3 || args[0].Value != NVarCharMax("[]") || args[1].Name != "p2_1" {
+		t.Errorf("got args %v", args)
+	}
+
+	if _, _, err = s.expandLists("dbo.proc", []namedValue{{Ordinal: 1, Value: listParam{int64(1)}}}); err == nil {
+		t.Error("expected an error for a procedure")
+	}
+}
+
+func TestExpandListsLimit(t *testing.T) {
+	s := &Stmt{c: &Conn{}}
+	small := make(listParam, 900)
+	large := make(listParam, 1000)
+	for i := range small {
+		small[i] = int64(i)
+	}
+	for i := range large {
+		large[i] = int64(i)
+	}
+	// the largest list is sent as JSON to stay below 2100 parameters
+	query, args, err := s.expandLists("select @a, @b, @c", []namedValue{
+		{Name: "a", Value: small},
+		{Name: "b", Value: large},
+		{Name: "c", Value: small},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 1801 || !strings.Contains(query, "OPENJSON(@b) WITH ([value] bigint '$')") {
+		t.Errorf("got %d args for query %.100s", len(args), query)
+	}
+}
+
+func TestListJSON(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.FixedZone("", 3600))
+	c := &Conn{}
+	text, typ, err := c.listJSON(listParam{at, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != `["2024-01-02T03:04:05.6+01:00",null]` || typ != "datetimeoffset" {
+		t.Errorf("got %s %s", text, typ)
+	}
+	c.connector = &Connector{params: msdsn.Config{TimeParameterType: msdsn.TimeParameterDateTime2}}
+	if text, typ, _ = c.listJSON(listParam{at}); text != `["2024-01-02T03:04:05.6"]` || typ != "datetime2" {
+		t.Errorf("got %s %s", text, typ)
+	}
+	if _, _, err = c.listJSON(listParam{int64(1), "a"}); err == nil {
+		t.Error("expected an error for mixed types")
+	}
+	if _, _, err = c.listJSON(listParam{[]byte{1}}); err == nil {
+		t.Error("expected an error for binary elements")
+	}
+}
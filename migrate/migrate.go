@@ -0,0 +1,337 @@
+// Package migrate applies the migrations of a database schema, scripts
+// that are run once in the order of their versions and recorded in a
+// history table.
+//
+//	migrations, err := migrate.LoadDir("migrations")
+//	if err != nil {
+//		return err
+//	}
+//	m := &migrate.Migrator{Migrations: migrations}
+//	applied, err := m.Migrate(ctx, db)
+//
+// Scripts are split into batches by the batch package. The batches of a
+// migration and its history record run in a transaction, unless the
+// script has a "-- migrate:no-transaction" line. Concurrent runners
+// are serialized by an application lock, sp_getapplock, on the history
+// table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/denisenkom/go-mssqldb/batch"
+)
+
+// DefaultTable is the history table used when Migrator.Table is empty.
+const DefaultTable = "dbo.migration_history"
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	// Migrations are the migrations to apply, sorted as LoadDir does.
+	Migrations []Migration
+
+	// Table is the name of the history table, as written in SQL such as
+	// "dbo.migration_history" or "[app].[history]". DefaultTable is used
+	// when empty. The table is created by Migrate.
+	Table string
+
+	// Separator is the batch separator of the scripts, GO if empty.
+	Separator string
+
+	// Author is recorded as the author of the migrations, the login of
+	// the connection when empty.
+	Author string
+
+	// LockTimeout is how long Migrate waits for the lock of another
+	// runner, it waits until the context is done when zero.
+	LockTimeout time.Duration
+}
+
+// Record is a migration recorded in the history table.
+type Record struct {
+	// Rank is the order in which the migration was applied.
+	Rank int
+
+	Version     string // empty for repeatable migrations
+	Description string
+	Script      string
+	Checksum    string
+
+	// InstalledBy is the author of the migration.
+	InstalledBy string
+	InstalledOn time.Time
+	Duration    time.Duration
+}
+
+// queryer reads the history with a *sql.DB or *sql.Conn.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Migrate applies the pending migrations and returns them. The history
+// is validated first, see Validate. When a migration fails, the
+// migrations applied before it are returned with the error.
+func (m *Migrator) Migrate(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = m.lock(ctx, conn); err != nil {
+		return nil, err
+	}
+	defer m.unlock(conn)
+
+	if err = m.createTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	history, err := m.history(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := plan(m.Migrations, history)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, mig := range pending {
+		if err = m.apply(ctx, conn, mig); err != nil {
+			return applied, err
+		}
+		applied = append(applied, mig)
+	}
+	return applied, nil
+}
+
+// DryRun returns the migrations that Migrate would apply, without
+// changing the database.
+func (m *Migrator) DryRun(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	history, err := m.History(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return plan(m.Migrations, history)
+}
+
+// Validate checks that the applied versioned migrations have not changed
+// or been removed since they were applied, and that no pending migration
+// is older than the last applied migration.
+func (m *Migrator) Validate(ctx context.Context, db *sql.DB) error {
+	_, err := m.DryRun(ctx, db)
+	return err
+}
+
+// History returns the applied migrations in the order they were applied,
+// none when the history table does not exist.
+func (m *Migrator) History(ctx context.Context, db *sql.DB) ([]Record, error) {
+	return m.history(ctx, db)
+}
+
+func (m *Migrator) table() string {
+	if m.Table == "" {
+		return DefaultTable
+	}
+	return m.Table
+}
+
+func (m *Migrator) history(ctx context.Context, q queryer) ([]Record, error) {
+	rows, err := q.QueryContext(ctx, `
+IF OBJECT_ID(@table, 'U') IS NOT NULL
+SELECT installed_rank, version, description, script, checksum, installed_by, installed_on, execution_ms
+FROM `+m.table()+`
+ORDER BY installed_rank`, sql.Named("table", m.table()))
+	if err != nil {
+		return nil, fmt.Errorf("migrate: cannot read the history: %w", err)
+	}
+	defer rows.Close()
+	var res []Record
+	for rows.Next() {
+		var r Record
+		var version sql.NullString
+		var ms int64
+		if err = rows.Scan(&r.Rank, &version, &r.Description, &r.Script, &r.Checksum, &r.InstalledBy, &r.InstalledOn, &ms); err != nil {
+			return nil, err
+		}
+		r.Version = version.String
+		r.Duration = time.Duration(ms) * time.Millisecond
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+IF OBJECT_ID(@table, 'U') IS NULL
+CREATE TABLE `+m.table()+` (
+	installed_rank int IDENTITY(1,1) NOT NULL PRIMARY KEY,
+	version nvarchar(50) NULL,
+	description nvarchar(200) NOT NULL,
+	script nvarchar(1000) NOT NULL,
+	checksum char(64) NOT NULL,
+	installed_by nvarchar(128) NOT NULL,
+	installed_on datetime2 NOT NULL DEFAULT SYSUTCDATETIME(),
+	execution_ms int NOT NULL
+)`, sql.Named("table", m.table()))
+	if err != nil {
+		return fmt.Errorf("migrate: cannot create the history table: %w", err)
+	}
+	return nil
+}
+
+// lock takes an exclusive application lock of the session, so that the
+// migrations are applied by a single runner.
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) error {
+	timeout := int64(-1)
+	if m.LockTimeout > 0 {
+		timeout = int64(m.LockTimeout / time.Millisecond)
+	}
+	var res int
+	err := conn.QueryRowContext(ctx, `
+DECLARE @res int
+EXEC @res = sp_getapplock @Resource = @resource, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = @timeout
+SELECT @res`, sql.Named("resource", m.lockResource()), sql.Named("timeout", timeout)).Scan(&res)
+	if err != nil {
+		return fmt.Errorf("migrate: cannot lock the history: %w", err)
+	}
+	switch res {
+	case 0, 1:
+		return nil
+	case -1:
+		return errors.New("migrate: the history is locked by another runner")
+	}
+	return fmt.Errorf("migrate: cannot lock the history, sp_getapplock returned %d", res)
+}
+
+func (m *Migrator) unlock(conn *sql.Conn) {
+	// the lock is released by the server if the connection is lost
+	conn.ExecContext(context.Background(), "EXEC sp_releaseapplock @Resource = @resource, @LockOwner = 'Session'",
+		sql.Named("resource", m.lockResource()))
+}
+
+func (m *Migrator) lockResource() string {
+	return "migrate:" + m.table()
+}
+
+// execer runs the batches of a migration in a transaction or not.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// apply runs the batches of a migration and records it.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	separator := m.Separator
+	if separator == "" {
+		separator = "GO"
+	}
+	var ex execer = conn
+	var tx *sql.Tx
+	if !mig.NoTransaction {
+		var err error
+		if tx, err = conn.BeginTx(ctx, nil); err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		ex = tx
+	}
+
+	start := time.Now()
+	for _, b := range batch.SplitBatches(mig.SQL, separator) {
+		if strings.TrimSpace(b.Text) == "" {
+			continue
+		}
+		b.File = mig.Script
+		if _, err := ex.ExecContext(ctx, b.Text); err != nil {
+			if mig.NoTransaction {
+				return fmt.Errorf("migrate: %s failed and may be partly applied: %w", mig.Script, b.WrapError(err))
+			}
+			return fmt.Errorf("migrate: %s failed: %w", mig.Script, b.WrapError(err))
+		}
+	}
+	elapsed := time.Since(start)
+
+	var version, author sql.NullString
+	if !mig.Repeatable() {
+		version = sql.NullString{String: mig.Version, Valid: true}
+	}
+	if m.Author != "" {
+		author = sql.NullString{String: m.Author, Valid: true}
+	}
+	_, err := ex.ExecContext(ctx, `
+INSERT INTO `+m.table()+` (version, description, script, checksum, installed_by, execution_ms)
+VALUES (@version, @description, @script, @checksum, COALESCE(@author, SUSER_SNAME()), @ms)`,
+		sql.Named("version", version),
+		sql.Named("description", mig.Description),
+		sql.Named("script", mig.Script),
+		sql.Named("checksum", mig.Checksum()),
+		sql.Named("author", author),
+		sql.Named("ms", int64(elapsed/time.Millisecond)))
+	if err != nil {
+		return fmt.Errorf("migrate: cannot record %s: %w", mig.Script, err)
+	}
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
+
+// plan validates the history against the migrations and returns the
+// pending migrations.
+func plan(migrations []Migration, history []Record) ([]Migration, error) {
+	var problems []string
+	var last string
+	applied := make(map[string]bool)
+	checksums := make(map[string]string)
+	for _, r := range history {
+		if r.Version == "" {
+			// the last record of a repeatable migration is its state
+			checksums[r.Script] = r.Checksum
+			continue
+		}
+		var mig *Migration
+		for i := range migrations {
+			if !migrations[i].Repeatable() && compareVersions(migrations[i].Version, r.Version) == 0 {
+				mig = &migrations[i]
+				break
+			}
+		}
+		switch {
+		case mig == nil:
+			problems = append(problems, fmt.Sprintf("version %s (%s) was applied but is missing", r.Version, r.Script))
+		case mig.Checksum() != r.Checksum:
+			problems = append(problems, fmt.Sprintf("%s was changed after it was applied", mig.Script))
+		}
+		applied[r.Version] = true
+		if mig != nil {
+			applied[mig.Version] = true
+		}
+		if last == "" || compareVersions(r.Version, last) > 0 {
+			last = r.Version
+		}
+	}
+
+	var pending []Migration
+	for _, mig := range migrations {
+		switch {
+		case mig.Repeatable():
+			if checksums[mig.Script] == mig.Checksum() {
+				continue
+			}
+		case applied[mig.Version]:
+			continue
+		case last != "" && compareVersions(mig.Version, last) < 0:
+			problems = append(problems, fmt.Sprintf("%s is older than the applied version %s", mig.Script, last))
+			continue
+		}
+		pending = append(pending, mig)
+	}
+	if len(problems) > 0 {
+		return nil, errors.New("migrate: invalid history: " + strings.Join(problems, "; "))
+	}
+	return pending, nil
+}
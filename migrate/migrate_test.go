@@ -0,0 +1,187 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/denisenkom/go-mssqldb"
+	"github.com/denisenkom/go-mssqldb/batch"
+)
+
+func testMigrations(t *testing.T, scripts ...string) []Migration {
+	t.Helper()
+	var res []Migration
+	for i := 0; i < len(scripts); i += 2 {
+		m, err := ParseMigration(scripts[i], scripts[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, m)
+	}
+	sortMigrations(res)
+	return res
+}
+
+func record(m Migration) Record {
+	return Record{Version: m.Version, Script: m.Script, Checksum: m.Checksum()}
+}
+
+func TestPlan(t *testing.T) {
+	migrations := testMigrations(t,
+		"V1__a.sql", "select 1",
+		"V2__b.sql", "select 2",
+		"V3__c.sql", "select 3",
+		"R__views.sql", "select 'v'",
+		"R__procs.sql", "select 'p'",
+	)
+	names := func(migrations []Migration) string {
+		var res []string
+		for _, m := range migrations {
+			res = append(res, m.Script)
+		}
+		return strings.Join(res, ",")
+	}
+
+	pending, err := plan(migrations, nil)
+	if err != nil || names(pending) != "V1__a.sql,V2__b.sql,V3__c.sql,R__procs.sql,R__views.sql" {
+		t.Errorf("empty history: got %s, %v", names(pending), err)
+	}
+
+	changed := record(migrations[4])
+	changed.Checksum = "old"
+	history := []Record{record(migrations[0]), record(migrations[1]), record(migrations[3]), changed}
+	pending, err = plan(migrations, history)
+	if err != nil || names(pending) != "V3__c.sql,R__views.sql" {
+		t.Errorf("got %s, %v", names(pending), err)
+	}
+
+	// a changed repeatable migration applied again is no longer pending
+	history = append(history, record(migrations[4]))
+	pending, err = plan(migrations, history)
+	if err != nil || names(pending) != "V3__c.sql" {
+		t.Errorf("got %s, %v", names(pending), err)
+	}
+
+	invalid := []struct {
+		history []Record
+		err     string
+	}{
+		{[]Record{{Version: "1", Script: "V1__a.sql", Checksum: "old"}}, "V1__a.sql was changed after it was applied"},
+		{[]Record{{Version: "0.5", Script: "V0.5__gone.sql"}}, "version 0.5 (V0.5__gone.sql) was applied but is missing"},
+		{[]Record{record(migrations[0]), record(migrations[2])}, "V2__b.sql is older than the applied version 3"},
+	}
+	for _, v := range invalid {
+		_, err := plan(migrations, v.history)
+		if err == nil || !strings.Contains(err.Error(), v.err) {
+			t.Errorf("got error %v, want %s", err, v.err)
+		}
+	}
+}
+
+func open(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("SQLSERVER_DSN")
+	if dsn == "" {
+		t.Skip("no SQLSERVER_DSN")
+	}
+	db, err := sql.Open("sqlserver", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrate(t *testing.T) {
+	db := open(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	table := "migrate_test_" + suffix
+	history := "migrate_history_" + suffix
+	defer db.Exec("DROP TABLE IF EXISTS " + table + ", " + history)
+	defer db.Exec("DROP VIEW IF EXISTS v_" + table)
+
+	m := &Migrator{
+		Table:  history,
+		Author: "tester",
+		Migrations: testMigrations(t,
+			"V1__create.sql", "create table "+table+" (n int)\nGO\ninsert into "+table+" values (1)",
+			"V2__insert.sql", "insert into "+table+" values (2)",
+			"R__view.sql", "create or alter view v_"+table+" as select n from "+table,
+		),
+	}
+	pending, err := m.DryRun(ctx, db)
+	if err != nil || len(pending) != 3 {
+		t.Fatalf("dry run: got %d migrations, %v", len(pending), err)
+	}
+	var exists bool
+	if err = db.QueryRow("SELECT CASE WHEN OBJECT_ID(@p1) IS NULL THEN 0 ELSE 1 END", history).Scan(&exists); err != nil || exists {
+		t.Fatalf("the dry run changed the database: %v", err)
+	}
+
+	applied, err := m.Migrate(ctx, db)
+	if err != nil || len(applied) != 3 {
+		t.Fatalf("got %d migrations, %v", len(applied), err)
+	}
+	applied, err = m.Migrate(ctx, db)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("second run: got %d migrations, %v", len(applied), err)
+	}
+	records, err := m.History(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].Version != "1" || records[0].InstalledBy != "tester" || records[2].Version != "" || records[1].Checksum != m.Migrations[1].Checksum() {
+		t.Errorf("unexpected history %+v", records)
+	}
+
+	// a failed migration is rolled back and located in its script
+	failed := testMigrations(t, "V3__fail.sql", "insert into "+table+" values (3)\nGO\nselect 1\nselect * from missing_table_"+suffix)
+	m.Migrations = append(m.Migrations[:2], failed[0], m.Migrations[2])
+	applied, err = m.Migrate(ctx, db)
+	var scriptErr *batch.ScriptError
+	if len(applied) != 0 || !errors.As(err, &scriptErr) || scriptErr.File != "V3__fail.sql" || scriptErr.Line != 4 {
+		t.Fatalf("got %d migrations, %v", len(applied), err)
+	}
+	var count int
+	if err = db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil || count != 2 {
+		t.Errorf("got %d rows, %v", count, err)
+	}
+
+	m.Migrations = m.Migrations[:2]
+	m.Migrations[1].SQL += " -- changed"
+	if err = m.Validate(ctx, db); err == nil || !strings.Contains(err.Error(), "V2__insert.sql was changed") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestMigrateLock(t *testing.T) {
+	db := open(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	m := &Migrator{Table: "migrate_lock_" + fmt.Sprint(time.Now().UnixNano()), LockTimeout: 100 * time.Millisecond}
+	defer db.Exec("DROP TABLE IF EXISTS " + m.Table)
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = m.lock(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Migrate(ctx, db); err == nil || !strings.Contains(err.Error(), "locked by another runner") {
+		t.Errorf("got %v", err)
+	}
+	m.unlock(conn)
+	if _, err = m.Migrate(ctx, db); err != nil {
+		t.Error(err)
+	}
+}
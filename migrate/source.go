@@ -0,0 +1,199 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// noTransaction is the directive of the scripts that must not run in a
+// transaction, such as scripts altering the database.
+const noTransaction = "-- migrate:no-transaction"
+
+// Migration is a script of a migration.
+//
+// Versioned migrations are named V<version>__<description>.sql, such as
+// V1.2__add_users.sql, and are applied once in the order of their
+// versions. Repeatable migrations are named R__<description>.sql and are
+// applied after the versioned migrations each time their checksum
+// changes, such as the scripts defining views and procedures.
+type Migration struct {
+	// Version is the version of a versioned migration, made of numbers
+	// separated by dots or underscores. It is empty for repeatable
+	// migrations.
+	Version string
+
+	// Description is the description of the name of the script, with
+	// spaces instead of underscores.
+	Description string
+
+	// Script is the name of the file of the migration.
+	Script string
+
+	// SQL is the text of the script, split into batches by the separator
+	// of the Migrator.
+	SQL string
+
+	// NoTransaction runs the batches outside of a transaction, it is set
+	// by a line "-- migrate:no-transaction" in the script. A failed
+	// migration without transaction may be partly applied.
+	NoTransaction bool
+}
+
+// Repeatable tells whether the migration is applied each time it changes.
+func (m Migration) Repeatable() bool {
+	return m.Version == ""
+}
+
+// Checksum returns the SHA-256 of the SQL of the migration as hexadecimal,
+// line breaks are normalized so that checkouts with CRLF line breaks have
+// the same checksum.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(strings.Replace(m.SQL, "\r\n", "\n", -1)))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseMigration returns the migration of a script, the name of the file
+// sets its version and description.
+func ParseMigration(name, sql string) (Migration, error) {
+	base := path.Base(filepath.ToSlash(name))
+	if !strings.HasSuffix(base, ".sql") {
+		return Migration{}, fmt.Errorf("migrate: %s is not a .sql file", name)
+	}
+	base = strings.TrimSuffix(base, ".sql")
+	sep := strings.Index(base, "__")
+	if sep < 1 {
+		return Migration{}, fmt.Errorf("migrate: %s is not named V<version>__<description>.sql or R__<description>.sql", name)
+	}
+	m := Migration{
+		Description: strings.Replace(base[sep+2:], "_", " ", -1),
+		Script:      name,
+		SQL:         sql,
+	}
+	switch prefix := base[:sep]; prefix[0] {
+	case 'V':
+		m.Version = strings.Replace(prefix[1:], "_", ".", -1)
+		if _, err := parseVersion(m.Version); err != nil {
+			return Migration{}, fmt.Errorf("migrate: %s: %v", name, err)
+		}
+	case 'R':
+		if len(prefix) > 1 {
+			return Migration{}, fmt.Errorf("migrate: %s: repeatable migrations have no version", name)
+		}
+	default:
+		return Migration{}, fmt.Errorf("migrate: %s is not named V<version>__<description>.sql or R__<description>.sql", name)
+	}
+	for _, line := range strings.Split(sql, "\n") {
+		if strings.EqualFold(strings.TrimSpace(line), noTransaction) {
+			m.NoTransaction = true
+			break
+		}
+	}
+	return m, nil
+}
+
+// LoadDir loads the migrations of the .sql files of a directory whose
+// names start with V or R, other files are ignored.
+func LoadDir(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() {
+			names = append(names, f.Name())
+		}
+	}
+	return load(names, func(name string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(dir, name))
+	})
+}
+
+func load(names []string, readFile func(name string) ([]byte, error)) ([]Migration, error) {
+	var res []Migration
+	versions := make(map[string]string)
+	for _, name := range names {
+		if !isMigrationName(name) {
+			continue
+		}
+		data, err := readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		m, err := ParseMigration(name, string(data))
+		if err != nil {
+			return nil, err
+		}
+		if !m.Repeatable() {
+			v, _ := parseVersion(m.Version)
+			key := fmt.Sprint(v)
+			if other, ok := versions[key]; ok {
+				return nil, fmt.Errorf("migrate: %s and %s have the same version", other, name)
+			}
+			versions[key] = name
+		}
+		res = append(res, m)
+	}
+	sortMigrations(res)
+	return res, nil
+}
+
+func isMigrationName(name string) bool {
+	return strings.HasSuffix(name, ".sql") && (strings.HasPrefix(name, "V") || strings.HasPrefix(name, "R"))
+}
+
+// sortMigrations sorts the versioned migrations by version, followed by
+// the repeatable migrations by description.
+func sortMigrations(migrations []Migration) {
+	sort.SliceStable(migrations, func(i, j int) bool {
+		a, b := migrations[i], migrations[j]
+		if a.Repeatable() != b.Repeatable() {
+			return !a.Repeatable()
+		}
+		if a.Repeatable() {
+			return a.Description < b.Description
+		}
+		return compareVersions(a.Version, b.Version) < 0
+	})
+}
+
+// parseVersion returns the numbers of a version such as 1.2.10.
+func parseVersion(version string) ([]int, error) {
+	if version == "" {
+		return nil, fmt.Errorf("missing version")
+	}
+	parts := strings.Split(version, ".")
+	res := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %s", version)
+		}
+		res[i] = n
+	}
+	// 1.0 and 1 are the same version
+	for len(res) > 1 && res[len(res)-1] == 0 {
+		res = res[:len(res)-1]
+	}
+	return res, nil
+}
+
+// compareVersions compares two valid versions numerically, it returns a
+// negative number when a is older than b.
+func compareVersions(a, b string) int {
+	va, _ := parseVersion(a)
+	vb, _ := parseVersion(b)
+	for i := 0; i < len(va) && i < len(vb); i++ {
+		if va[i] != vb[i] {
+			return va[i] - vb[i]
+		}
+	}
+	return len(va) - len(vb)
+}
@@ -0,0 +1,27 @@
+//go:build go1.16
+// +build go1.16
+
+package migrate
+
+import (
+	"io/fs"
+	"path"
+)
+
+// LoadFS loads the migrations of the .sql files of a directory of a file
+// system, such as an embed.FS, whose names start with V or R.
+func LoadFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return load(names, func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, path.Join(dir, name))
+	})
+}
@@ -0,0 +1,29 @@
+//go:build go1.16
+// +build go1.16
+
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"db/V2__users.sql":    {Data: []byte("create table users (id int)")},
+		"db/V1__init.sql":     {Data: []byte("create schema app")},
+		"db/R__views.sql":     {Data: []byte("create or alter view v as select 1 n")},
+		"db/sub/V3__skip.sql": {Data: []byte("select 3")},
+		"V9__outside.sql":     {Data: []byte("select 9")},
+	}
+	migrations, err := LoadFS(fsys, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 3 || migrations[0].Version != "1" || migrations[1].Version != "2" || !migrations[2].Repeatable() {
+		t.Fatalf("got %+v", migrations)
+	}
+	if migrations[1].SQL != "create table users (id int)" {
+		t.Errorf("got SQL %q", migrations[1].SQL)
+	}
+}
@@ -0,0 +1,120 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseMigration(t *testing.T) {
+	values := []struct {
+		name          string
+		sql           string
+		version       string
+		description   string
+		noTransaction bool
+	}{
+		{"V1__init.sql", "create table t (n int)", "1", "init", false},
+		{"dir/V1_2_10__add_users_table.sql", "", "1.2.10", "add users table", false},
+		{"R__views.sql", "-- views\n-- MIGRATE:NO-TRANSACTION\ncreate view v as select 1 n", "", "views", true},
+		{"V2__index.sql", strings.Repeat("-- comment\n", 20) + "-- migrate:no-transaction\r\ncreate index i on t (n) with (online = on)", "2", "index", true},
+	}
+	for _, v := range values {
+		m, err := ParseMigration(v.name, v.sql)
+		if err != nil {
+			t.Errorf("%s: %v", v.name, err)
+			continue
+		}
+		if m.Version != v.version || m.Description != v.description || m.Script != v.name || m.NoTransaction != v.noTransaction {
+			t.Errorf("%s: got %+v", v.name, m)
+		}
+	}
+
+	for _, name := range []string{"V1__init.txt", "V1_init.sql", "__init.sql", "Vx__init.sql", "V__init.sql", "R1__views.sql", "U1__undo.sql"} {
+		if _, err := ParseMigration(name, ""); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	values := []struct {
+		a, b string
+		cmp  int
+	}{
+		{"1", "2", -1},
+		{"2", "10", -1},
+		{"1.9", "1.10", -1},
+		{"1.0", "1", 0},
+		{"1.1", "1", 1},
+		{"2", "1.5", 1},
+	}
+	for _, v := range values {
+		got := compareVersions(v.a, v.b)
+		if (got < 0 && v.cmp >= 0) || (got == 0 && v.cmp != 0) || (got > 0 && v.cmp <= 0) {
+			t.Errorf("compareVersions(%s, %s) = %d", v.a, v.b, got)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	a := Migration{SQL: "select 1\nselect 2\n"}
+	b := Migration{SQL: "select 1\r\nselect 2\r\n"}
+	c := Migration{SQL: "select 1\nselect 3\n"}
+	if a.Checksum() != b.Checksum() {
+		t.Error("the checksum depends on line breaks")
+	}
+	if a.Checksum() == c.Checksum() || len(a.Checksum()) != 64 {
+		t.Errorf("unexpected checksums %s and %s", a.Checksum(), c.Checksum())
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"V10__last.sql":  "select 10",
+		"V2__second.sql": "select 2",
+		"V1__first.sql":  "select 1",
+		"R__b.sql":       "select 'b'",
+		"R__a.sql":       "select 'a'",
+		"README.md":      "not a migration",
+	}
+	for name, data := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	migrations, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range migrations {
+		got = append(got, m.Script)
+	}
+	want := []string{"V1__first.sql", "V2__second.sql", "V10__last.sql", "R__a.sql", "R__b.sql"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if migrations[0].SQL != "select 1" {
+		t.Errorf("got SQL %q", migrations[0].SQL)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "V1.0__again.sql"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadDir(dir); err == nil {
+		t.Error("expected an error for the duplicate version")
+	}
+}
@@ -16,8 +16,9 @@ import (
 )
 
 type (
-	Encryption int
-	Log        uint64
+	Encryption        int
+	Log               uint64
+	TimeParameterType int
 )
 
 const (
@@ -37,6 +38,30 @@ const (
 	LogRetries     Log = 128
 )
 
+// SQL types used for time.Time parameters.
+const (
+	TimeParameterDateTimeOffset TimeParameterType = iota // datetimeoffset(7), datetime before TDS 7.3
+	TimeParameterDateTime2                               // datetime2(7)
+	TimeParameterDateTime                                // datetime
+	TimeParameterDate                                    // date
+)
+
+var timeParameterTypes = map[string]TimeParameterType{
+	"datetimeoffset": TimeParameterDateTimeOffset,
+	"datetime2":      TimeParameterDateTime2,
+	"datetime":       TimeParameterDateTime,
+	"date":           TimeParameterDate,
+}
+
+func (t TimeParameterType) String() string {
+	for name, v := range timeParameterTypes {
+		if v == t {
+			return name
+		}
+	}
+	return fmt.Sprintf("TimeParameterType(%d)", int(t))
+}
+
 type Config struct {
 	Port       uint64
 	Host       string
@@ -67,6 +92,19 @@ type Config struct {
 	// that start on bad connections.
 	DisableRetry bool
 
+	// SQL type used for time.Time parameters, defaults to datetimeoffset.
+	TimeParameterType TimeParameterType
+
+	// If true string parameters are sent as varchar instead of nvarchar,
+	// encoded with the code page of the database collation.
+	StringParametersAsVarChar bool
+
+	// Slice parameters with more elements are sent as a single JSON
+	// string read with OPENJSON instead of a parameter per element.
+	// Zero uses the default of 1000, a negative value sends all slices
+	// as JSON.
+	ListParameterThreshold int
+
 	// Do not use the following.
 
 	DialTimeout time.Duration // DialTimeout defaults to 15s. Set negative to disable.
@@ -323,6 +361,34 @@ func Parse(dsn string) (Config, map[string]string, error) {
 		p.DisableRetry = disableRetryDefault
 	}
 
+	sendUnicode, ok := params["sendstringparametersasunicode"]
+	if ok {
+		unicode, err := strconv.ParseBool(sendUnicode)
+		if err != nil {
+			f := "invalid sendStringParametersAsUnicode '%s': %s"
+			return p, params, fmt.Errorf(f, sendUnicode, err.Error())
+		}
+		p.StringParametersAsVarChar = !unicode
+	}
+
+	timeParameterType, ok := params["time parameter type"]
+	if ok {
+		p.TimeParameterType, ok = timeParameterTypes[strings.ToLower(timeParameterType)]
+		if !ok {
+			return p, params, fmt.Errorf("invalid time parameter type '%s': must be one of datetimeoffset, datetime2, datetime or date", timeParameterType)
+		}
+	}
+
+	listThreshold, ok := params["list parameter threshold"]
+	if ok {
+		var err error
+		p.ListParameterThreshold, err = strconv.Atoi(listThreshold)
+		if err != nil {
+			f := "invalid list parameter threshold '%s': %s"
+			return p, params, fmt.Errorf(f, listThreshold, err.Error())
+		}
+	}
+
 	return p, params, nil
 }
 
@@ -341,6 +407,15 @@ func (p Config) URL() *url.URL {
 		host = fmt.Sprintf("%s:%d", p.Host, p.Port)
 	}
 	q.Add("disableRetry", fmt.Sprintf("%t", p.DisableRetry))
+	if p.StringParametersAsVarChar {
+		q.Add("sendStringParametersAsUnicode", "false")
+	}
+	if p.TimeParameterType != TimeParameterDateTimeOffset {
+		q.Add("time parameter type", p.TimeParameterType.String())
+	}
+	if p.ListParameterThreshold != 0 {
+		q.Add("list parameter threshold", strconv.Itoa(p.ListParameterThreshold))
+	}
 	res := url.URL{
 		Scheme: "sqlserver",
 		Host:   host,
@@ -19,6 +19,9 @@ func TestInvalidConnectionString(t *testing.T) {
 		"failoverport=invalid",
 		"applicationintent=ReadOnly",
 		"disableretry=invalid",
+		"time parameter type=smalldatetime",
+		"sendstringparametersasunicode=invalid",
+		"list parameter threshold=many",
 
 		// ODBC mode
 		"odbc:password={",
@@ -76,6 +79,17 @@ func TestValidConnectionString(t *testing.T) {
 		{"disableretry=1", func(p Config) bool { return p.DisableRetry }},
 		{"disableretry=0", func(p Config) bool { return !p.DisableRetry }},
 		{"", func(p Config) bool { return p.DisableRetry == disableRetryDefault }},
+		{"", func(p Config) bool { return p.TimeParameterType == TimeParameterDateTimeOffset }},
+		{"", func(p Config) bool { return !p.StringParametersAsVarChar }},
+		{"sendstringparametersasunicode=false", func(p Config) bool { return p.StringParametersAsVarChar }},
+		{"sendStringParametersAsUnicode=true", func(p Config) bool { return !p.StringParametersAsVarChar }},
+		{"time parameter type=datetime2", func(p Config) bool { return p.TimeParameterType == TimeParameterDateTime2 }},
+		{"time parameter type=DateTime", func(p Config) bool { return p.TimeParameterType == TimeParameterDateTime }},
+		{"time parameter type=date", func(p Config) bool { return p.TimeParameterType == TimeParameterDate }},
+		{"time parameter type=datetimeoffset", func(p Config) bool { return p.TimeParameterType == TimeParameterDateTimeOffset }},
+		{"", func(p Config) bool { return p.ListParameterThreshold == 0 }},
+		{"list parameter threshold=50", func(p Config) bool { return p.ListParameterThreshold == 50 }},
+		{"list parameter threshold=-1", func(p Config) bool { return p.ListParameterThreshold == -1 }},
 
 		// those are supported currently, but maybe should not be
 		{"someparam", func(p Config) bool { return true }},
@@ -135,6 +149,9 @@ func TestValidConnectionString(t *testing.T) {
 		}},
 
 		// URL mode
+		{"sqlserver://somehost?time+parameter+type=datetime2", func(p Config) bool {
+			return p.Host == "somehost" && p.TimeParameterType == TimeParameterDateTime2
+		}},
 		{"sqlserver://somehost?connection+timeout=30", func(p Config) bool {
 			return p.Host == "somehost" && p.Port == 0 && p.Instance == "" && p.ConnTimeout == 30*time.Second
 		}},
@@ -11,10 +11,14 @@ import (
 	"math"
 	"net"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
+	"github.com/denisenkom/go-mssqldb/columnar"
+	"github.com/denisenkom/go-mssqldb/internal/cp"
 	"github.com/denisenkom/go-mssqldb/internal/querytext"
 	"github.com/denisenkom/go-mssqldb/msdsn"
 	"github.com/golang-sql/sqlexp"
@@ -179,6 +183,79 @@ type Connector struct {
 	// Dialer sets a custom dialer for all network operations.
 	// If Dialer is not set, normal net dialers are used.
 	Dialer Dialer
+
+	// StringParameterCollation is the collation used to encode varchar
+	// parameters. If nil the default collation of the current database is used.
+	StringParameterCollation *Collation
+
+	// ParameterSizing controls the declared length of string and binary
+	// parameters. By default the length of each value is declared, which
+	// creates a separate query plan for every distinct length.
+	ParameterSizing ParameterSizing
+
+	// tvpTypes caches the columns of table types, by database and name
+	tvpTypesMu sync.Mutex
+	tvpTypes   map[string][]columnStruct
+}
+
+// ParameterSizing selects how the length of nvarchar, varchar and
+// varbinary parameters is declared in sp_executesql calls.
+// Values longer than the type limit are always declared as (max).
+type ParameterSizing int
+
+const (
+	// ParameterSizingExact declares the length of the value,
+	// e.g. nvarchar(5) for "hello".
+	ParameterSizingExact ParameterSizing = iota
+	// ParameterSizingBuckets rounds the length up to 16, 64, 256, 1024
+	// or the type limit of 4000 characters for nvarchar and 8000 bytes
+	// for varchar and varbinary.
+	ParameterSizingBuckets
+	// ParameterSizingLimit declares the type limit, nvarchar(4000),
+	// varchar(8000) or varbinary(8000).
+	ParameterSizingLimit
+)
+
+var parameterSizingBuckets = []int{16, 64, 256, 1024}
+
+// declSize returns the declared size of a parameter, in bytes.
+func (ps ParameterSizing) declSize(ti typeInfo) int {
+	var unit int
+	switch ti.TypeId {
+	case typeNVarChar:
+		unit = 2
+	case typeBigVarChar, typeBigVarBin:
+		unit = 1
+	default:
+		return ti.Size
+	}
+	limit := 8000 / unit
+	n := ti.Size / unit
+	if ti.Size == 0 || n > limit {
+		// max types
+		return ti.Size
+	}
+	switch ps {
+	case ParameterSizingBuckets:
+		for _, b := range parameterSizingBuckets {
+			if n <= b {
+				return b * unit
+			}
+		}
+		return limit * unit
+	case ParameterSizingLimit:
+		return limit * unit
+	}
+	return ti.Size
+}
+
+// Collation identifies the code page of varchar parameters.
+// LCID is the locale id of a Windows collation, as returned by
+// COLLATIONPROPERTY(name, 'LCID'). SortID is the sort order id of
+// a SQL collation (names starting with SQL_), zero for Windows collations.
+type Collation struct {
+	LCID   uint32
+	SortID uint8
 }
 
 type Dialer interface {
@@ -208,6 +285,30 @@ type outputs struct {
 	params       map[string]interface{}
 	returnStatus *ReturnStatus
 	msgq         *sqlexp.ReturnMessage
+	// notifSub is set by a QueryNotification argument
+	notifSub *queryNotifSub
+	// sink receives the rows of columnar queries
+	sink columnar.Sink
+	// callOuts are the keys in params of the output arguments of a call
+	// escape, whose return values have the names of the procedure parameters
+	callOuts []string
+}
+
+// returnValue scans a return value into the destination of its output
+// argument, matched by position for a call escape and by name otherwise.
+func (o *outputs) returnValue(nv namedValue) error {
+	if len(nv.Name) == 0 {
+		return nil
+	}
+	name := nv.Name[1:] // Remove the leading "@".
+	if len(o.callOuts) > 0 {
+		name = o.callOuts[0]
+		o.callOuts = o.callOuts[1:]
+	}
+	if ov, has := o.params[name]; has {
+		return scanIntoOut(name, nv.Value, ov)
+	}
+	return nil
 }
 
 // IsValid satisfies the driver.Validator interface.
@@ -421,6 +522,12 @@ type Stmt struct {
 	query      string
 	paramCount int
 	notifSub   *queryNotifSub
+	// call is set when the query is an ODBC call escape, it is sent as
+	// an RPC of the procedure
+	call *querytext.Call
+	// tvpTypeKeys are the cache keys of the table types discovered for
+	// the TVPs of the last query
+	tvpTypeKeys []string
 }
 
 type queryNotifSub struct {
@@ -429,6 +536,35 @@ type queryNotifSub struct {
 	timeout uint32
 }
 
+// QueryNotification subscribes to a query notification when passed as an
+// argument of a query, as Stmt.SetQueryNotification does. The
+// notification is sent to the Service Broker service named in Options
+// when the results of the query change.
+//
+//	rows, err := db.QueryContext(ctx, "SELECT id, name FROM dbo.users", mssql.QueryNotification{
+//		ID:      "users",
+//		Options: "service=CacheNotifications",
+//	})
+type QueryNotification struct {
+	// ID is the message of the notification, its qn:Message element.
+	ID string
+	// Options are the Service Broker options, such as
+	// "service=CacheNotifications;local database=app".
+	Options string
+	// Timeout is how long the subscription lasts, the server default
+	// of 5 days when zero.
+	Timeout time.Duration
+}
+
+func (n QueryNotification) sub() *queryNotifSub {
+	// the timeout is sent in milliseconds, zero is left out
+	to := n.Timeout / time.Millisecond
+	if to > math.MaxUint32 {
+		to = math.MaxUint32
+	}
+	return &queryNotifSub{n.ID, n.Options, uint32(to)}
+}
+
 func (c *Conn) Prepare(query string) (driver.Stmt, error) {
 	if !c.connectionGood {
 		return nil, driver.ErrBadConn
@@ -441,10 +577,11 @@ func (c *Conn) Prepare(query string) (driver.Stmt, error) {
 
 func (c *Conn) prepareContext(ctx context.Context, query string) (*Stmt, error) {
 	paramCount := -1
+	var call *querytext.Call
 	if c.processQueryText {
-		query, paramCount = querytext.ParseParams(query)
+		query, paramCount, call = querytext.Parse(query)
 	}
-	return &Stmt{c, query, paramCount, nil}, nil
+	return &Stmt{c: c, query: query, paramCount: paramCount, call: call}, nil
 }
 
 func (s *Stmt) Close() error {
@@ -472,23 +609,34 @@ func (s *Stmt) sendQuery(ctx context.Context, args []namedValue) (err error) {
 			data: transDescrHdr{s.c.sess.tranid, 1}.pack()},
 	}
 
-	if s.notifSub != nil {
+	notifSub := s.notifSub
+	if notifSub == nil {
+		notifSub = s.c.outs.notifSub
+	}
+	if notifSub != nil {
 		headers = append(headers,
 			headerStruct{
 				hdrtype: dataStmHdrQueryNotif,
 				data: queryNotifHdr{
-					s.notifSub.msgText,
-					s.notifSub.options,
-					s.notifSub.timeout,
+					notifSub.msgText,
+					notifSub.options,
+					notifSub.timeout,
 				}.pack(),
 			})
 	}
 
 	conn := s.c
+	if err = s.resolveTVPColumns(ctx, args); err != nil {
+		return
+	}
+	query, args, err := s.expandLists(s.query, args)
+	if err != nil {
+		return
+	}
 
 	// no need to check number of parameters here, it is checked by database/sql
 	if conn.sess.logFlags&logSQL != 0 {
-		conn.sess.logger.Log(ctx, msdsn.LogSQL, s.query)
+		conn.sess.logger.Log(ctx, msdsn.LogSQL, query)
 	}
 	if conn.sess.logFlags&logParams != 0 && len(args) > 0 {
 		for i := 0; i < len(args); i++ {
@@ -502,9 +650,9 @@ func (s *Stmt) sendQuery(ctx context.Context, args []namedValue) (err error) {
 
 	reset := conn.resetSession
 	conn.resetSession = false
-	isProc := isProc(s.query)
+	isProc := s.call != nil || isProc(query)
 	if len(args) == 0 && !isProc {
-		if err = sendSqlBatch72(conn.sess.buf, s.query, headers, reset); err != nil {
+		if err = sendSqlBatch72(conn.sess.buf, query, headers, reset); err != nil {
 			if conn.sess.logFlags&logErrors != 0 {
 				conn.sess.logger.Log(ctx, msdsn.LogErrors, fmt.Sprintf("Failed to send SqlBatch with %v", err))
 			}
@@ -515,7 +663,13 @@ func (s *Stmt) sendQuery(ctx context.Context, args []namedValue) (err error) {
 		proc := sp_ExecuteSql
 		var params []param
 		if isProc {
-			proc.name = s.query
+			proc.name = query
+			if s.call != nil {
+				proc.name = s.call.Proc
+				if args, conn.outs.callOuts, err = callArgs(s.call, args); err != nil {
+					return
+				}
+			}
 			params, _, err = s.makeRPCParams(args, true)
 			if err != nil {
 				return
@@ -526,13 +680,26 @@ func (s *Stmt) sendQuery(ctx context.Context, args []namedValue) (err error) {
 			if err != nil {
 				return
 			}
-			params[0] = makeStrParam(s.query)
+			params[0] = makeStrParam(query)
 			params[1] = makeStrParam(strings.Join(decls, ","))
 		}
 		if err = sendRpc(conn.sess.buf, headers, proc, 0, params, reset); err != nil {
 			if conn.sess.logFlags&logErrors != 0 {
 				conn.sess.logger.Log(ctx, msdsn.LogErrors, fmt.Sprintf("Failed to send Rpc with %v", err))
 			}
+			if werr, ok := err.(writerError); ok {
+				if werr.source {
+					// the server discards the request, including the
+					// session reset
+					conn.resetSession = reset
+					if abortErr := conn.abortRequest(ctx); abortErr != nil && conn.sess.logFlags&logErrors != 0 {
+						conn.sess.logger.Log(ctx, msdsn.LogErrors, fmt.Sprintf("Failed to cancel Rpc with %v", abortErr))
+					}
+					return werr
+				}
+				conn.connectionGood = false
+				return writerError{err: fmt.Errorf("failed to send RPC: %v", werr.err)}
+			}
 			conn.connectionGood = false
 			return fmt.Errorf("failed to send RPC: %v", err)
 		}
@@ -540,6 +707,72 @@ func (s *Stmt) sendQuery(ctx context.Context, args []namedValue) (err error) {
 	return
 }
 
+// sendError returns the error of sendQuery, which is retried when the
+// connection failed unless the request streamed values from a source.
+func (c *Conn) sendError(ctx context.Context, err error) error {
+	if werr, ok := err.(writerError); ok {
+		return werr.err
+	}
+	return c.checkBadConn(ctx, err, true)
+}
+
+// abortRequest ends the request being sent with the ignore flag and
+// cancels it, so the connection can be used for other requests.
+func (c *Conn) abortRequest(ctx context.Context) error {
+	buf := c.sess.buf
+	if err := buf.AbortPacket(); err != nil {
+		return c.checkBadConn(ctx, err, false)
+	}
+	if err := sendAttention(buf); err != nil {
+		return c.checkBadConn(ctx, err, false)
+	}
+	// the ignored message may have a response before the cancellation
+	// confirmation, see tokenProcessor.nextToken
+	for i := 0; i < 2; i++ {
+		tokChan := make(chan tokenStruct, 5)
+		go processSingleResponse(ctx, c.sess, tokChan, outputs{})
+		if readCancelConfirmation(tokChan) {
+			return nil
+		}
+	}
+	c.connectionGood = false
+	return errors.New("did not get cancellation confirmation from the server")
+}
+
+// outputKey returns the key in outputs.params of an output argument,
+// its name or, for an unnamed argument, the name it is sent with.
+func outputKey(name string, ordinal int) string {
+	if name != "" {
+		return name
+	}
+	return "p" + strconv.Itoa(ordinal)
+}
+
+// callArgs returns the arguments of a call escape in the order of the
+// parameters of the procedure, and the keys in outputs.params of its
+// output arguments in the same order.
+func callArgs(call *querytext.Call, args []namedValue) ([]namedValue, []string, error) {
+	res := make([]namedValue, len(call.Params))
+	var outs []string
+	for i, name := range call.Params {
+		found := false
+		for _, arg := range args {
+			if "@"+outputKey(arg.Name, arg.Ordinal) == name {
+				res[i] = namedValue{Ordinal: i + 1, Value: arg.Value}
+				if isOutputValue(arg.Value) {
+					outs = append(outs, outputKey(arg.Name, arg.Ordinal))
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("mssql: no value for parameter %s of the call of %s", name, call.Proc)
+		}
+	}
+	return res, outs, nil
+}
+
 // isProc takes the query text in s and determines if it is a stored proc name
 // or SQL text.
 func isProc(s string) bool {
@@ -621,6 +854,9 @@ func (s *Stmt) makeRPCParams(args []namedValue, isProc bool) ([]param, []string,
 			name = fmt.Sprintf("@p%d", val.Ordinal)
 		}
 		params[i+offset].Name = name
+		if !isProcValue(val.Value) {
+			params[i+offset].ti.Size = s.c.parameterSizing().declSize(params[i+offset].ti)
+		}
 		const outputSuffix = " output"
 		var output string
 		if isOutputValue(val.Value) {
@@ -660,9 +896,26 @@ func (s *Stmt) queryContext(ctx context.Context, args []namedValue) (rows driver
 		return nil, driver.ErrBadConn
 	}
 	if err = s.sendQuery(ctx, args); err != nil {
-		return nil, s.c.checkBadConn(ctx, err, true)
+		return nil, s.c.sendError(ctx, err)
+	}
+	if rows, err = s.processQueryResponse(ctx); err != nil {
+		s.forgetTVPTypes(err)
+	}
+	return
+}
+
+// forgetTVPTypes drops the cached columns of the table types of the TVPs
+// of the query when the server rejects it, the types may have changed.
+func (s *Stmt) forgetTVPTypes(err error) {
+	cn := s.c.connector
+	if _, ok := err.(Error); !ok || cn == nil || len(s.tvpTypeKeys) == 0 {
+		return
 	}
-	return s.processQueryResponse(ctx)
+	cn.tvpTypesMu.Lock()
+	for _, key := range s.tvpTypeKeys {
+		delete(cn.tvpTypes, key)
+	}
+	cn.tvpTypesMu.Unlock()
 }
 
 func (s *Stmt) processQueryResponse(ctx context.Context) (res driver.Rows, err error) {
@@ -727,9 +980,10 @@ func (s *Stmt) exec(ctx context.Context, args []namedValue) (res driver.Result,
 		return nil, driver.ErrBadConn
 	}
 	if err = s.sendQuery(ctx, args); err != nil {
-		return nil, s.c.checkBadConn(ctx, err, true)
+		return nil, s.c.sendError(ctx, err)
 	}
 	if res, err = s.processExec(ctx); err != nil {
+		s.forgetTVPTypes(err)
 		return nil, err
 	}
 	return
@@ -881,6 +1135,13 @@ func (r *Rows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
 	return makeGoLangTypePrecisionScale(r.cols[index].ti)
 }
 
+// ColumnTypeXMLSchemaCollection returns the XML schema collection
+// bound to a typed xml column. If the column is not a typed xml column
+// ok is false.
+func (r *Rows) ColumnTypeXMLSchemaCollection(index int) (collection XMLSchemaCollection, ok bool) {
+	return makeXMLSchemaCollection(r.cols[index].ti)
+}
+
 // The nullable value should
 // be true if it is known the column may be null, or false if the column is known
 // to be not nullable.
@@ -891,6 +1152,46 @@ func (r *Rows) ColumnTypeNullable(index int) (nullable, ok bool) {
 	return
 }
 
+// timeParameterType returns the SQL type used for time.Time parameters.
+func (c *Conn) timeParameterType() msdsn.TimeParameterType {
+	if c.connector == nil {
+		return msdsn.TimeParameterDateTimeOffset
+	}
+	return c.connector.params.TimeParameterType
+}
+
+// parameterSizing returns the sizing policy of string and binary parameters.
+func (c *Conn) parameterSizing() ParameterSizing {
+	if c.connector == nil {
+		return ParameterSizingExact
+	}
+	return c.connector.ParameterSizing
+}
+
+// stringParametersAsVarChar reports whether string parameters are sent as varchar.
+func (c *Conn) stringParametersAsVarChar() bool {
+	return c.connector != nil && c.connector.params.StringParametersAsVarChar
+}
+
+// stringCollation returns the collation used to encode varchar parameters.
+func (c *Conn) stringCollation() cp.Collation {
+	if c.connector != nil && c.connector.StringParameterCollation != nil {
+		col := c.connector.StringParameterCollation
+		return cp.Collation{LcidAndFlags: col.LCID & 0xfffff, SortId: col.SortID}
+	}
+	return c.sess.collation
+}
+
+// makeVarCharParam makes a varchar parameter, val is converted
+// to the code page of the collation.
+func makeVarCharParam(val string, col cp.Collation) (res param) {
+	res.ti.TypeId = typeBigVarChar
+	res.ti.Collation = col
+	res.buffer = cp.UTF8ToCharset(col, val)
+	res.ti.Size = len(res.buffer)
+	return
+}
+
 func makeStrParam(val string) (res param) {
 	res.ti.TypeId = typeNVarChar
 	res.buffer = str2ucs2(val)
@@ -933,10 +1234,18 @@ func (s *Stmt) makeParam(val driver.Value) (res param, err error) {
 		res.ti.Size = len(val)
 		res.buffer = val
 	case string:
-		res = makeStrParam(val)
+		if s.c.stringParametersAsVarChar() {
+			res = makeVarCharParam(val, s.c.stringCollation())
+		} else {
+			res = makeStrParam(val)
+		}
 	case sql.NullString:
 		// only null values should be getting here
 		res.ti.TypeId = typeNVarChar
+		if s.c.stringParametersAsVarChar() {
+			res.ti.TypeId = typeBigVarChar
+			res.ti.Collation = s.c.stringCollation()
+		}
 		res.buffer = nil
 		res.ti.Size = 8000
 	case bool:
@@ -953,16 +1262,28 @@ func (s *Stmt) makeParam(val driver.Value) (res param, err error) {
 		res.buffer = []byte{}
 
 	case time.Time:
-		if s.c.sess.loginAck.TDSVersion >= verTDS73 {
-			res.ti.TypeId = typeDateTimeOffsetN
+		timeType := s.c.timeParameterType()
+		if s.c.sess.loginAck.TDSVersion < verTDS73 {
+			// date, datetime2 and datetimeoffset were introduced in TDS 7.3
+			timeType = msdsn.TimeParameterDateTime
+		}
+		switch timeType {
+		case msdsn.TimeParameterDateTime2:
+			res.ti.TypeId = typeDateTime2N
 			res.ti.Scale = 7
-			res.buffer = encodeDateTimeOffset(val, int(res.ti.Scale))
-			res.ti.Size = len(res.buffer)
-		} else {
+			res.buffer = encodeDateTime2(val, int(res.ti.Scale))
+		case msdsn.TimeParameterDateTime:
 			res.ti.TypeId = typeDateTimeN
 			res.buffer = encodeDateTime(val)
-			res.ti.Size = len(res.buffer)
+		case msdsn.TimeParameterDate:
+			res.ti.TypeId = typeDateN
+			res.buffer = encodeDate(val)
+		default:
+			res.ti.TypeId = typeDateTimeOffsetN
+			res.ti.Scale = 7
+			res.buffer = encodeDateTimeOffset(val, int(res.ti.Scale))
 		}
+		res.ti.Size = len(res.buffer)
 	default:
 		return s.makeParamExtra(val)
 	}
@@ -985,7 +1306,7 @@ func (c *Conn) Ping(ctx context.Context) error {
 	if !c.connectionGood {
 		return driver.ErrBadConn
 	}
-	stmt := &Stmt{c, `select 1;`, 0, nil}
+	stmt := &Stmt{c: c, query: `select 1;`}
 	_, err := stmt.ExecContext(ctx, nil)
 	return err
 }
@@ -1269,6 +1590,13 @@ func (r *Rowsq) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
 	return makeGoLangTypePrecisionScale(r.cols[index].ti)
 }
 
+// ColumnTypeXMLSchemaCollection returns the XML schema collection
+// bound to a typed xml column. If the column is not a typed xml column
+// ok is false.
+func (r *Rowsq) ColumnTypeXMLSchemaCollection(index int) (collection XMLSchemaCollection, ok bool) {
+	return makeXMLSchemaCollection(r.cols[index].ti)
+}
+
 // The nullable value should
 // be true if it is known the column may be null, or false if the column is known
 // to be not nullable.
@@ -5,8 +5,10 @@ package mssql
 import (
 	"database/sql"
 	"database/sql/driver"
+	"encoding"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"time"
 
@@ -40,6 +42,85 @@ type DateTime1 time.Time
 // DateTimeOffset encodes parameters to DateTimeOffset, preserving the UTC offset.
 type DateTimeOffset time.Time
 
+// DateTime2 encodes parameters to the datetime2 SQL type.
+// The zero scale is the default scale of 7, use NewDateTime2 for other scales.
+type DateTime2 struct {
+	Time  time.Time
+	scale int // see newScale
+}
+
+// NewDateTime2 returns a DateTime2 encoded with the given scale (0-7).
+// Parameters with other scales fail.
+func NewDateTime2(t time.Time, scale int) DateTime2 {
+	return DateTime2{Time: t, scale: newScale(scale)}
+}
+
+// Scale returns the number of fractional second digits sent to the server.
+func (d DateTime2) Scale() int {
+	return timeScale(d.scale)
+}
+
+// Scan allows DateTime2 to be used as an output parameter destination.
+func (d *DateTime2) Scan(v interface{}) error {
+	t, ok := v.(time.Time)
+	if !ok {
+		return fmt.Errorf("mssql: cannot convert %T to DateTime2", v)
+	}
+	d.Time = t
+	return nil
+}
+
+// Date encodes parameters to the date SQL type.
+type Date time.Time
+
+// Time encodes the time of day of parameters to the time SQL type.
+// The zero scale is the default scale of 7, use NewTime for other scales.
+type Time struct {
+	Time  time.Time
+	scale int // see newScale
+}
+
+// NewTime returns a Time encoded with the given scale (0-7).
+// Parameters with other scales fail.
+func NewTime(t time.Time, scale int) Time {
+	return Time{Time: t, scale: newScale(scale)}
+}
+
+// Scale returns the number of fractional second digits sent to the server.
+func (t Time) Scale() int {
+	return timeScale(t.scale)
+}
+
+// Scan allows Time to be used as an output parameter destination.
+func (t *Time) Scan(v interface{}) error {
+	tm, ok := v.(time.Time)
+	if !ok {
+		return fmt.Errorf("mssql: cannot convert %T to Time", v)
+	}
+	t.Time = tm
+	return nil
+}
+
+// newScale stores a scale so that the zero value is the default scale:
+// valid scales are stored plus one, negative scales as they are, so that
+// they stay invalid.
+func newScale(scale int) int {
+	if scale < 0 {
+		return scale
+	}
+	return scale + 1
+}
+
+func timeScale(scale int) int {
+	switch {
+	case scale == 0:
+		return 7
+	case scale < 0:
+		return scale
+	}
+	return scale - 1
+}
+
 func convertInputParameter(val interface{}) (interface{}, error) {
 	switch v := val.(type) {
 	case VarChar:
@@ -52,12 +133,24 @@ func convertInputParameter(val interface{}) (interface{}, error) {
 		return val, nil
 	case DateTimeOffset:
 		return val, nil
+	case DateTime2:
+		return val, nil
+	case Date:
+		return val, nil
+	case Time:
+		return val, nil
 	case civil.Date:
 		return val, nil
 	case civil.DateTime:
 		return val, nil
 	case civil.Time:
 		return val, nil
+	case Vector:
+		return val, nil
+	case XML:
+		return val, nil
+	case procValue:
+		return val, nil
 		// case *apd.Decimal:
 		// 	return nil
 	default:
@@ -71,7 +164,7 @@ func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
 		if c.outs.params == nil {
 			c.outs.params = make(map[string]interface{})
 		}
-		c.outs.params[nv.Name] = v.Dest
+		c.outs.params[outputKey(nv.Name, nv.Ordinal)] = v.Dest
 
 		if v.Dest == nil {
 			return errors.New("destination is a nil pointer")
@@ -114,6 +207,9 @@ func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
 		*v = 0 // By default the return value should be zero.
 		c.outs.returnStatus = v
 		return driver.ErrRemoveArgument
+	case QueryNotification:
+		c.outs.notifSub = v.sub()
+		return driver.ErrRemoveArgument
 	case TVP:
 		return nil
 	case *sqlexp.ReturnMessage:
@@ -122,20 +218,35 @@ func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
 		return driver.ErrRemoveArgument
 	default:
 		var err error
+		if isListParameter(nv.Value) {
+			nv.Value, err = convertListParameter(nv.Value)
+			return err
+		}
 		nv.Value, err = convertInputParameter(nv.Value)
 		return err
 	}
 }
 
+// CheckNamedValue lets io.Reader values through, they are streamed
+// into PLP columns, and encoding.BinaryMarshaler values, which are
+// the native serialization of UDT columns.
+func (ci *copyin) CheckNamedValue(nv *driver.NamedValue) error {
+	switch nv.Value.(type) {
+	case io.Reader, encoding.BinaryMarshaler:
+		return nil
+	}
+	if isListParameter(nv.Value) {
+		return fmt.Errorf("mssql: bulk copy does not support values of type %T", nv.Value)
+	}
+	return ci.cn.CheckNamedValue(nv)
+}
+
 func (s *Stmt) makeParamExtra(val driver.Value) (res param, err error) {
 	switch val := val.(type) {
 	case VarChar:
-		res.ti.TypeId = typeBigVarChar
-		res.buffer = []byte(val)
-		res.ti.Size = len(res.buffer)
+		res = makeVarCharParam(string(val), s.c.stringCollation())
 	case VarCharMax:
-		res.ti.TypeId = typeBigVarChar
-		res.buffer = []byte(val)
+		res = makeVarCharParam(string(val), s.c.stringCollation())
 		res.ti.Size = 0 // currently zero forces varchar(max)
 	case NVarCharMax:
 		res.ti.TypeId = typeNVarChar
@@ -151,6 +262,31 @@ func (s *Stmt) makeParamExtra(val driver.Value) (res param, err error) {
 		res.ti.Scale = 7
 		res.buffer = encodeDateTimeOffset(time.Time(val), int(res.ti.Scale))
 		res.ti.Size = len(res.buffer)
+	case DateTime2:
+		scale := val.Scale()
+		if scale < 0 || scale > 7 {
+			err = fmt.Errorf("mssql: invalid datetime2 scale %d", scale)
+			return
+		}
+		res.ti.TypeId = typeDateTime2N
+		res.ti.Scale = uint8(scale)
+		res.buffer = encodeDateTime2(val.Time, scale)
+		res.ti.Size = len(res.buffer)
+	case Date:
+		res.ti.TypeId = typeDateN
+		res.buffer = encodeDate(time.Time(val))
+		res.ti.Size = len(res.buffer)
+	case Time:
+		scale := val.Scale()
+		if scale < 0 || scale > 7 {
+			err = fmt.Errorf("mssql: invalid time scale %d", scale)
+			return
+		}
+		t := val.Time
+		res.ti.TypeId = typeTimeN
+		res.ti.Scale = uint8(scale)
+		res.buffer = encodeTime(t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), scale)
+		res.ti.Size = len(res.buffer)
 	case civil.Date:
 		res.ti.TypeId = typeDateN
 		res.buffer = encodeDate(val.In(time.UTC))
@@ -165,9 +301,29 @@ func (s *Stmt) makeParamExtra(val driver.Value) (res param, err error) {
 		res.ti.Scale = 7
 		res.buffer = encodeTime(val.Hour, val.Minute, val.Second, val.Nanosecond, int(res.ti.Scale))
 		res.ti.Size = len(res.buffer)
+	case Vector:
+		res, err = makeVectorParam(val, s.c.sess.vectorVersion > 0)
+	case XML:
+		res.ti.TypeId = typeXml
+		if val.SchemaCollection != "" {
+			schema, name, errGetName := getSchemeAndName(val.SchemaCollection)
+			if errGetName != nil {
+				err = errGetName
+				return
+			}
+			res.ti.XmlInfo = xmlInfo{
+				SchemaPresent:       1,
+				OwningSchema:        schema,
+				XmlSchemaCollection: name,
+			}
+		}
+		res.buffer = str2ucs2(val.Value)
+		res.ti.Size = len(res.buffer)
 	case sql.Out:
 		res, err = s.makeParam(val.Dest)
 		res.Flags = fByRevValue
+	case procValue:
+		res, err = s.makeProcParam(val)
 	case TVP:
 		err = val.check()
 		if err != nil {
@@ -180,12 +336,48 @@ func (s *Stmt) makeParamExtra(val driver.Value) (res param, err error) {
 		res.ti.UdtInfo.TypeName = name
 		res.ti.UdtInfo.SchemaName = schema
 		res.ti.TypeId = typeTvp
-		columnStr, tvpFieldIndexes, errCalTypes := val.columnTypes()
+		if val.columns != nil {
+			rows, sources, errRows := val.discoveredRows()
+			if errRows != nil {
+				err = errRows
+				return
+			}
+			columnStr := val.columns
+			res.writer = func(w io.Writer) error {
+				return writeDiscoveredTVPRows(w, schema, name, columnStr, sources, rows)
+			}
+			return
+		}
+		rows, errRows := val.rows()
+		if errRows != nil {
+			err = errRows
+			return
+		}
+		if rows != nil {
+			stmt := newTVPStmt(s.c.timeParameterType())
+			columnStr, errColumns := tvpRowsColumns(rows.Columns(), stmt)
+			if errColumns != nil {
+				err = errColumns
+				return
+			}
+			if sqlRows, ok := rows.(*tvpSQLRows); ok && sqlRows.types != nil {
+				sources := sqlRows.setTypes(columnStr)
+				res.writer = func(w io.Writer) error {
+					return writeDiscoveredTVPRows(w, schema, name, columnStr, sources, rows)
+				}
+				return
+			}
+			res.writer = func(w io.Writer) error {
+				return writeTVPRows(w, schema, name, columnStr, rows, stmt)
+			}
+			return
+		}
+		columnStr, tvpFieldIndexes, errCalTypes := val.columnTypes(s.c.timeParameterType())
 		if errCalTypes != nil {
 			err = errCalTypes
 			return
 		}
-		res.buffer, err = val.encode(schema, name, columnStr, tvpFieldIndexes)
+		res.buffer, err = val.encode(schema, name, columnStr, tvpFieldIndexes, s.c.timeParameterType())
 		if err != nil {
 			return
 		}
@@ -205,3 +397,13 @@ func isOutputValue(val driver.Value) bool {
 	_, out := val.(sql.Out)
 	return out
 }
+
+// isProcValue reports whether a value is sent with the declared type of
+// a procedure parameter, whose size is not changed by ParameterSizing.
+func isProcValue(val driver.Value) bool {
+	if out, ok := val.(sql.Out); ok {
+		val = out.Dest
+	}
+	_, ok := val.(procValue)
+	return ok
+}
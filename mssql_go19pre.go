@@ -3,6 +3,7 @@
 package mssql
 
 import (
+	"context"
 	"database/sql/driver"
 	"fmt"
 )
@@ -11,6 +12,14 @@ func (s *Stmt) makeParamExtra(val driver.Value) (param, error) {
 	return param{}, fmt.Errorf("mssql: unknown type for %T", val)
 }
 
+func (s *Stmt) resolveTVPColumns(ctx context.Context, args []namedValue) error {
+	return nil
+}
+
+func (s *Stmt) expandLists(query string, args []namedValue) (string, []namedValue, error) {
+	return query, args, nil
+}
+
 func scanIntoOut(name string, fromServer, scanInto interface{}) error {
 	return fmt.Errorf("mssql: unsupported OUTPUT type, use a newer Go version")
 }
@@ -18,3 +27,7 @@ func scanIntoOut(name string, fromServer, scanInto interface{}) error {
 func isOutputValue(val driver.Value) bool {
 	return false
 }
+
+func isProcValue(val driver.Value) bool {
+	return false
+}
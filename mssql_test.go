@@ -1,15 +1,20 @@
 package mssql
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/denisenkom/go-mssqldb/internal/cp"
+	"github.com/denisenkom/go-mssqldb/internal/querytext"
 	"github.com/denisenkom/go-mssqldb/msdsn"
 )
 
@@ -247,3 +252,165 @@ func TestBadConnRejection(t *testing.T) {
 	}
 
 }
+
+func TestStringParametersAsVarChar(t *testing.T) {
+	cyrillic := cp.Collation{LcidAndFlags: 0x0419, SortId: 0}
+	conn := &Conn{
+		connector: &Connector{params: msdsn.Config{StringParametersAsVarChar: true}},
+		sess:      &tdsSession{collation: cyrillic},
+	}
+	stmt := &Stmt{c: conn}
+
+	res, err := stmt.makeParam("Привет")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(res.ti); decl != "varchar(6)" {
+		t.Errorf("string declared as %s", decl)
+	}
+	if res.ti.Collation != cyrillic {
+		t.Errorf("unexpected collation %+v", res.ti.Collation)
+	}
+	if !reflect.DeepEqual(res.buffer, []byte{0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2}) {
+		t.Errorf("string encoded as % x", res.buffer)
+	}
+
+	res, err = stmt.makeParam(sql.NullString{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(res.ti); decl != "varchar(8000)" || res.buffer != nil {
+		t.Errorf("null string declared as %s", decl)
+	}
+
+	// explicit collation takes precedence over the database collation
+	conn.connector.StringParameterCollation = &Collation{LCID: 0x0409}
+	res, err = stmt.makeParam("café")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.buffer, []byte{'c', 'a', 'f', 0xe9}) || res.ti.Collation.LcidAndFlags != 0x0409 {
+		t.Errorf("string encoded as % x with collation %+v", res.buffer, res.ti.Collation)
+	}
+
+	// VarChar is always encoded with the collation
+	conn.connector.params.StringParametersAsVarChar = false
+	res, err = stmt.makeParam(VarChar("café"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.buffer, []byte{'c', 'a', 'f', 0xe9}) {
+		t.Errorf("VarChar encoded as % x", res.buffer)
+	}
+	res, err = stmt.makeParam("café")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(res.ti); decl != "nvarchar(4)" {
+		t.Errorf("string declared as %s by default", decl)
+	}
+}
+
+func TestParameterSizing(t *testing.T) {
+	long := strings.Repeat("x", 5000)
+	args := []namedValue{
+		{Ordinal: 1, Value: "abc"},
+		{Ordinal: 2, Value: strings.Repeat("x", 100)},
+		{Ordinal: 3, Value: VarChar("abc")},
+		{Ordinal: 4, Value: []byte{1, 2}},
+		{Ordinal: 5, Value: long},
+		{Ordinal: 6, Value: int64(1)},
+		{Name: "out", Value: sql.Out{Dest: "x"}},
+	}
+	tests := []struct {
+		sizing   ParameterSizing
+		expected []string
+	}{
+		{ParameterSizingExact, []string{
+			"@p1 nvarchar(3)", "@p2 nvarchar(100)", "@p3 varchar(3)", "@p4 varbinary(2)",
+			"@p5 nvarchar(max)", "@p6 bigint", "@out nvarchar(1) output"}},
+		{ParameterSizingBuckets, []string{
+			"@p1 nvarchar(16)", "@p2 nvarchar(256)", "@p3 varchar(16)", "@p4 varbinary(16)",
+			"@p5 nvarchar(max)", "@p6 bigint", "@out nvarchar(16) output"}},
+		{ParameterSizingLimit, []string{
+			"@p1 nvarchar(4000)", "@p2 nvarchar(4000)", "@p3 varchar(8000)", "@p4 varbinary(8000)",
+			"@p5 nvarchar(max)", "@p6 bigint", "@out nvarchar(4000) output"}},
+	}
+	for _, tt := range tests {
+		stmt := &Stmt{c: &Conn{connector: &Connector{ParameterSizing: tt.sizing}, sess: &tdsSession{}}}
+		params, decls, err := stmt.makeRPCParams(args, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decls, tt.expected) {
+			t.Errorf("sizing %d: declarations = %q, want %q", tt.sizing, decls, tt.expected)
+		}
+		// declared size must hold the value
+		for _, p := range params[2:] {
+			if p.ti.Size != 0 && p.ti.Size < len(p.buffer) {
+				t.Errorf("sizing %d: size %d is smaller than value of %d bytes", tt.sizing, p.ti.Size, len(p.buffer))
+			}
+		}
+		// the values are sent with their own length
+		var buf bytes.Buffer
+		if err = writeTypeInfo(&buf, &params[2].ti); err != nil {
+			t.Fatal(err)
+		}
+		typeLen := buf.Len()
+		if err = params[2].ti.Writer(&buf, params[2].ti, params[2].buffer); err != nil {
+			t.Fatal(err)
+		}
+		if n := binary.LittleEndian.Uint16(buf.Bytes()[typeLen:]); int(n) != len(params[2].buffer) {
+			t.Errorf("sizing %d: value length %d, want %d", tt.sizing, n, len(params[2].buffer))
+		}
+	}
+}
+
+func TestStringParametersAsVarCharQuery(t *testing.T) {
+	checkConnStr(t)
+	connStr := makeConnStr(t)
+	q := connStr.Query()
+	q.Set("sendstringparametersasunicode", "false")
+	connStr.RawQuery = q.Encode()
+	db, err := sql.Open("sqlserver", connStr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var typ, value string
+	err = db.QueryRow("select cast(sql_variant_property(@p1, 'BaseType') as varchar(20)), @p1", "abc").Scan(&typ, &value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != "varchar" || value != "abc" {
+		t.Errorf("got %s %s, want varchar abc", typ, value)
+	}
+}
+
+func TestCallArgs(t *testing.T) {
+	call := &querytext.Call{Proc: "dbo.proc", Params: []string{"@p2", "@name", "@p1"}}
+	args := []namedValue{
+		{Ordinal: 1, Value: "first"},
+		{Ordinal: 2, Value: "second"},
+		{Name: "name", Ordinal: 3, Value: "named"},
+	}
+	got, outs, err := callArgs(call, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []namedValue{
+		{Ordinal: 1, Value: "second"},
+		{Ordinal: 2, Value: "named"},
+		{Ordinal: 3, Value: "first"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if outs != nil {
+		t.Errorf("got outputs %v for input arguments", outs)
+	}
+	if _, _, err = callArgs(call, args[:1]); err == nil {
+		t.Error("expected an error for a missing parameter")
+	}
+}
@@ -0,0 +1,36 @@
+//go:build go1.9
+// +build go1.9
+
+package mssql
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestQueryNotificationArgument(t *testing.T) {
+	c := &Conn{}
+	nv := &driver.NamedValue{Ordinal: 1, Value: QueryNotification{ID: "users", Options: "service=s", Timeout: time.Minute}}
+	if err := c.CheckNamedValue(nv); err != driver.ErrRemoveArgument {
+		t.Fatalf("got %v, want the argument removed", err)
+	}
+	if sub := c.outs.notifSub; sub == nil || *sub != (queryNotifSub{"users", "service=s", 60000}) {
+		t.Errorf("got subscription %+v", sub)
+	}
+	c.clearOuts()
+	if c.outs.notifSub != nil {
+		t.Error("subscription is kept for the next query")
+	}
+
+	// without a timeout the header has none, the server default is used
+	hdr := queryNotifHdr{"a", "b", 0}.pack()
+	if want := []byte{2, 0, 'a', 0, 2, 0, 'b', 0}; !bytes.Equal(hdr, want) {
+		t.Errorf("got header %v, want %v", hdr, want)
+	}
+	hdr = queryNotifHdr{"a", "b", 1000}.pack()
+	if want := []byte{2, 0, 'a', 0, 2, 0, 'b', 0, 0xe8, 3, 0, 0}; !bytes.Equal(hdr, want) {
+		t.Errorf("got header %v, want %v", hdr, want)
+	}
+}
@@ -0,0 +1,311 @@
+// Package notify receives the query notifications of SQL Server, which
+// tell that the results of a query changed, for cache invalidation.
+//
+// Queries subscribe with an mssql.QueryNotification argument, or
+// Stmt.SetQueryNotification, naming a Service Broker service. A Listener
+// receives the notifications from the queue of the service on a
+// connection of its own and dispatches them by ID:
+//
+//	l := &notify.Listener{Queue: "dbo.cache_queue", Service: "CacheNotifications"}
+//	err := l.Subscribe(ctx, db, notify.Subscription{
+//		ID:    "users",
+//		Query: "SELECT id, name FROM dbo.users",
+//		Load:  loadUsers,
+//	})
+//	...
+//	go l.Listen(ctx, db)
+//
+// A notification is sent once, Subscribe runs the query again after each
+// notification so that the cache is reloaded and stays subscribed.
+// Queries that subscribe must follow the rules of indexed views, such as
+// two-part table names and explicit columns.
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+// Listener dispatches the query notifications of a queue.
+type Listener struct {
+	// Queue is the Service Broker queue of the notifications, as written
+	// in SQL such as "dbo.cache_queue".
+	Queue string
+	// Service is the name of the Service Broker service of the queue,
+	// the subscriptions of Subscribe send their notifications to it.
+	Service string
+
+	// Wait is how long a RECEIVE waits for notifications, a minute when
+	// zero.
+	Wait time.Duration
+
+	// OnError is called with the errors of Subscribe subscriptions,
+	// when they fail or cannot subscribe again. Subscriptions that cannot
+	// subscribe again are retried after each Wait. Messages of the queue
+	// which are not valid notifications are reported with an empty id.
+	OnError func(id string, err error)
+
+	mu       sync.Mutex
+	handlers map[string][]func(Notification)
+	subs     map[string]*subscription
+}
+
+// Subscription is a query whose results are reloaded when they change.
+type Subscription struct {
+	// ID identifies the subscription in its notifications.
+	ID    string
+	Query string
+	Args  []interface{}
+	// Timeout is how long the subscription lasts, the server default
+	// when zero. The subscription is renewed when it expires.
+	Timeout time.Duration
+
+	// Load reads the results of the query, when it subscribes and after
+	// each notification.
+	Load func(rows *sql.Rows) error
+}
+
+// subscription is a subscription of Subscribe.
+type subscription struct {
+	Subscription
+	db *sql.DB
+	// retry is set when the last subscription failed
+	retry bool
+}
+
+// Handle calls f with the notifications of id, of all notifications when
+// id is empty. It is called by Listen, which waits for it to return.
+func (l *Listener) Handle(id string, f func(Notification)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.handlers == nil {
+		l.handlers = make(map[string][]func(Notification))
+	}
+	l.handlers[id] = append(l.handlers[id], f)
+}
+
+// Notify sends the notifications of id to ch, all notifications when id
+// is empty. Listen waits for ch to receive them.
+func (l *Listener) Notify(id string, ch chan<- Notification) {
+	l.Handle(id, func(n Notification) {
+		ch <- n
+	})
+}
+
+// Subscribe runs the query of sub with a subscription to its
+// notifications and reads its results with sub.Load. The query is run
+// again with a new subscription after each notification of sub.ID.
+func (l *Listener) Subscribe(ctx context.Context, db *sql.DB, sub Subscription) error {
+	s := &subscription{Subscription: sub, db: db}
+	l.mu.Lock()
+	if l.subs == nil {
+		l.subs = make(map[string]*subscription)
+	}
+	l.subs[sub.ID] = s
+	l.mu.Unlock()
+	if err := l.subscribe(ctx, s); err != nil {
+		l.Unsubscribe(sub.ID)
+		return err
+	}
+	return nil
+}
+
+// Unsubscribe stops running the query of a subscription again, its
+// last subscription lasts until its next notification.
+func (l *Listener) Unsubscribe(id string) {
+	l.mu.Lock()
+	delete(l.subs, id)
+	l.mu.Unlock()
+}
+
+func (l *Listener) subscribe(ctx context.Context, s *subscription) error {
+	args := append(append([]interface{}{}, s.Args...), mssql.QueryNotification{
+		ID:      s.ID,
+		Options: "service=" + l.Service,
+		Timeout: s.Timeout,
+	})
+	rows, err := s.db.QueryContext(ctx, s.Query, args...)
+	if err != nil {
+		return fmt.Errorf("notify: cannot subscribe %s: %w", s.ID, err)
+	}
+	defer rows.Close()
+	if s.Load != nil {
+		if err = s.Load(rows); err != nil {
+			return fmt.Errorf("notify: cannot load %s: %w", s.ID, err)
+		}
+	}
+	if err = rows.Close(); err != nil {
+		return fmt.Errorf("notify: cannot subscribe %s: %w", s.ID, err)
+	}
+	return nil
+}
+
+// Listen receives the notifications of the queue on a connection of its
+// own and dispatches them until the context is done or the connection
+// fails, it returns the error.
+func (l *Listener) Listen(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for {
+		notifications, err := l.receive(ctx, conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		for _, n := range notifications {
+			l.dispatch(ctx, n)
+		}
+		l.retry(ctx)
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *Listener) wait() time.Duration {
+	if l.Wait <= 0 {
+		return time.Minute
+	}
+	return l.Wait
+}
+
+// receive waits for messages of the queue and returns the notifications,
+// the dialogs ended by the server are ended.
+func (l *Listener) receive(ctx context.Context, conn *sql.Conn) ([]Notification, error) {
+	rows, err := conn.QueryContext(ctx, `
+WAITFOR (
+	RECEIVE message_type_name, conversation_handle, CAST(CAST(message_body AS xml) AS nvarchar(max))
+	FROM `+l.Queue+`
+), TIMEOUT @p1`, int64(l.wait()/time.Millisecond))
+	if err != nil {
+		return nil, fmt.Errorf("notify: cannot receive from %s: %w", l.Queue, err)
+	}
+	defer rows.Close()
+	var notifications []Notification
+	var ended []mssql.UniqueIdentifier
+	for rows.Next() {
+		var messageType string
+		var handle mssql.UniqueIdentifier
+		var body sql.NullString
+		if err = rows.Scan(&messageType, &handle, &body); err != nil {
+			return nil, err
+		}
+		switch messageType {
+		case queryNotificationType:
+			if n, ok := l.notification(body.String); ok {
+				notifications = append(notifications, n)
+			}
+		case endDialogType, errorType:
+			ended = append(ended, handle)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("notify: cannot receive from %s: %w", l.Queue, err)
+	}
+	rows.Close()
+	for _, handle := range ended {
+		if _, err = conn.ExecContext(ctx, "END CONVERSATION @p1", handle); err != nil {
+			return nil, fmt.Errorf("notify: cannot end conversation %s: %w", handle, err)
+		}
+	}
+	return notifications, nil
+}
+
+// notification parses the body of a query notification message. The
+// message is removed from the queue, an invalid one is reported to
+// OnError so that it does not stop the other notifications.
+func (l *Listener) notification(body string) (Notification, bool) {
+	n, err := Parse(body)
+	if err != nil {
+		l.onError("", err)
+		return Notification{}, false
+	}
+	return n, true
+}
+
+// dispatch calls the handlers of a notification and subscribes again.
+func (l *Listener) dispatch(ctx context.Context, n Notification) {
+	l.mu.Lock()
+	handlers := append(append([]func(Notification){}, l.handlers[n.ID]...), l.handlers[""]...)
+	s := l.subs[n.ID]
+	l.mu.Unlock()
+
+	for _, f := range handlers {
+		f(n)
+	}
+	if s == nil {
+		return
+	}
+	if n.Failed() {
+		l.Unsubscribe(n.ID)
+		l.onError(n.ID, fmt.Errorf("notify: subscription %s failed: %s %s", n.ID, n.Source, n.Info))
+		return
+	}
+	l.resubscribe(ctx, s)
+}
+
+// retry subscribes again the subscriptions that failed to.
+func (l *Listener) retry(ctx context.Context) {
+	l.mu.Lock()
+	var subs []*subscription
+	for _, s := range l.subs {
+		if s.retry {
+			subs = append(subs, s)
+		}
+	}
+	l.mu.Unlock()
+	for _, s := range subs {
+		l.resubscribe(ctx, s)
+	}
+}
+
+func (l *Listener) resubscribe(ctx context.Context, s *subscription) {
+	err := l.subscribe(ctx, s)
+	l.mu.Lock()
+	s.retry = err != nil
+	l.mu.Unlock()
+	if err != nil && ctx.Err() == nil {
+		l.onError(s.ID, err)
+	}
+}
+
+func (l *Listener) onError(id string, err error) {
+	if l.OnError != nil {
+		l.OnError(id, err)
+	}
+}
+
+// Create creates the queue and the service of the listener when they do
+// not exist. Service Broker must be enabled in the database.
+func (l *Listener) Create(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+IF OBJECT_ID(@queue, 'SQ') IS NULL
+CREATE QUEUE `+l.Queue, sql.Named("queue", l.Queue))
+	if err != nil {
+		return fmt.Errorf("notify: cannot create %s: %w", l.Queue, err)
+	}
+	_, err = db.ExecContext(ctx, `
+IF NOT EXISTS (SELECT * FROM sys.services WHERE name = @service)
+CREATE SERVICE `+quoteName(l.Service)+` ON QUEUE `+l.Queue+` ([http://schemas.microsoft.com/SQL/Notifications/PostQueryNotification])`,
+		sql.Named("service", l.Service))
+	if err != nil {
+		return fmt.Errorf("notify: cannot create %s: %w", l.Service, err)
+	}
+	return nil
+}
+
+// quoteName quotes an identifier with brackets.
+func quoteName(name string) string {
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatch(t *testing.T) {
+	ctx := context.Background()
+	l := &Listener{}
+	var got []string
+	l.Handle("users", func(n Notification) {
+		got = append(got, "users:"+n.Info)
+	})
+	l.Handle("", func(n Notification) {
+		got = append(got, "all:"+n.ID)
+	})
+	ch := make(chan Notification, 1)
+	l.Notify("roles", ch)
+
+	l.dispatch(ctx, Notification{ID: "users", Type: "change", Source: "data", Info: "update"})
+	l.dispatch(ctx, Notification{ID: "roles", Type: "change", Source: "data", Info: "delete"})
+	if want := []string{"users:update", "all:users", "all:roles"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	select {
+	case n := <-ch:
+		if n.ID != "roles" {
+			t.Errorf("got %+v", n)
+		}
+	default:
+		t.Error("no notification sent to the channel")
+	}
+
+	// failed subscriptions are reported and not run again
+	var errs []string
+	l.OnError = func(id string, err error) {
+		errs = append(errs, id+": "+err.Error())
+	}
+	l.subs = map[string]*subscription{"bad": {Subscription: Subscription{ID: "bad"}}}
+	l.dispatch(ctx, Notification{ID: "bad", Type: "subscribe", Source: "statement", Info: "invalid"})
+	if want := []string{"bad: notify: subscription bad failed: statement invalid"}; !reflect.DeepEqual(errs, want) {
+		t.Errorf("got errors %q, want %q", errs, want)
+	}
+	if len(l.subs) != 0 {
+		t.Errorf("failed subscription is kept: %v", l.subs)
+	}
+}
+
+func TestInvalidNotification(t *testing.T) {
+	var errs []string
+	l := &Listener{OnError: func(id string, err error) {
+		errs = append(errs, id+": "+err.Error())
+	}}
+	if _, ok := l.notification("<QueryNotification"); ok {
+		t.Error("invalid message is a notification")
+	}
+	n, ok := l.notification(`<QueryNotification type="change" source="data" info="insert"><Message>users</Message></QueryNotification>`)
+	if !ok || n.ID != "users" {
+		t.Errorf("got %+v, %v", n, ok)
+	}
+	if len(errs) != 1 || !strings.HasPrefix(errs[0], ": notify: invalid query notification") {
+		t.Errorf("got errors %q", errs)
+	}
+}
+
+func TestListen(t *testing.T) {
+	dsn := os.Getenv("SQLSERVER_DSN")
+	if dsn == "" {
+		t.Skip("no SQLSERVER_DSN")
+	}
+	db, err := sql.Open("sqlserver", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var enabled bool
+	if err = db.QueryRow("SELECT is_broker_enabled FROM sys.databases WHERE database_id = DB_ID()").Scan(&enabled); err != nil {
+		t.Fatal(err)
+	}
+	if !enabled {
+		t.Skip("Service Broker is not enabled")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	table := "dbo.notify_" + suffix
+	l := &Listener{Queue: "dbo.notify_queue_" + suffix, Service: "notify_service_" + suffix, Wait: time.Second}
+	if err = l.Create(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP SERVICE [" + l.Service + "]; DROP QUEUE " + l.Queue)
+	if _, err = db.Exec("CREATE TABLE " + table + " (id int NOT NULL PRIMARY KEY, name nvarchar(50) NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE " + table)
+
+	loaded := make(chan int, 10)
+	err = l.Subscribe(ctx, db, Subscription{
+		ID:    "names",
+		Query: "SELECT id, name FROM " + table,
+		Load: func(rows *sql.Rows) error {
+			n := 0
+			for rows.Next() {
+				n++
+			}
+			loaded <- n
+			return rows.Err()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := <-loaded; n != 0 {
+		t.Fatalf("loaded %d rows", n)
+	}
+	ch := make(chan Notification, 10)
+	l.Notify("names", ch)
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Listen(ctx, db)
+	}()
+
+	for i := 1; i <= 2; i++ {
+		if _, err = db.Exec("INSERT INTO "+table+" VALUES (@p1, N'x')", i); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case n := <-ch:
+			if n.Type != "change" || n.Source != "data" || n.Info != "insert" {
+				t.Errorf("got %+v", n)
+			}
+		case err = <-done:
+			t.Fatal(err)
+		case <-ctx.Done():
+			t.Fatal("no notification")
+		}
+		// the query is run again and subscribed
+		if n := <-loaded; n != i {
+			t.Errorf("loaded %d rows, want %d", n, i)
+		}
+	}
+	cancel()
+	if err = <-done; err != context.Canceled {
+		t.Errorf("got error %v", err)
+	}
+}
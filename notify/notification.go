@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// Message types of the messages received from the queue.
+const (
+	queryNotificationType = "http://schemas.microsoft.com/SQL/Notifications/QueryNotification"
+	endDialogType         = "http://schemas.microsoft.com/SQL/ServiceBroker/EndDialog"
+	errorType             = "http://schemas.microsoft.com/SQL/ServiceBroker/Error"
+)
+
+// Notification is a query notification.
+type Notification struct {
+	// ID is the ID of the subscription, the message given to
+	// mssql.QueryNotification or Stmt.SetQueryNotification.
+	ID string
+
+	// Type is "change" when the results of the query changed and
+	// "subscribe" when the subscription failed.
+	Type string
+	// Source is the cause of the notification, such as "data",
+	// "timeout", "object" or "statement".
+	Source string
+	// Info details the cause, such as "insert", "update", "delete",
+	// "truncate", "drop", "expired" or "invalid".
+	Info string
+}
+
+// Failed reports whether the subscription failed, the query did not
+// subscribe and subscribing again would fail the same way.
+func (n Notification) Failed() bool {
+	return n.Type == "subscribe"
+}
+
+func (n Notification) String() string {
+	return fmt.Sprintf("%s: %s %s %s", n.ID, n.Type, n.Source, n.Info)
+}
+
+// qnMessage is the body of a message of type queryNotificationType.
+type qnMessage struct {
+	XMLName xml.Name `xml:"QueryNotification"`
+	Type    string   `xml:"type,attr"`
+	Source  string   `xml:"source,attr"`
+	Info    string   `xml:"info,attr"`
+	Message string   `xml:"Message"`
+}
+
+// Parse parses the XML body of a query notification message.
+func Parse(body string) (Notification, error) {
+	var m qnMessage
+	if err := xml.Unmarshal([]byte(body), &m); err != nil {
+		return Notification{}, fmt.Errorf("notify: invalid query notification: %w", err)
+	}
+	return Notification{ID: m.Message, Type: m.Type, Source: m.Source, Info: m.Info}, nil
+}
@@ -0,0 +1,26 @@
+package notify
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	n, err := Parse(`<qn:QueryNotification xmlns:qn="http://schemas.microsoft.com/SQL/Notifications/QueryNotification" id="7" type="change" source="data" info="insert" database_id="5" sid="0x01"><qn:Message>users &amp; roles</qn:Message></qn:QueryNotification>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Notification{ID: "users & roles", Type: "change", Source: "data", Info: "insert"}
+	if n != want {
+		t.Errorf("got %+v, want %+v", n, want)
+	}
+	if n.Failed() || n.String() != "users & roles: change data insert" {
+		t.Errorf("got %s", n)
+	}
+
+	n, err = Parse(`<qn:QueryNotification xmlns:qn="http://schemas.microsoft.com/SQL/Notifications/QueryNotification" id="8" type="subscribe" source="statement" info="invalid"><qn:Message>bad</qn:Message></qn:QueryNotification>`)
+	if err != nil || !n.Failed() {
+		t.Errorf("got %+v, %v", n, err)
+	}
+
+	if _, err = Parse("<Other/>"); err == nil {
+		t.Error("no error for another message")
+	}
+}
@@ -0,0 +1,455 @@
+//go:build go1.9
+// +build go1.9
+
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/denisenkom/go-mssqldb/internal/catalog"
+)
+
+// Queryer runs queries, it is implemented by *sql.DB, *sql.Conn and
+// *sql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Procedures calls stored procedures with arguments converted to the
+// declared types of their parameters, which are read from sys.parameters
+// and cached. The zero value is ready to use. A Procedures caches the
+// procedures of the databases it is used with, by name, use one per
+// database when the same names are used in several databases.
+//
+// The Queryer passed to Lookup and Call must come from a *sql.DB opened
+// with the "sqlserver" driver name: the "mssql" driver does not accept the
+// @p1 and named parameters of the catalog query and of the call.
+//
+//	var procs mssql.Procedures
+//	res, err := procs.Call(ctx, db, "dbo.AddOrder", customerID, sql.Named("Amount", "19.99"))
+//	if err != nil {
+//		return err
+//	}
+//	orderID := res.Output["@OrderID"]
+type Procedures struct {
+	mu    sync.Mutex
+	procs map[string]*Procedure
+}
+
+// Procedure is the metadata of a stored procedure.
+type Procedure struct {
+	Schema string
+	Name   string
+	Params []ProcParam
+}
+
+// ProcParam is a parameter of a stored procedure.
+type ProcParam struct {
+	// Name is the name of the parameter with its leading @.
+	Name string
+	// DatabaseType is the type name as returned by
+	// Rows.ColumnTypeDatabaseTypeName, such as NVARCHAR, or the
+	// schema qualified name of table types and CLR types.
+	DatabaseType string
+	// Decl is the declaration of the type, such as nvarchar(50).
+	Decl string
+
+	Output bool
+	// ReadOnly is set for table-valued parameters.
+	ReadOnly bool
+
+	// HasDefault and Default are only known for CLR procedures, the
+	// server does not keep the defaults of Transact-SQL procedures, whose
+	// parameters may be omitted when they have a default.
+	HasDefault bool
+	Default    interface{}
+
+	// ti is the declared type, TypeId is 0 for the types sent as
+	// they are, such as table and CLR types
+	ti typeInfo
+}
+
+// ProcResult is the result of a procedure call.
+type ProcResult struct {
+	ReturnStatus ReturnStatus
+	// Output are the values of the output parameters by name, with
+	// their leading @.
+	Output map[string]interface{}
+	// ResultSets are the result sets returned by the procedure, read
+	// into memory.
+	ResultSets []ResultSet
+}
+
+// ResultSet is a result set read into memory.
+type ResultSet struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Lookup returns the metadata of a procedure, read from the catalog of
+// the current database of q the first time.
+func (p *Procedures) Lookup(ctx context.Context, q Queryer, name string) (*Procedure, error) {
+	key := strings.ToLower(name)
+	p.mu.Lock()
+	proc, ok := p.procs[key]
+	p.mu.Unlock()
+	if ok {
+		return proc, nil
+	}
+	proc, err := queryProcedure(ctx, q, name)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	if p.procs == nil {
+		p.procs = make(map[string]*Procedure)
+	}
+	p.procs[key] = proc
+	p.mu.Unlock()
+	return proc, nil
+}
+
+// Forget removes a procedure from the cache, so that its parameters are
+// read again after it is altered.
+func (p *Procedures) Forget(name string) {
+	p.mu.Lock()
+	delete(p.procs, strings.ToLower(name))
+	p.mu.Unlock()
+}
+
+// Call calls a procedure. The arguments are the values of the parameters
+// in order, followed by sql.Named arguments, whose names may omit the
+// leading @. Values are converted to the declared types of the
+// parameters and checked against their range and length. Output
+// parameters are always sent, with their argument as input value or
+// NULL, and returned in the result with the return status and the
+// result sets.
+func (p *Procedures) Call(ctx context.Context, q Queryer, name string, args ...interface{}) (*ProcResult, error) {
+	proc, err := p.Lookup(ctx, q, name)
+	if err != nil {
+		return nil, err
+	}
+	values, err := proc.bind(args)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ProcResult{Output: make(map[string]interface{})}
+	outputs := make(map[string]*procValue)
+	callArgs := make([]interface{}, 0, len(proc.Params)+1)
+	for i, param := range proc.Params {
+		v, ok := values[i]
+		if !ok && !param.Output {
+			// omitted, the default of the parameter is used
+			continue
+		}
+		arg := param.value(proc, v)
+		if param.Output {
+			pv := arg.(procValue)
+			outputs[param.Name] = &pv
+			arg = sql.Out{Dest: &pv, In: ok}
+		}
+		callArgs = append(callArgs, sql.Named(param.Name[1:], arg))
+	}
+	callArgs = append(callArgs, &res.ReturnStatus)
+
+	rows, err := q.QueryContext(ctx, quoteName(proc.Schema)+"."+quoteName(proc.Name), callArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for {
+		columns, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		set := ResultSet{Columns: columns}
+		for rows.Next() {
+			row := make([]interface{}, len(columns))
+			dest := make([]interface{}, len(columns))
+			for i := range dest {
+				dest[i] = &row[i]
+			}
+			if err = rows.Scan(dest...); err != nil {
+				return nil, err
+			}
+			set.Rows = append(set.Rows, row)
+		}
+		if len(columns) > 0 {
+			res.ResultSets = append(res.ResultSets, set)
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	// the output parameters and the return status are set at the end
+	// of the response
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	for name, pv := range outputs {
+		res.Output[name] = pv.value
+	}
+	return res, nil
+}
+
+// Param returns a parameter by name, with or without its leading @,
+// compared without case, nil if there is none.
+func (proc *Procedure) Param(name string) *ProcParam {
+	if !strings.HasPrefix(name, "@") {
+		name = "@" + name
+	}
+	for i := range proc.Params {
+		if strings.EqualFold(proc.Params[i].Name, name) {
+			return &proc.Params[i]
+		}
+	}
+	return nil
+}
+
+// bind returns the values of the arguments by position of the parameters.
+func (proc *Procedure) bind(args []interface{}) (map[int]interface{}, error) {
+	values := make(map[int]interface{}, len(args))
+	named := false
+	for i, arg := range args {
+		if na, ok := arg.(sql.NamedArg); ok {
+			named = true
+			param := proc.Param(na.Name)
+			if param == nil {
+				return nil, fmt.Errorf("mssql: procedure %s.%s has no parameter %s", proc.Schema, proc.Name, na.Name)
+			}
+			j := param.index(proc)
+			if _, ok := values[j]; ok {
+				return nil, fmt.Errorf("mssql: parameter %s of %s.%s is set twice", param.Name, proc.Schema, proc.Name)
+			}
+			values[j] = na.Value
+			continue
+		}
+		if named {
+			return nil, fmt.Errorf("mssql: positional argument %d of %s.%s follows named arguments", i+1, proc.Schema, proc.Name)
+		}
+		if i >= len(proc.Params) {
+			return nil, fmt.Errorf("mssql: procedure %s.%s has %d parameters, got %d arguments", proc.Schema, proc.Name, len(proc.Params), len(args))
+		}
+		values[i] = arg
+	}
+	return values, nil
+}
+
+func (param *ProcParam) index(proc *Procedure) int {
+	for i := range proc.Params {
+		if &proc.Params[i] == param {
+			return i
+		}
+	}
+	return -1
+}
+
+// value returns the argument sent for a value of the parameter.
+func (param *ProcParam) value(proc *Procedure, v interface{}) interface{} {
+	if param.ReadOnly {
+		if tvp, ok := v.(TVP); ok {
+			if tvp.TypeName == "" {
+				tvp.TypeName = param.DatabaseType
+			}
+			return tvp
+		}
+		if v != nil && reflect.TypeOf(v).Kind() == reflect.Slice {
+			return TVP{TypeName: param.DatabaseType, Value: v, DiscoverColumns: true}
+		}
+		return v
+	}
+	if param.ti.TypeId == 0 {
+		return v
+	}
+	return procValue{proc: proc.Schema + "." + proc.Name, name: param.Name, ti: param.ti, value: v}
+}
+
+// procValue is a value of a parameter sent with its declared type.
+type procValue struct {
+	proc  string
+	name  string
+	ti    typeInfo
+	value interface{}
+}
+
+// Scan sets the value of an output parameter.
+func (v *procValue) Scan(src interface{}) error {
+	v.value = src
+	return nil
+}
+
+// makeProcParam makes a parameter of the declared type of a procedure
+// parameter, the value is converted as values of bulk copies are.
+func (s *Stmt) makeProcParam(v procValue) (res param, err error) {
+	res.ti = v.ti
+	if v.value == nil {
+		return res, nil
+	}
+	val, err := tvpPlainValue(v.value)
+	if err == nil {
+		val, err = procPlainValue(val, v.ti)
+	}
+	if err != nil {
+		return res, fmt.Errorf("mssql: parameter %s of %s: %v", v.name, v.proc, err)
+	}
+	if val == nil {
+		return res, nil
+	}
+	b := &Bulk{cn: s.c}
+	col := columnStruct{ti: v.ti}
+	switch v.ti.TypeId {
+	case typeBigVarChar, typeBigChar, typeText:
+		col.ti.Collation = b.collation()
+		res.ti.Collation = col.ti.Collation
+	}
+	p, err := b.makeParam(val, col)
+	if err != nil {
+		return res, fmt.Errorf("mssql: parameter %s of %s: %v", v.name, v.proc, err)
+	}
+	switch v.ti.TypeId {
+	case typeBigVarChar, typeBigChar, typeNVarChar, typeNChar, typeBigVarBin, typeBigBinary:
+		if v.ti.Size <= 8000 && len(p.buffer) > v.ti.Size {
+			return res, fmt.Errorf("mssql: parameter %s of %s: value of %d bytes is too long for %s", v.name, v.proc, len(p.buffer), makeDecl(v.ti))
+		}
+	}
+	res.buffer = p.buffer
+	if res.buffer == nil {
+		// an empty value is not NULL
+		res.buffer = []byte{}
+	}
+	return res, nil
+}
+
+// procPlainValue checks the range of integers and converts the values
+// that bulk copies do not convert.
+func procPlainValue(val interface{}, ti typeInfo) (interface{}, error) {
+	switch ti.TypeId {
+	case typeIntN:
+		n, ok := val.(int64)
+		if !ok {
+			break
+		}
+		var min, max int64
+		switch ti.Size {
+		case 1:
+			min, max = 0, math.MaxUint8
+		case 2:
+			min, max = math.MinInt16, math.MaxInt16
+		case 4:
+			min, max = math.MinInt32, math.MaxInt32
+		default:
+			return val, nil
+		}
+		if n < min || n > max {
+			return nil, fmt.Errorf("value %d is out of range for %s", n, makeDecl(ti))
+		}
+	case typeDecimalN, typeNumericN, typeMoneyN:
+		if b, ok := val.([]byte); ok {
+			// decimals scanned from result sets
+			return string(b), nil
+		}
+	case typeGuid:
+		switch v := val.(type) {
+		case string:
+			var id UniqueIdentifier
+			if err := id.Scan(v); err != nil {
+				return nil, err
+			}
+			return id.Value()
+		case []byte:
+			if len(v) != 16 {
+				return nil, fmt.Errorf("uniqueidentifier of %d bytes", len(v))
+			}
+		}
+	}
+	return val, nil
+}
+
+// queryProcedure reads the parameters of a procedure from the catalog.
+func queryProcedure(ctx context.Context, q Queryer, name string) (*Procedure, error) {
+	rows, err := q.QueryContext(ctx, `
+SELECT SCHEMA_NAME(o.schema_id), o.name, p.name, TYPE_NAME(p.system_type_id), p.max_length, p.precision,
+	p.scale, p.is_output, p.is_readonly, p.has_default_value, p.default_value, SCHEMA_NAME(t.schema_id),
+	t.name, t.is_table_type, t.is_assembly_type
+FROM sys.objects o
+LEFT JOIN sys.parameters p ON p.object_id = o.object_id AND p.parameter_id > 0
+LEFT JOIN sys.types t ON t.user_type_id = p.user_type_id
+WHERE o.object_id = OBJECT_ID(@p1) AND o.type IN ('P', 'PC', 'X')
+ORDER BY p.parameter_id`, name)
+	if err != nil {
+		return nil, fmt.Errorf("mssql: read parameters of procedure %s failed: %v", name, err)
+	}
+	defer rows.Close()
+	var proc *Procedure
+	for rows.Next() {
+		var (
+			schema, procName                  string
+			paramName, systemType, typeSchema sql.NullString
+			typeName                          sql.NullString
+			maxLength, precision, scale       sql.NullInt64
+			output, readOnly, hasDefault      sql.NullBool
+			tableType, assembly               sql.NullBool
+			defaultValue                      interface{}
+		)
+		err = rows.Scan(&schema, &procName, &paramName, &systemType, &maxLength, &precision, &scale,
+			&output, &readOnly, &hasDefault, &defaultValue, &typeSchema, &typeName, &tableType, &assembly)
+		if err != nil {
+			return nil, err
+		}
+		if proc == nil {
+			proc = &Procedure{Schema: schema, Name: procName}
+		}
+		if !paramName.Valid {
+			// procedure without parameters
+			continue
+		}
+		param := ProcParam{
+			Name:       paramName.String,
+			Output:     output.Bool,
+			ReadOnly:   readOnly.Bool,
+			HasDefault: hasDefault.Bool,
+			Default:    defaultValue,
+		}
+		t := catalog.Type{
+			Name:      systemType.String,
+			MaxLength: int(maxLength.Int64),
+			Precision: int(precision.Int64),
+			Scale:     int(scale.Int64),
+		}
+		d, ok := describeCatalogType(t)
+		switch {
+		case tableType.Bool || assembly.Bool || !ok:
+			param.DatabaseType = typeSchema.String + "." + typeName.String
+			param.Decl = quoteName(typeSchema.String) + "." + quoteName(typeName.String)
+			if tableType.Bool {
+				param.Decl += " READONLY"
+			}
+		default:
+			param.DatabaseType, param.Decl = d.DatabaseType, d.Decl
+			param.ti, _ = catalogTypeInfo(t)
+			switch param.ti.TypeId {
+			case typeText, typeNText, typeImage, typeVariant:
+				// sent as they are and converted by the server
+				param.ti = typeInfo{}
+			}
+		}
+		proc.Params = append(proc.Params, param)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if proc == nil {
+		return nil, fmt.Errorf("mssql: procedure %s not found", name)
+	}
+	return proc, nil
+}
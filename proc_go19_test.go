@@ -0,0 +1,181 @@
+//go:build go1.9
+// +build go1.9
+
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testProcedure() *Procedure {
+	return &Procedure{Schema: "dbo", Name: "AddOrder", Params: []ProcParam{
+		{Name: "@CustomerID", ti: typeInfo{TypeId: typeIntN, Size: 4}},
+		{Name: "@Amount", ti: typeInfo{TypeId: typeDecimalN, Size: 9, Prec: 10, Scale: 2}},
+		{Name: "@Note", ti: typeInfo{TypeId: typeNVarChar, Size: 20}},
+		{Name: "@OrderID", Output: true, ti: typeInfo{TypeId: typeIntN, Size: 8}},
+	}}
+}
+
+func TestProcedureBind(t *testing.T) {
+	proc := testProcedure()
+	values, err := proc.bind([]interface{}{1, sql.Named("amount", "9.99"), sql.Named("@ORDERID", 5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]interface{}{0: 1, 1: "9.99", 3: 5}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+
+	errors := []struct {
+		args []interface{}
+		err  string
+	}{
+		{[]interface{}{1, 2, 3, 4, 5}, "has 4 parameters, got 5 arguments"},
+		{[]interface{}{sql.Named("Missing", 1)}, "has no parameter Missing"},
+		{[]interface{}{1, sql.Named("CustomerID", 1)}, "parameter @CustomerID of dbo.AddOrder is set twice"},
+		{[]interface{}{sql.Named("Amount", 1), 2}, "positional argument 2 of dbo.AddOrder follows named arguments"},
+	}
+	for _, e := range errors {
+		if _, err := proc.bind(e.args); err == nil || !strings.Contains(err.Error(), e.err) {
+			t.Errorf("%v: got error %v, want %q", e.args, err, e.err)
+		}
+	}
+}
+
+func TestMakeProcParam(t *testing.T) {
+	proc := testProcedure()
+	stmt := &Stmt{c: &Conn{connector: &Connector{ParameterSizing: ParameterSizingBuckets}, sess: &tdsSession{}}}
+	args := []namedValue{
+		{Name: "CustomerID", Value: proc.Params[0].value(proc, int64(7))},
+		{Name: "Amount", Value: proc.Params[1].value(proc, "12.5")},
+		{Name: "Note", Value: proc.Params[2].value(proc, "abc")},
+		{Name: "OrderID", Value: sql.Out{Dest: proc.Params[3].value(proc, nil)}},
+	}
+	params, decls, err := stmt.makeRPCParams(args, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"@CustomerID int", "@Amount decimal(10, 2)", "@Note nvarchar(10)", "@OrderID bigint output"}
+	if !reflect.DeepEqual(decls, want) {
+		t.Errorf("got declarations %q, want %q", decls, want)
+	}
+	buffers := [][]byte{
+		{7, 0, 0, 0},
+		{1, 0xe2, 4, 0, 0, 0, 0, 0, 0},
+		{'a', 0, 'b', 0, 'c', 0},
+		nil,
+	}
+	for i, p := range params {
+		if p.ti.Size != proc.Params[i].ti.Size {
+			t.Errorf("%s: got size %d, want the declared %d", p.Name, p.ti.Size, proc.Params[i].ti.Size)
+		}
+		if !bytes.Equal(p.buffer, buffers[i]) || (p.buffer == nil) != (buffers[i] == nil) {
+			t.Errorf("%s: got value %v, want %v", p.Name, p.buffer, buffers[i])
+		}
+	}
+	if params[3].Flags != fByRevValue {
+		t.Errorf("output parameter has flags %d", params[3].Flags)
+	}
+
+	errors := []struct {
+		i     int
+		value interface{}
+		err   string
+	}{
+		{0, int64(1) << 31, "parameter @CustomerID of dbo.AddOrder: value 2147483648 is out of range for int"},
+		{0, "abc", "invalid type for int column"},
+		{1, "1e100", "parameter @Amount of dbo.AddOrder"},
+		{2, strings.Repeat("x", 11), "value of 22 bytes is too long for nvarchar(10)"},
+	}
+	for _, e := range errors {
+		v := proc.Params[e.i].value(proc, e.value)
+		if _, err := stmt.makeProcParam(v.(procValue)); err == nil || !strings.Contains(err.Error(), e.err) {
+			t.Errorf("%v: got error %v, want %q", e.value, err, e.err)
+		}
+	}
+
+	guid := procValue{proc: "p", name: "@id", ti: typeInfo{TypeId: typeGuid, Size: 16}, value: "6F9619FF-8B86-D011-B42D-00C04FC964FF"}
+	p, err := stmt.makeProcParam(guid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.buffer) != 16 || p.buffer[0] != 0xff {
+		t.Errorf("got uniqueidentifier %x", p.buffer)
+	}
+}
+
+func TestProceduresCall(t *testing.T) {
+	checkConnStr(t)
+	db, logger := open(t)
+	defer db.Close()
+	defer logger.StopLogging()
+	ctx := context.Background()
+
+	_, err := db.Exec(`
+IF OBJECT_ID('dbo.test_proc_call') IS NOT NULL DROP PROC dbo.test_proc_call`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+CREATE PROC dbo.test_proc_call
+	@id int,
+	@amount numeric(10, 2),
+	@name varchar(10) = 'none',
+	@total numeric(12, 2) OUTPUT,
+	@echo nvarchar(10) OUTPUT
+AS
+	SET @total = @amount * 2
+	SET @echo = @name
+	SELECT @id AS id, @name AS name
+	SELECT 1 AS one UNION ALL SELECT 2
+	RETURN 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP PROC dbo.test_proc_call")
+
+	var procs Procedures
+	proc, err := procs.Lookup(ctx, db, "test_proc_call")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proc.Params) != 5 || proc.Params[1].Decl != "numeric(10, 2)" || proc.Params[2].DatabaseType != "VARCHAR" || !proc.Params[3].Output {
+		t.Fatalf("got parameters %+v", proc.Params)
+	}
+
+	res, err := procs.Call(ctx, db, "dbo.test_proc_call", 7, "1.25", sql.Named("total", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ReturnStatus != 3 {
+		t.Errorf("got return status %d", res.ReturnStatus)
+	}
+	if total, ok := res.Output["@total"].([]byte); !ok || string(total) != "2.50" {
+		t.Errorf("got total %v", res.Output["@total"])
+	}
+	if res.Output["@echo"] != "none" {
+		t.Errorf("got echo %v", res.Output["@echo"])
+	}
+	if len(res.ResultSets) != 2 || res.ResultSets[0].Columns[1] != "name" || len(res.ResultSets[1].Rows) != 2 {
+		t.Fatalf("got result sets %+v", res.ResultSets)
+	}
+	if row := res.ResultSets[0].Rows[0]; row[0] != int64(7) || row[1] != "none" {
+		t.Errorf("got row %v", row)
+	}
+
+	if _, err = procs.Call(ctx, db, "dbo.test_proc_call", 1<<40, 1); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("got error %v, want out of range", err)
+	}
+	if _, err = procs.Call(ctx, db, "dbo.test_proc_call", 1, 1, "a long name"); err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Errorf("got error %v, want too long", err)
+	}
+	if _, err = procs.Lookup(ctx, db, "dbo.missing_proc"); err == nil {
+		t.Error("found a missing procedure")
+	}
+}
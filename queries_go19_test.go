@@ -7,12 +7,14 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"reflect"
 	"regexp"
 	"testing"
 	"time"
 
+	"github.com/denisenkom/go-mssqldb/internal/querytext"
 	"github.com/golang-sql/sqlexp"
 )
 
@@ -1369,3 +1371,176 @@ func TestCancelWithNoResults(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", r.Err())
 	}
 }
+
+func TestXMLParamRoundTrip(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	_, err := conn.Exec(`create xml schema collection dbo.TestXMLParamCollection as N'
+<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema">
+	<xsd:element name="item" type="xsd:int"/>
+</xsd:schema>'`)
+	if err != nil {
+		t.Fatal("creating schema collection failed:", err)
+	}
+	defer conn.Exec("drop xml schema collection dbo.TestXMLParamCollection")
+
+	var res string
+	err = conn.QueryRow("select @p1", XML{Value: "<item>12</item>"}).Scan(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "<item>12</item>" {
+		t.Errorf("untyped xml returned %s", res)
+	}
+
+	typed := XML{Value: "<item>12</item>", SchemaCollection: "dbo.TestXMLParamCollection"}
+	err = conn.QueryRow("select @p1", typed).Scan(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "<item>12</item>" {
+		t.Errorf("typed xml returned %s", res)
+	}
+
+	typed.Value = "<item>twelve</item>"
+	err = conn.QueryRow("select @p1", typed).Scan(&res)
+	if err == nil {
+		t.Error("xml not valid for the schema collection should be rejected")
+	}
+}
+
+func TestODBCEscapes(t *testing.T) {
+	checkConnStr(t)
+	tl := testLogger{t: t}
+	defer tl.StopLogging()
+	SetLogger(&tl)
+
+	// the query text is only parsed by the mssql driver
+	db, err := sql.Open("mssql", makeConnStr(t).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "CREATE PROC #odbc_call @a int, @b nvarchar(10) output AS BEGIN SET @b = concat(@b, @a); RETURN @a + 1 END")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rs ReturnStatus
+	b := "x"
+	_, err = conn.ExecContext(ctx, "{?= call #odbc_call(?, ?)}", &rs, 5, sql.Out{Dest: &b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs != 6 || b != "x5" {
+		t.Errorf("got status %d and output %q", rs, b)
+	}
+
+	var s string
+	var d time.Time
+	err = conn.QueryRowContext(ctx, "select {fn UCASE(?)}, {d '2024-01-02'}", "abc").Scan(&s, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "ABC" || !d.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %q and %v", s, d)
+	}
+}
+
+func TestCallOutputValues(t *testing.T) {
+	var b string
+	var n int64
+	c := &Conn{}
+	args := []driver.NamedValue{
+		{Ordinal: 1, Value: sql.Out{Dest: &b}},
+		{Ordinal: 2, Value: int64(5)},
+		{Name: "n", Ordinal: 3, Value: sql.Out{Dest: &n}},
+	}
+	var nvs []namedValue
+	for i := range args {
+		if err := c.CheckNamedValue(&args[i]); err != nil && err != driver.ErrSkip {
+			t.Fatal(err)
+		}
+		nvs = append(nvs, namedValue(args[i]))
+	}
+
+	call := &querytext.Call{Proc: "dbo.proc", Params: []string{"@n", "@p2", "@p1"}}
+	_, callOuts, err := callArgs(call, nvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"n", "p1"}; !reflect.DeepEqual(callOuts, want) {
+		t.Fatalf("got output keys %v, want %v", callOuts, want)
+	}
+
+	// return values have the names of the procedure parameters
+	outs := c.outs
+	outs.callOuts = callOuts
+	if err = outs.returnValue(namedValue{Name: "@count", Value: int64(7)}); err != nil {
+		t.Fatal(err)
+	}
+	if err = outs.returnValue(namedValue{Name: "@text", Value: "x5"}); err != nil {
+		t.Fatal(err)
+	}
+	if n != 7 || b != "x5" {
+		t.Errorf("got output values %d and %q, want 7 and \"x5\"", n, b)
+	}
+
+	// outside of a call escape unnamed outputs are returned as @p<ordinal>
+	outs = c.outs
+	if err = outs.returnValue(namedValue{Name: "@p1", Value: "y"}); err != nil {
+		t.Fatal(err)
+	}
+	if b != "y" {
+		t.Errorf("got output value %q, want \"y\"", b)
+	}
+}
+
+func TestSliceParameters(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	ids := make([]int64, 3000)
+	for i := range ids {
+		ids[i] = int64(i)
+	}
+	query := "select count(*) from (select top 5000 row_number() over (order by (select 1)) - 1 n " +
+		"from sys.all_columns a cross join sys.all_columns b) t where n in (@ids) and n not in (@p2)"
+	values := []struct {
+		ids     []int64
+		exclude []int
+		count   int
+	}{
+		{ids[:10], []int{1, 2}, 8},
+		{ids, []int{1}, 2999},
+		{ids[:5], nil, 5},
+	}
+	for _, v := range values {
+		var count int
+		err := conn.QueryRow(query, sql.Named("ids", v.ids), v.exclude).Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != v.count {
+			t.Errorf("got %d rows for %d ids, expected %d", count, len(v.ids), v.count)
+		}
+	}
+
+	var count int
+	err := conn.QueryRow("select count(*) from (values ('a'), ('b'), ('c')) t(value) where value in (@p1)", []string{"c", "a"}).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("got %d rows for 2 strings", count)
+	}
+}
@@ -2,6 +2,7 @@ package mssql
 
 import (
 	"encoding/binary"
+	"io"
 )
 
 type procId struct {
@@ -20,6 +21,9 @@ type param struct {
 	Flags  uint8
 	ti     typeInfo
 	buffer []byte
+	// writer, when set, writes the value in place of buffer, it streams
+	// values read from a source while the request is sent
+	writer func(w io.Writer) error
 }
 
 var (
@@ -63,21 +67,62 @@ func sendRpc(buf *tdsBuffer, headers []headerStruct, proc procId, flags uint16,
 	if err != nil {
 		return
 	}
+	streamed := false
 	for _, param := range params {
 		if err = writeBVarChar(buf, param.Name); err != nil {
-			return
+			break
 		}
 		if err = binary.Write(buf, binary.LittleEndian, param.Flags); err != nil {
-			return
+			break
 		}
 		err = writeTypeInfo(buf, &param.ti)
 		if err != nil {
-			return
+			break
 		}
-		err = param.ti.Writer(buf, param.ti, param.buffer)
-		if err != nil {
-			return
+		if param.writer != nil {
+			w := &paramWriter{w: buf}
+			if err = param.writer(w); err != nil {
+				return writerError{err: err, source: w.err == nil}
+			}
+			streamed = true
+		} else if err = param.ti.Writer(buf, param.ti, param.buffer); err != nil {
+			break
 		}
 	}
-	return buf.FinishPacket()
+	if err == nil {
+		err = buf.FinishPacket()
+	}
+	if err != nil && streamed {
+		err = writerError{err: err}
+	}
+	return
+}
+
+// paramWriter keeps the error of the writes of a param writer, to tell
+// the errors of the connection from the errors of the source of the values.
+type paramWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *paramWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// writerError is the error of a request sending params with a writer,
+// the values of the writer were read and can't be sent again so the
+// request must not be retried.
+type writerError struct {
+	err error
+	// source is set when the writer failed without a connection error,
+	// the request can be cancelled and the connection used again.
+	source bool
+}
+
+func (e writerError) Error() string {
+	return e.err.Error()
 }
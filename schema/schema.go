@@ -0,0 +1,417 @@
+// Package schema reads the tables and table types of a database from the
+// catalog views, for code generation and validation.
+//
+// The types of the columns are named as Rows.ColumnTypeDatabaseTypeName
+// names the columns of result sets, so a column read by a query has the
+// DatabaseType of its Column.
+//
+//	db, err := schema.Load(ctx, conn)
+//	if err != nil {
+//		return err
+//	}
+//	for _, t := range db.Tables {
+//		fmt.Println(t.Schema, t.Name, len(t.Columns))
+//	}
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	_ "github.com/denisenkom/go-mssqldb" // sets catalog.Describe
+	"github.com/denisenkom/go-mssqldb/internal/catalog"
+)
+
+// Queryer reads the catalog views, it is implemented by *sql.DB,
+// *sql.Conn and *sql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Database is the schema of the user tables and table types of a
+// database.
+type Database struct {
+	// Tables are sorted by schema and name.
+	Tables []Table
+	// TableTypes are the user-defined table types, as used by
+	// table-valued parameters, sorted by schema and name.
+	TableTypes []TableType
+}
+
+// Table is a user table.
+type Table struct {
+	Schema string
+	Name   string
+	// Columns are in the order of the table.
+	Columns []Column
+	// Indexes include the indexes of the primary key and unique
+	// constraints.
+	Indexes     []Index
+	ForeignKeys []ForeignKey
+}
+
+// TableType is a user-defined table type.
+type TableType struct {
+	Schema  string
+	Name    string
+	Columns []Column
+	Indexes []Index
+}
+
+// Column is a column of a table or table type.
+type Column struct {
+	Name string
+
+	// DatabaseType is the name of the type as returned by
+	// Rows.ColumnTypeDatabaseTypeName, such as NVARCHAR. CLR types, such
+	// as hierarchyid, are named in uppercase.
+	DatabaseType string
+	// Decl is the declaration of the type, such as nvarchar(50).
+	Decl string
+	// UserType is the schema qualified name of the alias type of the
+	// column, such as dbo.phone, empty for system types.
+	UserType string
+
+	// Length is the length returned by Rows.ColumnTypeLength, in
+	// characters for strings, 0 for types without a length.
+	Length int64
+	// MaxLength is the maximum length in bytes, -1 for max types.
+	MaxLength int
+	Precision int
+	Scale     int
+
+	Nullable  bool
+	Collation string // empty for types other than strings
+
+	// Default is the expression of the default constraint, empty
+	// without default.
+	Default string
+	// Identity is set for identity columns.
+	Identity *Identity
+	// Computed is the expression of a computed column.
+	Computed  string
+	Persisted bool
+}
+
+// Identity is the seed and increment of an identity column.
+type Identity struct {
+	Seed      int64
+	Increment int64
+}
+
+// Index is an index or a primary key or unique constraint.
+type Index struct {
+	Name string
+	// Type is CLUSTERED, NONCLUSTERED, CLUSTERED COLUMNSTORE and so on.
+	Type             string
+	Unique           bool
+	PrimaryKey       bool
+	UniqueConstraint bool
+	// Columns are the key columns in order.
+	Columns []IndexColumn
+	// Included are the included columns of a nonclustered index.
+	Included []string
+	// Filter is the predicate of a filtered index.
+	Filter string
+}
+
+// IndexColumn is a key column of an index.
+type IndexColumn struct {
+	Name       string
+	Descending bool
+}
+
+// ForeignKey is a foreign key constraint.
+type ForeignKey struct {
+	Name string
+	// Columns reference the columns of the same position of RefColumns.
+	Columns           []string
+	RefSchema         string
+	RefTable          string
+	RefColumns        []string
+	OnDelete          string // NO_ACTION, CASCADE, SET_NULL or SET_DEFAULT
+	OnUpdate          string
+	Disabled          bool
+	NotTrusted        bool
+	NotForReplication bool
+}
+
+// PrimaryKey returns the index of the primary key of the table, nil
+// without primary key.
+func (t *Table) PrimaryKey() *Index {
+	for i := range t.Indexes {
+		if t.Indexes[i].PrimaryKey {
+			return &t.Indexes[i]
+		}
+	}
+	return nil
+}
+
+// Column returns a column by name, compared without case as the default
+// collations do, nil if there is none.
+func (t *Table) Column(name string) *Column {
+	return findColumn(t.Columns, name)
+}
+
+// Column returns a column by name, nil if there is none.
+func (t *TableType) Column(name string) *Column {
+	return findColumn(t.Columns, name)
+}
+
+func findColumn(columns []Column, name string) *Column {
+	for i := range columns {
+		if strings.EqualFold(columns[i].Name, name) {
+			return &columns[i]
+		}
+	}
+	return nil
+}
+
+// Table returns a table by schema and name, nil if there is none.
+func (db *Database) Table(schema, name string) *Table {
+	for i := range db.Tables {
+		t := &db.Tables[i]
+		if strings.EqualFold(t.Schema, schema) && strings.EqualFold(t.Name, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+// TableType returns a table type by schema and name, nil if there is
+// none.
+func (db *Database) TableType(schema, name string) *TableType {
+	for i := range db.TableTypes {
+		t := &db.TableTypes[i]
+		if strings.EqualFold(t.Schema, schema) && strings.EqualFold(t.Name, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+// objects are the objects of the catalog whose columns and indexes are
+// read, tables and the tables of table types.
+const objects = `
+SELECT object_id FROM sys.tables WHERE is_ms_shipped = 0
+UNION ALL
+SELECT type_table_object_id FROM sys.table_types WHERE is_user_defined = 1`
+
+// object is the columns and indexes of a table or table type.
+type object struct {
+	columns []Column
+	indexes []Index
+}
+
+// Load reads the schema of the user tables and table types of the current
+// database of q.
+func Load(ctx context.Context, q Queryer) (*Database, error) {
+	objs := make(map[int]*object)
+	get := func(id int) *object {
+		o := objs[id]
+		if o == nil {
+			o = &object{}
+			objs[id] = o
+		}
+		return o
+	}
+	if err := loadColumns(ctx, q, get); err != nil {
+		return nil, err
+	}
+	if err := loadIndexes(ctx, q, get); err != nil {
+		return nil, err
+	}
+	foreignKeys, err := loadForeignKeys(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &Database{}
+	rows, err := q.QueryContext(ctx, `
+SELECT object_id, SCHEMA_NAME(schema_id), name FROM sys.tables
+WHERE is_ms_shipped = 0
+ORDER BY 2, 3`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var t Table
+		if err = rows.Scan(&id, &t.Schema, &t.Name); err != nil {
+			return nil, err
+		}
+		o := get(id)
+		t.Columns, t.Indexes, t.ForeignKeys = o.columns, o.indexes, foreignKeys[id]
+		db.Tables = append(db.Tables, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.QueryContext(ctx, `
+SELECT type_table_object_id, SCHEMA_NAME(schema_id), name FROM sys.table_types
+WHERE is_user_defined = 1
+ORDER BY 2, 3`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var t TableType
+		if err = rows.Scan(&id, &t.Schema, &t.Name); err != nil {
+			return nil, err
+		}
+		o := get(id)
+		t.Columns, t.Indexes = o.columns, o.indexes
+		db.TableTypes = append(db.TableTypes, t)
+	}
+	return db, rows.Err()
+}
+
+func loadColumns(ctx context.Context, q Queryer, get func(id int) *object) error {
+	rows, err := q.QueryContext(ctx, `
+SELECT c.object_id, c.name, TYPE_NAME(c.system_type_id), t.name, SCHEMA_NAME(t.schema_id),
+	t.is_user_defined, t.is_assembly_type, c.max_length, c.precision, c.scale, c.is_nullable,
+	c.collation_name, d.definition, CAST(i.seed_value AS bigint), CAST(i.increment_value AS bigint),
+	cc.definition, cc.is_persisted
+FROM sys.columns c
+JOIN sys.types t ON t.user_type_id = c.user_type_id
+LEFT JOIN sys.default_constraints d ON d.object_id = c.default_object_id
+LEFT JOIN sys.identity_columns i ON i.object_id = c.object_id AND i.column_id = c.column_id
+LEFT JOIN sys.computed_columns cc ON cc.object_id = c.object_id AND cc.column_id = c.column_id
+WHERE c.object_id IN (`+objects+`)
+ORDER BY c.object_id, c.column_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id                         int
+			c                          Column
+			systemType, typ, typSchema string
+			userDefined, assembly      bool
+			collation, def, computed   sql.NullString
+			seed, increment            sql.NullInt64
+			persisted                  sql.NullBool
+		)
+		err = rows.Scan(&id, &c.Name, &systemType, &typ, &typSchema, &userDefined, &assembly,
+			&c.MaxLength, &c.Precision, &c.Scale, &c.Nullable, &collation, &def, &seed, &increment,
+			&computed, &persisted)
+		if err != nil {
+			return err
+		}
+		if assembly {
+			// CLR types are not named by the driver
+			c.DatabaseType = strings.ToUpper(typ)
+			c.Decl = typ
+		} else {
+			d, ok := catalog.Describe(catalog.Type{Name: systemType, MaxLength: c.MaxLength, Precision: c.Precision, Scale: c.Scale})
+			if ok {
+				c.DatabaseType, c.Decl, c.Length = d.DatabaseType, d.Decl, d.Length
+			} else {
+				c.DatabaseType, c.Decl = strings.ToUpper(systemType), systemType
+			}
+			if userDefined {
+				c.UserType = typSchema + "." + typ
+			}
+		}
+		c.Collation = collation.String
+		c.Default = def.String
+		c.Computed = computed.String
+		c.Persisted = persisted.Bool
+		if seed.Valid {
+			c.Identity = &Identity{Seed: seed.Int64, Increment: increment.Int64}
+		}
+		o := get(id)
+		o.columns = append(o.columns, c)
+	}
+	return rows.Err()
+}
+
+func loadIndexes(ctx context.Context, q Queryer, get func(id int) *object) error {
+	rows, err := q.QueryContext(ctx, `
+SELECT i.object_id, i.index_id, i.name, i.type_desc, i.is_unique, i.is_primary_key,
+	i.is_unique_constraint, i.filter_definition, c.name, ic.is_descending_key, ic.is_included_column
+FROM sys.indexes i
+JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+WHERE i.type > 0 AND i.object_id IN (`+objects+`)
+ORDER BY i.object_id, i.index_id, ic.is_included_column, ic.key_ordinal, ic.index_column_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	lastID, lastIndex := -1, -1
+	for rows.Next() {
+		var (
+			id, indexID          int
+			idx                  Index
+			name, filter         sql.NullString
+			column               string
+			descending, included bool
+		)
+		err = rows.Scan(&id, &indexID, &name, &idx.Type, &idx.Unique, &idx.PrimaryKey,
+			&idx.UniqueConstraint, &filter, &column, &descending, &included)
+		if err != nil {
+			return err
+		}
+		o := get(id)
+		if id != lastID || indexID != lastIndex {
+			idx.Name = name.String
+			idx.Filter = filter.String
+			o.indexes = append(o.indexes, idx)
+			lastID, lastIndex = id, indexID
+		}
+		cur := &o.indexes[len(o.indexes)-1]
+		if included {
+			cur.Included = append(cur.Included, column)
+		} else {
+			cur.Columns = append(cur.Columns, IndexColumn{Name: column, Descending: descending})
+		}
+	}
+	return rows.Err()
+}
+
+func loadForeignKeys(ctx context.Context, q Queryer) (map[int][]ForeignKey, error) {
+	rows, err := q.QueryContext(ctx, `
+SELECT fk.parent_object_id, fk.name, SCHEMA_NAME(rt.schema_id), rt.name,
+	fk.delete_referential_action_desc, fk.update_referential_action_desc,
+	fk.is_disabled, fk.is_not_trusted, fk.is_not_for_replication, pc.name, rc.name
+FROM sys.foreign_keys fk
+JOIN sys.tables rt ON rt.object_id = fk.referenced_object_id
+JOIN sys.foreign_key_columns fkc ON fkc.constraint_object_id = fk.object_id
+JOIN sys.columns pc ON pc.object_id = fkc.parent_object_id AND pc.column_id = fkc.parent_column_id
+JOIN sys.columns rc ON rc.object_id = fkc.referenced_object_id AND rc.column_id = fkc.referenced_column_id
+WHERE fk.is_ms_shipped = 0
+ORDER BY fk.parent_object_id, fk.name, fkc.constraint_column_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[int][]ForeignKey)
+	for rows.Next() {
+		var (
+			id             int
+			fk             ForeignKey
+			column, refCol string
+		)
+		err = rows.Scan(&id, &fk.Name, &fk.RefSchema, &fk.RefTable, &fk.OnDelete, &fk.OnUpdate,
+			&fk.Disabled, &fk.NotTrusted, &fk.NotForReplication, &column, &refCol)
+		if err != nil {
+			return nil, err
+		}
+		keys := res[id]
+		if len(keys) == 0 || keys[len(keys)-1].Name != fk.Name {
+			keys = append(keys, fk)
+		}
+		last := &keys[len(keys)-1]
+		last.Columns = append(last.Columns, column)
+		last.RefColumns = append(last.RefColumns, refCol)
+		res[id] = keys
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,146 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLookup(t *testing.T) {
+	db := &Database{
+		Tables: []Table{{Schema: "dbo", Name: "Users", Columns: []Column{{Name: "ID"}, {Name: "Name"}}, Indexes: []Index{
+			{Name: "IX_Name"},
+			{Name: "PK_Users", PrimaryKey: true},
+		}}},
+		TableTypes: []TableType{{Schema: "app", Name: "IDs", Columns: []Column{{Name: "id"}}}},
+	}
+	table := db.Table("DBO", "users")
+	if table == nil || table.Column("id") != &table.Columns[0] || table.Column("missing") != nil {
+		t.Fatalf("got table %+v", table)
+	}
+	if pk := table.PrimaryKey(); pk == nil || pk.Name != "PK_Users" {
+		t.Errorf("got primary key %+v", pk)
+	}
+	if db.Table("app", "Users") != nil {
+		t.Error("found a table of another schema")
+	}
+	if tt := db.TableType("app", "ids"); tt == nil || tt.Column("ID") == nil {
+		t.Errorf("got table type %+v", tt)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dsn := os.Getenv("SQLSERVER_DSN")
+	if dsn == "" {
+		t.Skip("no SQLSERVER_DSN")
+	}
+	sqldb, err := sql.Open("sqlserver", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Close()
+	ctx := context.Background()
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	parent, child, tableType := "schema_parent_"+suffix, "schema_child_"+suffix, "schema_type_"+suffix
+	_, err = sqldb.Exec(`
+CREATE TABLE ` + parent + ` (
+	id int IDENTITY(10, 5) NOT NULL CONSTRAINT PK_` + parent + ` PRIMARY KEY,
+	code char(3) NOT NULL CONSTRAINT UQ_` + parent + ` UNIQUE
+)
+CREATE TABLE ` + child + ` (
+	id bigint NOT NULL,
+	parent_id int NULL CONSTRAINT FK_` + child + ` REFERENCES ` + parent + ` (id) ON DELETE CASCADE,
+	name nvarchar(50) COLLATE Latin1_General_CI_AS NOT NULL DEFAULT (N'none'),
+	notes nvarchar(max) NULL,
+	price numeric(10, 2) NULL,
+	total AS (price * 2) PERSISTED,
+	created datetime2(3) NOT NULL,
+	uid uniqueidentifier NULL,
+	version rowversion,
+	CONSTRAINT PK_` + child + ` PRIMARY KEY (id DESC)
+)
+CREATE INDEX IX_` + child + ` ON ` + child + ` (name, created) INCLUDE (notes) WHERE price > 0
+CREATE TYPE ` + tableType + ` AS TABLE (id int NOT NULL PRIMARY KEY, value sysname NULL)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqldb.Exec("DROP TABLE " + child + "; DROP TABLE " + parent + "; DROP TYPE " + tableType)
+
+	db, err := Load(ctx, sqldb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, c, tt := db.Table("dbo", parent), db.Table("dbo", child), db.TableType("dbo", tableType)
+	if p == nil || c == nil || tt == nil {
+		t.Fatalf("tables not found: %v %v %v", p, c, tt)
+	}
+
+	id := p.Column("id")
+	if id.DatabaseType != "INT" || id.Nullable || id.Identity == nil || *id.Identity != (Identity{Seed: 10, Increment: 5}) {
+		t.Errorf("got id %+v", id)
+	}
+	if pk := p.PrimaryKey(); pk == nil || pk.Name != "PK_"+parent || pk.Type != "CLUSTERED" || len(pk.Columns) != 1 {
+		t.Errorf("got primary key %+v", pk)
+	}
+	if len(p.Indexes) != 2 || !p.Indexes[1].UniqueConstraint || !p.Indexes[1].Unique {
+		t.Errorf("got indexes %+v", p.Indexes)
+	}
+
+	name := c.Column("name")
+	if name.Decl != "nvarchar(50)" || name.Length != 50 || name.Collation != "Latin1_General_CI_AS" || name.Default != "(N'none')" {
+		t.Errorf("got name %+v", name)
+	}
+	if total := c.Column("total"); total.Computed != "([price]*(2))" || !total.Persisted {
+		t.Errorf("got total %+v", total)
+	}
+	wantFK := []ForeignKey{{
+		Name:       "FK_" + child,
+		Columns:    []string{"parent_id"},
+		RefSchema:  "dbo",
+		RefTable:   parent,
+		RefColumns: []string{"id"},
+		OnDelete:   "CASCADE",
+		OnUpdate:   "NO_ACTION",
+	}}
+	if !reflect.DeepEqual(c.ForeignKeys, wantFK) {
+		t.Errorf("got foreign keys %+v", c.ForeignKeys)
+	}
+	wantIndex := Index{
+		Name:     "IX_" + child,
+		Type:     "NONCLUSTERED",
+		Columns:  []IndexColumn{{Name: "name"}, {Name: "created"}},
+		Included: []string{"notes"},
+		Filter:   "([price]>(0))",
+	}
+	if len(c.Indexes) != 2 || !reflect.DeepEqual(c.Indexes[1], wantIndex) || !c.Indexes[0].Columns[0].Descending {
+		t.Errorf("got indexes %+v", c.Indexes)
+	}
+	if value := tt.Column("value"); value.DatabaseType != "NVARCHAR" || value.Decl != "nvarchar(128)" || tt.Indexes[0].Columns[0].Name != "id" {
+		t.Errorf("got table type %+v", tt)
+	}
+
+	// the types are those of the columns of result sets
+	rows, err := sqldb.Query("SELECT * FROM " + child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ct := range types {
+		col := c.Columns[i]
+		if ct.Name() != col.Name || ct.DatabaseTypeName() != col.DatabaseType {
+			t.Errorf("column %s: got %s, result set has %s %s", col.Name, col.DatabaseType, ct.Name(), ct.DatabaseTypeName())
+		}
+		if length, ok := ct.Length(); ok && length != col.Length {
+			t.Errorf("column %s: got length %d, result set has %d", col.Name, col.Length, length)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package sqlcmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/denisenkom/go-mssqldb/batch"
+)
+
+// Output receives the results of the batches of a script.
+type Output interface {
+	// Rows writes a result set, reading its rows until the end.
+	Rows(rows *sql.Rows) error
+	// Message writes a PRINT message or a RAISERROR message of severity
+	// 10 or less.
+	Message(msg string)
+	// Error writes the error of a batch, server errors are
+	// *batch.ScriptError located in the script.
+	Error(err error)
+	// RowsAffected writes the number of rows of a statement.
+	RowsAffected(count int64)
+	// BatchDone is called after a batch ran.
+	BatchDone(elapsed time.Duration)
+}
+
+// textOutput writes the results as sqlcmd does, result sets are tab
+// separated.
+type textOutput struct {
+	w io.Writer
+}
+
+func (o textOutput) Rows(rows *sql.Rows) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(o.w, strings.Join(cols, "\t"))
+	values := make([]interface{}, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range dest {
+		dest[i] = &values[i]
+	}
+	fields := make([]string, len(cols))
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			switch v := v.(type) {
+			case nil:
+				fields[i] = "NULL"
+			case []byte:
+				fields[i] = fmt.Sprintf("0x%X", v)
+			case time.Time:
+				fields[i] = v.Format("2006-01-02 15:04:05.9999999")
+			default:
+				fields[i] = fmt.Sprint(v)
+			}
+		}
+		fmt.Fprintln(o.w, strings.Join(fields, "\t"))
+	}
+	return rows.Err()
+}
+
+func (o textOutput) Message(msg string) {
+	fmt.Fprintln(o.w, msg)
+}
+
+func (o textOutput) Error(err error) {
+	fmt.Fprintln(o.w, FormatError(err))
+}
+
+func (o textOutput) RowsAffected(count int64) {
+	fmt.Fprintf(o.w, "(%d rows affected)\n", count)
+}
+
+func (o textOutput) BatchDone(elapsed time.Duration) {}
+
+// FormatError formats an error as sqlcmd, with the number, severity and
+// state of server errors and their location in the script.
+func FormatError(err error) string {
+	var sqlErr mssql.Error
+	if !errors.As(err, &sqlErr) {
+		return err.Error()
+	}
+	location := fmt.Sprintf("Line %d", sqlErr.LineNo)
+	var scriptErr *batch.ScriptError
+	if errors.As(err, &scriptErr) {
+		location = position{scriptErr.File, scriptErr.Line}.String()
+	}
+	return fmt.Sprintf("Msg %d, Level %d, State %d, Server %s, %s\n%s",
+		sqlErr.Number, sqlErr.Class, sqlErr.State, sqlErr.ServerName, location, sqlErr.Message)
+}
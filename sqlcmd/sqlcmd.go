@@ -0,0 +1,534 @@
+// Package sqlcmd runs scripts written for the sqlcmd utility.
+//
+// Scripts are split into batches by batch.Split and may use the sqlcmd
+// commands :setvar, :r, :on error and :connect, as well as $(Var)
+// scripting variables. Commands must start a line. The batches are run
+// through a *sql.DB, *sql.Conn or *sql.Tx of the sqlserver driver; use a
+// *sql.Conn to keep the session, such as temporary tables, between
+// batches.
+package sqlcmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denisenkom/go-mssqldb/batch"
+	"github.com/golang-sql/sqlexp"
+)
+
+// Queryer runs the batches of a script, it is implemented by *sql.DB,
+// *sql.Conn and *sql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ConnectArgs are the arguments of a :connect command.
+type ConnectArgs struct {
+	Server       string
+	User         string // empty for integrated authentication
+	Password     string
+	LoginTimeout time.Duration // zero if not set
+}
+
+// Runner runs sqlcmd scripts.
+type Runner struct {
+	// Vars are the scripting variables defined before the script runs.
+	// They are not changed by :setvar, unless KeepVars is set.
+	Vars map[string]string
+
+	// KeepVars stores the variables set by :setvar in Vars, so they are
+	// defined for the next scripts, such as the batches typed in an
+	// interactive session.
+	KeepVars bool
+
+	// Output receives the results of the batches. When nil, PRINT and
+	// RAISERROR messages, errors, tab separated result sets and the
+	// number of rows affected are written to Out.
+	Output Output
+
+	// Out receives the results when Output is nil. Nil discards them.
+	Out io.Writer
+
+	// Connect opens the connection of a :connect command. If the
+	// connection implements io.Closer it is closed when the script ends
+	// or connects again. A nil Connect fails :connect commands.
+	Connect func(ctx context.Context, args ConnectArgs) (Queryer, error)
+
+	// ReadFile reads the files included by :r, ioutil.ReadFile is used
+	// when nil. Relative names are relative to the directory of the
+	// including file.
+	ReadFile func(name string) ([]byte, error)
+
+	// ExitOnError stops the script at the first failed batch, as
+	// :on error exit. By default errors are written to Out and the
+	// script continues, as :on error ignore.
+	ExitOnError bool
+
+	// Separator is the batch separator, GO if empty.
+	Separator string
+}
+
+// Run runs a script. It returns the error that stopped the script, nil
+// if the script ran until its end, even with errors ignored by
+// :on error ignore. Server errors are returned as *batch.ScriptError
+// located in the script and its included files.
+func (r *Runner) Run(ctx context.Context, q Queryer, script string) error {
+	return r.run(ctx, q, script, "")
+}
+
+// RunFile runs the script of a file.
+func (r *Runner) RunFile(ctx context.Context, q Queryer, name string) error {
+	data, err := r.readFile(name)
+	if err != nil {
+		return err
+	}
+	return r.run(ctx, q, string(data), name)
+}
+
+func (r *Runner) run(ctx context.Context, q Queryer, text, name string) error {
+	s, err := r.parse(text, name)
+	if err != nil {
+		return err
+	}
+	exitOnError := r.ExitOnError
+	var opened io.Closer
+	defer func() {
+		if opened != nil {
+			opened.Close()
+		}
+	}()
+	for _, b := range s.batches {
+		for _, cmd := range b.commands {
+			switch cmd.name {
+			case "on error":
+				exitOnError = cmd.exitOnError
+			case "connect":
+				if r.Connect == nil {
+					return fmt.Errorf("sqlcmd: %s: no Connect function to connect to %s", cmd.pos, cmd.connect.Server)
+				}
+				conn, err := r.Connect(ctx, cmd.connect)
+				if err != nil {
+					return fmt.Errorf("sqlcmd: %s: connect to %s failed: %v", cmd.pos, cmd.connect.Server, err)
+				}
+				if opened != nil {
+					opened.Close()
+					opened = nil
+				}
+				q = conn
+				if closer, ok := conn.(io.Closer); ok {
+					opened = closer
+				}
+			}
+		}
+		if strings.TrimSpace(b.Text) == "" {
+			continue
+		}
+		err = r.exec(ctx, q, s, b.Batch)
+		if err != nil && (exitOnError || ctx.Err() != nil) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) output() Output {
+	if r.Output != nil {
+		return r.Output
+	}
+	if r.Out == nil {
+		return textOutput{ioutil.Discard}
+	}
+	return textOutput{r.Out}
+}
+
+// exec runs a batch, writing its messages and results to the output. The
+// server errors are located in the script.
+func (r *Runner) exec(ctx context.Context, q Queryer, s *script, b batch.Batch) error {
+	out := r.output()
+	start := time.Now()
+	defer func() { out.BatchDone(time.Since(start)) }()
+	retmsg := &sqlexp.ReturnMessage{}
+	rows, err := q.QueryContext(ctx, b.Text, retmsg)
+	if err != nil {
+		err = s.locate(b, err)
+		out.Error(err)
+		return err
+	}
+	defer rows.Close()
+	var firstErr error
+	for active := true; active; {
+		switch m := retmsg.Message(ctx).(type) {
+		case sqlexp.MsgNotice:
+			out.Message(m.Message.String())
+		case sqlexp.MsgNext:
+			if err = out.Rows(rows); err != nil && firstErr == nil {
+				out.Error(err)
+				firstErr = err
+			}
+		case sqlexp.MsgNextResultSet:
+			active = rows.NextResultSet()
+		case sqlexp.MsgError:
+			err = s.locate(b, m.Error)
+			out.Error(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		case sqlexp.MsgRowsAffected:
+			out.RowsAffected(m.Count)
+		}
+	}
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr == nil {
+		firstErr = rows.Err()
+	}
+	return firstErr
+}
+
+func (r *Runner) readFile(name string) ([]byte, error) {
+	if r.ReadFile != nil {
+		return r.ReadFile(name)
+	}
+	return ioutil.ReadFile(name)
+}
+
+// script is a script whose includes and variables are expanded.
+type script struct {
+	batches []scriptBatch
+
+	// lines are the positions of the lines of the expanded script
+	lines []position
+}
+
+// scriptBatch is a batch of the expanded script and the commands read
+// before its separator.
+type scriptBatch struct {
+	batch.Batch
+	commands []command
+}
+
+// position returns the position of a 1-based line of the expanded script.
+func (s *script) position(line int) position {
+	switch {
+	case len(s.lines) == 0:
+		return position{}
+	case line < 1:
+		return s.lines[0]
+	case line > len(s.lines):
+		return s.lines[len(s.lines)-1]
+	}
+	return s.lines[line-1]
+}
+
+// locate returns a *batch.ScriptError locating a server error in the
+// files of the script.
+func (s *script) locate(b batch.Batch, err error) error {
+	err = b.WrapError(err)
+	var scriptErr *batch.ScriptError
+	if errors.As(err, &scriptErr) {
+		pos := s.position(scriptErr.Line)
+		scriptErr.File, scriptErr.Line = pos.file, pos.line
+	}
+	return err
+}
+
+type command struct {
+	name        string
+	pos         position
+	exitOnError bool
+	connect     ConnectArgs
+}
+
+type position struct {
+	file string
+	line int
+}
+
+func (p position) String() string {
+	if p.file == "" {
+		return "line " + strconv.Itoa(p.line)
+	}
+	return p.file + ":" + strconv.Itoa(p.line)
+}
+
+// commandMarker replaces the lines of the commands run between batches,
+// it cannot appear in SQL text.
+const commandMarker = "--\x00sqlcmd "
+
+// parser expands the includes and variables of a script, the commands
+// run between batches are kept as marker lines.
+type parser struct {
+	r        *Runner
+	vars     map[string]string
+	files    []string // files being included
+	commands []command
+	text     strings.Builder
+	script   script
+}
+
+// parse expands a script and splits it into batches.
+func (r *Runner) parse(text, name string) (*script, error) {
+	p := &parser{r: r, vars: make(map[string]string)}
+	for k, v := range r.Vars {
+		p.vars[strings.ToUpper(k)] = v
+	}
+	if name != "" {
+		p.files = append(p.files, name)
+	}
+	if err := p.parseScript(text, name); err != nil {
+		return nil, err
+	}
+	if r.KeepVars {
+		r.Vars = p.vars
+	}
+	separator := r.Separator
+	if separator == "" {
+		separator = "GO"
+	}
+	s := &p.script
+	applied := make(map[int]bool)
+	for _, split := range batch.SplitBatches(p.text.String(), separator) {
+		b := scriptBatch{Batch: split}
+		var sqlText strings.Builder
+		for _, line := range strings.SplitAfter(split.Text, "\n") {
+			if !strings.HasPrefix(line, commandMarker) {
+				sqlText.WriteString(line)
+				continue
+			}
+			// the marker line is kept empty so the lines of the server
+			// errors do not move
+			sqlText.WriteString("\n")
+			// the commands of a batch repeated by GO n are run once
+			n, _ := strconv.Atoi(strings.TrimSpace(line[len(commandMarker):]))
+			if !applied[n] {
+				applied[n] = true
+				b.commands = append(b.commands, p.commands[n])
+			}
+		}
+		b.Text = sqlText.String()
+		if len(b.commands) > 0 || strings.TrimSpace(b.Text) != "" {
+			s.batches = append(s.batches, b)
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) parseScript(script, name string) error {
+	lines := strings.SplitAfter(script, "\n")
+	for i, line := range lines {
+		pos := position{file: name, line: i + 1}
+		line, err := p.substitute(line, pos)
+		if err != nil {
+			return err
+		}
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, ":") {
+			p.write(line, pos)
+			continue
+		}
+		if err = p.parseCommand(trimmed[1:], pos, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// substitute replaces the $(Var) variables of a line.
+func (p *parser) substitute(line string, pos position) (string, error) {
+	if !strings.Contains(line, "$(") {
+		return line, nil
+	}
+	var w strings.Builder
+	for {
+		start := strings.Index(line, "$(")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(line[start:], ')')
+		if end < 0 {
+			break
+		}
+		name := line[start+2 : start+end]
+		value, ok := p.vars[strings.ToUpper(name)]
+		if !ok {
+			return "", fmt.Errorf("sqlcmd: %s: variable %s is not defined", pos, name)
+		}
+		w.WriteString(line[:start])
+		w.WriteString(value)
+		line = line[start+end+1:]
+	}
+	w.WriteString(line)
+	return w.String(), nil
+}
+
+func (p *parser) parseCommand(s string, pos position, name string) error {
+	args, err := splitArgs(s)
+	if err != nil {
+		return fmt.Errorf("sqlcmd: %s: %v", pos, err)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("sqlcmd: %s: missing command", pos)
+	}
+	switch strings.ToLower(args[0]) {
+	case "setvar":
+		switch len(args) {
+		case 2:
+			delete(p.vars, strings.ToUpper(args[1]))
+		case 3:
+			p.vars[strings.ToUpper(args[1])] = args[2]
+		default:
+			return fmt.Errorf("sqlcmd: %s: usage is :setvar name [value]", pos)
+		}
+	case "r":
+		if len(args) != 2 {
+			return fmt.Errorf("sqlcmd: %s: usage is :r filename", pos)
+		}
+		return p.include(args[1], pos, name)
+	case "on":
+		if len(args) != 3 || !strings.EqualFold(args[1], "error") {
+			return fmt.Errorf("sqlcmd: %s: usage is :on error exit|ignore", pos)
+		}
+		cmd := command{name: "on error", pos: pos}
+		switch strings.ToLower(args[2]) {
+		case "exit":
+			cmd.exitOnError = true
+		case "ignore":
+		default:
+			return fmt.Errorf("sqlcmd: %s: usage is :on error exit|ignore", pos)
+		}
+		p.addCommand(cmd)
+	case "connect":
+		cmd := command{name: "connect", pos: pos}
+		if cmd.connect, err = parseConnect(args[1:]); err != nil {
+			return fmt.Errorf("sqlcmd: %s: %v", pos, err)
+		}
+		p.addCommand(cmd)
+	default:
+		return fmt.Errorf("sqlcmd: %s: unknown command :%s", pos, args[0])
+	}
+	return nil
+}
+
+func (p *parser) addCommand(cmd command) {
+	p.write(commandMarker+strconv.Itoa(len(p.commands))+"\n", cmd.pos)
+	p.commands = append(p.commands, cmd)
+}
+
+// write writes text of the expanded script read at pos, the lines it
+// starts are located at pos.
+func (p *parser) write(text string, pos position) {
+	if text == "" {
+		return
+	}
+	n := strings.Count(strings.TrimSuffix(text, "\n"), "\n")
+	if p.text.Len() == 0 || strings.HasSuffix(p.text.String(), "\n") {
+		n++
+	}
+	p.text.WriteString(text)
+	for ; n > 0; n-- {
+		p.script.lines = append(p.script.lines, pos)
+	}
+}
+
+func (p *parser) include(file string, pos position, name string) error {
+	if !filepath.IsAbs(file) && name != "" {
+		file = filepath.Join(filepath.Dir(name), file)
+	}
+	for _, f := range p.files {
+		if f == file {
+			return fmt.Errorf("sqlcmd: %s: %s includes itself", pos, file)
+		}
+	}
+	data, err := p.r.readFile(file)
+	if err != nil {
+		return fmt.Errorf("sqlcmd: %s: %v", pos, err)
+	}
+	p.files = append(p.files, file)
+	defer func() { p.files = p.files[:len(p.files)-1] }()
+	if err = p.parseScript(string(data), file); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(p.text.String(), "\n") {
+		// the including script continues on the next line
+		p.write("\n", pos)
+	}
+	return nil
+}
+
+func parseConnect(args []string) (ConnectArgs, error) {
+	var res ConnectArgs
+	if len(args) == 0 {
+		return res, errors.New("usage is :connect server[\\instance] [-l timeout] [-U user [-P password]]")
+	}
+	res.Server = args[0]
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return res, fmt.Errorf("missing value of %s", args[i])
+		}
+		value := args[i+1]
+		switch args[i] {
+		case "-U":
+			res.User = value
+		case "-P":
+			res.Password = value
+		case "-l":
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				return res, fmt.Errorf("invalid login timeout %s", value)
+			}
+			res.LoginTimeout = time.Duration(seconds) * time.Second
+		default:
+			return res, fmt.Errorf("unknown option %s", args[i])
+		}
+	}
+	return res, nil
+}
+
+// splitArgs splits the arguments of a command at spaces, double quoted
+// arguments may contain spaces and "" for a quote.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return args, nil
+		}
+		if s[0] != '"' {
+			end := strings.IndexAny(s, " \t\r\n")
+			if end < 0 {
+				end = len(s)
+			}
+			args = append(args, s[:end])
+			s = s[end:]
+			continue
+		}
+		var arg strings.Builder
+		i := 1
+		for {
+			if i == len(s) {
+				return nil, errors.New("missing closing quote")
+			}
+			if s[i] == '"' {
+				if i+1 < len(s) && s[i+1] == '"' {
+					arg.WriteByte('"')
+					i += 2
+					continue
+				}
+				break
+			}
+			arg.WriteByte(s[i])
+			i++
+		}
+		args = append(args, arg.String())
+		s = s[i+1:]
+	}
+}
@@ -0,0 +1,206 @@
+package sqlcmd
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/denisenkom/go-mssqldb/batch"
+)
+
+func testRunner(files map[string]string) *Runner {
+	return &Runner{
+		Vars: map[string]string{"Table": "t"},
+		ReadFile: func(name string) ([]byte, error) {
+			data, ok := files[name]
+			if !ok {
+				return nil, fmt.Errorf("open %s: no such file", name)
+			}
+			return []byte(data), nil
+		},
+	}
+}
+
+func TestParse(t *testing.T) {
+	r := testRunner(map[string]string{
+		"scripts/inc.sql":       "insert into $(table) values ($(n))\n:r sub/inner.sql",
+		"scripts/sub/inner.sql": ":setvar n 3\ninsert into $(Table) values ($(n))\n",
+	})
+	script := `:setvar n 1
+create table $(Table) (n int)
+GO
+:on error exit
+:setvar n "2"
+:r inc.sql
+GO 2
+:connect other\inst -U "the user" -P pass
+select '$(n)'
+:on error ignore
+`
+	s, err := r.parse(script, "scripts/main.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []scriptBatch{
+		{Batch: batch.Batch{Text: "create table t (n int)\n"}},
+		{Batch: batch.Batch{Text: "\n\ninsert into t values (2)\ninsert into t values (3)\n"}, commands: []command{
+			{name: "on error", pos: position{"scripts/main.sql", 4}, exitOnError: true},
+		}},
+		{Batch: batch.Batch{Text: "\n\ninsert into t values (2)\ninsert into t values (3)\n"}},
+		{Batch: batch.Batch{Text: "\n\nselect '3'\n\n"}, commands: []command{
+			{name: "connect", pos: position{"scripts/main.sql", 8}, connect: ConnectArgs{Server: `other\inst`, User: "the user", Password: "pass"}},
+			{name: "on error", pos: position{"scripts/main.sql", 10}},
+		}},
+	}
+	if len(s.batches) != len(want) {
+		t.Fatalf("got %d batches, want %d", len(s.batches), len(want))
+	}
+	for i, b := range s.batches {
+		if b.Text != want[i].Text || !reflect.DeepEqual(b.commands, want[i].commands) {
+			t.Errorf("batch %d: got %q %+v, want %q %+v", i, b.Text, b.commands, want[i].Text, want[i].commands)
+		}
+	}
+
+	// the lines of the server errors are located in the included files
+	for line, want := range map[int32]string{3: "scripts/inc.sql:1", 4: "scripts/sub/inner.sql:2"} {
+		err := s.locate(s.batches[1].Batch, mssql.Error{Message: "failed", LineNo: line})
+		var scriptErr *batch.ScriptError
+		if !errors.As(err, &scriptErr) {
+			t.Fatalf("expected a script error, got %v", err)
+		}
+		if got := (position{scriptErr.File, scriptErr.Line}).String(); got != want {
+			t.Errorf("line %d: got %s, want %s", line, got, want)
+		}
+	}
+	err = s.locate(s.batches[3].Batch, mssql.Error{Message: "failed", LineNo: 3})
+	if want := "scripts/main.sql:9: mssql: failed\n\tselect '3'"; err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+	if r.Vars["Table"] != "t" || len(r.Vars) != 1 {
+		t.Errorf("the variables of the runner were changed: %v", r.Vars)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	r := testRunner(map[string]string{
+		"loop.sql": "select 1\n:r loop.sql\n",
+	})
+	values := []struct {
+		script string
+		err    string
+	}{
+		{"select 1\nselect $(missing)", "sqlcmd: line 2: variable missing is not defined"},
+		{":r loop.sql", "sqlcmd: loop.sql:2: loop.sql includes itself"},
+		{":r other.sql", "sqlcmd: line 1: open other.sql: no such file"},
+		{":setvar a b c", "sqlcmd: line 1: usage is :setvar name [value]"},
+		{":setvar a \"b", "sqlcmd: line 1: missing closing quote"},
+		{":on error retry", "sqlcmd: line 1: usage is :on error exit|ignore"},
+		{":connect srv -U", "sqlcmd: line 1: missing value of -U"},
+		{":connect srv -l x", "sqlcmd: line 1: invalid login timeout x"},
+		{":listvar", "sqlcmd: line 1: unknown command :listvar"},
+	}
+	for _, v := range values {
+		_, err := r.parse(v.script, "")
+		if err == nil || err.Error() != v.err {
+			t.Errorf("got error %v for %q, want %s", err, v.script, v.err)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(` setvar  name "a ""quoted"" value" x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"setvar", "name", `a "quoted" value`, "x"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("got %q", args)
+	}
+	connect, err := parseConnect([]string{"srv", "-l", "30"})
+	if err != nil || connect != (ConnectArgs{Server: "srv", LoginTimeout: 30 * time.Second}) {
+		t.Errorf("got %+v, %v", connect, err)
+	}
+}
+
+func TestParseKeepVars(t *testing.T) {
+	r := testRunner(nil)
+	r.KeepVars = true
+	if _, err := r.parse(":setvar n 1\nselect $(n)\n", ""); err != nil {
+		t.Fatal(err)
+	}
+	s, err := r.parse("select $(n) from $(Table)\n", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.batches[0].Text; got != "select 1 from t\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dsn := os.Getenv("SQLSERVER_DSN")
+	if dsn == "" {
+		t.Skip("no SQLSERVER_DSN")
+	}
+	db, err := sql.Open("sqlserver", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var out bytes.Buffer
+	r := &Runner{Vars: map[string]string{"Name": "world"}, Out: &out}
+	script := `PRINT 'hello $(Name)'
+GO
+RAISERROR ('ignored', 16, 1)
+GO
+:on error exit
+select 1 as n
+RAISERROR ('stop', 16, 1)
+GO
+PRINT 'not run'
+`
+	err = r.Run(ctx, conn, script)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 7: mssql: stop") {
+		t.Errorf("expected the error of the third batch at line 7, got %v", err)
+	}
+	got := out.String()
+	for _, s := range []string{"hello world\n", "Level 16, State 1", "ignored\n", "n\n1\n", "stop\n"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("output does not contain %q:\n%s", s, got)
+		}
+	}
+	if strings.Contains(got, "not run") {
+		t.Errorf("the script did not stop at the error:\n%s", got)
+	}
+
+	out.Reset()
+	r = &Runner{
+		Out: &out,
+		Connect: func(ctx context.Context, args ConnectArgs) (Queryer, error) {
+			if args.Server != "again" {
+				return nil, fmt.Errorf("unexpected server %s", args.Server)
+			}
+			return db.Conn(ctx)
+		},
+	}
+	if err = r.Run(ctx, conn, ":connect again\nPRINT 'connected'\n"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "connected\n" {
+		t.Errorf("got %q", out.String())
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"unicode/utf16"
 	"unicode/utf8"
 
+	"github.com/denisenkom/go-mssqldb/internal/cp"
 	"github.com/denisenkom/go-mssqldb/msdsn"
 )
 
@@ -129,6 +130,7 @@ const (
 	featExtAZURESQLSUPPORT    byte = 0x08
 	featExtDATACLASSIFICATION byte = 0x09
 	featExtUTF8SUPPORT        byte = 0x0A
+	featExtVECTORSUPPORT      byte = 0x0E
 	featExtTERMINATOR         byte = 0xFF
 )
 
@@ -143,6 +145,13 @@ type tdsSession struct {
 	logger       ContextLogger
 	routedServer string
 	routedPort   uint16
+
+	// vectorVersion is the vector feature version acknowledged by the
+	// server during login, zero when the server has no vector support.
+	vectorVersion byte
+
+	// collation is the default collation of the current database
+	collation cp.Collation
 }
 
 const (
@@ -335,9 +344,15 @@ func (e featureExts) toBytes() []byte {
 	if len(e.features) == 0 {
 		return nil
 	}
+	// sort the features so the login packet is deterministic
+	ids := make(keySlice, 0, len(e.features))
+	for featureID := range e.features {
+		ids = append(ids, featureID)
+	}
+	sort.Sort(ids)
 	var d []byte
-	for featureID, f := range e.features {
-		featureData := f.toBytes()
+	for _, featureID := range ids {
+		featureData := e.features[featureID].toBytes()
 
 		hdr := make([]byte, 5)
 		hdr[0] = featureID                                               // FedAuth feature extension BYTE
@@ -414,6 +429,22 @@ func (e *featureExtFedAuth) toBytes() []byte {
 	return d
 }
 
+// vectorSupportVersion is the highest vector feature version understood by the driver.
+const vectorSupportVersion byte = 0x01
+
+// featureExtVectorSupport asks the server to send vector columns using the
+// native binary vector type instead of JSON text.
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-tds/773a62b6-ee89-4c02-9e5e-344882630aac
+type featureExtVectorSupport struct{}
+
+func (e *featureExtVectorSupport) featureID() byte {
+	return featExtVECTORSUPPORT
+}
+
+func (e *featureExtVectorSupport) toBytes() []byte {
+	return []byte{vectorSupportVersion}
+}
+
 type loginHeader struct {
 	Length               uint32
 	TDSVersion           uint32
@@ -759,7 +790,12 @@ func (hdr queryNotifHdr) pack() (res []byte) {
 	notifyId := str2ucs2(hdr.notifyId)
 	ssbDeployment := str2ucs2(hdr.ssbDeployment)
 
-	res = make([]byte, 2+len(notifyId)+2+len(ssbDeployment)+4)
+	// the timeout is optional, the server default is used without it
+	size := 2 + len(notifyId) + 2 + len(ssbDeployment)
+	if hdr.notifyTimeout != 0 {
+		size += 4
+	}
+	res = make([]byte, size)
 	b := res
 
 	binary.LittleEndian.PutUint16(b, uint16(len(notifyId)))
@@ -772,7 +808,9 @@ func (hdr queryNotifHdr) pack() (res []byte) {
 	copy(b, ssbDeployment)
 	b = b[len(ssbDeployment):]
 
-	binary.LittleEndian.PutUint32(b, hdr.notifyTimeout)
+	if hdr.notifyTimeout != 0 {
+		binary.LittleEndian.PutUint32(b, hdr.notifyTimeout)
+	}
 
 	return res
 }
@@ -994,6 +1032,7 @@ func prepareLogin(ctx context.Context, c *Connector, p msdsn.Config, logger Cont
 		AppName:      p.AppName,
 		TypeFlags:    typeFlags,
 	}
+	l.FeatureExt.Add(&featureExtVectorSupport{})
 	switch {
 	case fe.FedAuthLibrary == FedAuthLibrarySecurityToken:
 		if uint64(p.LogFlags)&logDebug != 0 {
@@ -1251,6 +1290,10 @@ initiate_connection:
 			case loginAckStruct:
 				sess.loginAck = token
 				loginAck = true
+			case map[byte]interface{}:
+				if version, ok := token[featExtVECTORSUPPORT].(byte); ok {
+					sess.vectorVersion = version
+				}
 			case doneStruct:
 				if token.isError() {
 					tokenErr := token.getError()
@@ -132,18 +132,18 @@ func TestLoginWithSQLServerAuth(t *testing.T) {
 			"  12 01 00 2f 00 00 01 00  00 00 1a 00 06 01 00 20\n" +
 				"00 01 02 00 21 00 01 03  00 22 00 04 04 00 26 00\n" +
 				"01 ff 00 00 00 00 00 00  00 00 00 00 00 00 00\n",
-			"  10 01 00 b2 00 00 01 00  aa 00 00 00 04 00 00 74\n" +
+			"  10 01 00 bd 00 00 01 00  b5 00 00 00 04 00 00 74\n" +
 				"00 10 00 00 00 00 00 00  00 00 00 00 00 00 00 00\n" +
-				"A0 02 00 00 00 00 00 00  00 00 00 00 5e 00 09 00\n" +
+				"A0 02 00 10 00 00 00 00  00 00 00 00 5e 00 09 00\n" +
 				"70 00 04 00 78 00 06 00  84 00 0a 00 98 00 09 00\n" +
-				"00 00 00 00 aa 00 00 00  aa 00 00 00 aa 00 00 00\n" +
+				"aa 00 04 00 aa 00 00 00  aa 00 00 00 aa 00 00 00\n" +
 				"00 00 00 00 00 00 aa 00  00 00 aa 00 00 00 aa 00\n" +
 				"00 00 00 00 00 00 6c 00  6f 00 63 00 61 00 6c 00\n" +
 				"68 00 6f 00 73 00 74 00  74 00 65 00 73 00 74 00\n" +
 				"92 a5 f3 a5 93 a5 82 a5  f3 a5 e2 a5 67 00 6f 00\n" +
 				"2d 00 6d 00 73 00 73 00  71 00 6c 00 64 00 62 00\n" +
 				"6c 00 6f 00 63 00 61 00  6c 00 68 00 6f 00 73 00\n" +
-				"74 00\n",
+				"74 00 ae 00 00 00 0e 01  00 00 00 01 ff\n",
 		},
 		[]string{
 			"  04 01 00 20  00 00 01 00   00 00 10 00  06 01 00 16\n" +
@@ -193,7 +193,7 @@ func TestLoginWithSecurityTokenAuth(t *testing.T) {
 				"00 01 02 00 26 00 01 03  00 27 00 04 04 00 2B 00\n" +
 				"01 06 00 2c 00 01 ff 00  00 00 00 00 00 00 00 00\n" +
 				"00 00 00 00 01\n",
-			"  10 01 00 BB 00 00 01 00  B3 00 00 00 04 00 00 74\n" +
+			"  10 01 00 C1 00 00 01 00  B9 00 00 00 04 00 00 74\n" +
 				"00 10 00 00 00 00 00 00  00 00 00 00 00 00 00 00\n" +
 				"A0 02 00 10 00 00 00 00  00 00 00 00 5E 00 09 00\n" +
 				"70 00 00 00 70 00 00 00  70 00 0A 00 84 00 09 00\n" +
@@ -204,7 +204,8 @@ func TestLoginWithSecurityTokenAuth(t *testing.T) {
 				"73 00 73 00 71 00 6C 00  64 00 62 00 6C 00 6F 00\n" +
 				"63 00 61 00 6C 00 68 00  6F 00 73 00 74 00 9A 00\n" +
 				"00 00 02 13 00 00 00 03  0E 00 00 00 3C 00 74 00\n" +
-				"6F 00 6B 00 65 00 6E 00  3E 00 FF\n",
+				"6F 00 6B 00 65 00 6E 00  3E 00 0E 01 00 00 00 01\n" +
+				"FF\n",
 		},
 		[]string{
 			"  04 01 00 20  00 00 01 00   00 00 10 00  06 01 00 16\n" +
@@ -256,7 +257,7 @@ func TestLoginWithADALUsernamePasswordAuth(t *testing.T) {
 				"00 01 02 00 26 00 01 03  00 27 00 04 04 00 2B 00\n" +
 				"01 06 00 2C 00 01 ff 00  00 00 00 00 00 00 00 00\n" +
 				"00 00 00 00 01\n",
-			"  10 01 00 aa 00 00 01 00  a2 00 00 00 04 00 00 74\n" +
+			"  10 01 00 b0 00 00 01 00  a8 00 00 00 04 00 00 74\n" +
 				"00 10 00 00 00 00 00 00  00 00 00 00 00 00 00 00\n" +
 				"A0 02 00 10 00 00 00 00  00 00 00 00 5e 00 09 00\n" +
 				"70 00 00 00 70 00 00 00  70 00 0a 00 84 00 09 00\n" +
@@ -266,7 +267,7 @@ func TestLoginWithADALUsernamePasswordAuth(t *testing.T) {
 				"68 00 6f 00 73 00 74 00  67 00 6f 00 2d 00 6d 00\n" +
 				"73 00 73 00 71 00 6c 00  64 00 62 00 6c 00 6f 00\n" +
 				"63 00 61 00 6c 00 68 00  6f 00 73 00 74 00 9a 00\n" +
-				"00 00 02 02 00 00 00 05  01 ff\n",
+				"00 00 02 02 00 00 00 05  01 0e 01 00 00 00 01 ff\n",
 			"  08 01 00 1e 00 00 01 00  12 00 00 00 0e 00 00 00\n" +
 				"3c 00 74 00 6f 00 6b 00  65 00 6e 00 3e 00\n",
 		},
@@ -330,7 +331,7 @@ func TestLoginWithADALManagedIdentityAuth(t *testing.T) {
 				"00 01 02 00 26 00 01 03  00 27 00 04 04 00 2B 00\n" +
 				"01 06 00 2C 00 01 ff 00  00 00 00 00 00 00 00 00\n" +
 				"00 00 00 00 01\n",
-			"  10 01 00 aa 00 00 01 00  a2 00 00 00 04 00 00 74\n" +
+			"  10 01 00 b0 00 00 01 00  a8 00 00 00 04 00 00 74\n" +
 				"00 10 00 00 00 00 00 00  00 00 00 00 00 00 00 00\n" +
 				"A0 02 00 10 00 00 00 00  00 00 00 00 5e 00 09 00\n" +
 				"70 00 00 00 70 00 00 00  70 00 0a 00 84 00 09 00\n" +
@@ -340,7 +341,7 @@ func TestLoginWithADALManagedIdentityAuth(t *testing.T) {
 				"68 00 6f 00 73 00 74 00  67 00 6f 00 2d 00 6d 00\n" +
 				"73 00 73 00 71 00 6c 00  64 00 62 00 6c 00 6f 00\n" +
 				"63 00 61 00 6c 00 68 00  6f 00 73 00 74 00 9a 00\n" +
-				"00 00 02 02 00 00 00 05  03 ff\n",
+				"00 00 02 02 00 00 00 05  03 0e 01 00 00 00 01 ff\n",
 			"  08 01 00 1e 00 00 01 00  12 00 00 00 0e 00 00 00\n" +
 				"3c 00 74 00 6f 00 6b 00  65 00 6e 00 3e 00\n",
 		},
@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"strconv"
 
+	"github.com/denisenkom/go-mssqldb/internal/cp"
 	"github.com/denisenkom/go-mssqldb/msdsn"
 	"github.com/golang-sql/sqlexp"
 )
@@ -82,6 +83,7 @@ const (
 // https://msdn.microsoft.com/en-us/library/dd357363.aspx
 const (
 	colFlagNullable = 1
+	colFlagIdentity = 0x10
 	// TODO implement more flags
 )
 
@@ -197,7 +199,6 @@ func processEnvChg(ctx context.Context, sess *tdsSession) {
 				badStreamPanic(err)
 			}
 		case envSqlCollation:
-			// currently ignored
 			var collationSize uint8
 			err = binary.Read(r, binary.LittleEndian, &collationSize)
 			if err != nil {
@@ -222,6 +223,7 @@ func processEnvChg(ctx context.Context, sess *tdsSession) {
 			if err != nil {
 				badStreamPanic(err)
 			}
+			sess.collation = cp.Collation{LcidAndFlags: info, SortId: sortID}
 
 			// old value, should be 0
 			if _, err = readBVarChar(r); err != nil {
@@ -541,7 +543,12 @@ func parseFeatureExtAck(r *tdsBuffer) map[byte]interface{} {
 				length -= 32
 			}
 			ack[feature] = fedAuthAck
-
+		case featExtVECTORSUPPORT:
+			// the server replies with the vector version it will use
+			if length >= 1 {
+				ack[feature] = r.byte()
+				length--
+			}
 		}
 
 		// Skip unprocessed bytes
@@ -668,6 +675,18 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 		badStreamPanic(fmt.Errorf("unexpected packet type in reply: got %v, expected %v", packet_type, packReply))
 	}
 	var columns []columnStruct
+	var decoder *columnarDecoder
+	if outs.sink != nil {
+		decoder = &columnarDecoder{sink: outs.sink}
+	}
+	// flush passes the rows decoded since the last batch
+	flush := func() {
+		if decoder != nil {
+			if batch := decoder.sink.Flush(); batch != nil {
+				ch <- columnarBatch{batch}
+			}
+		}
+	}
 	errs := make([]Error, 0, 5)
 	for tokens := 0; ; tokens += 1 {
 		token := token(sess.buf.byte())
@@ -695,6 +714,7 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 			ch <- order
 		case tokenDoneInProc:
 			done := parseDoneInProc(sess.buf)
+			flush()
 
 			ch <- done
 			if sess.logFlags&logRows != 0 && done.Status&doneCount != 0 {
@@ -715,6 +735,7 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 			}
 		case tokenDone, tokenDoneProc:
 			done := parseDone(sess.buf)
+			flush()
 			done.errors = errs
 			if outs.msgq != nil {
 				errs = make([]Error, 0, 5)
@@ -746,6 +767,9 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 			}
 		case tokenColMetadata:
 			columns = parseColMetadata72(sess.buf)
+			if decoder != nil {
+				decoder.begin(columns)
+			}
 			ch <- columns
 
 			if outs.msgq != nil {
@@ -756,13 +780,19 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 			}
 			firstResult = false
 
-		case tokenRow:
-			row := make([]interface{}, len(columns))
-			parseRow(sess.buf, columns, row)
-			ch <- row
-		case tokenNbcRow:
+		case tokenRow, tokenNbcRow:
+			if decoder != nil {
+				if decoder.decodeRow(sess.buf, columns, token == tokenNbcRow) {
+					flush()
+				}
+				continue
+			}
 			row := make([]interface{}, len(columns))
-			parseNbcRow(sess.buf, columns, row)
+			if token == tokenRow {
+				parseRow(sess.buf, columns, row)
+			} else {
+				parseNbcRow(sess.buf, columns, row)
+			}
 			ch <- row
 		case tokenEnvChange:
 			processEnvChg(ctx, sess)
@@ -791,15 +821,9 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 			}
 		case tokenReturnValue:
 			nv := parseReturnValue(sess.buf)
-			if len(nv.Name) > 0 {
-				name := nv.Name[1:] // Remove the leading "@".
-				if ov, has := outs.params[name]; has {
-					err = scanIntoOut(name, nv.Value, ov)
-					if err != nil {
-						fmt.Println("scan error", err)
-						ch <- err
-					}
-				}
+			if err = outs.returnValue(nv); err != nil {
+				fmt.Println("scan error", err)
+				ch <- err
 			}
 		default:
 			badStreamPanic(fmt.Errorf("unknown token type returned: %v", token))
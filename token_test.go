@@ -21,6 +21,7 @@ func TestParseFeatureExtAck(t *testing.T) {
 			"1B 1C 1D 1E 1F 20 21 22  23 24 25 26 27 28 29 2A\n" +
 			"2B 2C 2D 2E 2F 30 31 32  33 34 35 36 37 38 39 3A\n" +
 			"3B 3C 3D 3E 3F FF\n",
+		"  0E 01 00 00 00 01 FF",
 	}
 
 	for _, tst := range tests {
@@ -40,3 +41,24 @@ func TestParseFeatureExtAck(t *testing.T) {
 		parseFeatureExtAck(r)
 	}
 }
+
+func TestParseFeatureExtAckVector(t *testing.T) {
+	b, _ := hex.DecodeString("0200000000" + "0E0100000001" + "FF")
+	r := &tdsBuffer{
+		packetSize: len(b),
+		rbuf:       b,
+		rpos:       0,
+		rsize:      len(b),
+	}
+
+	ack := parseFeatureExtAck(r)
+	if version, ok := ack[featExtVECTORSUPPORT].(byte); !ok || version != 1 {
+		t.Errorf("expected vector version 1, got %v", ack[featExtVECTORSUPPORT])
+	}
+	if _, ok := ack[featExtFEDAUTH]; !ok {
+		t.Error("fedauth acknowledgement was lost")
+	}
+	if r.rpos != len(b) {
+		t.Errorf("feature ext ack was not fully consumed, %d of %d bytes read", r.rpos, len(b))
+	}
+}
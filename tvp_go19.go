@@ -9,9 +9,12 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 	"time"
+
+	"github.com/denisenkom/go-mssqldb/msdsn"
 )
 
 const (
@@ -29,14 +32,29 @@ var (
 	ErrorSkip             = errors.New("all fields mustn't skip")
 	ErrorObjectName       = errors.New("wrong tvp name")
 	ErrorWrongTyping      = errors.New("the number of elements in columnStr and tvpFieldIndexes do not align")
+	ErrorTVPColumns       = errors.New("TVP of maps must have Columns")
 )
 
 // TVP is driver type, which allows supporting Table Valued Parameters (TVP) in SQL Server
 type TVP struct {
 	//TypeName mustn't be default value
 	TypeName string
-	//Value must be the slice, mustn't be nil
+	//Value must be the slice of structs, mustn't be nil.
+	//It can also be a []map[string]interface{}, a TVPRows or the *sql.Rows
+	//of a query on another connection, those are streamed to the server.
 	Value interface{}
+	//Columns are the columns of a []map[string]interface{} Value, they
+	//replace the columns of a *sql.Rows Value, which otherwise have the
+	//types of the columns of the rows.
+	Columns []TVPColumn
+	//DiscoverColumns fetches the columns of the table type from the server,
+	//the values are sent with the declared types of the columns. Struct
+	//fields, Columns and map keys are matched to the columns by name, other
+	//columns are sent as default. The columns are cached per Connector.
+	DiscoverColumns bool
+
+	// columns of the table type, set when DiscoverColumns is
+	columns []columnStruct
 }
 
 func (tvp TVP) check() error {
@@ -49,6 +67,26 @@ func (tvp TVP) check() error {
 	if sepCount := getCountSQLSeparators(tvp.TypeName); sepCount > 1 {
 		return ErrorObjectName
 	}
+	switch v := tvp.Value.(type) {
+	case []map[string]interface{}:
+		if v == nil {
+			return ErrorTypeSliceIsEmpty
+		}
+		if len(tvp.Columns) == 0 && !tvp.DiscoverColumns {
+			return ErrorTVPColumns
+		}
+		return nil
+	case *sql.Rows:
+		if v == nil {
+			return ErrorTypeSliceIsEmpty
+		}
+		return nil
+	case TVPRows:
+		if reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+			return ErrorTypeSliceIsEmpty
+		}
+		return nil
+	}
 	valueOf := reflect.ValueOf(tvp.Value)
 	if valueOf.Kind() != reflect.Slice {
 		return ErrorTypeSlice
@@ -62,36 +100,29 @@ func (tvp TVP) check() error {
 	return nil
 }
 
-func (tvp TVP) encode(schema, name string, columnStr []columnStruct, tvpFieldIndexes []int) ([]byte, error) {
+// newTVPStmt returns a statement used to encode TVP columns and values,
+// timeType is the SQL type used for time.Time fields.
+func newTVPStmt(timeType msdsn.TimeParameterType) *Stmt {
+	conn := new(Conn)
+	conn.connector = &Connector{params: msdsn.Config{TimeParameterType: timeType}}
+	conn.sess = new(tdsSession)
+	conn.sess.loginAck = loginAckStruct{TDSVersion: verTDS73}
+	return &Stmt{
+		c: conn,
+	}
+}
+
+func (tvp TVP) encode(schema, name string, columnStr []columnStruct, tvpFieldIndexes []int, timeType msdsn.TimeParameterType) ([]byte, error) {
 	if len(columnStr) != len(tvpFieldIndexes) {
 		return nil, ErrorWrongTyping
 	}
 	preparedBuffer := make([]byte, 0, 20+(10*len(columnStr)))
 	buf := bytes.NewBuffer(preparedBuffer)
-	err := writeBVarChar(buf, "")
-	if err != nil {
+	if err := writeTVPColumns(buf, schema, name, columnStr); err != nil {
 		return nil, err
 	}
 
-	writeBVarChar(buf, schema)
-	writeBVarChar(buf, name)
-	binary.Write(buf, binary.LittleEndian, uint16(len(columnStr)))
-
-	for i, column := range columnStr {
-		binary.Write(buf, binary.LittleEndian, column.UserType)
-		binary.Write(buf, binary.LittleEndian, column.Flags)
-		writeTypeInfo(buf, &columnStr[i].ti)
-		writeBVarChar(buf, "")
-	}
-	// The returned error is always nil
-	buf.WriteByte(_TVP_END_TOKEN)
-
-	conn := new(Conn)
-	conn.sess = new(tdsSession)
-	conn.sess.loginAck = loginAckStruct{TDSVersion: verTDS73}
-	stmt := &Stmt{
-		c: conn,
-	}
+	stmt := newTVPStmt(timeType)
 
 	val := reflect.ValueOf(tvp.Value)
 	for i := 0; i < val.Len(); i++ {
@@ -111,7 +142,7 @@ func (tvp TVP) encode(schema, name string, columnStr []columnStruct, tvpFieldInd
 			if elemKind == reflect.Ptr && valOf.IsNil() {
 				switch tvpVal.(type) {
 				case *bool, *time.Time, *int8, *int16, *int32, *int64, *float32, *float64, *int,
-					*uint8, *uint16, *uint32, *uint64, *uint:
+					*uint8, *uint16, *uint32, *uint64, *uint, *DateTime2, *Date, *Time:
 					binary.Write(buf, binary.LittleEndian, uint8(0))
 					continue
 				default:
@@ -128,6 +159,13 @@ func (tvp TVP) encode(schema, name string, columnStr []columnStruct, tvpFieldInd
 			if err != nil {
 				return nil, fmt.Errorf("failed to convert tvp parameter row col: %s", err)
 			}
+			// values must be encoded with the scale of the column
+			switch v := cval.(type) {
+			case DateTime2:
+				cval = NewDateTime2(v.Time, int(columnStr[columnStrIdx].ti.Scale))
+			case Time:
+				cval = NewTime(v.Time, int(columnStr[columnStrIdx].ti.Scale))
+			}
 			param, err := stmt.makeParam(cval)
 			if err != nil {
 				return nil, fmt.Errorf("failed to make tvp parameter row col: %s", err)
@@ -139,7 +177,39 @@ func (tvp TVP) encode(schema, name string, columnStr []columnStruct, tvpFieldInd
 	return buf.Bytes(), nil
 }
 
-func (tvp TVP) columnTypes() ([]columnStruct, []int, error) {
+// writeTVPColumns writes the type name and the column metadata of a TVP.
+func writeTVPColumns(w io.Writer, schema, name string, columnStr []columnStruct) error {
+	if err := writeBVarChar(w, ""); err != nil {
+		return err
+	}
+	if err := writeBVarChar(w, schema); err != nil {
+		return err
+	}
+	if err := writeBVarChar(w, name); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(columnStr))); err != nil {
+		return err
+	}
+	for i, column := range columnStr {
+		if err := binary.Write(w, binary.LittleEndian, column.UserType); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, column.Flags); err != nil {
+			return err
+		}
+		if err := writeTypeInfo(w, &columnStr[i].ti); err != nil {
+			return err
+		}
+		if err := writeBVarChar(w, ""); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{_TVP_END_TOKEN})
+	return err
+}
+
+func (tvp TVP) columnTypes(timeType msdsn.TimeParameterType) ([]columnStruct, []int, error) {
 	type fieldDetailStore struct {
 		defaultValue interface{}
 		isIdentity   bool
@@ -184,39 +254,43 @@ func (tvp TVP) columnTypes() ([]columnStruct, []int, error) {
 		return nil, nil, ErrorSkip
 	}
 
-	conn := new(Conn)
-	conn.sess = new(tdsSession)
-	conn.sess.loginAck = loginAckStruct{TDSVersion: verTDS73}
-	stmt := &Stmt{
-		c: conn,
-	}
+	stmt := newTVPStmt(timeType)
 
 	columnConfiguration := make([]columnStruct, 0, columnCount)
 	for index, val := range defaultValues {
-		cval, err := convertInputParameter(val.defaultValue)
+		column, err := makeTVPColumn(stmt, val.defaultValue, val.isIdentity)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to convert tvp parameter row %d col %d: %s", index, val.defaultValue, err)
 		}
-		param, err := stmt.makeParam(cval)
-		if err != nil {
-			return nil, nil, err
-		}
-		column := columnStruct{
-			ti: param.ti,
-		}
-		if val.isIdentity {
-			column.Flags = fDefault
-		}
-		switch param.ti.TypeId {
-		case typeNVarChar, typeBigVarBin:
-			column.ti.Size = 0
-		}
 		columnConfiguration = append(columnConfiguration, column)
 	}
 
 	return columnConfiguration, tvpFieldIndexes, nil
 }
 
+// makeTVPColumn returns the column of values of the type of defaultValue.
+func makeTVPColumn(stmt *Stmt, defaultValue interface{}, isIdentity bool) (columnStruct, error) {
+	cval, err := convertInputParameter(defaultValue)
+	if err != nil {
+		return columnStruct{}, err
+	}
+	param, err := stmt.makeParam(cval)
+	if err != nil {
+		return columnStruct{}, err
+	}
+	column := columnStruct{
+		ti: param.ti,
+	}
+	if isIdentity {
+		column.Flags = fDefault
+	}
+	switch param.ti.TypeId {
+	case typeNVarChar, typeBigVarBin:
+		column.ti.Size = 0
+	}
+	return column, nil
+}
+
 func IsSkipField(tvpTagValue string, isTvpValue bool, jsonTagValue string, isJsonTagValue bool) bool {
 	if !isTvpValue && !isJsonTagValue {
 		return false
@@ -6,8 +6,10 @@ package mssql
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -1474,3 +1476,182 @@ func TestTVPIdentity(t *testing.T) {
 		t.Fatal("TestTVPIdentity have to be same")
 	}
 }
+
+func TestTVPRows(t *testing.T) {
+	checkConnStr(t)
+	tl := testLogger{t: t}
+	defer tl.StopLogging()
+	SetLogger(&tl)
+
+	db, err := sql.Open("sqlserver", makeConnStr(t).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TYPE dbo.TestTVPRows AS TABLE (id int identity(1,1), n int, s varchar(20), d decimal(18,4))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`DROP TYPE dbo.TestTVPRows`)
+
+	columns := []TVPColumn{
+		{Name: "id", Type: int64(0), Default: true},
+		{Name: "n", Type: int64(0)},
+		{Name: "s", Type: VarChar("")},
+		{Name: "d", Type: ""},
+	}
+	source, err := db.Query(`select top 100 id = 0, n = cast(row_number() over (order by (select 1)) as int), s = cast('r' as varchar(20)), d = cast(1.5 as decimal(18,4)) from sys.all_columns`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	tests := []struct {
+		name  string
+		value interface{}
+		cols  []TVPColumn
+		count int
+		sum   int64
+	}{
+		{"maps", []map[string]interface{}{{"n": 1, "s": "a", "d": "1.25"}, {"n": 2}}, columns, 2, 3},
+		{"rows", &tvpTestRows{columns: columns, rows: [][]interface{}{{nil, int64(5), "b", "2"}}}, nil, 1, 5},
+		{"sql.Rows", source, columns, 100, 5050},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var count, sum int64
+			err := db.QueryRow(`select count(*), sum(n) from @p1`,
+				TVP{TypeName: "dbo.TestTVPRows", Value: tt.value, Columns: tt.cols}).Scan(&count, &sum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != int64(tt.count) || sum != tt.sum {
+				t.Errorf("got %d rows with sum %d, want %d rows with sum %d", count, sum, tt.count, tt.sum)
+			}
+		})
+	}
+
+	// the columns taken from sql.Rows have the types of the source columns
+	_, err = db.Exec(`CREATE TYPE dbo.TestTVPRowsTypes AS TABLE (i int, si smallint, ti tinyint, r real, d decimal(9,2), m money, sm smallmoney, sdt smalldatetime, g uniqueidentifier)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`DROP TYPE dbo.TestTVPRowsTypes`)
+	typed, err := db.Query(`select i = cast(2147483647 as int), si = cast(-32768 as smallint), ti = cast(255 as tinyint), r = cast(1.5 as real),
+		d = cast(1234567.89 as decimal(9,2)), m = cast(12.3456 as money), sm = cast(-1.25 as smallmoney),
+		sdt = cast('2021-03-04 05:06' as smalldatetime), g = cast('6F9619FF-8B86-D011-B42D-00C04FC964FF' as uniqueidentifier)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer typed.Close()
+	var got string
+	err = db.QueryRow(`select concat(i, ' ', si, ' ', ti, ' ', r, ' ', d, ' ', m, ' ', sm, ' ', convert(varchar(16), sdt, 120), ' ', g) from @p1`,
+		TVP{TypeName: "dbo.TestTVPRowsTypes", Value: typed}).Scan(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2147483647 -32768 255 1.5 1234567.89 12.3456 -1.2500 2021-03-04 05:06 6F9619FF-8B86-D011-B42D-00C04FC964FF"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// a source failing after some rows cancels the query, which is not
+	// retried, and the connection can be used again
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sourceErr := errors.New("source failed")
+	failing := &tvpTestRows{columns: columns, rows: [][]interface{}{{nil, int64(1), "a", "1"}, {nil, int64(2), "b", "2"}}, err: sourceErr}
+	_, err = conn.ExecContext(context.Background(), `select * from @p1`, TVP{TypeName: "dbo.TestTVPRows", Value: failing})
+	if err != sourceErr {
+		t.Errorf("got error %v, want the source error", err)
+	}
+	if failing.calls != 3 {
+		t.Errorf("the source was read %d times, want 3", failing.calls)
+	}
+	var n int
+	if err = conn.QueryRowContext(context.Background(), `select 1`).Scan(&n); err != nil || n != 1 {
+		t.Errorf("the connection can't be used after the failed query: %v", err)
+	}
+}
+
+func TestTVPDiscoverColumns(t *testing.T) {
+	checkConnStr(t)
+	tl := testLogger{t: t}
+	defer tl.StopLogging()
+	SetLogger(&tl)
+
+	connector, err := NewConnector(makeConnStr(t).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TYPE dbo.TestTVPDiscover AS TABLE (id int identity(1,1), code varchar(10) collate Latin1_General_CI_AS, amount decimal(18,4), at datetime2(3), note nvarchar(20) default 'none')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`DROP TYPE dbo.TestTVPDiscover`)
+
+	type row struct {
+		Code   string
+		Amount float64
+		At     time.Time
+	}
+	at := time.Date(2021, 3, 4, 5, 6, 7, 123456700, time.UTC)
+	for i := 0; i < 2; i++ {
+		var id int
+		var code, note string
+		var amount string
+		var got time.Time
+		err = db.QueryRow(`select id, code, amount, at, note from @p1`, TVP{
+			TypeName:        "dbo.TestTVPDiscover",
+			Value:           []row{{Code: "café", Amount: 12.3456, At: at}},
+			DiscoverColumns: true,
+		}).Scan(&id, &code, &amount, &got, &note)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 1 || code != "café" || amount != "12.3456" || !got.Equal(at.Truncate(time.Millisecond)) || note != "none" {
+			t.Errorf("got %d %q %s %v %q", id, code, amount, got, note)
+		}
+	}
+	if len(connector.tvpTypes) != 1 {
+		t.Errorf("expected the type in the cache, got %d entries", len(connector.tvpTypes))
+	}
+
+	type wrongRow struct {
+		Code  string
+		Price float64
+	}
+	_, err = db.Exec(`select * from @p1`, TVP{TypeName: "dbo.TestTVPDiscover", Value: []wrongRow{}, DiscoverColumns: true})
+	if err == nil || !strings.Contains(err.Error(), "tvp field Price does not match a column") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// a failing source cancels the query, which is not retried
+	sourceErr := errors.New("source failed")
+	failing := &tvpTestRows{columns: []TVPColumn{{Name: "code"}}, rows: [][]interface{}{{"a"}}, err: sourceErr}
+	_, err = db.Exec(`select * from @p1`, TVP{TypeName: "dbo.TestTVPDiscover", Value: failing, DiscoverColumns: true})
+	if err != sourceErr || failing.calls != 2 {
+		t.Errorf("got error %v after %d reads of the source", err, failing.calls)
+	}
+
+	// the cached columns of a changed type are rejected by the server
+	// and read again
+	if _, err = db.Exec(`DROP TYPE dbo.TestTVPDiscover; CREATE TYPE dbo.TestTVPDiscover AS TABLE (code varchar(10))`); err != nil {
+		t.Fatal(err)
+	}
+	codes := []map[string]interface{}{{"code": "x"}}
+	if _, err = db.Exec(`select * from @p1`, TVP{TypeName: "dbo.TestTVPDiscover", Value: codes, DiscoverColumns: true}); err == nil {
+		t.Error("no error for the changed type")
+	}
+	var code string
+	err = db.QueryRow(`select code from @p1`, TVP{TypeName: "dbo.TestTVPDiscover", Value: codes, DiscoverColumns: true}).Scan(&code)
+	if err != nil || code != "x" {
+		t.Errorf("got %q, %v after the type changed", code, err)
+	}
+}
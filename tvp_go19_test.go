@@ -6,6 +6,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/denisenkom/go-mssqldb/msdsn"
 )
 
 type TestFields struct {
@@ -116,7 +118,7 @@ func TestTVPType_columnTypes(t *testing.T) {
 				TypeName: tt.fields.TVPName,
 				Value:    tt.fields.TVPValue,
 			}
-			_, _, err := tvp.columnTypes()
+			_, _, err := tvp.columnTypes(msdsn.TimeParameterDateTimeOffset)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TVP.columnTypes() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -322,7 +324,7 @@ func BenchmarkColumnTypes(b *testing.B) {
 		Value:    wal,
 	}
 	for i := 0; i < b.N; i++ {
-		_, _, err := tvp.columnTypes()
+		_, _, err := tvp.columnTypes(msdsn.TimeParameterDateTimeOffset)
 		if err != nil {
 			b.Error(err)
 		}
@@ -566,7 +568,7 @@ func TestTVP_encode(t *testing.T) {
 				TypeName: tt.fields.TypeName,
 				Value:    tt.fields.Value,
 			}
-			got, err := tvp.encode(tt.args.schema, tt.args.name, tt.args.columnStr, tt.args.tvpFieldIndexes)
+			got, err := tvp.encode(tt.args.schema, tt.args.name, tt.args.columnStr, tt.args.tvpFieldIndexes, msdsn.TimeParameterDateTimeOffset)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TVP.encode() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -0,0 +1,359 @@
+//go:build go1.9
+// +build go1.9
+
+package mssql
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TVPColumn is a column of a TVP whose rows are not structs.
+type TVPColumn struct {
+	// Name of the column, it is the key of the values of map rows.
+	Name string
+	// Type is a value of the Go type of the column, its SQL type is chosen
+	// as for struct fields, e.g. int64(0) is a bigint column and
+	// VarChar("") a varchar(max) column.
+	Type interface{}
+	// Default is set for identity and computed columns, as with the
+	// `tvp:"@identity"` tag of struct fields, their values are not sent.
+	Default bool
+}
+
+// TVPRows is a source of TVP rows, it is read while the TVP is sent so the
+// rows do not have to be in memory.
+type TVPRows interface {
+	// Columns returns the columns of the rows.
+	Columns() []TVPColumn
+	// Next reads the values of the next row into dest, one per column.
+	// It returns io.EOF after the last row.
+	Next(dest []interface{}) error
+}
+
+// tvpMapRows are the rows of a []map[string]interface{} TVP.
+type tvpMapRows struct {
+	columns []TVPColumn
+	maps    []map[string]interface{}
+}
+
+func (r *tvpMapRows) Columns() []TVPColumn {
+	return r.columns
+}
+
+func (r *tvpMapRows) Next(dest []interface{}) error {
+	if len(r.maps) == 0 {
+		return io.EOF
+	}
+	m := r.maps[0]
+	r.maps = r.maps[1:]
+	found := 0
+	for i, col := range r.columns {
+		v, ok := m[col.Name]
+		if ok {
+			found++
+		}
+		dest[i] = v
+	}
+	if found != len(m) {
+		for key := range m {
+			if !r.hasColumn(key) {
+				return fmt.Errorf("mssql: tvp map key %q is not a column", key)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *tvpMapRows) hasColumn(name string) bool {
+	for _, col := range r.columns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// tvpSQLRows are the rows of a *sql.Rows TVP.
+type tvpSQLRows struct {
+	columns []TVPColumn
+	rows    *sql.Rows
+	ptrs    []interface{}
+	// types are the SQL types of the columns taken from rows, a zero
+	// type keeps the type of the Go type of the column
+	types []typeInfo
+}
+
+func newTVPSQLRows(rows *sql.Rows, columns []TVPColumn) (*tvpSQLRows, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	r := &tvpSQLRows{columns: columns, rows: rows, ptrs: make([]interface{}, len(types))}
+	if columns == nil {
+		r.columns = make([]TVPColumn, len(types))
+		r.types = make([]typeInfo, len(types))
+		for i, ct := range types {
+			r.columns[i] = TVPColumn{Name: ct.Name(), Type: tvpColumnType(ct)}
+			r.types[i] = tvpSQLType(ct)
+		}
+	} else if len(columns) != len(types) {
+		return nil, fmt.Errorf("mssql: tvp has %d columns, the rows have %d", len(columns), len(types))
+	}
+	return r, nil
+}
+
+// tvpSQLType returns the SQL type of the TVP column for a column of rows
+// when the Go type of the column has another SQL type, e.g. int64 is a
+// bigint, and a zero type otherwise.
+func tvpSQLType(ct *sql.ColumnType) typeInfo {
+	switch strings.ToUpper(ct.DatabaseTypeName()) {
+	case "INT":
+		return typeInfo{TypeId: typeIntN, Size: 4}
+	case "SMALLINT":
+		return typeInfo{TypeId: typeIntN, Size: 2}
+	case "TINYINT":
+		return typeInfo{TypeId: typeIntN, Size: 1}
+	case "REAL":
+		return typeInfo{TypeId: typeFltN, Size: 4}
+	case "DECIMAL", "NUMERIC":
+		if prec, scale, ok := ct.DecimalSize(); ok {
+			return typeInfo{TypeId: typeDecimalN, Size: 17, Prec: uint8(prec), Scale: uint8(scale)}
+		}
+	case "MONEY":
+		return typeInfo{TypeId: typeMoneyN, Size: 8}
+	case "SMALLMONEY":
+		return typeInfo{TypeId: typeMoneyN, Size: 4}
+	case "SMALLDATETIME":
+		return typeInfo{TypeId: typeDateTimeN, Size: 4}
+	case "UNIQUEIDENTIFIER":
+		return typeInfo{TypeId: typeGuid, Size: 16}
+	}
+	return typeInfo{}
+}
+
+// setTypes sets the SQL types of the source columns to the columns of the
+// TVP, their values are then encoded by writeDiscoveredTVPRows. It
+// returns the sources of the columns.
+func (r *tvpSQLRows) setTypes(columnStr []columnStruct) []int {
+	sources := make([]int, len(columnStr))
+	for i := range columnStr {
+		if r.types[i].TypeId != 0 {
+			columnStr[i].ti = r.types[i]
+		}
+		sources[i] = i
+	}
+	return sources
+}
+
+// tvpColumnType returns a value of the Go type of the TVP column for a
+// column of rows.
+func tvpColumnType(ct *sql.ColumnType) interface{} {
+	switch strings.ToUpper(ct.DatabaseTypeName()) {
+	case "BIGINT", "INT", "SMALLINT", "TINYINT":
+		return int64(0)
+	case "BIT":
+		return false
+	case "FLOAT", "REAL":
+		return float64(0)
+	case "DECIMAL", "NUMERIC", "MONEY", "SMALLMONEY":
+		// the values are decimal text, converted by the server
+		return ""
+	case "DATE":
+		return Date{}
+	case "TIME":
+		return NewTime(time.Time{}, 7)
+	case "DATETIME2":
+		return NewDateTime2(time.Time{}, 7)
+	case "DATETIME", "SMALLDATETIME":
+		return DateTime1{}
+	case "DATETIMEOFFSET":
+		return DateTimeOffset{}
+	case "CHAR", "VARCHAR", "TEXT":
+		return VarChar("")
+	case "NCHAR", "NVARCHAR", "NTEXT", "XML":
+		return ""
+	case "BINARY", "VARBINARY", "IMAGE", "UNIQUEIDENTIFIER":
+		return []byte{}
+	}
+	if t := ct.ScanType(); t != nil {
+		return reflect.Zero(t).Interface()
+	}
+	return ""
+}
+
+func (r *tvpSQLRows) Columns() []TVPColumn {
+	return r.columns
+}
+
+func (r *tvpSQLRows) Next(dest []interface{}) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	for i := range dest {
+		r.ptrs[i] = &dest[i]
+	}
+	if err := r.rows.Scan(r.ptrs...); err != nil {
+		return err
+	}
+	for i := range r.types {
+		b, ok := dest[i].([]byte)
+		if !ok {
+			continue
+		}
+		switch r.columns[i].Type.(type) {
+		case string, VarChar:
+			// text, such as the decimal values read by this driver
+			dest[i] = string(b)
+		}
+	}
+	return nil
+}
+
+// rows returns the rows of a TVP whose Value is not a slice of structs,
+// nil for slices of structs.
+func (tvp TVP) rows() (TVPRows, error) {
+	switch v := tvp.Value.(type) {
+	case []map[string]interface{}:
+		return &tvpMapRows{columns: tvp.Columns, maps: v}, nil
+	case *sql.Rows:
+		return newTVPSQLRows(v, tvp.Columns)
+	case TVPRows:
+		return v, nil
+	}
+	return nil, nil
+}
+
+// tvpRowsColumns returns the columns of TVP rows.
+func tvpRowsColumns(columns []TVPColumn, stmt *Stmt) ([]columnStruct, error) {
+	if len(columns) == 0 {
+		return nil, ErrorSkip
+	}
+	columnStr := make([]columnStruct, len(columns))
+	for i, col := range columns {
+		if col.Type == nil {
+			return nil, fmt.Errorf("mssql: tvp column %q has no Type", col.Name)
+		}
+		defaultValue := (TVP{}).createZeroType(col.Type)
+		if t := reflect.TypeOf(col.Type); t.Kind() == reflect.Ptr {
+			defaultValue = reflect.New(t.Elem()).Interface()
+		}
+		var err error
+		columnStr[i], err = makeTVPColumn(stmt, defaultValue, col.Default)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert tvp column %q: %s", col.Name, err)
+		}
+		columnStr[i].ColName = col.Name
+	}
+	return columnStr, nil
+}
+
+// writeTVPRows writes a TVP reading its values from rows.
+func writeTVPRows(w io.Writer, schema, name string, columnStr []columnStruct, rows TVPRows, stmt *Stmt) error {
+	if err := writeTVPColumns(w, schema, name, columnStr); err != nil {
+		return err
+	}
+	dest := make([]interface{}, len(columnStr))
+	for {
+		for i := range dest {
+			dest[i] = nil
+		}
+		err := rows.Next(dest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write([]byte{_TVP_ROW_TOKEN}); err != nil {
+			return err
+		}
+		for i := range columnStr {
+			if columnStr[i].Flags == fDefault {
+				continue
+			}
+			if err = writeTVPValue(w, &columnStr[i], dest[i], stmt); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := w.Write([]byte{_TVP_END_TOKEN})
+	return err
+}
+
+// writeTVPValue writes a value of a TVP row, converted to the type of its
+// column.
+func writeTVPValue(w io.Writer, col *columnStruct, val interface{}, stmt *Stmt) error {
+	cval, err := convertInputParameter(val)
+	if err != nil {
+		return fmt.Errorf("failed to convert tvp column %q: %s", col.ColName, err)
+	}
+	if cval == nil {
+		return col.ti.Writer(w, col.ti, nil)
+	}
+	cval = convertTVPValue(cval, col.ti)
+	param, err := stmt.makeParam(cval)
+	if err != nil {
+		return fmt.Errorf("failed to make tvp column %q: %s", col.ColName, err)
+	}
+	if param.ti.TypeId != col.ti.TypeId {
+		return fmt.Errorf("mssql: tvp column %q is %s, got a value of type %T", col.ColName, makeDecl(col.ti), val)
+	}
+	return col.ti.Writer(w, param.ti, param.buffer)
+}
+
+// convertTVPValue converts the driver values of TVP rows which can be
+// sent as the type of the column.
+func convertTVPValue(val interface{}, ti typeInfo) interface{} {
+	switch v := val.(type) {
+	case string:
+		if ti.TypeId == typeBigVarChar {
+			return VarChar(v)
+		}
+	case VarChar:
+		if ti.TypeId == typeNVarChar {
+			return string(v)
+		}
+	case VarCharMax:
+		if ti.TypeId == typeNVarChar {
+			return string(v)
+		}
+	case NVarCharMax:
+		if ti.TypeId == typeBigVarChar {
+			return VarChar(v)
+		}
+	case []byte:
+		switch ti.TypeId {
+		case typeNVarChar:
+			return string(v)
+		case typeBigVarChar:
+			return VarChar(v)
+		}
+	case time.Time:
+		switch ti.TypeId {
+		case typeDateN:
+			return Date(v)
+		case typeTimeN:
+			return NewTime(v, int(ti.Scale))
+		case typeDateTime2N:
+			return NewDateTime2(v, int(ti.Scale))
+		case typeDateTimeN:
+			return DateTime1(v)
+		case typeDateTimeOffsetN:
+			return DateTimeOffset(v)
+		}
+	case DateTime2:
+		// values must be encoded with the scale of the column
+		return NewDateTime2(v.Time, int(ti.Scale))
+	case Time:
+		return NewTime(v.Time, int(ti.Scale))
+	}
+	return val
+}
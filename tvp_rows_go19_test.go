@@ -0,0 +1,174 @@
+//go:build go1.9
+// +build go1.9
+
+package mssql
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denisenkom/go-mssqldb/msdsn"
+)
+
+// tvpTestRows are TVP rows read from a slice.
+type tvpTestRows struct {
+	columns []TVPColumn
+	rows    [][]interface{}
+	err     error
+	// calls is the number of calls to Next
+	calls int
+}
+
+func (r *tvpTestRows) Columns() []TVPColumn {
+	return r.columns
+}
+
+func (r *tvpTestRows) Next(dest []interface{}) error {
+	r.calls++
+	if len(r.rows) == 0 {
+		if r.err != nil {
+			return r.err
+		}
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func encodeTVPRows(t *testing.T, tvp TVP) ([]byte, error) {
+	t.Helper()
+	if err := tvp.check(); err != nil {
+		return nil, err
+	}
+	rows, err := tvp.rows()
+	if err != nil {
+		return nil, err
+	}
+	stmt := newTVPStmt(msdsn.TimeParameterDateTimeOffset)
+	columnStr, err := tvpRowsColumns(rows.Columns(), stmt)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = writeTVPRows(&buf, "dbo", "T", columnStr, rows, stmt)
+	return buf.Bytes(), err
+}
+
+func TestTVPRowsEncodeAsStructs(t *testing.T) {
+	type row struct {
+		ID   int64 `tvp:"@identity"`
+		Num  int64
+		Name string
+		Note VarChar
+		When time.Time
+		Flag *bool
+		Data []byte
+	}
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	flag := true
+	structs := TVP{TypeName: "dbo.T", Value: []row{
+		{Num: 1, Name: "a", Note: "x", When: tm, Flag: &flag, Data: []byte{1}},
+		{Num: 2, Name: "b", When: tm},
+	}}
+	columnStr, indexes, err := structs.columnTypes(msdsn.TimeParameterDateTimeOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := structs.encode("dbo", "T", columnStr, indexes, msdsn.TimeParameterDateTimeOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns := []TVPColumn{
+		{Name: "ID", Type: int64(0), Default: true},
+		{Name: "Num", Type: int64(0)},
+		{Name: "Name", Type: ""},
+		{Name: "Note", Type: VarChar("")},
+		{Name: "When", Type: time.Time{}},
+		{Name: "Flag", Type: (*bool)(nil)},
+		{Name: "Data", Type: []byte{}},
+	}
+	tests := []struct {
+		name string
+		tvp  TVP
+	}{
+		{"maps", TVP{TypeName: "dbo.T", Columns: columns, Value: []map[string]interface{}{
+			{"Num": 1, "Name": "a", "Note": "x", "When": tm, "Flag": true, "Data": []byte{1}},
+			{"Num": int32(2), "Name": "b", "Note": VarChar(""), "When": tm, "Data": []byte(nil)},
+		}}},
+		{"rows", TVP{TypeName: "dbo.T", Value: &tvpTestRows{columns: columns, rows: [][]interface{}{
+			{nil, int64(1), "a", VarChar("x"), tm, &flag, []byte{1}},
+			{nil, int64(2), "b", "", tm, (*bool)(nil), nil},
+		}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeTVPRows(t, tt.tvp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("got\n%x\nwant\n%x", got, want)
+			}
+		})
+	}
+}
+
+func TestTVPRowsErrors(t *testing.T) {
+	columns := []TVPColumn{{Name: "Num", Type: int64(0)}}
+	sourceErr := errors.New("source failed")
+	tests := []struct {
+		name string
+		tvp  TVP
+		err  string
+	}{
+		{"maps without columns", TVP{TypeName: "T", Value: []map[string]interface{}{}}, ErrorTVPColumns.Error()},
+		{"nil maps", TVP{TypeName: "T", Columns: columns, Value: []map[string]interface{}(nil)}, ErrorTypeSliceIsEmpty.Error()},
+		{"nil rows", TVP{TypeName: "T", Value: (*tvpTestRows)(nil)}, ErrorTypeSliceIsEmpty.Error()},
+		{"unknown key", TVP{TypeName: "T", Columns: columns, Value: []map[string]interface{}{{"Num": 1, "Other": 2}}}, `"Other" is not a column`},
+		{"wrong type", TVP{TypeName: "T", Columns: columns, Value: []map[string]interface{}{{"Num": "1"}}}, `tvp column "Num" is bigint`},
+		{"no type", TVP{TypeName: "T", Columns: []TVPColumn{{Name: "Num"}}, Value: []map[string]interface{}{}}, "has no Type"},
+		{"source error", TVP{TypeName: "T", Value: &tvpTestRows{columns: columns, rows: [][]interface{}{{1}}, err: sourceErr}}, sourceErr.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := encodeTVPRows(t, tt.tvp)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTVPRowsSourceFailure(t *testing.T) {
+	columns := []TVPColumn{{Name: "Num", Type: int64(0)}}
+	sourceErr := errors.New("source failed")
+	rows := &tvpTestRows{columns: columns, rows: [][]interface{}{{int64(1)}, {int64(2)}}, err: sourceErr}
+	s := &Stmt{c: &Conn{}}
+	p, err := s.makeParam(TVP{TypeName: "dbo.T", Value: rows})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the source fails after the rows, the request can be cancelled
+	buf := newTdsBuffer(defaultPacketSize, closableBuffer{new(bytes.Buffer)})
+	err = sendRpc(buf, nil, sp_ExecuteSql, 0, []param{p}, false)
+	if werr, ok := err.(writerError); !ok || !werr.source || werr.err != sourceErr {
+		t.Errorf("got error %#v, want the source error", err)
+	}
+
+	// errors of the connection are not errors of the source
+	p.writer = func(w io.Writer) error {
+		_, err := w.Write(make([]byte, 1000))
+		return err
+	}
+	buf = newTdsBuffer(100, failBuffer{})
+	err = sendRpc(buf, nil, sp_ExecuteSql, 0, []param{p}, false)
+	if werr, ok := err.(writerError); !ok || werr.source {
+		t.Errorf("got error %#v, want a connection error", err)
+	}
+}
@@ -0,0 +1,342 @@
+//go:build go1.9
+// +build go1.9
+
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/golang-sql/civil"
+)
+
+// resolveTVPColumns sets the columns of the table types of TVP arguments
+// with DiscoverColumns.
+func (s *Stmt) resolveTVPColumns(ctx context.Context, args []namedValue) error {
+	s.tvpTypeKeys = s.tvpTypeKeys[:0]
+	for i := range args {
+		tvp, ok := args[i].Value.(TVP)
+		if !ok || !tvp.DiscoverColumns {
+			continue
+		}
+		columns, err := s.c.tvpTypeColumns(ctx, tvp.TypeName)
+		if err != nil {
+			return err
+		}
+		s.tvpTypeKeys = append(s.tvpTypeKeys, s.c.tvpTypeKey(tvp.TypeName))
+		// writeTypeInfo sets the writers of the columns, the cached
+		// columns are shared between connections
+		tvp.columns = append([]columnStruct(nil), columns...)
+		args[i].Value = tvp
+	}
+	return nil
+}
+
+// tvpTypeColumns returns the columns of a table type of the current
+// database, they are cached by the connector.
+func (c *Conn) tvpTypeColumns(ctx context.Context, typeName string) ([]columnStruct, error) {
+	key := c.tvpTypeKey(typeName)
+	cn := c.connector
+	if cn != nil {
+		cn.tvpTypesMu.Lock()
+		columns, ok := cn.tvpTypes[key]
+		cn.tvpTypesMu.Unlock()
+		if ok {
+			return columns, nil
+		}
+	}
+	columns, err := c.queryTVPType(ctx, typeName)
+	if err != nil {
+		return nil, err
+	}
+	if cn != nil {
+		cn.tvpTypesMu.Lock()
+		if cn.tvpTypes == nil {
+			cn.tvpTypes = make(map[string][]columnStruct)
+		}
+		cn.tvpTypes[key] = columns
+		cn.tvpTypesMu.Unlock()
+	}
+	return columns, nil
+}
+
+// tvpTypeKey returns the key of a table type of the current database in
+// the cache of the connector.
+func (c *Conn) tvpTypeKey(typeName string) string {
+	return c.sess.database + "\x00" + typeName
+}
+
+// queryTVPType reads the columns of a table type, their types are those
+// of the result set of a variable of the type.
+func (c *Conn) queryTVPType(ctx context.Context, typeName string) ([]columnStruct, error) {
+	parts, err := parseObjectName(typeName)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) > 2 {
+		return nil, ErrorObjectName
+	}
+	// the query must not take the outputs of the query of the TVP
+	outs := c.outs
+	c.outs = outputs{}
+	defer func() { c.outs = outs }()
+
+	stmt, err := c.prepareContext(ctx, "declare @t "+quoteObjectName(parts)+"; select top 0 * from @t; "+
+		"select c.name, c.is_identity | c.is_computed from sys.table_types t "+
+		"join sys.columns c on c.object_id = t.type_table_object_id where t.user_type_id = type_id(@p1)")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, []driver.NamedValue{{Ordinal: 1, Value: typeName}})
+	if err != nil {
+		return nil, fmt.Errorf("mssql: get columns of tvp type %s failed: %v", typeName, err)
+	}
+	defer rows.Close()
+	r := rows.(*Rows)
+	columns := make([]columnStruct, len(r.cols))
+	for i, col := range r.cols {
+		columns[i] = columnStruct{
+			ColName: col.ColName,
+			Flags:   col.Flags & colFlagNullable,
+			ti:      tvpTypeInfo(col.ti),
+		}
+	}
+	if err = r.NextResultSet(); err != nil {
+		return nil, fmt.Errorf("mssql: get columns of tvp type %s failed: %v", typeName, err)
+	}
+	row := make([]driver.Value, 2)
+	for {
+		if err = r.Next(row); err != nil {
+			break
+		}
+		name, _ := row[0].(string)
+		if isDefault, _ := row[1].(bool); !isDefault {
+			continue
+		}
+		for i := range columns {
+			if columns[i].ColName == name {
+				columns[i].Flags = fDefault
+			}
+		}
+	}
+	if err != io.EOF {
+		return nil, fmt.Errorf("mssql: get columns of tvp type %s failed: %v", typeName, err)
+	}
+	return columns, nil
+}
+
+// tvpTypeInfo returns the type of a TVP column of a result set column,
+// fixed length types are sent as their nullable variants.
+func tvpTypeInfo(ti typeInfo) typeInfo {
+	res := typeInfo{
+		TypeId:    ti.TypeId,
+		Size:      ti.Size,
+		Scale:     ti.Scale,
+		Prec:      ti.Prec,
+		Collation: ti.Collation,
+		UdtInfo:   ti.UdtInfo,
+		XmlInfo:   ti.XmlInfo,
+	}
+	switch ti.TypeId {
+	case typeInt1, typeInt2, typeInt4, typeInt8:
+		res.TypeId = typeIntN
+	case typeBit:
+		res.TypeId = typeBitN
+	case typeFlt4, typeFlt8:
+		res.TypeId = typeFltN
+	case typeMoney, typeMoney4:
+		res.TypeId = typeMoneyN
+	case typeDateTime, typeDateTim4:
+		res.TypeId = typeDateTimeN
+	}
+	return res
+}
+
+// tvpStructRows are the rows of a slice of structs TVP, the columns are
+// named after the fields.
+type tvpStructRows struct {
+	columns []TVPColumn
+	fields  []int
+	val     reflect.Value
+	next    int
+}
+
+func newTVPStructRows(value interface{}) *tvpStructRows {
+	val := reflect.ValueOf(value)
+	rowType := val.Type().Elem()
+	r := &tvpStructRows{val: val}
+	for i := 0; i < rowType.NumField(); i++ {
+		field := rowType.Field(i)
+		tvpTagValue, isTvpTag := field.Tag.Lookup(tvpTag)
+		jsonTagValue, isJsonTag := field.Tag.Lookup(jsonTag)
+		if IsSkipField(tvpTagValue, isTvpTag, jsonTagValue, isJsonTag) {
+			continue
+		}
+		name := field.Name
+		if jsonName := strings.Split(jsonTagValue, ",")[0]; jsonName != "" {
+			name = jsonName
+		}
+		r.columns = append(r.columns, TVPColumn{Name: name, Default: tvpTagValue == tvpIdentity})
+		r.fields = append(r.fields, i)
+	}
+	return r
+}
+
+func (r *tvpStructRows) Columns() []TVPColumn {
+	return r.columns
+}
+
+func (r *tvpStructRows) Next(dest []interface{}) error {
+	if r.next == r.val.Len() {
+		return io.EOF
+	}
+	row := r.val.Index(r.next)
+	r.next++
+	for i, field := range r.fields {
+		dest[i] = row.Field(field).Interface()
+	}
+	return nil
+}
+
+// matchTVPColumns returns the source column of each column of the table
+// type, -1 for columns sent as default.
+func matchTVPColumns(typeName string, columnStr []columnStruct, source []TVPColumn) ([]int, error) {
+	sources := make([]int, len(columnStr))
+	for i := range sources {
+		sources[i] = -1
+	}
+	for j, src := range source {
+		found := false
+		for i, col := range columnStr {
+			if strings.EqualFold(col.ColName, src.Name) {
+				sources[i] = j
+				found = true
+				break
+			}
+		}
+		if !found && !src.Default {
+			return nil, fmt.Errorf("mssql: tvp field %s does not match a column of type %s", src.Name, typeName)
+		}
+	}
+	for i := range columnStr {
+		if sources[i] < 0 || source[sources[i]].Default {
+			columnStr[i].Flags = fDefault
+		}
+		if columnStr[i].Flags == fDefault {
+			sources[i] = -1
+		}
+	}
+	return sources, nil
+}
+
+// discoveredRows returns the rows of a TVP with discovered columns and
+// the source column of each column of the table type.
+func (tvp TVP) discoveredRows() (TVPRows, []int, error) {
+	var rows TVPRows
+	switch v := tvp.Value.(type) {
+	case []map[string]interface{}:
+		columns := tvp.Columns
+		if columns == nil {
+			for _, col := range tvp.columns {
+				columns = append(columns, TVPColumn{Name: col.ColName})
+			}
+		}
+		rows = &tvpMapRows{columns: columns, maps: v}
+	default:
+		var err error
+		if rows, err = tvp.rows(); err != nil {
+			return nil, nil, err
+		}
+		if rows == nil {
+			rows = newTVPStructRows(tvp.Value)
+		}
+	}
+	sources, err := matchTVPColumns(tvp.TypeName, tvp.columns, rows.Columns())
+	if err != nil {
+		return nil, nil, err
+	}
+	return rows, sources, nil
+}
+
+// writeDiscoveredTVPRows writes a TVP encoding the values with the types
+// of the columns of the table type.
+func writeDiscoveredTVPRows(w io.Writer, schema, name string, columnStr []columnStruct, sources []int, rows TVPRows) error {
+	if err := writeTVPColumns(w, schema, name, columnStr); err != nil {
+		return err
+	}
+	b := &Bulk{}
+	dest := make([]interface{}, len(rows.Columns()))
+	for {
+		for i := range dest {
+			dest[i] = nil
+		}
+		err := rows.Next(dest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write([]byte{_TVP_ROW_TOKEN}); err != nil {
+			return err
+		}
+		for i, col := range columnStr {
+			if sources[i] < 0 {
+				continue
+			}
+			val, err := tvpPlainValue(dest[sources[i]])
+			if err != nil {
+				return fmt.Errorf("failed to convert tvp column %q: %s", col.ColName, err)
+			}
+			param, err := b.makeParam(val, col)
+			if err != nil {
+				return fmt.Errorf("failed to make tvp column %q: %s", col.ColName, err)
+			}
+			if err = col.ti.Writer(w, param.ti, param.buffer); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := w.Write([]byte{_TVP_END_TOKEN})
+	return err
+}
+
+// tvpPlainValue converts a value to the types accepted by Bulk.makeParam.
+func tvpPlainValue(val interface{}) (interface{}, error) {
+	val, err := convertInputParameter(val)
+	if err != nil {
+		return nil, err
+	}
+	switch v := val.(type) {
+	case VarChar:
+		return string(v), nil
+	case VarCharMax:
+		return string(v), nil
+	case NVarCharMax:
+		return string(v), nil
+	case DateTime1:
+		return time.Time(v), nil
+	case DateTimeOffset:
+		return time.Time(v), nil
+	case Date:
+		return time.Time(v), nil
+	case DateTime2:
+		return v.Time, nil
+	case Time:
+		return v.Time, nil
+	case civil.Date:
+		return v.In(time.UTC), nil
+	case civil.DateTime:
+		return v.In(time.UTC), nil
+	case civil.Time:
+		return time.Date(1, 1, 1, v.Hour, v.Minute, v.Second, v.Nanosecond, time.UTC), nil
+	case XML:
+		return v.Value, nil
+	}
+	return val, nil
+}
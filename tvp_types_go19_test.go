@@ -0,0 +1,125 @@
+//go:build go1.9
+// +build go1.9
+
+package mssql
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denisenkom/go-mssqldb/internal/cp"
+)
+
+func testTVPTypeColumns() []columnStruct {
+	latin1 := cp.Collation{LcidAndFlags: 0x0409, SortId: 52}
+	return []columnStruct{
+		{ColName: "id", Flags: fDefault, ti: typeInfo{TypeId: typeIntN, Size: 4}},
+		{ColName: "amount", ti: typeInfo{TypeId: typeDecimalN, Size: 9, Prec: 18, Scale: 4}},
+		{ColName: "code", ti: typeInfo{TypeId: typeBigVarChar, Size: 10, Collation: latin1}},
+		{ColName: "at", ti: typeInfo{TypeId: typeDateTime2N, Scale: 3}},
+		{ColName: "small", ti: tvpTypeInfo(typeInfo{TypeId: typeInt2, Size: 2})},
+		{ColName: "missing", ti: typeInfo{TypeId: typeIntN, Size: 4}},
+	}
+}
+
+func TestWriteDiscoveredTVPRows(t *testing.T) {
+	type row struct {
+		ID     int `tvp:"@identity"`
+		Amount float64
+		Code   string
+		At     time.Time
+		Small  int16 `json:"small,omitempty"`
+	}
+	at := time.Date(2021, 3, 4, 5, 6, 7, 123456700, time.UTC)
+	tvp := TVP{
+		TypeName:        "dbo.T",
+		Value:           []row{{Amount: 1.25, Code: "café", At: at, Small: -2}},
+		DiscoverColumns: true,
+		columns:         testTVPTypeColumns(),
+	}
+	rows, sources, err := tvp.discoveredRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{-1, 1, 2, 3, 4, -1}; !reflect.DeepEqual(sources, want) {
+		t.Errorf("got sources %v, want %v", sources, want)
+	}
+	if tvp.columns[5].Flags != fDefault {
+		t.Error("a column without field should be sent as default")
+	}
+	var buf bytes.Buffer
+	if err = writeDiscoveredTVPRows(&buf, "dbo", "T", tvp.columns, sources, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	// read the row back with readers of the column types
+	var header bytes.Buffer
+	if err = writeTVPColumns(&header, "dbo", "T", testTVPTypeColumns()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()[header.Len():]
+	if data[0] != _TVP_ROW_TOKEN || data[len(data)-1] != _TVP_END_TOKEN {
+		t.Fatalf("unexpected rows %x", data)
+	}
+	r := &tdsBuffer{packetSize: len(data), rbuf: data, rpos: 1, rsize: len(data) - 1}
+	want := []interface{}{[]byte("1.2500"), "café", at.Truncate(time.Millisecond), int64(-2)}
+	for i, col := range tvp.columns[1:5] {
+		var ti bytes.Buffer
+		if err = writeTypeInfo(&ti, &col.ti); err != nil {
+			t.Fatal(err)
+		}
+		tir := &tdsBuffer{packetSize: ti.Len(), rbuf: ti.Bytes(), rsize: ti.Len()}
+		reader := readTypeInfo(tir)
+		got := reader.Reader(&reader, r)
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("column %s: got %T %v, want %T %v", col.ColName, got, got, want[i], want[i])
+		}
+	}
+	if r.rpos != r.rsize {
+		t.Errorf("%d bytes left after the row", r.rsize-r.rpos)
+	}
+}
+
+func TestMatchTVPColumnsErrors(t *testing.T) {
+	type row struct {
+		Amount  float64
+		Unknown string
+	}
+	tvp := TVP{TypeName: "dbo.T", Value: []row{}, DiscoverColumns: true, columns: testTVPTypeColumns()}
+	_, _, err := tvp.discoveredRows()
+	if err == nil || !strings.Contains(err.Error(), "tvp field Unknown does not match a column of type dbo.T") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	tvp.Value = []map[string]interface{}{{"amount": 1, "other": 2}}
+	rows, sources, err := tvp.discoveredRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = writeDiscoveredTVPRows(&buf, "dbo", "T", tvp.columns, sources, rows)
+	if err == nil || !strings.Contains(err.Error(), `"other" is not a column`) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestForgetTVPTypes(t *testing.T) {
+	cn := &Connector{tvpTypes: map[string][]columnStruct{"db\x00dbo.T": testTVPTypeColumns(), "db\x00dbo.U": nil}}
+	s := &Stmt{c: &Conn{connector: cn, sess: &tdsSession{database: "db"}}}
+	s.tvpTypeKeys = []string{s.c.tvpTypeKey("dbo.T")}
+
+	// errors of the client keep the types
+	s.forgetTVPTypes(errors.New("mssql: tvp field Price does not match a column"))
+	if len(cn.tvpTypes) != 2 {
+		t.Fatalf("got %d cached types, want 2", len(cn.tvpTypes))
+	}
+	// types rejected by the server are read again
+	s.forgetTVPTypes(Error{Number: 8037, Message: "The incoming tabular data stream (TDS) remote procedure call (RPC) protocol stream is incorrect."})
+	if _, ok := cn.tvpTypes["db\x00dbo.T"]; ok || len(cn.tvpTypes) != 1 {
+		t.Errorf("got cached types %v", cn.tvpTypes)
+	}
+}
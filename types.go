@@ -8,6 +8,7 @@ import (
 	"math"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/denisenkom/go-mssqldb/internal/cp"
@@ -64,6 +65,7 @@ const (
 	typeXml        = 0xf1
 	typeUdt        = 0xf0
 	typeTvp        = 0xf3
+	typeVector     = 0xf5
 
 	// long length types
 	typeText    = 0x23
@@ -119,6 +121,32 @@ type xmlInfo struct {
 	XmlSchemaCollection string
 }
 
+// XML encodes parameters to the xml SQL type.
+// When SchemaCollection is set the parameter is typed by that XML schema
+// collection, optionally qualified with its owning schema, e.g. "dbo.Orders".
+type XML struct {
+	Value            string
+	SchemaCollection string
+}
+
+// XMLSchemaCollection identifies the XML schema collection of a typed xml column.
+type XMLSchemaCollection struct {
+	Database     string
+	OwningSchema string
+	Name         string
+}
+
+func makeXMLSchemaCollection(ti typeInfo) (XMLSchemaCollection, bool) {
+	if ti.TypeId != typeXml || ti.XmlInfo.SchemaPresent == 0 {
+		return XMLSchemaCollection{}, false
+	}
+	return XMLSchemaCollection{
+		Database:     ti.XmlInfo.DBName,
+		OwningSchema: ti.XmlInfo.OwningSchema,
+		Name:         ti.XmlInfo.XmlSchemaCollection,
+	}, true
+}
+
 func readTypeInfo(r *tdsBuffer) (res typeInfo) {
 	res.TypeId = r.byte()
 	switch res.TypeId {
@@ -217,7 +245,7 @@ func writeVarLen(w io.Writer, ti *typeInfo) (err error) {
 		}
 		ti.Writer = writeByteLenType
 	case typeBigVarBin, typeBigVarChar, typeBigBinary, typeBigChar,
-		typeNVarChar, typeNChar, typeXml, typeUdt:
+		typeNVarChar, typeNChar, typeUdt:
 
 		// short len types
 		if ti.Size > 8000 || ti.Size == 0 {
@@ -236,20 +264,49 @@ func writeVarLen(w io.Writer, ti *typeInfo) (err error) {
 			if err = writeCollation(w, ti.Collation); err != nil {
 				return
 			}
-		case typeXml:
-			if err = binary.Write(w, binary.LittleEndian, ti.XmlInfo.SchemaPresent); err != nil {
+		}
+	case typeXml:
+		// xml has no length, values are always sent as PLP
+		if err = binary.Write(w, binary.LittleEndian, ti.XmlInfo.SchemaPresent); err != nil {
+			return
+		}
+		if ti.XmlInfo.SchemaPresent != 0 {
+			if err = writeBVarChar(w, ti.XmlInfo.DBName); err != nil {
+				return
+			}
+			if err = writeBVarChar(w, ti.XmlInfo.OwningSchema); err != nil {
+				return
+			}
+			if err = writeUsVarChar(w, ti.XmlInfo.XmlSchemaCollection); err != nil {
 				return
 			}
 		}
+		ti.Writer = writePLPType
 	case typeText, typeImage, typeNText, typeVariant:
 		// LONGLEN_TYPE
 		if err = binary.Write(w, binary.LittleEndian, uint32(ti.Size)); err != nil {
 			return
 		}
-		if err = writeCollation(w, ti.Collation); err != nil {
+		switch ti.TypeId {
+		case typeText, typeNText:
+			if err = writeCollation(w, ti.Collation); err != nil {
+				return
+			}
+		}
+		if ti.TypeId == typeVariant {
+			ti.Writer = writeVariantType
+		} else {
+			ti.Writer = writeLongLenType
+		}
+	case typeVector:
+		// short len type followed by the element type
+		if err = binary.Write(w, binary.LittleEndian, uint16(ti.Size)); err != nil {
 			return
 		}
-		ti.Writer = writeLongLenType
+		if err = binary.Write(w, binary.LittleEndian, ti.Scale); err != nil {
+			return
+		}
+		ti.Writer = writeShortLenType
 	default:
 		panic("Invalid type")
 	}
@@ -469,6 +526,12 @@ func readShortLenType(ti *typeInfo, r *tdsBuffer) interface{} {
 		return decodeNChar(buf)
 	case typeUdt:
 		return decodeUdt(*ti, buf)
+	case typeVector:
+		v, err := decodeVector(buf)
+		if err != nil {
+			badStreamPanic(err)
+		}
+		return v
 	default:
 		badStreamPanicf("Invalid typeid")
 	}
@@ -480,10 +543,11 @@ func writeShortLenType(w io.Writer, ti typeInfo, buf []byte) (err error) {
 		err = binary.Write(w, binary.LittleEndian, uint16(0xffff))
 		return
 	}
-	if ti.Size > 0xfffe {
+	if len(buf) > 0xfffe {
 		panic("Invalid size for USHORTLEN_TYPE")
 	}
-	err = binary.Write(w, binary.LittleEndian, uint16(ti.Size))
+	// the declared size of a parameter may be larger than its value
+	err = binary.Write(w, binary.LittleEndian, uint16(len(buf)))
 	if err != nil {
 		return
 	}
@@ -523,6 +587,11 @@ func readLongLenType(ti *typeInfo, r *tdsBuffer) interface{} {
 	panic("shoulnd't get here")
 }
 func writeLongLenType(w io.Writer, ti typeInfo, buf []byte) (err error) {
+	if buf == nil {
+		// textptr of length zero is a NULL value
+		err = binary.Write(w, binary.LittleEndian, byte(0))
+		return
+	}
 	//textptr
 	err = binary.Write(w, binary.LittleEndian, byte(0x10))
 	if err != nil {
@@ -564,6 +633,17 @@ func writeCollation(w io.Writer, col cp.Collation) (err error) {
 	return
 }
 
+// writes variant value, buf holds the base type, properties and data
+// as made by encodeVariant
+func writeVariantType(w io.Writer, ti typeInfo, buf []byte) (err error) {
+	err = binary.Write(w, binary.LittleEndian, uint32(len(buf)))
+	if err != nil {
+		return
+	}
+	_, err = w.Write(buf)
+	return
+}
+
 // reads variant value
 // http://msdn.microsoft.com/en-us/library/dd303302.aspx
 func readVariantType(ti *typeInfo, r *tdsBuffer) interface{} {
@@ -792,6 +872,12 @@ func readVarLen(ti *typeInfo, r *tdsBuffer) {
 			ti.Buffer = make([]byte, ti.Size)
 			ti.Reader = readShortLenType
 		}
+	case typeVector:
+		ti.Size = int(r.uint16())
+		// element type of the vector, only float32 is currently defined
+		ti.Scale = r.byte()
+		ti.Buffer = make([]byte, ti.Size)
+		ti.Reader = readShortLenType
 	case typeText, typeImage, typeNText, typeVariant:
 		// LONGLEN_TYPE
 		ti.Size = int(r.int32())
@@ -907,11 +993,9 @@ func calcTimeSize(scale int) int {
 func encodeTimeInt(seconds, ns, scale int, buf []byte) {
 	ns_total := int64(seconds)*1000*1000*1000 + int64(ns)
 	t := ns_total / int64(math.Pow10(int(scale)*-1)*1e9)
-	buf[0] = byte(t)
-	buf[1] = byte(t >> 8)
-	buf[2] = byte(t >> 16)
-	buf[3] = byte(t >> 24)
-	buf[4] = byte(t >> 32)
+	for i := 0; i < calcTimeSize(scale); i++ {
+		buf[i] = byte(t >> (8 * uint(i)))
+	}
 }
 
 func decodeTime(scale uint8, buf []byte) time.Time {
@@ -1119,11 +1203,18 @@ func makeGoLangScanType(ti typeInfo) reflect.Type {
 		return reflect.TypeOf([]byte{})
 	case typeVariant:
 		return reflect.TypeOf(nil)
+	case typeVector:
+		return reflect.TypeOf(Vector{})
 	default:
 		panic(fmt.Sprintf("not implemented makeGoLangScanType for type %d", ti.TypeId))
 	}
 }
 
+// quoteName delimits an identifier the same way as QUOTENAME does
+func quoteName(name string) string {
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
+
 func makeDecl(ti typeInfo) string {
 	switch ti.TypeId {
 	case typeNull:
@@ -1223,7 +1314,7 @@ func makeDecl(ti typeInfo) string {
 			panic("invalid size of DATETIMNTYPE")
 		}
 	case typeTimeN:
-		return "time"
+		return fmt.Sprintf("time(%d)", ti.Scale)
 	case typeDateTime2N:
 		return fmt.Sprintf("datetime2(%d)", ti.Scale)
 	case typeDateTimeOffsetN:
@@ -1232,6 +1323,10 @@ func makeDecl(ti typeInfo) string {
 		return "text"
 	case typeNText:
 		return "ntext"
+	case typeImage:
+		return "image"
+	case typeVariant:
+		return "sql_variant"
 	case typeUdt:
 		return ti.UdtInfo.TypeName
 	case typeGuid:
@@ -1241,6 +1336,16 @@ func makeDecl(ti typeInfo) string {
 			return fmt.Sprintf("%s.%s READONLY", ti.UdtInfo.SchemaName, ti.UdtInfo.TypeName)
 		}
 		return fmt.Sprintf("%s READONLY", ti.UdtInfo.TypeName)
+	case typeVector:
+		return fmt.Sprintf("vector(%d)", vectorDimensions(ti.Size))
+	case typeXml:
+		if ti.XmlInfo.SchemaPresent == 0 {
+			return "xml"
+		}
+		if ti.XmlInfo.OwningSchema != "" {
+			return fmt.Sprintf("xml(%s.%s)", quoteName(ti.XmlInfo.OwningSchema), quoteName(ti.XmlInfo.XmlSchemaCollection))
+		}
+		return fmt.Sprintf("xml(%s)", quoteName(ti.XmlInfo.XmlSchemaCollection))
 	default:
 		panic(fmt.Sprintf("not implemented makeDecl for type %#x", ti.TypeId))
 	}
@@ -1348,6 +1453,8 @@ func makeGoLangTypeName(ti typeInfo) string {
 		return "SQL_VARIANT"
 	case typeBigBinary:
 		return "BINARY"
+	case typeVector:
+		return "VECTOR"
 	default:
 		panic(fmt.Sprintf("not implemented makeGoLangTypeName for type %d", ti.TypeId))
 	}
@@ -1472,6 +1579,9 @@ func makeGoLangTypeLength(ti typeInfo) (int64, bool) {
 		return 0, false
 	case typeBigBinary:
 		return int64(ti.Size), true
+	case typeVector:
+		// length of a vector is its number of dimensions
+		return int64(vectorDimensions(ti.Size)), true
 	default:
 		panic(fmt.Sprintf("not implemented makeGoLangTypeLength for type %d", ti.TypeId))
 	}
@@ -1584,6 +1694,8 @@ func makeGoLangTypePrecisionScale(ti typeInfo) (int64, int64, bool) {
 		return 0, 0, false
 	case typeBigBinary:
 		return 0, 0, false
+	case typeVector:
+		return 0, 0, false
 	default:
 		panic(fmt.Sprintf("not implemented makeGoLangTypePrecisionScale for type %d", ti.TypeId))
 	}
@@ -1,9 +1,13 @@
 package mssql
 
 import (
+	"bytes"
+	"database/sql"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/denisenkom/go-mssqldb/msdsn"
 )
 
 func TestMakeGoLangScanType(t *testing.T) {
@@ -53,6 +57,7 @@ func TestMakeGoLangTypeName(t *testing.T) {
 		{"typeDateTime", "DATETIME", typeDateTime},
 		{"typeDateTim4", "SMALLDATETIME", typeDateTim4},
 		{"typeBigBinary", "BINARY", typeBigBinary},
+		{"typeVector", "VECTOR", typeVector},
 		//TODO: Add other supported types
 	}
 
@@ -78,6 +83,7 @@ func TestMakeGoLangTypeLength(t *testing.T) {
 		{"typeBigVarChar", true, 2147483645, typeBigVarChar, 0xffff},
 		{"typeBigVarChar", true, 10, typeBigVarChar, 10},
 		{"typeBigBinary", true, 30, typeBigBinary, 30},
+		{"typeVector", true, 3, typeVector, 20},
 		//TODO: Add other supported types
 	}
 
@@ -136,6 +142,7 @@ func TestMakeDecl(t *testing.T) {
 		{"varbinary(max)", 0xffff, typeBigVarBin},
 		{"varbinary(8000)", 8000, typeBigVarBin},
 		{"varbinary(4001)", 4001, typeBigVarBin},
+		{"vector(3)", 20, typeVector},
 	}
 
 	for _, tt := range tests {
@@ -151,3 +158,196 @@ func handlePanic(t *testing.T) {
 		t.Errorf("recovered panic")
 	}
 }
+
+func TestXMLMakeParam(t *testing.T) {
+	stmt := &Stmt{c: &Conn{sess: &tdsSession{}}}
+
+	res, err := stmt.makeParam(XML{Value: "<a/>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(res.ti); decl != "xml" {
+		t.Errorf("untyped xml declared as %s", decl)
+	}
+	var w bytes.Buffer
+	if err := writeTypeInfo(&w, &res.ti); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes(), []byte{typeXml, 0}) {
+		t.Errorf("untyped xml type info = %x", w.Bytes())
+	}
+
+	res, err = stmt.makeParam(XML{Value: "<a/>", SchemaCollection: "[dbo].Orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(res.ti); decl != "xml([dbo].[Orders])" {
+		t.Errorf("typed xml declared as %s", decl)
+	}
+	w.Reset()
+	if err := writeTypeInfo(&w, &res.ti); err != nil {
+		t.Fatal(err)
+	}
+	b := w.Bytes()
+	r := &tdsBuffer{
+		packetSize: len(b),
+		rbuf:       b,
+		rpos:       0,
+		rsize:      len(b),
+	}
+	ti := readTypeInfo(r)
+	collection, ok := makeXMLSchemaCollection(ti)
+	if !ok {
+		t.Fatal("schema collection was not read back")
+	}
+	if collection != (XMLSchemaCollection{OwningSchema: "dbo", Name: "Orders"}) {
+		t.Errorf("unexpected schema collection %+v", collection)
+	}
+	if _, ok := makeXMLSchemaCollection(typeInfo{TypeId: typeNVarChar}); ok {
+		t.Error("nvarchar column should have no schema collection")
+	}
+
+	if _, err = stmt.makeParam(XML{Value: "<a/>", SchemaCollection: "a.b.c"}); err == nil {
+		t.Error("three part schema collection name should be rejected")
+	}
+}
+
+func TestXMLBulkMakeParam(t *testing.T) {
+	b := &Bulk{}
+	col := columnStruct{ti: typeInfo{TypeId: typeXml}}
+	for _, val := range []DataValue{"<a/>", []byte("<a/>"), XML{Value: "<a/>"}} {
+		res, err := b.makeParam(val, col)
+		if err != nil {
+			t.Errorf("makeParam(%v) failed: %v", val, err)
+			continue
+		}
+		if s, _ := ucs22str(res.buffer); s != "<a/>" {
+			t.Errorf("makeParam(%v) = %s", val, s)
+		}
+	}
+	if _, err := b.makeParam(1, col); err == nil {
+		t.Error("makeParam should reject int for xml column")
+	}
+}
+
+func TestTimeParameterType(t *testing.T) {
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC)
+	tests := []struct {
+		timeType   msdsn.TimeParameterType
+		tdsVersion uint32
+		decl       string
+	}{
+		{msdsn.TimeParameterDateTimeOffset, verTDS73, "datetimeoffset(7)"},
+		{msdsn.TimeParameterDateTime2, verTDS73, "datetime2(7)"},
+		{msdsn.TimeParameterDateTime, verTDS73, "datetime"},
+		{msdsn.TimeParameterDate, verTDS73, "date"},
+		{msdsn.TimeParameterDateTimeOffset, verTDS72, "datetime"},
+		{msdsn.TimeParameterDate, verTDS72, "datetime"},
+	}
+	for _, tt := range tests {
+		conn := &Conn{
+			connector: &Connector{params: msdsn.Config{TimeParameterType: tt.timeType}},
+			sess:      &tdsSession{loginAck: loginAckStruct{TDSVersion: tt.tdsVersion}},
+		}
+		stmt := &Stmt{c: conn}
+		res, err := stmt.makeParam(tm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decl := makeDecl(res.ti); decl != tt.decl {
+			t.Errorf("time.Time with %v on TDS %x declared as %s, want %s", tt.timeType, tt.tdsVersion, decl, tt.decl)
+		}
+		if len(res.buffer) != res.ti.Size {
+			t.Errorf("invalid parameter size %d for %s", res.ti.Size, tt.decl)
+		}
+
+		// output parameters are declared the same way
+		out, err := stmt.makeParam(sql.Out{Dest: tm})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decl := makeDecl(out.ti); decl != tt.decl {
+			t.Errorf("output time.Time declared as %s, want %s", decl, tt.decl)
+		}
+	}
+}
+
+func TestTimeWrapperParams(t *testing.T) {
+	stmt := &Stmt{c: &Conn{sess: &tdsSession{loginAck: loginAckStruct{TDSVersion: verTDS74}}}}
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	tests := []struct {
+		val  interface{}
+		decl string
+		size int
+	}{
+		{DateTime2{Time: tm}, "datetime2(7)", 8},
+		{NewDateTime2(tm, 0), "datetime2(0)", 6},
+		{NewDateTime2(tm, 3), "datetime2(3)", 7},
+		{Date(tm), "date", 3},
+		{Time{Time: tm}, "time(7)", 5},
+		{NewTime(tm, 2), "time(2)", 3},
+	}
+	for _, tt := range tests {
+		res, err := stmt.makeParam(tt.val)
+		if err != nil {
+			t.Errorf("makeParam(%v) failed: %v", tt.val, err)
+			continue
+		}
+		if decl := makeDecl(res.ti); decl != tt.decl {
+			t.Errorf("makeParam(%v) declared as %s, want %s", tt.val, decl, tt.decl)
+		}
+		if res.ti.Size != tt.size || len(res.buffer) != tt.size {
+			t.Errorf("makeParam(%v) size %d, want %d", tt.val, res.ti.Size, tt.size)
+		}
+	}
+	for _, val := range []interface{}{NewDateTime2(tm, 8), NewDateTime2(tm, -1), NewTime(tm, -2), NewTime(tm, -1)} {
+		if _, err := stmt.makeParam(val); err == nil {
+			t.Errorf("makeParam(%v) should fail on invalid scale", val)
+		}
+	}
+
+	// output destinations keep their scale
+	out := NewDateTime2(time.Time{}, 3)
+	if err := convertAssign(&out, tm); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Time.Equal(tm) || out.Scale() != 3 {
+		t.Errorf("unexpected output value %v scale %d", out.Time, out.Scale())
+	}
+	var d Date
+	if err := convertAssign(&d, tm); err != nil || !time.Time(d).Equal(tm) {
+		t.Errorf("unexpected output date %v: %v", time.Time(d), err)
+	}
+}
+
+func TestTimeParameterTypeTVP(t *testing.T) {
+	type row struct {
+		Created time.Time
+		Updated DateTime2
+	}
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	tvp := TVP{TypeName: "rows", Value: []row{{tm, NewDateTime2(tm, 3)}}}
+	columns, indexes, err := tvp.columnTypes(msdsn.TimeParameterDateTime2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(columns[0].ti); decl != "datetime2(7)" {
+		t.Errorf("time.Time column declared as %s", decl)
+	}
+	if decl := makeDecl(columns[1].ti); decl != "datetime2(7)" {
+		t.Errorf("DateTime2 column declared as %s", decl)
+	}
+	buf, err := tvp.encode("", "rows", columns, indexes, msdsn.TimeParameterDateTime2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both values are encoded with the column scale
+	value := encodeDateTime2(tm, 7)
+	expected := append([]byte{_TVP_ROW_TOKEN, byte(len(value))}, value...)
+	expected = append(expected, byte(len(value)))
+	expected = append(expected, value...)
+	expected = append(expected, _TVP_END_TOKEN)
+	if !bytes.HasSuffix(buf, expected) {
+		t.Errorf("unexpected TVP rows % x", buf)
+	}
+}
@@ -0,0 +1,170 @@
+package mssql
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Binary layout of the vector type, see
+// https://learn.microsoft.com/en-us/sql/t-sql/data-types/vector-data-type
+const (
+	vectorMagic          = 0xa9
+	vectorVersion1       = 0x01
+	vectorElementFloat32 = 0x00
+	vectorHeaderSize     = 8
+	vectorMaxDimensions  = 1998
+)
+
+// Vector is the value of a SQL Server vector(n) column.
+//
+// A Vector with nil Values is NULL. When Dimensions is zero it is taken from
+// the number of Values. When the server does not support the vector type
+// the value is sent as JSON text, which the server converts implicitly.
+type Vector struct {
+	Dimensions int
+	Values     []float32
+}
+
+// NewVector returns a Vector holding values.
+func NewVector(values []float32) Vector {
+	return Vector{Dimensions: len(values), Values: values}
+}
+
+// IsNull reports whether v represents a NULL vector.
+func (v Vector) IsNull() bool {
+	return v.Values == nil
+}
+
+func (v Vector) dimensions() (int, error) {
+	if v.Dimensions == 0 || v.Dimensions == len(v.Values) {
+		return len(v.Values), nil
+	}
+	return 0, fmt.Errorf("mssql: vector has %d dimensions but %d values", v.Dimensions, len(v.Values))
+}
+
+// String returns the vector in the JSON array format used by SQL Server.
+func (v Vector) String() string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range v.Values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// Scan implements the sql.Scanner interface. It accepts the native vector
+// type as well as its JSON text representation.
+func (v *Vector) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*v = Vector{}
+		return nil
+	case Vector:
+		*v = src
+		return nil
+	case []byte:
+		if len(src) >= vectorHeaderSize && src[0] == vectorMagic {
+			res, err := decodeVector(src)
+			if err != nil {
+				return err
+			}
+			*v = res
+			return nil
+		}
+		return v.scanJSON(src)
+	case string:
+		return v.scanJSON([]byte(src))
+	default:
+		return fmt.Errorf("mssql: cannot convert %T to Vector", src)
+	}
+}
+
+func (v *Vector) scanJSON(src []byte) error {
+	var values []float32
+	if err := json.Unmarshal(src, &values); err != nil {
+		return fmt.Errorf("mssql: invalid vector text: %v", err)
+	}
+	if values == nil {
+		values = []float32{}
+	}
+	*v = NewVector(values)
+	return nil
+}
+
+// vectorDimensions returns number of dimensions of a vector type with given size in bytes
+func vectorDimensions(size int) int {
+	if size < vectorHeaderSize {
+		return 0
+	}
+	return (size - vectorHeaderSize) / 4
+}
+
+func encodeVector(v Vector) ([]byte, error) {
+	dims, err := v.dimensions()
+	if err != nil {
+		return nil, err
+	}
+	if dims == 0 || dims > vectorMaxDimensions {
+		return nil, fmt.Errorf("mssql: invalid number of vector dimensions %d", dims)
+	}
+	buf := make([]byte, vectorHeaderSize+4*dims)
+	buf[0] = vectorMagic
+	buf[1] = vectorVersion1
+	binary.LittleEndian.PutUint16(buf[2:], uint16(dims))
+	buf[4] = vectorElementFloat32
+	for i, f := range v.Values {
+		binary.LittleEndian.PutUint32(buf[vectorHeaderSize+4*i:], math.Float32bits(f))
+	}
+	return buf, nil
+}
+
+func decodeVector(buf []byte) (Vector, error) {
+	if len(buf) < vectorHeaderSize || buf[0] != vectorMagic {
+		return Vector{}, errors.New("mssql: invalid vector header")
+	}
+	if buf[1] != vectorVersion1 {
+		return Vector{}, fmt.Errorf("mssql: unsupported vector version %d", buf[1])
+	}
+	if buf[4] != vectorElementFloat32 {
+		return Vector{}, fmt.Errorf("mssql: unsupported vector element type %d", buf[4])
+	}
+	dims := int(binary.LittleEndian.Uint16(buf[2:]))
+	if len(buf) != vectorHeaderSize+4*dims {
+		return Vector{}, fmt.Errorf("mssql: vector of %d dimensions has invalid length %d", dims, len(buf))
+	}
+	values := make([]float32, dims)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[vectorHeaderSize+4*i:]))
+	}
+	return Vector{Dimensions: dims, Values: values}, nil
+}
+
+// makeVectorParam encodes v using the native vector type when the server
+// acknowledged vector support and falls back to JSON text otherwise.
+func makeVectorParam(v Vector, vectorSupported bool) (res param, err error) {
+	if _, err = v.dimensions(); err != nil {
+		return
+	}
+	if !vectorSupported || len(v.Values) == 0 {
+		if v.IsNull() {
+			res.ti.TypeId = typeNVarChar
+			res.ti.Size = 0
+			return
+		}
+		return makeStrParam(v.String()), nil
+	}
+	res.ti.TypeId = typeVector
+	res.ti.Scale = vectorElementFloat32
+	res.buffer, err = encodeVector(v)
+	res.ti.Size = len(res.buffer)
+	return
+}
@@ -0,0 +1,241 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/denisenkom/go-mssqldb/msdsn"
+)
+
+func TestVectorEncodeDecode(t *testing.T) {
+	v := NewVector([]float32{1, -2.5, 0.125})
+	buf, err := encodeVector(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := hex.DecodeString("a901030000000000" + "0000803f" + "000020c0" + "0000003e")
+	if !bytes.Equal(buf, expected) {
+		t.Fatalf("encodeVector() = %x, want %x", buf, expected)
+	}
+	decoded, err := decodeVector(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, v) {
+		t.Errorf("decodeVector() = %v, want %v", decoded, v)
+	}
+
+	invalid := [][]byte{
+		nil,
+		buf[:7],
+		buf[:len(buf)-1],
+		append([]byte{0xa9, 0x02}, buf[2:]...),
+		append([]byte{0xa9, 0x01, 0x03, 0x00, 0x01}, buf[5:]...),
+	}
+	for _, b := range invalid {
+		if _, err := decodeVector(b); err == nil {
+			t.Errorf("decodeVector(%x) should fail", b)
+		}
+	}
+
+	if _, err := encodeVector(Vector{Dimensions: 4, Values: []float32{1}}); err == nil {
+		t.Error("encodeVector should fail on dimension mismatch")
+	}
+	if _, err := encodeVector(NewVector([]float32{})); err == nil {
+		t.Error("encodeVector should fail on empty vector")
+	}
+}
+
+func TestVectorScan(t *testing.T) {
+	bin, _ := encodeVector(NewVector([]float32{1, 2}))
+	tests := []struct {
+		src      interface{}
+		expected Vector
+	}{
+		{nil, Vector{}},
+		{NewVector([]float32{3}), NewVector([]float32{3})},
+		{bin, NewVector([]float32{1, 2})},
+		{"[1.0000000e+000,2.5000000e+000]", NewVector([]float32{1, 2.5})},
+		{[]byte("[0.5]"), NewVector([]float32{0.5})},
+		{"[]", NewVector([]float32{})},
+	}
+	for _, tt := range tests {
+		var v Vector
+		if err := v.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%v) failed: %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("Scan(%v) = %v, want %v", tt.src, v, tt.expected)
+		}
+	}
+
+	var v Vector
+	for _, src := range []interface{}{"[1,", 12, "{}"} {
+		if err := v.Scan(src); err == nil {
+			t.Errorf("Scan(%v) should fail", src)
+		}
+	}
+}
+
+func TestVectorString(t *testing.T) {
+	v := NewVector([]float32{1, -0.1, 3e-10})
+	if s := v.String(); s != "[1,-0.1,3e-10]" {
+		t.Errorf("String() = %s", s)
+	}
+	var back Vector
+	if err := back.Scan(v.String()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, v) {
+		t.Errorf("round trip through text = %v, want %v", back, v)
+	}
+}
+
+func TestVectorMakeParam(t *testing.T) {
+	conn := &Conn{sess: &tdsSession{}}
+	stmt := &Stmt{c: conn}
+	v := NewVector([]float32{1, 2, 3})
+
+	res, err := stmt.makeParam(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(res.ti); decl != "nvarchar(7)" {
+		t.Errorf("fallback declaration = %s", decl)
+	}
+	if s, _ := ucs22str(res.buffer); s != "[1,2,3]" {
+		t.Errorf("fallback value = %s", s)
+	}
+	res, err = stmt.makeParam(Vector{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(res.ti); decl != "nvarchar(max)" || res.buffer != nil {
+		t.Errorf("null fallback = %s %x", decl, res.buffer)
+	}
+
+	conn.sess.vectorVersion = 1
+	res, err = stmt.makeParam(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(res.ti); decl != "vector(3)" {
+		t.Errorf("native declaration = %s", decl)
+	}
+	if len(res.buffer) != res.ti.Size || res.ti.Size != 20 {
+		t.Errorf("invalid native parameter size %d", res.ti.Size)
+	}
+
+	if _, err = stmt.makeParam(Vector{Dimensions: 2, Values: []float32{1}}); err == nil {
+		t.Error("makeParam should fail on dimension mismatch")
+	}
+}
+
+func TestVectorTypeInfo(t *testing.T) {
+	// type info of a vector(2) column followed by a value
+	b, _ := hex.DecodeString("f5" + "1000" + "00" + "1000" + "a901020000000000" + "0000803f" + "00000040" + "ffff")
+	r := &tdsBuffer{
+		packetSize: len(b),
+		rbuf:       b,
+		rpos:       0,
+		rsize:      len(b),
+	}
+	ti := readTypeInfo(r)
+	if ti.TypeId != typeVector || ti.Size != 16 {
+		t.Fatalf("invalid type info %+v", ti)
+	}
+	if n, ok := makeGoLangTypeLength(ti); n != 2 || !ok {
+		t.Errorf("ColumnTypeLength = %d, %v", n, ok)
+	}
+	if makeGoLangScanType(ti) != reflect.TypeOf(Vector{}) {
+		t.Error("invalid scan type")
+	}
+	val := ti.Reader(&ti, r)
+	if !reflect.DeepEqual(val, NewVector([]float32{1, 2})) {
+		t.Errorf("read %v", val)
+	}
+	if val := ti.Reader(&ti, r); val != nil {
+		t.Errorf("expected NULL, got %v", val)
+	}
+
+	var w bytes.Buffer
+	if err := writeTypeInfo(&w, &ti); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes(), b[:4]) {
+		t.Errorf("writeTypeInfo() = %x, want %x", w.Bytes(), b[:4])
+	}
+}
+
+func TestVectorTVPColumnTypes(t *testing.T) {
+	type embedding struct {
+		ID  int
+		Vec Vector
+	}
+	tvp := TVP{TypeName: "embeddings", Value: []embedding{{1, NewVector([]float32{1, 2})}, {2, Vector{}}}}
+	columns, _, err := tvp.columnTypes(msdsn.TimeParameterDateTimeOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// TVP columns are sent as text and converted by the server
+	if columns[1].ti.TypeId != typeNVarChar {
+		t.Errorf("invalid TVP column type %#x", columns[1].ti.TypeId)
+	}
+	if _, err := tvp.encode("", "embeddings", columns, []int{0, 1}, msdsn.TimeParameterDateTimeOffset); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVectorBulkMakeParam(t *testing.T) {
+	b := &Bulk{}
+	col := columnStruct{ti: typeInfo{TypeId: typeVector, Size: 16}}
+	for _, val := range []DataValue{NewVector([]float32{1, 2}), []float32{1, 2}, "[1,2]"} {
+		res, err := b.makeParam(val, col)
+		if err != nil {
+			t.Errorf("makeParam(%v) failed: %v", val, err)
+			continue
+		}
+		if res.ti.Size != 16 || len(res.buffer) != 16 {
+			t.Errorf("makeParam(%v) produced %d bytes", val, len(res.buffer))
+		}
+	}
+	res, err := b.makeParam(Vector{}, col)
+	if err != nil || res.buffer != nil {
+		t.Errorf("NULL vector should produce nil buffer, got %x, %v", res.buffer, err)
+	}
+	if _, err := b.makeParam([]float32{1, 2, 3}, col); err == nil {
+		t.Error("makeParam should fail on dimension mismatch")
+	}
+
+	col = columnStruct{ti: typeInfo{TypeId: typeNVarChar, Size: 0xffff}}
+	res, err = b.makeParam(NewVector([]float32{1, 2}), col)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := ucs22str(res.buffer); s != "[1,2]" {
+		t.Errorf("nvarchar column value = %s", s)
+	}
+}
+
+func TestVectorQuery(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	var v Vector
+	err := conn.QueryRowContext(context.Background(), "select cast(@p1 as vector(3))", NewVector([]float32{1, 2, 3})).Scan(&v)
+	if err != nil {
+		if strings.Contains(err.Error(), "vector") {
+			t.Skip("server does not support vector type:", err)
+		}
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v.Values, []float32{1, 2, 3}) {
+		t.Errorf("unexpected vector %v", v)
+	}
+}